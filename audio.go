@@ -0,0 +1,585 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/hajimehoshi/go-mp3"
+	"github.com/mewkiz/flac"
+)
+
+// ErrUnsupportedAudio is returned for audio that can't be analysed, like MP3s that aren't Layer III or compressed WAVs.
+var ErrUnsupportedAudio = errors.New("unsupported audio")
+
+// silentLoudness is the loudness given to tracks too quiet to measure, the absolute gate of BS.1770.
+const silentLoudness = -70.0
+
+// AudioInfo is what analysing an entry's audio found. Entries that weren't analysed have no duration.
+type AudioInfo struct {
+	Container string `json:"container"`
+	Codec     string `json:"codec"`
+	// Duration is in milliseconds.
+	Duration   int `json:"duration"`
+	SampleRate int `json:"sample_rate"`
+	Channels   int `json:"channels"`
+	// Bitrate is the average in kbps, including any padding.
+	Bitrate int `json:"bitrate"`
+	// Loudness is the integrated loudness in LUFS, measured as ITU-R BS.1770 describes.
+	Loudness float64 `json:"loudness"`
+	// Summary describes the rest for the battle page. It isn't stored.
+	Summary string `json:"summary"`
+}
+
+// Analysed reports whether the audio was analysed.
+func (info AudioInfo) Analysed() bool {
+	return info.Duration > 0
+}
+
+// Describe sums the audio up, like "2:31 · MP3 320kbps · 44.1kHz stereo · -9.2 LUFS".
+func (info AudioInfo) Describe() string {
+	if !info.Analysed() {
+		return ""
+	}
+
+	channels := strconv.Itoa(info.Channels) + "ch"
+	switch info.Channels {
+	case 1:
+		channels = "mono"
+	case 2:
+		channels = "stereo"
+	}
+	sampleRate := strconv.FormatFloat(float64(info.SampleRate)/1000, 'f', -1, 64) + "kHz"
+
+	loudness := strconv.FormatFloat(info.Loudness, 'f', 1, 64) + " LUFS"
+	if info.Loudness <= silentLoudness {
+		loudness = "silent"
+	}
+
+	return strings.Join([]string{
+		TrackLength((info.Duration + 500) / 1000).String(),
+		info.Container + " " + strconv.Itoa(info.Bitrate) + "kbps",
+		sampleRate + " " + channels,
+		loudness,
+	}, " · ")
+}
+
+// AnalyseAudio works out an MP3, WAV or FLAC file's format, length and loudness, decoding all of it.
+func AnalyseAudio(r io.ReadSeeker) (AudioInfo, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	head := make([]byte, 12)
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return AudioInfo{}, err
+	}
+	n, _ := io.ReadFull(r, head)
+	format, ok := SniffAudio(head[:n])
+	if !ok {
+		return AudioInfo{}, ErrUnsupportedAudio
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return AudioInfo{}, err
+	}
+
+	var info AudioInfo
+	var audioBytes int64
+	switch format.Ext {
+	case "mp3":
+		info, audioBytes, err = analyseMP3(r, size)
+	case "wav":
+		info, audioBytes, err = analyseWAV(r)
+	case "flac":
+		info, audioBytes, err = analyseFLAC(r, size)
+	}
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	if info.Duration == 0 {
+		return AudioInfo{}, fmt.Errorf("%s has no audio", info.Container)
+	}
+
+	info.Bitrate = int(audioBytes * 8 / int64(info.Duration))
+	return info, nil
+}
+
+/*-------
+MP3
+-------*/
+
+// mpegVersions are the MPEG versions an audio frame header's version bits stand for.
+var mpegVersions = [4]string{"MPEG-2.5", "", "MPEG-2", "MPEG-1"}
+
+// analyseMP3 reads the first frame header for the codec and channels, then decodes the whole file.
+// The decoder always gives 16-bit stereo, so mono files only have their left channel measured.
+func analyseMP3(r io.ReadSeeker, size int64) (AudioInfo, int64, error) {
+	audioStart, err := id3v2Size(r)
+	if err != nil {
+		return AudioInfo{}, 0, err
+	}
+	audioBytes := size - audioStart
+	if size >= 128 {
+		tail := make([]byte, 3)
+		if _, err = r.Seek(size-128, io.SeekStart); err == nil {
+			if _, err = io.ReadFull(r, tail); err == nil && string(tail) == "TAG" {
+				audioBytes -= 128
+			}
+		}
+	}
+
+	// Encoders can leave junk before the first frame, so its sync is looked for in the first few kilobytes.
+	if _, err = r.Seek(audioStart, io.SeekStart); err != nil {
+		return AudioInfo{}, 0, err
+	}
+	head := make([]byte, 8<<10)
+	n, _ := io.ReadFull(r, head)
+	head = head[:n]
+	frame := -1
+	for i := 0; i+4 <= len(head); i++ {
+		if mpegFrameHeader(head[i:]) {
+			frame = i
+			break
+		}
+	}
+	if frame < 0 {
+		return AudioInfo{}, 0, ErrUnsupportedAudio
+	}
+
+	info := AudioInfo{
+		Container: "MP3",
+		Codec:     mpegVersions[head[frame+1]>>3&0x03] + " Layer III",
+		Channels:  2,
+	}
+	if head[frame+3]>>6 == 0x03 {
+		info.Channels = 1
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return AudioInfo{}, 0, err
+	}
+	decoder, err := mp3.NewDecoder(r)
+	if err != nil {
+		return AudioInfo{}, 0, err
+	}
+	info.SampleRate = decoder.SampleRate()
+
+	meter := newLoudnessMeter(info.SampleRate, info.Channels)
+	frames := int64(0)
+	pcm := make([]byte, 64<<10)
+	samples := make([]float64, 0, len(pcm)/2)
+	for {
+		n, err := io.ReadFull(decoder, pcm)
+		n -= n % 4
+		samples = samples[:0]
+		for i := 0; i < n; i += 4 {
+			samples = append(samples, float64(int16(binary.LittleEndian.Uint16(pcm[i:])))/32768)
+			if info.Channels == 2 {
+				samples = append(samples, float64(int16(binary.LittleEndian.Uint16(pcm[i+2:])))/32768)
+			}
+		}
+		meter.add(samples)
+		frames += int64(n / 4)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return AudioInfo{}, 0, err
+		}
+	}
+
+	info.Duration = int(frames * 1000 / int64(info.SampleRate))
+	info.Loudness = meter.integrated()
+	return info, audioBytes, nil
+}
+
+// mpegFrameHeader reports whether b starts with a valid MPEG Layer III frame header.
+func mpegFrameHeader(b []byte) bool {
+	return b[0] == 0xFF && b[1]&0xE0 == 0xE0 &&
+		b[1]&0x18 != 0x08 && // version isn't reserved
+		b[1]&0x06 == 0x02 && // layer III
+		b[2]&0xF0 != 0xF0 && // bitrate isn't invalid
+		b[2]&0x0C != 0x0C // sample rate isn't reserved
+}
+
+// id3v2Size is how many bytes an ID3v2 tag at the start of a file takes up, 0 if there isn't one.
+func id3v2Size(r io.ReadSeeker) (int64, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	header := make([]byte, 10)
+	if _, err := io.ReadFull(r, header); err != nil || string(header[:3]) != "ID3" {
+		return 0, nil
+	}
+
+	// The size is syncsafe, 7 bits a byte, and leaves out the header and any footer.
+	size := int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9])
+	size += 10
+	if header[5]&0x10 != 0 {
+		size += 10
+	}
+	return size, nil
+}
+
+/*-------
+WAV
+-------*/
+
+// WAV format tags the analysis can decode.
+const (
+	wavPCM        = 0x0001
+	wavFloat      = 0x0003
+	wavExtensible = 0xFFFE
+)
+
+// analyseWAV reads a RIFF WAVE file's chunks, decoding the PCM or float samples in its data chunk.
+func analyseWAV(r io.ReadSeeker) (AudioInfo, int64, error) {
+	if _, err := r.Seek(12, io.SeekStart); err != nil {
+		return AudioInfo{}, 0, err
+	}
+
+	info := AudioInfo{Container: "WAV"}
+	formatTag, bits, blockAlign := 0, 0, 0
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, chunk); err != nil {
+			return AudioInfo{}, 0, fmt.Errorf("wav has no data chunk: %w", err)
+		}
+		id, size := string(chunk[:4]), int64(binary.LittleEndian.Uint32(chunk[4:]))
+
+		if id == "fmt " {
+			if size < 16 || size > 1024 {
+				return AudioInfo{}, 0, errors.New("wav fmt chunk is the wrong size")
+			}
+			body := make([]byte, size)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return AudioInfo{}, 0, err
+			}
+			formatTag = int(binary.LittleEndian.Uint16(body[0:]))
+			info.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+			info.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			blockAlign = int(binary.LittleEndian.Uint16(body[12:]))
+			bits = int(binary.LittleEndian.Uint16(body[14:]))
+			// Extensible formats keep the real tag at the start of their sub-format GUID.
+			if formatTag == wavExtensible && size >= 26 {
+				formatTag = int(binary.LittleEndian.Uint16(body[24:]))
+			}
+			if size%2 == 1 {
+				r.Seek(1, io.SeekCurrent)
+			}
+			continue
+		}
+
+		if id != "data" {
+			// Chunks are padded to an even size.
+			if _, err := r.Seek(size+size%2, io.SeekCurrent); err != nil {
+				return AudioInfo{}, 0, err
+			}
+			continue
+		}
+
+		if info.Channels == 0 || info.Channels > 8 || info.SampleRate == 0 {
+			return AudioInfo{}, 0, errors.New("wav data comes before its format, or the format is invalid")
+		}
+		bytesPerSample := blockAlign / info.Channels
+		switch {
+		case formatTag == wavPCM && bytesPerSample >= 1 && bytesPerSample <= 4:
+			info.Codec = "PCM " + strconv.Itoa(bits) + "-bit"
+		case formatTag == wavFloat && (bytesPerSample == 4 || bytesPerSample == 8):
+			info.Codec = "IEEE float " + strconv.Itoa(bits) + "-bit"
+		default:
+			return AudioInfo{}, 0, fmt.Errorf("%w: wav format 0x%04X, %d bits", ErrUnsupportedAudio, formatTag, bits)
+		}
+
+		// Streaming writers leave the size unset, so the data runs to the end of the file.
+		if size == 0 || size == 0xFFFFFFFF {
+			size = math.MaxInt64
+		}
+		frames, loudness, err := decodeWAV(io.LimitReader(r, size), formatTag, info.SampleRate, info.Channels, bytesPerSample)
+		if err != nil {
+			return AudioInfo{}, 0, err
+		}
+
+		info.Duration = int(frames * 1000 / int64(info.SampleRate))
+		info.Loudness = loudness
+		return info, frames * int64(blockAlign), nil
+	}
+}
+
+// decodeWAV measures the samples in a WAV data chunk, returning how many frames it had.
+func decodeWAV(r io.Reader, formatTag int, sampleRate int, channels int, bytesPerSample int) (int64, float64, error) {
+	meter := newLoudnessMeter(sampleRate, channels)
+	blockAlign := bytesPerSample * channels
+	frames := int64(0)
+
+	raw := make([]byte, (64<<10)/blockAlign*blockAlign)
+	samples := make([]float64, 0, len(raw)/bytesPerSample)
+	for {
+		n, err := io.ReadFull(r, raw)
+		n -= n % blockAlign
+		samples = samples[:0]
+		for i := 0; i < n; i += bytesPerSample {
+			samples = append(samples, wavSample(raw[i:i+bytesPerSample], formatTag))
+		}
+		meter.add(samples)
+		frames += int64(n / blockAlign)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return frames, meter.integrated(), nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+// wavSample scales one little-endian sample to between -1 and 1. 8-bit PCM is the only unsigned size.
+func wavSample(b []byte, formatTag int) float64 {
+	if formatTag == wavFloat {
+		if len(b) == 8 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+	}
+
+	switch len(b) {
+	case 1:
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		return float64(int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24)>>8) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
+
+/*-------
+FLAC
+-------*/
+
+// analyseFLAC decodes every frame of a FLAC file. Its metadata, like cover art, doesn't count towards the bitrate.
+func analyseFLAC(r io.ReadSeeker, size int64) (AudioInfo, int64, error) {
+	metadata, err := flacMetadataSize(r)
+	if err != nil {
+		return AudioInfo{}, 0, err
+	}
+
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return AudioInfo{}, 0, err
+	}
+	stream, err := flac.New(r)
+	if err != nil {
+		return AudioInfo{}, 0, err
+	}
+
+	info := AudioInfo{
+		Container:  "FLAC",
+		Codec:      "FLAC " + strconv.Itoa(int(stream.Info.BitsPerSample)) + "-bit",
+		SampleRate: int(stream.Info.SampleRate),
+		Channels:   int(stream.Info.NChannels),
+	}
+	if info.SampleRate == 0 || info.Channels == 0 {
+		return AudioInfo{}, 0, errors.New("flac has no sample rate or channels")
+	}
+
+	meter := newLoudnessMeter(info.SampleRate, info.Channels)
+	frames := int64(0)
+	samples := []float64{}
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return AudioInfo{}, 0, err
+		}
+
+		scale := float64(int64(1) << (frame.BitsPerSample - 1))
+		block := len(frame.Subframes[0].Samples)
+		samples = samples[:0]
+		for i := 0; i < block; i++ {
+			for _, subframe := range frame.Subframes {
+				samples = append(samples, float64(subframe.Samples[i])/scale)
+			}
+		}
+		meter.add(samples)
+		frames += int64(block)
+	}
+
+	info.Duration = int(frames * 1000 / int64(info.SampleRate))
+	info.Loudness = meter.integrated()
+	return info, size - metadata, nil
+}
+
+// flacMetadataSize is how many bytes a FLAC file's signature and metadata blocks take up.
+func flacMetadataSize(r io.ReadSeeker) (int64, error) {
+	offset := int64(4)
+	header := make([]byte, 4)
+	for {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return 0, err
+		}
+		if _, err := io.ReadFull(r, header); err != nil {
+			return 0, err
+		}
+		offset += 4 + (int64(header[1])<<16 | int64(header[2])<<8 | int64(header[3]))
+		if header[0]&0x80 != 0 {
+			return offset, nil
+		}
+	}
+}
+
+/*-------
+Loudness
+-------*/
+
+// biquad is a second order filter, run in transposed direct form II.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	z1, z2             float64
+}
+
+func (f *biquad) filter(x float64) float64 {
+	y := f.b0*x + f.z1
+	f.z1 = f.b1*x - f.a1*y + f.z2
+	f.z2 = f.b2*x - f.a2*y
+	return y
+}
+
+// kWeighting returns BS.1770's K-weighting filters, a high shelf then a high pass, for a sample rate.
+// They're worked out from the filters' analog prototypes so every rate matches the standard's 48kHz coefficients.
+func kWeighting(sampleRate int) [2]biquad {
+	rate := float64(sampleRate)
+
+	// Stage 1 models the acoustic effect of the head, boosting highs by about 4dB.
+	k := math.Tan(math.Pi * 1681.974450955533 / rate)
+	q := 0.7071752369554196
+	vh := math.Pow(10, 3.999843853973347/20)
+	vb := math.Pow(vh, 0.4996667741545416)
+	a0 := 1 + k/q + k*k
+	shelf := biquad{
+		b0: (vh + vb*k/q + k*k) / a0,
+		b1: 2 * (k*k - vh) / a0,
+		b2: (vh - vb*k/q + k*k) / a0,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	// Stage 2 is the revised low-frequency B-curve, a high pass around 38Hz.
+	k = math.Tan(math.Pi * 38.13547087602444 / rate)
+	q = 0.5003270373238773
+	a0 = 1 + k/q + k*k
+	highPass := biquad{
+		b0: 1,
+		b1: -2,
+		b2: 1,
+		a1: 2 * (k*k - 1) / a0,
+		a2: (1 - k/q + k*k) / a0,
+	}
+
+	return [2]biquad{shelf, highPass}
+}
+
+// loudnessMeter measures integrated loudness. It keeps the K-weighted energy of every 100ms,
+// which the 400ms gating blocks are built from once all the audio is in.
+type loudnessMeter struct {
+	channels int
+	filters  [][2]biquad
+	stepSize int
+	stepFill int
+	energy   float64
+	steps    []float64
+}
+
+func newLoudnessMeter(sampleRate int, channels int) *loudnessMeter {
+	m := &loudnessMeter{
+		channels: channels,
+		filters:  make([][2]biquad, channels),
+		stepSize: sampleRate / 10,
+	}
+	for i := range m.filters {
+		m.filters[i] = kWeighting(sampleRate)
+	}
+	if m.stepSize == 0 {
+		m.stepSize = 1
+	}
+	return m
+}
+
+// add measures interleaved samples between -1 and 1. Every channel is weighted the same, as they are for stereo.
+func (m *loudnessMeter) add(samples []float64) {
+	for i := 0; i+m.channels <= len(samples); i += m.channels {
+		for ch := 0; ch < m.channels; ch++ {
+			filters := &m.filters[ch]
+			y := filters[1].filter(filters[0].filter(samples[i+ch]))
+			m.energy += y * y
+		}
+
+		m.stepFill++
+		if m.stepFill == m.stepSize {
+			m.steps = append(m.steps, m.energy)
+			m.energy, m.stepFill = 0, 0
+		}
+	}
+}
+
+// integrated gates the 400ms blocks, which overlap by 75%, first at -70 LUFS and then at 10 LU below the loudness
+// of what's left, and returns the loudness of the blocks that pass. Audio shorter than a block is one block.
+func (m *loudnessMeter) integrated() float64 {
+	blocks := []float64{}
+	for i := 0; i+4 <= len(m.steps); i++ {
+		blocks = append(blocks, (m.steps[i]+m.steps[i+1]+m.steps[i+2]+m.steps[i+3])/float64(4*m.stepSize))
+	}
+	if len(blocks) == 0 {
+		total, samples := m.energy, m.stepFill
+		for _, step := range m.steps {
+			total += step
+			samples += m.stepSize
+		}
+		if samples == 0 {
+			return silentLoudness
+		}
+		blocks = append(blocks, total/float64(samples))
+	}
+
+	gated := gateBlocks(blocks, silentLoudness)
+	if len(gated) == 0 {
+		return silentLoudness
+	}
+	gated = gateBlocks(gated, blockLoudness(meanEnergy(gated))-10)
+	if len(gated) == 0 {
+		return silentLoudness
+	}
+
+	return math.Max(blockLoudness(meanEnergy(gated)), silentLoudness)
+}
+
+// blockLoudness turns a block's mean square energy, summed over its channels, into LUFS.
+func blockLoudness(energy float64) float64 {
+	return -0.691 + 10*math.Log10(energy)
+}
+
+// gateBlocks returns the blocks louder than threshold.
+func gateBlocks(blocks []float64, threshold float64) []float64 {
+	gated := []float64{}
+	for _, energy := range blocks {
+		if energy > 0 && blockLoudness(energy) > threshold {
+			gated = append(gated, energy)
+		}
+	}
+	return gated
+}
+
+func meanEnergy(blocks []float64) float64 {
+	total := 0.0
+	for _, energy := range blocks {
+		total += energy
+	}
+	return total / float64(len(blocks))
+}
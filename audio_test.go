@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestAnalyseAudio analyses a second of a 1kHz tone at -20dBFS as WAV and FLAC, and silent MP3 frames wrapped in ID3 tags.
+func TestAnalyseAudio(t *testing.T) {
+	tests := []struct {
+		file string
+		want AudioInfo
+	}{
+		{"tone.wav", AudioInfo{Container: "WAV", Codec: "PCM 16-bit", Duration: 1000, SampleRate: 8000, Channels: 2, Bitrate: 256, Loudness: -20}},
+		{"tone.flac", AudioInfo{Container: "FLAC", Codec: "FLAC 16-bit", Duration: 1000, SampleRate: 8000, Channels: 1, Bitrate: 128, Loudness: -23}},
+		// The tags don't count towards the bitrate.
+		{"silence.mp3", AudioInfo{Container: "MP3", Codec: "MPEG-1 Layer III", Duration: 1200, SampleRate: 48000, Channels: 1, Bitrate: 32, Loudness: silentLoudness}},
+	}
+	for _, test := range tests {
+		file, err := os.Open(filepath.Join("testdata", "audio", test.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := AnalyseAudio(file)
+		file.Close()
+		if err != nil {
+			t.Errorf("%s: %v", test.file, err)
+			continue
+		}
+
+		if math.Abs(info.Loudness-test.want.Loudness) > 0.1 {
+			t.Errorf("%s: loudness = %.2f LUFS, want %.2f", test.file, info.Loudness, test.want.Loudness)
+		}
+		info.Loudness = test.want.Loudness
+		if info != test.want {
+			t.Errorf("%s: AnalyseAudio = %+v, want %+v", test.file, info, test.want)
+		}
+	}
+}
+
+func TestAnalyseUnsupportedAudio(t *testing.T) {
+	wav, err := os.ReadFile(filepath.Join("testdata", "audio", "tone.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Format tag 2 is Microsoft ADPCM.
+	adpcm := append([]byte{}, wav...)
+	adpcm[20] = 2
+
+	tests := []struct {
+		name  string
+		audio []byte
+	}{
+		{"not audio", []byte("<html>not audio at all</html>")},
+		{"empty", []byte{}},
+		{"compressed wav", adpcm},
+		// MP3s start with a frame sync, which Layer II frames have too.
+		{"mp2", append([]byte{0xFF, 0xFD, 0x14, 0xC0}, make([]byte, 92)...)},
+	}
+	for _, test := range tests {
+		_, err := AnalyseAudio(bytes.NewReader(test.audio))
+		if !errors.Is(err, ErrUnsupportedAudio) {
+			t.Errorf("%s: err = %v, want ErrUnsupportedAudio", test.name, err)
+		}
+	}
+}
+
+// tone is a 997Hz sine, the frequency BS.1770 is calibrated with, on every channel.
+func tone(sampleRate int, channels int, seconds float64, amplitude float64) []float64 {
+	samples := []float64{}
+	for i := 0; i < int(seconds*float64(sampleRate)); i++ {
+		sample := amplitude * math.Sin(2*math.Pi*997*float64(i)/float64(sampleRate))
+		for ch := 0; ch < channels; ch++ {
+			samples = append(samples, sample)
+		}
+	}
+	return samples
+}
+
+// TestLoudnessMeter measures tones with known loudness. A full scale sine on one channel is -3.01 LUFS.
+func TestLoudnessMeter(t *testing.T) {
+	tests := []struct {
+		name       string
+		sampleRate int
+		channels   int
+		samples    []float64
+		want       float64
+	}{
+		{"full scale", 48000, 1, tone(48000, 1, 3, 1), -3.01},
+		{"-20dBFS", 48000, 1, tone(48000, 1, 3, 0.1), -23.01},
+		{"-20dBFS stereo", 48000, 2, tone(48000, 2, 3, 0.1), -20},
+		{"44.1kHz", 44100, 2, tone(44100, 2, 3, 0.1), -20},
+		{"shorter than a block", 48000, 1, tone(48000, 1, 0.2, 0.1), -23.01},
+		// Silence is gated out rather than pulling the loudness down. Only the few blocks where the tone starts are partly quiet.
+		{"after silence", 48000, 1, append(make([]float64, 48000*10), tone(48000, 1, 30, 0.1)...), -23.01},
+		{"silence", 48000, 2, make([]float64, 48000*2*3), silentLoudness},
+		{"nothing", 48000, 2, []float64{}, silentLoudness},
+	}
+	for _, test := range tests {
+		meter := newLoudnessMeter(test.sampleRate, test.channels)
+		meter.add(test.samples)
+		if got := meter.integrated(); math.Abs(got-test.want) > 0.05 {
+			t.Errorf("%s: loudness = %.2f LUFS, want %.2f", test.name, got, test.want)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html"
@@ -9,6 +8,7 @@ import (
 	"log"
 	"math/rand"
 	"net/http"
+	"net/url"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,16 +29,34 @@ type Battle struct {
 	Deadline       time.Time      `gorm:"column:deadline" json:"deadline" validate:"required"`
 	VotingDeadline time.Time      `gorm:"column:voting_deadline" json:"voting_deadline" validate:"required"`
 	Attachment     string         `gorm:"column:attachment" json:"attachment"`
-	Status         string         `gorm:"column:status" json:"status"`
+	Status         BattleStatus   `gorm:"column:status" json:"status"`
 	ParsedDeadline string         `json:"parsed_deadline"`
 	Password       string         `gorm:"column:password" json:"password"`
 	Host           User           `json:"host"`
 	Entries        int            `json:"entries"`
 	MaxVotes       int            `gorm:"column:maxvotes" json:"maxvotes" validate:"required"`
+	VotingMode     VotingMode     `gorm:"column:voting_mode" json:"voting_mode"`
+	TrimScores     bool           `gorm:"column:trim_scores" json:"trim_scores"`
+	JudgeWeight    int            `gorm:"column:judge_weight" json:"judge_weight"`
 	Type           string         `gorm:"column:type" json:"type"`
 	Tags           []string       `json:"tags"`
-	Results        int            `json:"results"`
 	Settings       BattleSettings `json:"settings"`
+
+	// Qualification is what entrants have to do during voting for their entry to place.
+	Qualification QualificationRules `json:"qualification"`
+	// TieBreakers decide between entries that tie, in order. Entries still tied share a placement.
+	TieBreakers []TieBreaker `json:"tie_breakers"`
+	// Teams lets entrants credit other users on their entry. Invited users join the entry once they accept.
+	Teams bool `gorm:"column:teams" json:"teams"`
+	// TrackHosts narrow the sites entries can be linked from, e.g. to SoundCloud only, and turn off uploads.
+	// Empty allows every site the type does.
+	TrackHosts []string `json:"track_hosts"`
+	// Length limits how long entries can be. Entries whose length can't be worked out aren't allowed when it's set.
+	Length LengthLimits `json:"length"`
+	// WinnerID is the artist placed 1st once results are in. Co-winners are in the championship records.
+	WinnerID int `gorm:"column:winner_id" json:"winner_id"`
+	// SeasonID is the series season the battle counts towards, 0 for a standalone battle.
+	SeasonID int `gorm:"column:season_id" json:"season_id"`
 }
 
 type BattleSettings struct {
@@ -54,252 +72,223 @@ type BattleSettings struct {
 	Field3      string `gorm:"column:field_3" json:"field_3"`
 }
 
-// ParseDeadline returns a human readable deadline & updates the battle status in the database.
-func ParseDeadline(deadline time.Time, votingDeadline time.Time, battleID int, shortForm bool, homePage bool) string {
-	var status string = "entry"
-	var results int
-
-	err := dbRead.QueryRow("SELECT results FROM battles WHERE id = ?", battleID).Scan(&results)
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-
-	if results == -1 {
-		status = "draft"
-		return status
-	}
-
-	// If deadline has passed and status matches parameter
-	// Adjust status in DB.
-	if time.Until(deadline) < 0 {
-		status = "voting"
-
-		if time.Until(votingDeadline) < 0 {
-			status = "complete"
-			if results != 1 {
-				err = BattleResults(battleID)
-				if err != nil {
-					log.Println(err)
-				}
-
-				updateResults, err := dbWrite.Prepare("UPDATE battles SET results = '1' WHERE id = ?")
-				if err != nil {
-					log.Println(err)
-					return ""
-				}
-				defer updateResults.Close()
-				updateResults.Exec(battleID)
-			}
-		}
-	}
-	return status
-}
-
 // ViewBattles - Retrieves all battles and displays to user. Homepage.
-func ViewBattles(c echo.Context) error {
+func (app *App) ViewBattles(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 
 	// Default to index
 	tpl := "Index"
 	title := "Who's The Best Producer?"
-	status := "open"
-	URL := c.Request().URL.String()
-	if strings.Contains(URL, "past") {
+	list := "open"
+	query := OpenBattles()
+	// Match the route rather than the URL now that the query string can hold search terms.
+	if c.Path() == "/past" {
 		tpl = "Past"
 		title = "Past Battles"
-		status = "complete"
+		list = "past"
+		query = PastBattles()
 	}
 
 	// Get battle & user data
-	battles := GetBattles("status:" + status)
-	battlesJSON, _ := json.Marshal(battles)
-	me := GetUser(c, false)
+	battles := app.GetBattlePage(ParseBattleQuery(c, query))
+	me := app.GetUser(c, false)
 
 	m := map[string]interface{}{
 		"Meta": map[string]interface{}{
 			"Title":     "Beat Battle - " + title,
 			"Analytics": analyticsKey,
 		},
-		"Battles": string(battlesJSON),
-		"Me":      me,
-		"Toast":   toast,
-		"Ads":     ads,
+		"Battles":    battles,
+		"BattlesURL": battlesURL(c, url.Values{"list": {list}}),
+		"Me":         me,
+		"Toast":      toast,
+		"Ads":        ads,
 	}
 
 	return c.Render(http.StatusOK, tpl, m)
 }
 
 // ViewTaggedBattles - Retrieves all tagged battles and displays to user.
-func ViewTaggedBattles(c echo.Context) error {
+func (app *App) ViewTaggedBattles(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 
-	// Do GetBattles("tag:value")
-	title := "Battles Tagged With " + policy.Sanitize(c.Param("tag"))
-	battles := GetBattles("tag:" + policy.Sanitize(c.Param("tag")))
-	activeTag := policy.Sanitize(c.Param("tag"))
-	battlesJSON, _ := json.Marshal(battles)
+	activeTag := NormalizeTag(policy.Sanitize(c.Param("tag")))
+	title := "Battles Tagged With " + activeTag
+	query := ParseBattleQuery(c, TaggedBattles(activeTag))
+	query.Tag = activeTag
+	battles := app.GetBattlePage(query)
 
 	m := map[string]interface{}{
 		"Meta": map[string]interface{}{
 			"Title":     "Beatbattle.app - " + title,
 			"Analytics": analyticsKey,
 		},
-		"Battles": string(battlesJSON),
-		"Me":      me,
-		"Toast":   toast,
-		"Tag":     activeTag,
-		"Ads":     ads,
+		"Battles":    battles,
+		"BattlesURL": battlesURL(c, url.Values{"list": {"tag"}, "tag": {activeTag}}),
+		"Me":         me,
+		"Toast":      toast,
+		"Tag":        activeTag,
+		"Ads":        ads,
 	}
 
 	return c.Render(http.StatusOK, "ViewBattles", m)
 }
 
-// GetBattles retrieves battles from the database using a field and value.
-// TODO - This is really messy. Think about splitting up the parts into each part of the query and combining.
-func GetBattles(filter string) []Battle {
+// BattlePage is one page of a battle listing. Next is the cursor of the following page, empty on the last one.
+type BattlePage struct {
+	Battles []Battle `json:"battles"`
+	Next    string   `json:"next"`
+}
+
+// battlePageSize is the most battles a listing loads at once.
+const battlePageSize = 50
 
+// GetBattlePage retrieves a page of the battles matching a query from the store.
+func (app *App) GetBattlePage(query BattleQuery) BattlePage {
 	start := time.Now()
-	// FIELD & VALUE
-	// TODO - SET UP PROPER USER GETTING
-	query := `SELECT battles.id, battles.title, battles.deadline, battles.voting_deadline, 
-			battles.type, battles.results, battles.tags, COUNT(DISTINCT beats.id) as entry_count,
-			users.id, users.nickname, users.flair, IFNULL(battle_settings.private, 0)
-			FROM battles
-			LEFT JOIN users ON users.id = battles.user_ID
-			LEFT JOIN beats ON battles.id = beats.battle_id
-			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id`
-
-	where := ""
-	filterParams := strings.Split(filter, ":")
-	switch filterParams[0] {
-	case "status":
-		switch filterParams[1] {
-		case "complete":
-			where = "WHERE results = 1"
-		case "open":
-			where = "WHERE results = 0 AND IFNULL(battle_settings.private, 0) = 0"
-		}
-	case "user":
-		where = "WHERE battles.user_id = '" + policy.Sanitize(filterParams[1]) + "'"
-	case "tag":
-		// PERF: Like query is heavy.
-		where = "WHERE battles.tags LIKE '%" + policy.Sanitize(filterParams[1]) + "%' AND IFNULL(battle_settings.private, 0) = 0 "
-	}
-	log.Println(policy.Sanitize(filterParams[1]))
 
-	query += " " + where + " " + `GROUP BY battles.id
-								ORDER BY battles.deadline DESC`
+	if query.Limit <= 0 || query.Limit > battlePageSize {
+		query.Limit = battlePageSize
+	}
+	limit := query.Limit
 
-	rows, err := dbRead.Query(query)
+	// Fetch one extra battle to find out if there's another page.
+	query.Limit++
+	battles, err := app.Battles.List(query)
 	if err != nil {
 		log.Println(err)
-		return nil
+		return BattlePage{Battles: []Battle{}}
 	}
-	defer rows.Close()
 
-	tags := ""
+	page := BattlePage{Battles: battles}
+	if len(battles) > limit {
+		page.Battles = battles[:limit]
+		// The cursor has to use the stored title, so take it before unescaping.
+		page.Next = CursorAfter(query.Sort, page.Battles[limit-1]).String()
+	}
 
-	battle := Battle{}
-	battles := []Battle{}
-	for rows.Next() {
-		err = rows.Scan(&battle.ID, &battle.Title, &battle.Deadline, &battle.VotingDeadline,
-			&battle.Type, &battle.Results, &tags, &battle.Entries,
-			&battle.Host.ID, &battle.Host.Name, &battle.Host.Flair,
-			&battle.Settings.Private)
-		if err != nil {
-			log.Println(err)
-			return nil
-		}
+	for i := range page.Battles {
+		page.Battles[i].Title = html.UnescapeString(page.Battles[i].Title)
+		page.Battles[i].ParsedDeadline = DeadlineString(page.Battles[i])
+	}
 
-		battle.Title = html.UnescapeString(battle.Title)
-		battle.Status = ParseDeadline(battle.Deadline, battle.VotingDeadline, battle.ID, true, true)
-		battle.Tags = SetTags(tags)
-		deadlineString := ""
+	duration := time.Since(start)
+	fmt.Println("GetBattlePage time: " + duration.String())
 
-		if battle.Status == "entry" {
-			deadlineString += strconv.Itoa(int(battle.Deadline.UnixNano() / 1000000))
-		}
+	return page
+}
 
-		if battle.Status == "voting" {
-			deadlineString += strconv.Itoa(int(battle.VotingDeadline.UnixNano() / 1000000))
+// BattlesJSON - Returns a page of battles for the battle grids to load as they're paged through.
+func (app *App) BattlesJSON(c echo.Context) error {
+	query := OpenBattles()
+	switch c.QueryParam("list") {
+	case "past":
+		query = PastBattles()
+	case "tag":
+		tag := NormalizeTag(policy.Sanitize(c.QueryParam("tag")))
+		if tag == "" {
+			return c.JSON(http.StatusBadRequest, BattlePage{Battles: []Battle{}})
 		}
-
-		if battle.Status == "complete" {
-			layoutUS := "01/02/06"
-			deadlineString += battle.VotingDeadline.Format(layoutUS)
+		query = TaggedBattles(tag)
+	case "user":
+		hostID, _ := strconv.Atoi(c.QueryParam("user"))
+		if hostID <= 0 {
+			return c.JSON(http.StatusBadRequest, BattlePage{Battles: []Battle{}})
 		}
-
-		battle.ParsedDeadline = deadlineString
-		battles = append(battles, battle)
+		query = HostBattles(hostID, app.GetUser(c, false).ID)
 	}
 
-	// Err handle (see other examples, might not be necessary)
-	if err = rows.Err(); err != nil {
-		log.Println(err)
+	return c.JSON(http.StatusOK, app.GetBattlePage(ParseBattleQuery(c, query)))
+}
+
+// battlesURL is the endpoint a page's battle grid loads more battles from, keeping the page's filters.
+func battlesURL(c echo.Context, list url.Values) string {
+	params := url.Values{}
+	for key, values := range c.QueryParams() {
+		params[key] = values
 	}
-	if err = rows.Close(); err != nil {
-		log.Println(err)
+	params.Del("cursor")
+	params.Del("offset")
+	for key, values := range list {
+		params[key] = values
 	}
 
-	duration := time.Since(start)
-	fmt.Println("GetBattles time: " + duration.String())
+	return "/api/battles?" + params.Encode()
+}
 
-	return battles
+// DeadlineString is the deadline the frontend counts down to, or the date a complete battle ended.
+func DeadlineString(battle Battle) string {
+	switch battle.Status {
+	case StatusEntry:
+		return strconv.Itoa(int(battle.Deadline.UnixNano() / 1000000))
+	case StatusVoting:
+		return strconv.Itoa(int(battle.VotingDeadline.UnixNano() / 1000000))
+	default:
+		layoutUS := "01/02/06"
+		return battle.VotingDeadline.Format(layoutUS)
+	}
 }
 
-// BattleResults updates the voted and votes columns of a battle.
-func BattleResults(battleID int) error {
+// BattleResults updates the votes, voted and placement columns of a battle's entries
+// using the battle's voting mode. Entries whose artist didn't qualify are disqualified and get no placement.
+func (app *App) BattleResults(battleID int) error {
 	start := time.Now()
-	log.Println("test")
-	sql := `UPDATE beats
-			LEFT JOIN (SELECT beat_id, COUNT(beat_id) as beat_votes FROM votes WHERE battle_id = ? GROUP BY beat_id) beat_votes
-				ON beat_votes.beat_id = beats.id
-			LEFT JOIN (SELECT DISTINCT user_id, IF(user_id IS NOT NULL, true, false) as user_voted FROM votes WHERE battle_id = ? GROUP BY user_id) user_votes
-				ON user_votes.user_id = beats.user_id
-			SET
-				beats.votes = IFNULL(beat_votes, 0),
-				beats.voted = IFNULL(user_voted, FALSE)
-			WHERE beats.battle_id = ?`
-
-	upd, err := dbWrite.Prepare(sql)
+
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		return err
+	}
+
+	beats, err := app.Beats.ListByBattle(battleID)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := app.Qualifications(battle, beats)
 	if err != nil {
 		return err
 	}
-	defer upd.Close()
+	qualified := map[int]bool{}
+	for artistID, status := range statuses {
+		qualified[artistID] = status.Qualified
+	}
 
-	upd.Exec(battleID, battleID, battleID)
+	var results []BeatResult
+	switch battle.VotingMode {
+	case VotingRanked:
+		results, err = app.rankedResults(battle, beats, qualified)
+	case VotingScore:
+		results, err = app.scoreResults(battle, beats, qualified)
+	default:
+		results, err = app.approvalResults(battle, beats, qualified)
+	}
 	if err != nil {
 		return err
 	}
 
-	sql = `UPDATE beats target
-			JOIN
-			(
-				SELECT id, (@rownumber := @rownumber + 1) as rownum
-				FROM beats         
-				CROSS JOIN (SELECT @rownumber := 0) r
-					WHERE beats.battle_id = ? AND beats.voted = 1
-				ORDER BY votes DESC
-			) source ON target.id = source.id    
-			SET placement = rownum`
+	// Judged battles blend the judges' votes with the public's.
+	if battle.JudgeWeight > 0 {
+		results, err = app.judgedResults(battle, beats, results)
+		if err != nil {
+			return err
+		}
+	}
 
-	placement, err := dbWrite.Prepare(sql)
+	err = app.Beats.SaveResults(results)
 	if err != nil {
 		return err
 	}
-	defer upd.Close()
 
-	placement.Exec(battleID)
+	err = app.RecordChampionships(battle)
 	if err != nil {
 		return err
 	}
@@ -310,17 +299,37 @@ func BattleResults(battleID int) error {
 	return nil
 }
 
+// approvalResults places the qualified artists' entries by their number of votes.
+func (app *App) approvalResults(battle Battle, beats []Beat, qualified map[int]bool) ([]BeatResult, error) {
+	tally, err := app.Votes.Tally(battle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]BeatResult, len(beats))
+	scores := map[int]float64{}
+	for i, beat := range beats {
+		results[i] = BeatResult{
+			BeatID: beat.ID,
+			Votes:  tally.Votes[beat.ID],
+			Voted:  qualified[beat.Artist.ID],
+		}
+		scores[beat.ID] = float64(tally.Votes[beat.ID])
+	}
+
+	return app.placeResults(battle, beats, results, scores)
+}
+
 // BattleHTTP - Retrieves battle and displays to user.
-// TODO - fix feedback
 // TODO - slows down on the mainpage
-func BattleHTTP(c echo.Context) error {
+func (app *App) BattleHTTP(c echo.Context) error {
 	start := time.Now()
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 
 	// Validate that ID is an int.
 	battleID, err := strconv.Atoi(c.Param("id"))
@@ -331,121 +340,121 @@ func BattleHTTP(c echo.Context) error {
 	}
 
 	// Retrieve battle, return to front page if battle doesn't exist.
-	battle := GetBattle(battleID)
+	battle := app.GetBattle(battleID)
 	if battle.Title == "" {
 		SetToast(c, "404")
 		return c.Redirect(302, "/")
 	}
 
-	// Get user's liked beats.
+	// Get user's liked beats and the feedback they've left.
 	var lastVotes []int
 	var lastLikes []int
-	me := GetUser(c, false)
+	feedback := map[int]string{}
+	me := app.GetUser(c, false)
 	if me.Authenticated {
-		likes, err := dbRead.Query("SELECT beat_id FROM likes WHERE user_id = ? AND battle_id = ? ORDER BY beat_id", me.ID, battleID)
-		if err != nil && err != sql.ErrNoRows {
+		lastLikes, err = app.Votes.UserLikes(battleID, me.ID)
+		if err != nil {
+			log.Println(err)
 			SetToast(c, "502")
 			return c.Redirect(302, "/")
 		}
-		defer likes.Close()
 
-		for likes.Next() {
-			var curBeatID int
-			err = likes.Scan(&curBeatID)
-			if err != nil {
-				SetToast(c, "502")
-				return c.Redirect(302, "/")
-			}
-			lastLikes = append(lastLikes, curBeatID)
+		feedback, err = app.Feedback.Given(battleID, me.ID)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, "/")
 		}
 	}
 
-	// Get beats user has voted for if in voting stage.
-	if battle.Status == "voting" && me.Authenticated {
-		votes, err := dbRead.Query("SELECT beat_id FROM votes WHERE user_id = ? AND battle_id = ? ORDER BY beat_id", me.ID, battleID)
-		if err != nil && err != sql.ErrNoRows {
+	// Get beats user has voted for if in voting stage. A ranked ballot keeps its order.
+	userScores := map[int]map[int]int{}
+	if battle.Status == StatusVoting && me.Authenticated {
+		switch battle.VotingMode {
+		case VotingRanked:
+			lastVotes, err = app.Votes.Ballot(battleID, me.ID)
+		case VotingScore:
+			userScores, err = app.Votes.UserScores(battleID, me.ID)
+		default:
+			lastVotes, err = app.Votes.UserVotes(battleID, me.ID)
+		}
+		if err != nil {
+			log.Println(err)
 			SetToast(c, "502")
 			return c.Redirect(302, "/")
 		}
-		defer votes.Close()
+	}
 
-		for votes.Next() {
-			var curBeatID int
-			err = votes.Scan(&curBeatID)
-			if err != nil {
-				SetToast(c, "502")
-				return c.Redirect(302, "/")
-			}
-			lastVotes = append(lastVotes, curBeatID)
+	var criteria []Criterion
+	if battle.VotingMode == VotingScore {
+		criteria, err = app.Battles.Criteria(battleID)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, "/")
 		}
 	}
 
-	var count int
-	entries := []Beat{}
-	likes := []Beat{}
-	didntVote := []Beat{}
-	submission := Beat{}
-
-	query := `SELECT 
-			users.id, users.provider, users.provider_id, users.nickname, users.flair,
-			beats.id, beats.url, beats.votes, beats.voted, beats.placement, IFNULL(feedback.feedback, ''),
-			beats.field_1, beats.field_2, beats.field_3
-			FROM beats
-			LEFT JOIN users ON beats.user_id = users.id
-			LEFT JOIN feedback ON feedback.user_id=? AND feedback.beat_id=beats.id
-			WHERE beats.battle_id = ?
-			GROUP BY 1`
-	scanArgs := []interface{}{
-		// Artist
-		&submission.Artist.ID, &submission.Artist.Provider, &submission.Artist.ProviderID,
-		&submission.Artist.Name, &submission.Artist.Flair,
-		// Beat
-		&submission.ID, &submission.URL, &submission.Votes,
-		&submission.Voted, &submission.Placement, &submission.Feedback,
-		&submission.Field1, &submission.Field2, &submission.Field3}
-
-	rows, err := dbRead.Query(query, me.ID, battleID)
+	beats, err := app.Beats.ListByBattle(battleID)
 	if err != nil {
 		log.Println(err)
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
 	}
-	defer rows.Close()
+
+	// Team members see the entry they're credited on as their own.
+	members, err := app.Beats.Members(battleID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, "/")
+	}
+	credits := Credits(members)
+
+	entries := []Beat{}
+	likes := []Beat{}
+	didntVote := []Beat{}
 
 	entryPosition := 0
+	entryVotes := 0
 	hasEntered := false
 	userVotes := 0
 
-	for rows.Next() {
-		err = rows.Scan(scanArgs...)
-		if err != nil {
-			log.Println(err)
-			SetToast(c, "502")
-			return c.Redirect(302, "/")
-		}
-		count++
-
+	for _, submission := range beats {
 		if submission.Placement == 0 {
 			submission.Placement = 999
 		}
-		submission.BattleID = battle.ID
+		submission.Feedback = feedback[submission.ID]
+		submission.Members = EntryCredits(submission, members)
+		submission.Embed = app.Tracks.Offline(submission)
+		submission.Audio.Summary = submission.Audio.Describe()
+		if battle.Length.Unverified(submission.Audio) {
+			submission.Audio.Summary = "Length Unverified"
+		}
+		mine := submission.Artist.ID == me.ID || credits[submission.ID][me.ID]
+		if mine {
+			entryVotes = submission.Votes
+		}
 
+		// UserVote is 1 for an approval vote, or the entry's position on a ranked ballot.
 		submission.UserVote = 0
-		if battle.Status == "voting" {
-			if ContainsInt(lastVotes, submission.ID) {
-				submission.UserVote = 1
-				if battle.Status == "complete" && submission.Artist.ID == me.ID {
-					userVotes++
+		if battle.Status == StatusVoting {
+			for i, beatID := range lastVotes {
+				if beatID != submission.ID {
+					continue
 				}
-				if battle.Status != "complete" {
-					userVotes++
+				submission.UserVote = 1
+				if battle.VotingMode == VotingRanked {
+					submission.UserVote = i + 1
 				}
+				userVotes++
 			}
+			submission.UserScores = userScores[submission.ID]
 		}
 
-		if battle.Status == "complete" && !submission.Voted {
+		if battle.Status == StatusComplete && !submission.Voted {
 			didntVote = append(didntVote, submission)
-			if submission.Artist.ID == me.ID {
+			if mine {
 				hasEntered = true
 				entryPosition = len(didntVote)
 			}
@@ -459,40 +468,34 @@ func BattleHTTP(c echo.Context) error {
 		}
 
 		entries = append(entries, submission)
-		if submission.Artist.ID == me.ID {
+		if mine {
 			hasEntered = true
 			entryPosition = len(entries)
 		}
 	}
 
-	// Handle if rows error exists, or if closing results in error.
-	if err = rows.Err(); err != nil {
-		log.Println(err)
-	}
-	if err = rows.Close(); err != nil {
-		log.Println(err)
-	}
-
 	isOwner := me.ID == battle.Host.ID
 
 	// Get user vote position.
 	// TODO - Make this a function that is called from the client.
-	if hasEntered && battle.Status == "voting" {
-		query := `SELECT count(*)+1
-					FROM beats
-					WHERE battle_id=? AND votes > (SELECT votes FROM beats WHERE user_id=? AND battle_id=?)`
-		dbRead.QueryRow(query, battleID, me.ID, battleID).Scan(&entryPosition)
+	if hasEntered && battle.Status == StatusVoting {
+		entryPosition = 1
+		for _, beat := range beats {
+			if beat.Votes > entryVotes {
+				entryPosition++
+			}
+		}
 	}
 
-	if hasEntered && battle.Status == "complete" && userVotes == 0 {
+	if hasEntered && battle.Status == StatusComplete && userVotes == 0 {
 		entryPosition += len(entries)
 	}
 
 	entries = append(entries, didntVote...)
-	battle.Entries = count
+	battle.Entries = len(beats)
 
 	// Shuffle entries per user.
-	if battle.Status != "complete" {
+	if battle.Status != StatusComplete {
 		rand.Seed(int64(me.ID * battle.ID))
 		rand.Shuffle(len(entries), func(i, j int) {
 			entries[i], entries[j] = entries[j], entries[i]
@@ -504,16 +507,60 @@ func BattleHTTP(c echo.Context) error {
 		entries = likes
 	}
 
-	if battle.Status == "complete" {
-		sort.Slice(entries, func(i, j int) bool {
+	if battle.Status == StatusComplete {
+		sort.SliceStable(entries, func(i, j int) bool {
 			return entries[i].Placement < entries[j].Placement
 		})
 	}
 
+	// Tied entries share a placement until the host sets them apart.
+	tied := false
+	placements := map[int]bool{}
+	for _, beat := range beats {
+		if battle.Status == StatusComplete && beat.Voted && beat.Placement > 0 {
+			tied = tied || placements[beat.Placement]
+			placements[beat.Placement] = true
+		}
+	}
+
+	// Entrants see whether they've qualified yet while voting is open.
+	qualification := QualificationStatus{}
+	if hasEntered && battle.Status == StatusVoting {
+		statuses, err := app.Qualifications(battle, beats)
+		if err != nil {
+			log.Println(err)
+		}
+		qualification = statuses[me.ID]
+	}
+
+	var rounds []RoundView
+	var breakdown []BreakdownRow
+	var tallies []TallyRow
+	if battle.Status == StatusComplete {
+		switch battle.VotingMode {
+		case VotingRanked:
+			rounds = app.BattleRounds(battleID, beats)
+		case VotingScore:
+			breakdown = app.BattleBreakdown(battleID, criteria, beats)
+		}
+		if battle.JudgeWeight > 0 {
+			tallies = app.BattleTallies(battleID, beats)
+		}
+	}
+
+	// Show the panel and let invited judges see their invitation.
+	judges := app.BattleJudges(battle, beats)
+	invitation := Judge{}
+	for _, judge := range judges {
+		if judge.User.ID == me.ID {
+			invitation = judge
+		}
+	}
+
 	// Convert the entries to JSON.
 	e, err := json.Marshal(entries)
 	if err != nil {
-		log.Fatal(err)
+		log.Println(err)
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
 	}
@@ -534,6 +581,20 @@ func BattleHTTP(c echo.Context) error {
 		"VotesRemaining": battle.MaxVotes - userVotes,
 		"Ads":            ads,
 		"Filter":         filter,
+		"Transitions":    app.GetBattleTransitions(battleID),
+		"Rounds":         rounds,
+		"Criteria":       criteria,
+		"Breakdown":      breakdown,
+		"Tallies":        tallies,
+		"Judges":         judges,
+		"Invitation":     invitation,
+		"Team":           BattleTeam(beats, members, me.ID),
+		"Qualification":  qualification,
+		"TieBreakers":    TieBreakersText(battle.TieBreakers),
+		"Tied":           tied,
+		"Season":         app.BattleSeason(battle.SeasonID),
+		"Tournament":     app.BattleTournament(battle.ID),
+		"IsAdmin":        IsAdmin(me),
 	}
 
 	duration := time.Since(start)
@@ -542,73 +603,35 @@ func BattleHTTP(c echo.Context) error {
 	return c.Render(http.StatusOK, "Battle", m)
 }
 
-// GetBattle retrieves a battle from the database using an ID.
-func GetBattle(battleID int) Battle {
+// GetBattle retrieves a battle from the store using an ID, ready for display.
+// A battle that doesn't exist is returned empty.
+func (app *App) GetBattle(battleID int) Battle {
 	start := time.Now()
-	battle := Battle{}
-	query := `
-			SELECT users.id, users.nickname, users.flair, 
-			battles.id, battles.title, battles.rules, battles.deadline, battles.voting_deadline, 
-			battles.attachment, battles.password, battles.maxvotes, battles.type, battles.tags,
-			battles.settings_id, IFNULL(battle_settings.logo, ''), IFNULL(battle_settings.background, ''),
-			IFNULL(battle_settings.show_users, 0), IFNULL(battle_settings.show_entries, 0), 
-			IFNULL(battle_settings.tracking_id, ""), IFNULL(battle_settings.private, 0), 
-			IFNULL(battle_settings.field_1, ''), IFNULL(battle_settings.field_2, ''),
-			IFNULL(battle_settings.field_3, '')
-			FROM battles
-			INNER JOIN users ON users.id = battles.user_id
-			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id
-			WHERE battles.id = ?`
-
-	tags := ""
-	err := dbRead.QueryRow(query, battleID).Scan(
-		// Battle Host
-		&battle.Host.ID, &battle.Host.Name, &battle.Host.Flair,
-		// Battle
-		&battle.ID, &battle.Title, &battle.Rules, &battle.Deadline, &battle.VotingDeadline,
-		&battle.Attachment, &battle.Password, &battle.MaxVotes, &battle.Type, &tags,
-		&battle.Settings.ID, &battle.Settings.Logo, &battle.Settings.Background,
-		&battle.Settings.ShowUsers, &battle.Settings.ShowEntries,
-		&battle.Settings.TrackingID, &battle.Settings.Private,
-		&battle.Settings.Field1, &battle.Settings.Field2,
-		&battle.Settings.Field3)
+
+	battle, err := app.Battles.Get(battleID)
 	if err != nil {
 		log.Println(err)
-		return battle
+		return Battle{}
 	}
 
 	battle.Title = html.UnescapeString(battle.Title)
 	md := []byte(html.UnescapeString(battle.Rules))
 	battle.Rules = html.UnescapeString(battle.Rules)
 	battle.RulesHTML = template.HTML(markdown.ToHTML(md, nil, nil))
-	battle.Status = ParseDeadline(battle.Deadline, battle.VotingDeadline, battle.ID, true, false)
-	battle.Tags = SetTags(tags)
 	battle.Type = strings.Title(battle.Type)
-
-	// Create parsed deadline.
-	deadlineString := ""
-	switch battle.Status {
-	case "entry":
-		deadlineString += strconv.Itoa(int(battle.Deadline.UnixNano() / 1000000))
-	case "voting":
-		deadlineString += strconv.Itoa(int(battle.VotingDeadline.UnixNano() / 1000000))
-	default:
-		layoutUS := "01/02/06"
-		deadlineString += battle.VotingDeadline.Format(layoutUS)
-	}
-	battle.ParsedDeadline = deadlineString
+	battle.ParsedDeadline = DeadlineString(battle)
 
 	duration := time.Since(start)
 	fmt.Println("GetBattle time: " + duration.String())
 	return battle
 }
 
-// SubmitBattle ...
-func SubmitBattle(c echo.Context) error {
+// SubmitBattle - Shows the form for a new battle, prefilled from a template or a battle to clone when asked.
+func (app *App) SubmitBattle(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 	fmt.Println(me)
 	if !me.Authenticated {
 		fmt.Println("Submit error")
@@ -617,35 +640,41 @@ func SubmitBattle(c echo.Context) error {
 	}
 
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
+	battle, criteria := app.prefillBattle(c, me)
 
 	m := map[string]interface{}{
 		"Meta": map[string]interface{}{
 			"Title":     "Submit Battle",
 			"Analytics": analyticsKey,
 		},
-		"Me":    me,
-		"Toast": toast,
-		"Ads":   ads,
+		"Battle":      battle,
+		"Criteria":    criteria,
+		"TieBreakers": TieBreakerSlots(battle.TieBreakers),
+		"Seasons":     app.HostSeasons(me.ID),
+		"TrackSites":  TypeURLPolicy(battle.Type).Tracks,
+		"Me":          me,
+		"Toast":       toast,
+		"Ads":         ads,
 	}
 
 	return c.Render(http.StatusOK, "SubmitBattle", m)
 }
 
 // UpdateBattle ...
-func UpdateBattle(c echo.Context) error {
+func (app *App) UpdateBattle(c echo.Context) error {
 	start := time.Now()
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
 	}
 
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 	toast := GetToast(c)
 	region := c.Param("region")
 	country := c.Param("country")
@@ -662,7 +691,7 @@ func UpdateBattle(c echo.Context) error {
 		loc, _ = time.LoadLocation("America/Toronto")
 	}
 
-	battle := GetBattle(battleID)
+	battle := app.GetBattle(battleID)
 	if battle.Title == "" {
 		SetToast(c, "404")
 		return c.Redirect(302, "/")
@@ -673,6 +702,11 @@ func UpdateBattle(c echo.Context) error {
 		return c.Redirect(302, "/")
 	}
 
+	criteria, err := app.Battles.Criteria(battleID)
+	if err != nil {
+		log.Println(err)
+	}
+
 	// For time.Parse
 	layout := "Jan 2, 2006-03:04 PM"
 	deadline := strings.Split(battle.Deadline.In(loc).Format(layout), "-")
@@ -690,6 +724,10 @@ func UpdateBattle(c echo.Context) error {
 		"DeadlineTime":       deadline[1],
 		"VotingDeadlineDate": votingDeadline[0],
 		"VotingDeadlineTime": votingDeadline[1],
+		"Criteria":           CriteriaString(criteria),
+		"TieBreakers":        TieBreakerSlots(battle.TieBreakers),
+		"Seasons":            app.HostSeasons(me.ID),
+		"TrackSites":         TypeURLPolicy(battle.Type).Tracks,
 		"Toast":              toast,
 		"Ads":                ads,
 	}
@@ -701,13 +739,13 @@ func UpdateBattle(c echo.Context) error {
 
 // UpdateBattleDB ...
 // TODO - Return to battle ID.
-func UpdateBattleDB(c echo.Context) error {
+func (app *App) UpdateBattleDB(c echo.Context) error {
 	start := time.Now()
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	// Check if user is authenticated, if not kick them out.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -725,15 +763,18 @@ func UpdateBattleDB(c echo.Context) error {
 	}
 
 	// Check if user owns battle
-	userID := -1
-	err = dbRead.QueryRow("SELECT user_id FROM battles WHERE id = ?", battleID).Scan(&userID)
+	current, err := app.Battles.Get(battleID)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "502")
 	}
-	if userID != me.ID {
+	if current.Host.ID != me.ID {
 		return AjaxResponse(c, true, "/", "403")
 	}
+	status := current.Status
+	if status == StatusComplete {
+		return AjaxResponse(c, true, "/battle/"+c.Param("id"), "notopen")
+	}
 
 	// Handle time localization and deadline parsing.
 	loc, err := time.LoadLocation(policy.Sanitize(c.FormValue("timezone")))
@@ -761,6 +802,20 @@ func UpdateBattleDB(c echo.Context) error {
 		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "voteb4")
 	}
 
+	// Work out which status the edit moves the battle to.
+	nextStatus := status
+	switch {
+	case c.FormValue("submit") == "DRAFT":
+		nextStatus = StatusDraft
+	case status == StatusDraft:
+		nextStatus = StatusEntry
+	case status == StatusVoting && deadline.After(time.Now()):
+		nextStatus = StatusEntry
+	}
+	if nextStatus != status && !status.CanTransition(nextStatus) {
+		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "invalidstatus")
+	}
+
 	attachment := policy.Sanitize(c.FormValue("attachment"))
 	maxVotes, err := strconv.Atoi(policy.Sanitize(c.FormValue("maxvotes")))
 	if err != nil {
@@ -769,7 +824,39 @@ func UpdateBattleDB(c echo.Context) error {
 		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "502")
 	}
 
+	// Attachments from before the URL policy are kept until they're changed.
+	urls := TypeURLPolicy(battleType)
+	if toast := urls.CheckAttachment(attachment); toast != "" && attachment != current.Attachment {
+		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", toast)
+	}
+	trackHosts := FormTrackHosts(c)
+	if len(NarrowHosts(trackHosts, urls.Tracks)) != len(trackHosts) {
+		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "tracksites")
+	}
+	length, toast := ParseLengthLimits(c)
+	if toast != "" {
+		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", toast)
+	}
+
+	// Ballots already cast can't be recounted another way, so the mode, criteria, score trimming,
+	// judge weight, qualification rules, tie-breakers and teams are fixed once voting opens.
+	votingMode := ParseVotingMode(c.FormValue("voting_mode"))
+	trimScores := c.FormValue("trim_scores") == "1"
+	judgeWeight := ParseJudgeWeight(c.FormValue("judge_weight"))
+	qualification := ParseQualificationRules(c)
+	tieBreakers := FormTieBreakers(c)
+	teams := c.FormValue("teams") == "1"
+	if status == StatusVoting {
+		votingMode = current.VotingMode
+		trimScores = current.TrimScores
+		judgeWeight = current.JudgeWeight
+		qualification = current.Qualification
+		tieBreakers = current.TieBreakers
+		teams = current.Teams
+	}
+
 	battle := &Battle{
+		ID:             battleID,
 		Title:          policy.Sanitize(c.FormValue("title")),
 		Rules:          policy.Sanitize(c.FormValue("rules")),
 		Deadline:       deadline,
@@ -778,7 +865,17 @@ func UpdateBattleDB(c echo.Context) error {
 		Host:           me,
 		Password:       policy.Sanitize(c.FormValue("password")),
 		MaxVotes:       maxVotes,
+		VotingMode:     votingMode,
+		TrimScores:     trimScores,
+		JudgeWeight:    judgeWeight,
 		Type:           battleType,
+		Tags:           NormalizeTags(c.FormValue("tags")),
+		Qualification:  qualification,
+		TieBreakers:    tieBreakers,
+		Teams:          teams,
+		TrackHosts:     trackHosts,
+		Length:         length,
+		SeasonID:       app.FormSeason(c, me.ID),
 	}
 
 	// Validate the struct. This might be unnecessary.
@@ -791,80 +888,38 @@ func UpdateBattleDB(c echo.Context) error {
 		return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "validationerror")
 	}
 
-	logo := policy.Sanitize(c.FormValue("logo"))
-	background := policy.Sanitize(c.FormValue("background"))
-	showUsers, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_users")))
-	showEntries, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_entries")))
-	trackingID := policy.Sanitize(c.FormValue("tracking_id"))
-	private, _ := strconv.Atoi(policy.Sanitize(c.FormValue("private")))
-	field1 := policy.Sanitize(c.FormValue("field_1"))
-	field2 := policy.Sanitize(c.FormValue("field_2"))
-	field3 := policy.Sanitize(c.FormValue("field_3"))
-
 	// If style ID exists, update. Otherwise, insert.
-	settingsID, _ := strconv.Atoi(policy.Sanitize(c.FormValue("settings_id")))
-	log.Println(settingsID)
-	if settingsID == 0 {
-		if len(logo) > 0 || len(background) > 0 ||
-			showUsers == 1 || showEntries == 1 ||
-			len(trackingID) > 0 || private == 1 ||
-			len(field1) > 0 || len(field2) > 0 ||
-			len(field3) > 0 {
-			stmt := "INSERT INTO battle_settings(logo, background, show_users, show_entries, tracking_id, private, field_1, field_2, field_3) VALUES(?,?,?,?,?,?,?,?,?)"
-			ins, err := dbWrite.Prepare(stmt)
-			if err != nil {
-				log.Println(err)
-				return AjaxResponse(c, false, "/battle/submit", "502")
-			}
-			defer ins.Close()
-
-			res, err := ins.Exec(logo, background, showUsers, showEntries, trackingID, private, field1, field2, field3)
-			if err != nil {
-				log.Println(err)
-				SetToast(c, "502")
-				return c.Redirect(302, "/")
-			}
-			lastInsertID, _ := res.LastInsertId()
-			settingsID = int(lastInsertID) // truncated on machines with 32-bit ints
-		}
-	} else {
-		stmt := "UPDATE battle_settings SET logo = ?, background = ?, show_users = ?, show_entries = ?, tracking_id = ?, private = ?, field_1 = ?, field_2 = ?, field_3 = ? WHERE id = ?"
-		upd, err := dbWrite.Prepare(stmt)
-		if err != nil {
-			log.Println(err)
-			SetToast(c, "502")
-			return c.Redirect(302, "/")
-		}
-		defer upd.Close()
-		upd.Exec(logo, background, showUsers, showEntries, trackingID, private, field1, field2, field3, settingsID)
-	}
-
-	results := 0
-	if c.FormValue("submit") == "DRAFT" {
-		results = -1
-	}
-
-	query := `
-			UPDATE battles 
-			SET title = ?, rules = ?, deadline = ?, attachment = ?, password = ?, voting_deadline = ?, maxvotes = ?, type = ?, settings_id = ?, results = ?, tags = ?
-			WHERE id = ? AND user_id = ?`
-
-	ins, err := dbWrite.Prepare(query)
+	battle.Settings, err = app.SaveBattleSettings(c)
 	if err != nil {
 		log.Println(err)
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
 	}
-	defer ins.Close()
 
-	ins.Exec(battle.Title, battle.Rules, battle.Deadline, battle.Attachment,
-		battle.Password, battle.VotingDeadline, battle.MaxVotes,
-		battle.Type, settingsID, results, c.FormValue("tags"), battleID, me.ID)
+	err = app.Battles.Update(*battle)
 	if err != nil {
 		log.Println(err)
 		SetToast(c, "failadd")
 		return c.Redirect(302, "/")
 	}
+	app.IndexBattle(battleID)
+
+	if votingMode == VotingScore && status != StatusVoting {
+		err = app.Battles.SetCriteria(battleID, ParseCriteria(c.FormValue("criteria")))
+		if err != nil {
+			log.Println(err)
+			return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "502")
+		}
+	}
+
+	if nextStatus != status {
+		err = app.TransitionBattle(battleID, status, nextStatus, TriggerHost, me.ID, "")
+		if err != nil {
+			log.Println(err)
+			return AjaxResponse(c, false, "/battle/"+c.Param("id")+"/update", "invalidstatus")
+		}
+	}
+	app.WakeScheduler()
 
 	SetToast(c, "successupdate")
 
@@ -875,13 +930,13 @@ func UpdateBattleDB(c echo.Context) error {
 }
 
 // InsertBattle ...
-func InsertBattle(c echo.Context) error {
+func (app *App) InsertBattle(c echo.Context) error {
 	start := time.Now()
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	// Check if user is authenticated.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -926,6 +981,24 @@ func InsertBattle(c echo.Context) error {
 		return AjaxResponse(c, false, "/battle/submit", "502")
 	}
 
+	urls := TypeURLPolicy(battleType)
+	if toast := urls.CheckAttachment(attachment); toast != "" {
+		return AjaxResponse(c, false, "/battle/submit", toast)
+	}
+	trackHosts := FormTrackHosts(c)
+	if len(NarrowHosts(trackHosts, urls.Tracks)) != len(trackHosts) {
+		return AjaxResponse(c, false, "/battle/submit", "tracksites")
+	}
+	length, toast := ParseLengthLimits(c)
+	if toast != "" {
+		return AjaxResponse(c, false, "/battle/submit", toast)
+	}
+
+	status := StatusEntry
+	if c.FormValue("submit") == "DRAFT" {
+		status = StatusDraft
+	}
+
 	battle := &Battle{
 		Title:          strings.TrimSpace(policy.Sanitize(c.FormValue("title"))),
 		Rules:          strings.TrimSpace(policy.Sanitize(c.FormValue("rules"))),
@@ -937,12 +1010,18 @@ func InsertBattle(c echo.Context) error {
 		Entries:        0,
 		ID:             0,
 		MaxVotes:       maxVotes,
+		VotingMode:     ParseVotingMode(c.FormValue("voting_mode")),
+		TrimScores:     c.FormValue("trim_scores") == "1",
+		JudgeWeight:    ParseJudgeWeight(c.FormValue("judge_weight")),
 		Type:           battleType,
-	}
-
-	results := 0
-	if c.FormValue("submit") == "DRAFT" {
-		results = -1
+		Status:         status,
+		Tags:           NormalizeTags(c.FormValue("tags")),
+		Qualification:  ParseQualificationRules(c),
+		TieBreakers:    FormTieBreakers(c),
+		Teams:          c.FormValue("teams") == "1",
+		TrackHosts:     trackHosts,
+		Length:         length,
+		SeasonID:       app.FormSeason(c, me.ID),
 	}
 
 	v := validator.New()
@@ -955,64 +1034,106 @@ func InsertBattle(c echo.Context) error {
 		return AjaxResponse(c, false, "/battle/submit", "validationerror")
 	}
 
-	logo := policy.Sanitize(c.FormValue("logo"))
-	background := policy.Sanitize(c.FormValue("background"))
-	showUsers, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_users")))
-	showEntries, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_entries")))
-	trackingID := policy.Sanitize(c.FormValue("tracking_id"))
-	private, _ := strconv.Atoi(policy.Sanitize(c.FormValue("private")))
-	field1 := policy.Sanitize(c.FormValue("field_1"))
-	field2 := policy.Sanitize(c.FormValue("field_2"))
-	field3 := policy.Sanitize(c.FormValue("field_3"))
-
-	// If style ID exists, update. Otherwise, insert.
-	settingsID, _ := strconv.Atoi(policy.Sanitize(c.FormValue("settings_id")))
-	log.Println(settingsID)
-	if settingsID == 0 {
-		if len(logo) > 0 || len(background) > 0 ||
-			showUsers == 1 || showEntries == 1 ||
-			len(trackingID) > 0 || private == 1 ||
-			len(field1) > 0 || len(field2) > 0 ||
-			len(field3) > 0 {
-			stmt := "INSERT INTO battle_settings(logo, background, show_users, show_entries, tracking_id, private, field_1, field_2, field_3) VALUES(?,?,?,?,?,?,?,?,?)"
-			ins, err := dbWrite.Prepare(stmt)
-			if err != nil {
-				log.Println(err)
-				return AjaxResponse(c, false, "/battle/submit", "502")
-			}
-			defer ins.Close()
-
-			res, err := ins.Exec(logo, background, showUsers, showEntries, trackingID, private, field1, field2, field3)
-			if err != nil {
-				log.Println(err)
-				return AjaxResponse(c, false, "/battle/submit", "502")
-			}
-			lastInsertID, _ := res.LastInsertId()
-			settingsID = int(lastInsertID) // truncated on machines with 32-bit ints
-		}
+	battle.Settings, err = app.SaveBattleSettings(c)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, "/battle/submit", "502")
 	}
 
-	stmt := `INSERT INTO battles
-			(title, rules, results, deadline, attachment, password, user_id, 
-			voting_deadline, maxvotes, type, settings_id, tags)
-			VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`
-	ins, err := dbWrite.Prepare(stmt)
+	battleID, err := app.Battles.Insert(*battle)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, false, "/battle/submit", "502")
 	}
-	defer ins.Close()
-	res, err := ins.Exec(battle.Title, battle.Rules, results, battle.Deadline, battle.Attachment, battle.Password,
-		battle.Host.ID, battle.VotingDeadline, battle.MaxVotes, battle.Type, settingsID, c.FormValue("tags"))
+	app.IndexBattle(battleID)
+
+	if battle.VotingMode == VotingScore {
+		err = app.Battles.SetCriteria(battleID, ParseCriteria(c.FormValue("criteria")))
+		if err != nil {
+			log.Println(err)
+			return AjaxResponse(c, false, "/battle/submit", "502")
+		}
+	}
+
+	err = app.Battles.RecordTransition(battleID, "", status, TriggerHost, me.ID, "")
 	if err != nil {
 		log.Println(err)
-		return AjaxResponse(c, false, "/battle/submit", "502")
 	}
-	battleInsertedID, _ := res.LastInsertId()
+	app.WakeScheduler()
 
 	duration := time.Since(start)
 	fmt.Println("InsertBattle time: " + duration.String())
-	return AjaxResponse(c, true, "/battle/"+strconv.FormatInt(battleInsertedID, 10), "successadd")
+	return AjaxResponse(c, true, "/battle/"+strconv.Itoa(battleID), "successadd")
+}
+
+// CopyBattle inserts a new battle from an existing one, with its own copy of the settings and the
+// score criteria. The caller sets the status & deadlines beforehand and records the transition after.
+func (app *App) CopyBattle(battle Battle) (int, error) {
+	sourceID := battle.ID
+	battle.ID = 0
+	battle.WinnerID = 0
+
+	if battle.Settings.ID != 0 {
+		settings := battle.Settings
+		settings.ID = 0
+		var err error
+		battle.Settings.ID, err = app.Battles.SaveSettings(settings)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	battleID, err := app.Battles.Insert(battle)
+	if err != nil {
+		return 0, err
+	}
+	app.IndexBattle(battleID)
+
+	if battle.VotingMode == VotingScore {
+		criteria, err := app.Battles.Criteria(sourceID)
+		if err == nil {
+			err = app.Battles.SetCriteria(battleID, criteria)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+	}
+
+	return battleID, nil
+}
+
+// SaveBattleSettings saves the optional battle settings from the submit & update forms.
+// Settings are only created once one of them is set.
+func (app *App) SaveBattleSettings(c echo.Context) (BattleSettings, error) {
+	settings := FormBattleSettings(c)
+	if settings.ID == 0 && (settings == BattleSettings{}) {
+		return settings, nil
+	}
+
+	var err error
+	settings.ID, err = app.Battles.SaveSettings(settings)
+	return settings, err
+}
+
+// FormBattleSettings reads the optional battle settings from a form.
+func FormBattleSettings(c echo.Context) BattleSettings {
+	showUsers, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_users")))
+	showEntries, _ := strconv.Atoi(policy.Sanitize(c.FormValue("show_entries")))
+	private, _ := strconv.Atoi(policy.Sanitize(c.FormValue("private")))
+	settingsID, _ := strconv.Atoi(policy.Sanitize(c.FormValue("settings_id")))
+
+	return BattleSettings{
+		ID:          settingsID,
+		Logo:        policy.Sanitize(c.FormValue("logo")),
+		Background:  policy.Sanitize(c.FormValue("background")),
+		ShowUsers:   showUsers == 1,
+		ShowEntries: showEntries == 1,
+		TrackingID:  policy.Sanitize(c.FormValue("tracking_id")),
+		Private:     private == 1,
+		Field1:      policy.Sanitize(c.FormValue("field_1")),
+		Field2:      policy.Sanitize(c.FormValue("field_2")),
+		Field3:      policy.Sanitize(c.FormValue("field_3")),
+	}
 }
 
 // SetTags resolves a battle's tags.
@@ -1027,12 +1148,12 @@ func SetTags(tags string) []string {
 }
 
 // CloseBattle ...
-func CloseBattle(c echo.Context) error {
+func (app *App) CloseBattle(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	// Check if user is authenticated.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -1045,17 +1166,37 @@ func CloseBattle(c echo.Context) error {
 		return c.Redirect(302, "/")
 	}
 
-	// Check if the delete request was sent through the form.
+	// Check if the close request was sent through the form.
 	if c.FormValue("close") == "yes" {
-		stmt := "UPDATE battles SET deadline = NOW() WHERE user_id = ? AND id = ?"
+		battle := app.GetBattle(battleID)
+		if battle.Host.ID != me.ID {
+			SetToast(c, "403")
+			return c.Redirect(302, "/")
+		}
 
-		del, err := dbWrite.Prepare(stmt)
+		// Closing ends whichever stage the battle is currently in.
+		now := time.Now()
+		switch battle.Status {
+		case StatusEntry:
+			err = app.Battles.SetDeadlines(battleID, now, battle.VotingDeadline)
+			if err == nil {
+				err = app.TransitionBattle(battleID, StatusEntry, StatusVoting, TriggerClose, me.ID, "")
+			}
+		case StatusVoting:
+			err = app.Battles.SetDeadlines(battleID, battle.Deadline, now)
+			if err == nil {
+				err = app.CompleteBattle(battleID, TriggerClose, me.ID, "")
+			}
+		default:
+			SetToast(c, "notopen")
+			return c.Redirect(302, "/battle/"+strconv.Itoa(battleID))
+		}
 		if err != nil {
+			log.Println(err)
 			SetToast(c, "502")
 			return c.Redirect(302, "/")
 		}
-		defer del.Close()
-		del.Exec(me.ID, battleID)
+		app.WakeScheduler()
 
 		SetToast(c, "successclose")
 		return c.Redirect(302, "/")
@@ -1067,12 +1208,12 @@ func CloseBattle(c echo.Context) error {
 }
 
 // DeleteBattle ...
-func DeleteBattle(c echo.Context) error {
+func (app *App) DeleteBattle(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	// Check if user is authenticated.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -1087,15 +1228,24 @@ func DeleteBattle(c echo.Context) error {
 
 	// Check if the delete request was sent through the form.
 	if c.FormValue("delete") == "yes" {
-		stmt := "DELETE FROM battles WHERE user_id = ? AND id = ?"
+		// Entries' uploads go with the battle, so they're looked up while it's still there.
+		uploads := []Beat{}
+		if battle, err := app.Battles.Get(battleID); err == nil && battle.Host.ID == me.ID {
+			uploads, err = app.Beats.ListByBattle(battleID)
+			if err != nil {
+				log.Println(err)
+			}
+		}
 
-		del, err := dbWrite.Prepare(stmt)
+		err = app.Battles.Delete(battleID, me.ID)
 		if err != nil {
+			log.Println(err)
 			SetToast(c, "502")
 			return c.Redirect(302, "/")
 		}
-		defer del.Close()
-		del.Exec(me.ID, battleID)
+		for _, beat := range uploads {
+			app.replacedUpload(beat, Beat{})
+		}
 
 		SetToast(c, "successdel")
 		return c.Redirect(302, "/")
@@ -1,12 +1,11 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
@@ -29,33 +28,24 @@ type Beat struct {
 	Field1    string `gorm:"column:field_1" json:"field_1"`
 	Field2    string `gorm:"column:field_2" json:"field_2"`
 	Field3    string `gorm:"column:field_3" json:"field_3"`
-}
 
-func GetBeat(user User, battle Battle) Beat {
-	beat := Beat{}
-	query := `SELECT id, url, votes, voted, placement, field_1, field_2, field_3
-				FROM beats
-				WHERE beats.user_id = ?
-				AND beats.battle_id = ?`
-
-	err := dbRead.QueryRow(query, user.ID, battle.ID).
-		Scan(&beat.ID, &beat.URL, &beat.Votes,
-			&beat.Voted, &beat.Placement, &beat.Field1,
-			&beat.Field2, &beat.Field3)
-	if err != nil {
-		log.Println(err)
-	}
-
-	beat.Artist = user
-	beat.Battle = battle
-
-	return beat
+	// Embed is how the track plays on the site.
+	Embed TrackEmbed `json:"embed"`
+	// File is the entry's uploaded audio, if it was uploaded instead of linked.
+	File BeatFile `json:"file"`
+	// Audio is what analysing the entry's audio found, when it was uploaded or its provider allows downloads.
+	Audio AudioInfo `json:"audio"`
+
+	// UserScores holds the user's scores on a score battle's entry, keyed by criterion.
+	UserScores map[int]int `json:"user_scores,omitempty"`
+	// Members are the users credited on a team entry, its artist first. Solo entries have none.
+	Members []BeatMember `json:"members,omitempty"`
 }
 
 // SubmitBeat returns a page that allows a user to submit or update their entry.
-func SubmitBeat(c echo.Context) error {
+func (app *App) SubmitBeat(c echo.Context) error {
 	// Check if user is authenticated.
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -68,13 +58,13 @@ func SubmitBeat(c echo.Context) error {
 		return c.Redirect(302, "/")
 	}
 
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 	toast := GetToast(c)
 	URL := c.Request().URL.RequestURI()
 
 	// TODO - Reduce strain here (not *).
 	// Get battle and check if it's valid. The title thing can probably go to be honest.
-	battle := GetBattle(battleID)
+	battle := app.GetBattle(battleID)
 	if battle.Title == "" {
 		SetToast(c, "404")
 		return c.Redirect(302, "/404")
@@ -87,7 +77,26 @@ func SubmitBeat(c echo.Context) error {
 	if strings.Contains(URL, "update") {
 		tpl = "UpdateBeat"
 		title = "Update"
-		beat = GetBeat(me, battle)
+		beat, err = app.Beats.GetByUser(battleID, me.ID)
+		if err != nil {
+			log.Println(err)
+		}
+		beat.Artist = me
+		beat.Battle = battle
+	}
+
+	// Entrants on a team battle pick their own role.
+	role := RoleProducer
+	if battle.Teams && beat.ID != 0 {
+		members, err := app.Beats.Members(battleID)
+		if err != nil {
+			log.Println(err)
+		}
+		for _, member := range members {
+			if member.BeatID == beat.ID && member.User.ID == me.ID {
+				role = member.Role
+			}
+		}
 	}
 
 	m := map[string]interface{}{
@@ -96,92 +105,69 @@ func SubmitBeat(c echo.Context) error {
 			"Analytics": analyticsKey,
 			"Buttons":   title,
 		},
-		"Beat":   beat,
-		"Battle": battle,
-		"Me":     me,
-		"Toast":  toast,
-		"Ads":    ads,
+		"Beat":       beat,
+		"Battle":     battle,
+		"Role":       role,
+		"TrackSites": BattleURLPolicy(battle).Tracks,
+		"Uploads":    AllowsUploads(battle),
+		"Me":         me,
+		"Toast":      toast,
+		"Ads":        ads,
 	}
 
 	return c.Render(http.StatusOK, tpl, m)
 }
 
-// Future function to handle audius/other SC links.
-func ProcessBeat(beat *url.URL) string {
-	parts := strings.Split(beat.Hostname(), ".")
-	domain := parts[len(parts)-2] + "." + parts[len(parts)-1]
-	fmt.Println(domain)
-
-	processedURL := beat.String()
-	if domain == "goo.gl" {
-		client := &http.Client{
-			CheckRedirect: func(req *http.Request, via []*http.Request) error {
-				processedURL = req.URL.String()
-				return nil
-			},
-		}
-
-		req, err := http.NewRequest(http.MethodGet, beat.String(), nil)
-		if err != nil {
-			return ""
-		}
-
-		resp, err := client.Do(req)
-		if err != nil {
-			return ""
-		}
-
-		defer resp.Body.Close()
+// EntryAudio is what's known about an entry's audio. Uploads are analysed as they're read,
+// and linked tracks only when their site lets the audio be fetched.
+func (app *App) EntryAudio(upload *Upload, track ResolvedTrack) AudioInfo {
+	if upload != nil {
+		return upload.Info
 	}
+	info, err := app.Tracks.Analyse(track)
+	if err != nil {
+		log.Println(err)
+	}
+	return info
+}
 
-	/* else if domain == "audius.co" {
-		headers := map[string][]string{
-			"Accept": []string{"text/plain"},
-		}
-
-		data := bytes.NewBuffer([]byte{})
-		req, err := http.NewRequest("GET", "https://dn-usa.audius.metadata.fyi/v1/resolve?url="+beat.String()+"&app_name=Beatbattle.app", data)
-		if err != nil {
-			log.Println(err)
-		}
-		req.Header = headers
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Println(err)
-		}
-
-		defer resp.Body.Close()
-		body, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			log.Println(err)
-		}
-
-		var jsonResp AudiusResolve
-		err = json.Unmarshal(body, &jsonResp)
-		if err != nil {
-			log.Println(err)
-		}
-
-		processedURL = `https://audius.co/` + jsonResp.Data.ID
-	} */
+// TrackLink reads a track link from a beat form, checks it against the battle's URL policy and resolves it with
+// its provider. It returns the link to save with its embed, or the toast for why it can't be entered.
+// Short links are checked where they lead.
+func (app *App) TrackLink(text string, battle Battle) (ResolvedTrack, string) {
+	if strings.TrimSpace(text) == "" {
+		return ResolvedTrack{}, "notracks"
+	}
+	trackURL, ok := ParseLink(policy.Sanitize(text))
+	if !ok {
+		return ResolvedTrack{}, "badurl"
+	}
 
-	return processedURL
-}
+	trackURL, err := app.Tracks.Expand(trackURL)
+	if err != nil {
+		log.Println(err)
+		return ResolvedTrack{}, "badurl"
+	}
 
-type AudiusResolve struct {
-	Data AudiusResolveData `json:"data"`
-}
+	if toast := BattleURLPolicy(battle).CheckTrack(trackURL); toast != "" {
+		return ResolvedTrack{}, toast
+	}
 
-type AudiusResolveData struct {
-	ID string `json:"id"`
+	track, err := app.Tracks.Resolve(trackURL)
+	if err == ErrNotTrack {
+		return ResolvedTrack{}, "notrack"
+	}
+	if err != nil {
+		// The provider couldn't be reached, so the track plays from its link where it can.
+		log.Println(err)
+	}
+	return track, ""
 }
 
 // InsertBeat is the post request from SubmitBeat that enter's a user's beat into the database.
-func InsertBeat(c echo.Context) error {
+func (app *App) InsertBeat(c echo.Context) error {
 	// Check if user is authenticated.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -196,63 +182,138 @@ func InsertBeat(c echo.Context) error {
 	redirectURL := "/beat/" + strconv.Itoa(battleID) + "/submit"
 
 	// EFFI - CAN MAYBE MAKE MORE EFFICIENT BY JOINING BEAT TABLE TO SEE IF ENTERED
-	// MIGHT ALLOW ENTRIES PAST DEADLINES IF FORCED ON EDGE CASES
-	password := ""
-	err = dbRead.QueryRow("SELECT password FROM battles WHERE id = ? AND results = '0'", battleID).Scan(&password)
-	if err != nil {
+	// The battle is checked before the form is read, so an entry that started sending while the battle
+	// was open is on time however long its upload takes.
+	battle, err := app.Battles.Get(battleID)
+	if err != nil || battle.Status != StatusEntry || !time.Now().Before(battle.Deadline) {
 		SetToast(c, "notopen")
 		return c.Redirect(302, redirectURL)
 	}
-	if password != c.FormValue("password") {
+
+	if toast := ReadEntryForm(c); toast != "" {
+		SetToast(c, toast)
+		return c.Redirect(302, redirectURL)
+	}
+	if battle.Password != c.FormValue("password") {
 		SetToast(c, "password")
 		return c.Redirect(302, redirectURL)
 	}
 
-	track := policy.Sanitize(c.FormValue("track"))
-	trackURL, err := url.Parse(track)
-	if err != nil {
-		SetToast(c, "sconly")
-		return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/submit")
+	// Only a tournament match's two players can enter its battle.
+	match, err := app.Tournaments.MatchByBattle(battleID)
+	if err == nil && match.Players[0] != me.ID && match.Players[1] != me.ID {
+		SetToast(c, "notinmatch")
+		return c.Redirect(302, redirectURL)
+	}
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+	}
+
+	upload, toast := ReadUpload(c, battle)
+	track := ResolvedTrack{}
+	if upload == nil && toast == "" {
+		track, toast = app.TrackLink(c.FormValue("track"), battle)
+	}
+	audio := app.EntryAudio(upload, track)
+	if toast == "" {
+		toast = battle.Length.Check(audio)
+	}
+	if toast != "" {
+		SetToast(c, toast)
+		return c.Redirect(302, redirectURL)
 	}
-	track = ProcessBeat(trackURL)
 	field1 := policy.Sanitize(c.FormValue("field_1"))
 	field2 := policy.Sanitize(c.FormValue("field_2"))
 	field3 := policy.Sanitize(c.FormValue("field_3"))
 
-	/*
+	beat := Beat{
+		URL:      track.URL,
+		Embed:    track.Embed,
+		Audio:    audio,
+		BattleID: battleID,
+		Artist:   me,
+		Field1:   field1,
+		Field2:   field2,
+		Field3:   field3,
+	}
+	response := "/successadd"
 
-		// PERF - MIGHT IMPACT A LOT
-			if !contains(whitelist, strings.TrimPrefix(trackURL.Host, "www.")) {
-				SetToast(c, "sconly")
-				return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/submit")
-			}
-	*/
+	current, err := app.Beats.GetByUser(battleID, me.ID)
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, "/")
+	}
 
-	stmt := "INSERT INTO beats(url, battle_id, user_id, field_1, field_2, field_3) VALUES(?,?,?,?,?,?)"
-	response := "/successadd"
+	// Members of another entrant's team are already credited on an entry in this battle.
+	credits, err := app.teamCredits(battleID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, "/")
+	}
+	for beatID, members := range credits {
+		if members[me.ID] && beatID != current.ID {
+			SetToast(c, "alreadycredited")
+			return c.Redirect(302, redirectURL)
+		}
+	}
+
+	if upload != nil {
+		beat.File, err = app.StoreUpload(upload, battleID, me.ID)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, redirectURL)
+		}
+	}
 
 	// IF EXISTS UPDATE
-	if RowExists("SELECT battle_id FROM beats WHERE user_id = ? AND battle_id = ?", me.ID, battleID) {
-		stmt = "UPDATE beats SET url=? WHERE battle_id=? AND user_id=?"
+	if current.ID != 0 {
+		if upload != nil {
+			track = UploadTrack(battleID, current.ID)
+			beat.URL, beat.Embed = track.URL, track.Embed
+		}
+		err = app.Beats.Update(beat)
+		beat.ID = current.ID
 		response = "/successupdate"
+	} else {
+		beat.ID, err = app.Beats.Insert(beat)
+		// Uploads stream from the entry, so they can only say where once it's in.
+		if err == nil && upload != nil {
+			track = UploadTrack(battleID, beat.ID)
+			beat.URL, beat.Embed = track.URL, track.Embed
+			err = app.Beats.Update(beat)
+			// An entry that can't say where it streams from is taken back out, so it can be entered again.
+			if err != nil {
+				deleteErr := app.Beats.Delete(battleID, me.ID)
+				if deleteErr != nil {
+					log.Println(deleteErr)
+				}
+			}
+		}
 	}
-
-	ins, err := dbWrite.Prepare(stmt)
 	if err != nil {
+		log.Println(err)
+		app.replacedUpload(beat, current)
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
 	}
-	defer ins.Close()
+	app.replacedUpload(current, beat)
 
-	ins.Exec(track, battleID, me.ID, field1, field2, field3)
+	err = app.saveEntrantRole(battle, beat.ID, me, ParseMemberRole(c.FormValue("role")))
+	if err != nil {
+		log.Println(err)
+	}
 
 	SetToast(c, response)
 	return c.Redirect(302, "/battle/"+strconv.Itoa(battleID))
 }
 
 // UpdateBeat is the POST request from SubmitBeat when a user is updating their track.
-func UpdateBeat(c echo.Context) error {
-	me := GetUser(c, true)
+// Leaving the track blank keeps an uploaded one.
+func (app *App) UpdateBeat(c echo.Context) error {
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -264,55 +325,106 @@ func UpdateBeat(c echo.Context) error {
 		return c.Redirect(302, "/")
 	}
 
-	// MIGHT ALLOW ENTRIES PAST DEADLINES IF FORCED ON EDGE CASES
-	password := ""
-	err = dbRead.QueryRow("SELECT password FROM battles WHERE id = ? AND results = '0'", battleID).Scan(&password)
-	if err != nil {
+	// Checked before the form is read, like InsertBeat, so slow uploads that started in time are on time.
+	battle, err := app.Battles.Get(battleID)
+	if err != nil || battle.Status != StatusEntry || !time.Now().Before(battle.Deadline) {
 		SetToast(c, "notopen")
 		return c.Redirect(302, "/battle/"+strconv.Itoa(battleID))
 	}
 
-	track := policy.Sanitize(c.FormValue("track"))
-	trackURL, err := url.Parse(track)
+	if toast := ReadEntryForm(c); toast != "" {
+		SetToast(c, toast)
+		return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/update")
+	}
+
+	current, err := app.Beats.GetByUser(battleID, me.ID)
 	if err != nil {
-		SetToast(c, "sconly")
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "nobeat")
 		return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/submit")
 	}
-	track = ProcessBeat(trackURL)
+
+	upload, toast := ReadUpload(c, battle)
+	track := ResolvedTrack{URL: current.URL, Embed: current.Embed}
+	file := current.File
+	audio := current.Audio
+	if upload == nil && toast == "" && (current.File.Key == "" || strings.TrimSpace(c.FormValue("track")) != "") {
+		track, toast = app.TrackLink(c.FormValue("track"), battle)
+		file = BeatFile{}
+		audio = app.EntryAudio(nil, track)
+	}
+	if upload != nil {
+		audio = upload.Info
+	}
+	if toast == "" {
+		toast = battle.Length.Check(audio)
+	}
+	if toast != "" {
+		SetToast(c, toast)
+		return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/update")
+	}
 	field1 := policy.Sanitize(c.FormValue("field_1"))
 	field2 := policy.Sanitize(c.FormValue("field_2"))
 	field3 := policy.Sanitize(c.FormValue("field_3"))
 
-	/*
-		redirectURL := "/beat/" + strconv.Itoa(battleID) + "/update"
-			trackURL, err := url.Parse(track)
-			if err != nil {
-				SetToast(c, "sconly")
-				return c.Redirect(302, redirectURL)
-			}
-
-			// PERF - MIGHT IMPACT A LOT
-				if !contains(whitelist, strings.TrimPrefix(trackURL.Host, "www.")) {
-					SetToast(c, "sconly")
-					return c.Redirect(302, redirectURL)
-				}
-	*/
+	if upload != nil {
+		file, err = app.StoreUpload(upload, battleID, me.ID)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/update")
+		}
+		track = UploadTrack(battleID, current.ID)
+	}
 
-	ins, err := dbWrite.Prepare("UPDATE beats SET url=?, field_1=?, field_2=?, field_3=? WHERE battle_id=? AND user_id=?")
+	beat := Beat{
+		URL:      track.URL,
+		Embed:    track.Embed,
+		File:     file,
+		Audio:    audio,
+		BattleID: battleID,
+		Artist:   me,
+		Field1:   field1,
+		Field2:   field2,
+		Field3:   field3,
+	}
+	err = app.Beats.Update(beat)
 	if err != nil {
+		log.Println(err)
+		app.replacedUpload(beat, current)
 		SetToast(c, "nobeat")
 		return c.Redirect(302, "/beat/"+strconv.Itoa(battleID)+"/submit")
 	}
-	defer ins.Close()
-	ins.Exec(track, field1, field2, field3, battleID, me.ID)
+	app.replacedUpload(current, beat)
+
+	if battle.Teams {
+		err = app.saveEntrantRole(battle, current.ID, me, ParseMemberRole(c.FormValue("role")))
+		if err != nil {
+			log.Println(err)
+		}
+	}
 
 	SetToast(c, "successupdate")
 	return c.Redirect(302, "/battle/"+strconv.Itoa(battleID))
 }
 
+// replacedUpload removes an entry's uploaded file once it's been replaced or the entry's gone.
+// It also cleans up a new upload when saving the entry it was for fails.
+func (app *App) replacedUpload(current Beat, beat Beat) {
+	if current.File.Key == "" || current.File.Key == beat.File.Key {
+		return
+	}
+	err := app.Files.Delete(current.File.Key)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
 // DeleteBeat ...
-func DeleteBeat(c echo.Context) error {
-	me := GetUser(c, true)
+func (app *App) DeleteBeat(c echo.Context) error {
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
@@ -326,14 +438,18 @@ func DeleteBeat(c echo.Context) error {
 
 	redirectURL := "/battle/" + strconv.Itoa(battleID)
 
-	stmt := "DELETE FROM beats WHERE user_id = ? AND battle_id = ?"
-	ins, err := dbWrite.Prepare(stmt)
+	current, err := app.Beats.GetByUser(battleID, me.ID)
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+	}
+
+	err = app.Beats.Delete(battleID, me.ID)
 	if err != nil {
+		log.Println(err)
 		SetToast(c, "validationerror")
 		return c.Redirect(302, redirectURL)
 	}
-	defer ins.Close()
-	ins.Exec(me.ID, battleID)
+	app.replacedUpload(current, Beat{})
 
 	SetToast(c, "successdel")
 	return c.Redirect(302, redirectURL)
@@ -0,0 +1,323 @@
+package main
+
+import "strconv"
+
+// BracketSide is one of a tournament's brackets.
+type BracketSide string
+
+// Bracket sides. Single elimination tournaments only have a winners bracket.
+const (
+	BracketWinners BracketSide = "winners"
+	BracketLosers  BracketSide = "losers"
+	// BracketFinal is a double elimination tournament's grand final. Round 2 is the reset, only played
+	// when the losers bracket's champion wins the first.
+	BracketFinal BracketSide = "final"
+)
+
+// MatchKey places a match in a tournament's bracket. Rounds and positions count from 1.
+type MatchKey struct {
+	Side     BracketSide
+	Round    int
+	Position int
+}
+
+// MatchState is how far along a match in the bracket is.
+type MatchState string
+
+// Match states.
+const (
+	// MatchWaiting matches are still waiting on earlier matches for a player.
+	MatchWaiting MatchState = "waiting"
+	// MatchReady matches have both their players and are being battled out.
+	MatchReady   MatchState = "ready"
+	MatchDecided MatchState = "decided"
+	// MatchBye matches only have one player, who goes through without a battle.
+	MatchBye MatchState = "bye"
+	// MatchEmpty matches have nobody in them and are skipped.
+	MatchEmpty MatchState = "empty"
+)
+
+// BracketSlot is one side of a match. A slot without a user is still to be decided, unless it's a bye.
+type BracketSlot struct {
+	User User
+	Seed int
+	Bye  bool
+}
+
+// slotSource is where a slot gets its player from: a seed, or the winner or loser of an earlier match.
+type slotSource struct {
+	seed  int
+	match MatchKey
+	loser bool
+}
+
+// BracketMatch is a match as the bracket works it out from the seeds and the matches played so far.
+type BracketMatch struct {
+	Key   MatchKey
+	Slots [2]BracketSlot
+	State MatchState
+	// Winner is the index of the slot that won or went through on a bye, -1 until then.
+	Winner int
+	// Locked matches have had their result used by a later match that's been decided, so it can't change.
+	Locked bool
+	// Match is the stored match with its battle, empty until the match is ready.
+	Match TournamentMatch
+
+	sources [2]slotSource
+}
+
+// winnerSlot is who goes through from the match, empty while that's still to be decided.
+func (m *BracketMatch) winnerSlot() BracketSlot {
+	switch m.State {
+	case MatchDecided, MatchBye:
+		return m.Slots[m.Winner]
+	case MatchEmpty:
+		return BracketSlot{Bye: true}
+	}
+	return BracketSlot{}
+}
+
+// loserSlot is who drops out of the match, a bye if nobody does.
+func (m *BracketMatch) loserSlot() BracketSlot {
+	switch m.State {
+	case MatchDecided:
+		return m.Slots[1-m.Winner]
+	case MatchBye, MatchEmpty:
+		return BracketSlot{Bye: true}
+	}
+	return BracketSlot{}
+}
+
+// BracketRound is a column of the bracket.
+type BracketRound struct {
+	Name    string
+	Matches []*BracketMatch
+}
+
+// Bracket is a tournament's matches, round by round.
+type Bracket struct {
+	Winners []BracketRound
+	Losers  []BracketRound
+	Final   []BracketRound
+	// Champion is the tournament's winner, empty until the last match is decided.
+	Champion BracketSlot
+
+	matches map[MatchKey]*BracketMatch
+	// order is every match in the order they were resolved, so a match always comes after the ones it depends on.
+	order []*BracketMatch
+}
+
+// seedOrder lists the seeds of a bracket's first round top to bottom, so the top seeds can only meet late.
+func seedOrder(size int) []int {
+	order := []int{1}
+	for len(order) < size {
+		next := []int{}
+		for _, seed := range order {
+			next = append(next, seed, len(order)*2+1-seed)
+		}
+		order = next
+	}
+	return order
+}
+
+// BuildBracket works out a tournament's bracket from its entrants in seed order and the matches played.
+// The bracket is padded out to a power of two with byes, which the top seeds get. A played match only
+// counts while its players are still the ones the bracket puts there.
+func BuildBracket(format TournamentFormat, entrants []TournamentEntrant, played []TournamentMatch) Bracket {
+	size, rounds := 2, 1
+	for size < len(entrants) {
+		size *= 2
+		rounds++
+	}
+
+	b := Bracket{matches: map[MatchKey]*BracketMatch{}}
+	stored := map[MatchKey]TournamentMatch{}
+	for _, match := range played {
+		stored[MatchKey{match.Side, match.Round, match.Position}] = match
+	}
+
+	slot := func(source slotSource) BracketSlot {
+		if source.seed > len(entrants) {
+			return BracketSlot{Bye: true}
+		}
+		if source.seed > 0 {
+			return BracketSlot{User: entrants[source.seed-1].User, Seed: source.seed}
+		}
+		if source.loser {
+			return b.matches[source.match].loserSlot()
+		}
+		return b.matches[source.match].winnerSlot()
+	}
+
+	resolve := func(key MatchKey, sources [2]slotSource) *BracketMatch {
+		m := &BracketMatch{Key: key, Winner: -1, sources: sources}
+		m.Slots = [2]BracketSlot{slot(sources[0]), slot(sources[1])}
+
+		switch {
+		case m.Slots[0].Bye && m.Slots[1].Bye:
+			m.State = MatchEmpty
+		case m.Slots[0].Bye && m.Slots[1].User.ID != 0:
+			m.State, m.Winner = MatchBye, 1
+		case m.Slots[1].Bye && m.Slots[0].User.ID != 0:
+			m.State, m.Winner = MatchBye, 0
+		case m.Slots[0].User.ID == 0 || m.Slots[1].User.ID == 0:
+			m.State = MatchWaiting
+		default:
+			m.State = MatchReady
+			match, ok := stored[key]
+			if ok {
+				m.Match = match
+			}
+			if ok && match.Players == [2]int{m.Slots[0].User.ID, m.Slots[1].User.ID} {
+				for i := range m.Slots {
+					if match.WinnerID == m.Slots[i].User.ID {
+						m.State, m.Winner = MatchDecided, i
+					}
+				}
+			}
+		}
+
+		b.matches[key] = m
+		b.order = append(b.order, m)
+		return m
+	}
+
+	order := seedOrder(size)
+	for r := 1; r <= rounds; r++ {
+		round := BracketRound{Name: winnersRoundName(format, r, rounds)}
+		for p := 1; p <= size>>r; p++ {
+			sources := [2]slotSource{{match: MatchKey{BracketWinners, r - 1, 2*p - 1}}, {match: MatchKey{BracketWinners, r - 1, 2 * p}}}
+			if r == 1 {
+				sources = [2]slotSource{{seed: order[2*p-2]}, {seed: order[2*p-1]}}
+			}
+			round.Matches = append(round.Matches, resolve(MatchKey{BracketWinners, r, p}, sources))
+		}
+		b.Winners = append(b.Winners, round)
+	}
+
+	winnersFinal := b.matches[MatchKey{BracketWinners, rounds, 1}]
+	if format != FormatDouble {
+		b.Champion = winnersFinal.winnerSlot()
+		b.lock()
+		return b
+	}
+
+	// Losers bracket rounds alternate between the losers bracket playing itself down, and its
+	// survivors meeting the players just knocked out of the winners bracket.
+	losersRounds := 2 * (rounds - 1)
+	for r := 1; r <= losersRounds; r++ {
+		round := BracketRound{Name: "Losers Round " + strconv.Itoa(r)}
+		if r == losersRounds {
+			round.Name = "Losers Final"
+		}
+
+		count := size >> (r/2 + 2)
+		if r%2 == 0 {
+			count = size >> (r/2 + 1)
+		}
+		for p := 1; p <= count; p++ {
+			var sources [2]slotSource
+			switch {
+			case r == 1:
+				sources = [2]slotSource{{match: MatchKey{BracketWinners, 1, 2*p - 1}, loser: true}, {match: MatchKey{BracketWinners, 1, 2 * p}, loser: true}}
+			case r%2 == 0:
+				sources = [2]slotSource{{match: MatchKey{BracketLosers, r - 1, p}}, {match: MatchKey{BracketWinners, r/2 + 1, p}, loser: true}}
+			default:
+				sources = [2]slotSource{{match: MatchKey{BracketLosers, r - 1, 2*p - 1}}, {match: MatchKey{BracketLosers, r - 1, 2 * p}}}
+			}
+			round.Matches = append(round.Matches, resolve(MatchKey{BracketLosers, r, p}, sources))
+		}
+		b.Losers = append(b.Losers, round)
+	}
+
+	// With only two entrants there's no losers bracket, so the grand final is a rematch.
+	challenger := slotSource{match: MatchKey{BracketLosers, losersRounds, 1}}
+	if losersRounds == 0 {
+		challenger = slotSource{match: winnersFinal.Key, loser: true}
+	}
+	final := resolve(MatchKey{BracketFinal, 1, 1}, [2]slotSource{{match: winnersFinal.Key}, challenger})
+	b.Final = []BracketRound{{Name: "Grand Final", Matches: []*BracketMatch{final}}}
+
+	// The winners bracket's champion hasn't lost yet, so losing the grand final forces a reset.
+	if final.State == MatchDecided && final.Winner == 1 {
+		reset := resolve(MatchKey{BracketFinal, 2, 1}, [2]slotSource{{match: final.Key, loser: true}, {match: final.Key}})
+		b.Final = append(b.Final, BracketRound{Name: "Grand Final Reset", Matches: []*BracketMatch{reset}})
+		b.Champion = reset.winnerSlot()
+	} else {
+		b.Champion = final.winnerSlot()
+	}
+
+	b.lock()
+	return b
+}
+
+// lock marks the matches whose results a decided match depends on, going through byes.
+func (b *Bracket) lock() {
+	for i := len(b.order) - 1; i >= 0; i-- {
+		m := b.order[i]
+		if m.State != MatchDecided && !(m.State == MatchBye && m.Locked) {
+			continue
+		}
+		for _, source := range m.sources {
+			if source.seed == 0 {
+				b.matches[source.match].Locked = true
+			}
+		}
+	}
+}
+
+// Match returns a match in the bracket.
+func (b Bracket) Match(key MatchKey) (*BracketMatch, bool) {
+	m, ok := b.matches[key]
+	return m, ok
+}
+
+// Ready returns the matches that have both their players and still need a result.
+func (b Bracket) Ready() []*BracketMatch {
+	ready := []*BracketMatch{}
+	for _, m := range b.order {
+		if m.State == MatchReady {
+			ready = append(ready, m)
+		}
+	}
+	return ready
+}
+
+// Round returns the round a match is in.
+func (b Bracket) Round(key MatchKey) (BracketRound, bool) {
+	rounds := b.Winners
+	switch key.Side {
+	case BracketLosers:
+		rounds = b.Losers
+	case BracketFinal:
+		rounds = b.Final
+	}
+	if key.Round < 1 || key.Round > len(rounds) {
+		return BracketRound{}, false
+	}
+	return rounds[key.Round-1], true
+}
+
+// RoundName names the round a match is in.
+func (b Bracket) RoundName(key MatchKey) string {
+	round, _ := b.Round(key)
+	return round.Name
+}
+
+// winnersRoundName names a round of the winners bracket.
+func winnersRoundName(format TournamentFormat, round int, rounds int) string {
+	prefix := ""
+	if format == FormatDouble {
+		prefix = "Winners "
+	}
+
+	switch {
+	case round == rounds && format == FormatDouble:
+		return "Winners Final"
+	case round == rounds:
+		return "Final"
+	case round == rounds-1:
+		return prefix + "Semifinals"
+	}
+	return prefix + "Round " + strconv.Itoa(round)
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeedOrder(t *testing.T) {
+	tests := []struct {
+		size  int
+		order []int
+	}{
+		{1, []int{1}},
+		{2, []int{1, 2}},
+		{4, []int{1, 4, 2, 3}},
+		{8, []int{1, 8, 4, 5, 2, 7, 3, 6}},
+	}
+	for _, test := range tests {
+		if order := seedOrder(test.size); !reflect.DeepEqual(order, test.order) {
+			t.Errorf("seedOrder(%d) = %v, want %v", test.size, order, test.order)
+		}
+	}
+}
+
+// testEntrants are a tournament's entrants in seed order. Each user's ID is 100 more than their seed.
+func testEntrants(count int) []TournamentEntrant {
+	entrants := []TournamentEntrant{}
+	for seed := 1; seed <= count; seed++ {
+		entrants = append(entrants, TournamentEntrant{User: User{ID: 100 + seed}, Seed: seed})
+	}
+	return entrants
+}
+
+// playBracket plays a tournament out. The better seed wins every match apart from the upsets.
+// It returns the finished bracket and the matches in the order they were played.
+func playBracket(format TournamentFormat, entrants []TournamentEntrant, upsets map[MatchKey]bool) (Bracket, []MatchKey) {
+	played := []TournamentMatch{}
+	keys := []MatchKey{}
+	for {
+		bracket := BuildBracket(format, entrants, played)
+		ready := bracket.Ready()
+		if len(ready) == 0 {
+			return bracket, keys
+		}
+		for _, m := range ready {
+			winner := 0
+			if m.Slots[1].Seed < m.Slots[0].Seed {
+				winner = 1
+			}
+			if upsets[m.Key] {
+				winner = 1 - winner
+			}
+			played = append(played, TournamentMatch{Side: m.Key.Side, Round: m.Key.Round, Position: m.Key.Position,
+				Players: [2]int{m.Slots[0].User.ID, m.Slots[1].User.ID}, WinnerID: m.Slots[winner].User.ID})
+			keys = append(keys, m.Key)
+		}
+	}
+}
+
+func TestBuildBracketByes(t *testing.T) {
+	tests := []struct {
+		entrants int
+		// firstRound is the state of each first round match, top to bottom.
+		firstRound []MatchState
+		ready      []MatchKey
+	}{
+		{2, []MatchState{MatchReady}, []MatchKey{{BracketWinners, 1, 1}}},
+		{3, []MatchState{MatchBye, MatchReady}, []MatchKey{{BracketWinners, 1, 2}}},
+		{4, []MatchState{MatchReady, MatchReady}, []MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}}},
+		// The top three seeds get the byes, and the second and third seeds meet straight away.
+		{5, []MatchState{MatchBye, MatchReady, MatchBye, MatchBye}, []MatchKey{{BracketWinners, 1, 2}, {BracketWinners, 2, 2}}},
+		{8, []MatchState{MatchReady, MatchReady, MatchReady, MatchReady},
+			[]MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}, {BracketWinners, 1, 3}, {BracketWinners, 1, 4}}},
+	}
+	for _, test := range tests {
+		bracket := BuildBracket(FormatSingle, testEntrants(test.entrants), nil)
+		states := []MatchState{}
+		for _, m := range bracket.Winners[0].Matches {
+			states = append(states, m.State)
+		}
+		if !reflect.DeepEqual(states, test.firstRound) {
+			t.Errorf("%d entrants: first round is %v, want %v", test.entrants, states, test.firstRound)
+		}
+		ready := []MatchKey{}
+		for _, m := range bracket.Ready() {
+			ready = append(ready, m.Key)
+		}
+		if !reflect.DeepEqual(ready, test.ready) {
+			t.Errorf("%d entrants: ready matches are %v, want %v", test.entrants, ready, test.ready)
+		}
+	}
+}
+
+func TestPlayBracket(t *testing.T) {
+	winnersFinal := MatchKey{BracketWinners, 2, 1}
+	grandFinal := MatchKey{BracketFinal, 1, 1}
+	tests := []struct {
+		name     string
+		format   TournamentFormat
+		entrants int
+		upsets   map[MatchKey]bool
+		played   []MatchKey
+		champion int
+	}{
+		{
+			name: "single elimination with byes", format: FormatSingle, entrants: 5,
+			played:   []MatchKey{{BracketWinners, 1, 2}, {BracketWinners, 2, 2}, {BracketWinners, 2, 1}, {BracketWinners, 3, 1}},
+			champion: 1,
+		},
+		{
+			name: "single elimination upset", format: FormatSingle, entrants: 4, upsets: map[MatchKey]bool{winnersFinal: true},
+			played:   []MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}, winnersFinal},
+			champion: 2,
+		},
+		{
+			name: "double elimination", format: FormatDouble, entrants: 4,
+			played: []MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}, winnersFinal, {BracketLosers, 1, 1},
+				{BracketLosers, 2, 1}, grandFinal},
+			champion: 1,
+		},
+		{
+			// The top seed drops to the losers bracket, comes back through it and wins the grand final,
+			// which forces a reset.
+			name: "double elimination reset", format: FormatDouble, entrants: 4, upsets: map[MatchKey]bool{winnersFinal: true},
+			played: []MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}, winnersFinal, {BracketLosers, 1, 1},
+				{BracketLosers, 2, 1}, grandFinal, {BracketFinal, 2, 1}},
+			champion: 1,
+		},
+		{
+			name: "double elimination comeback falls short", format: FormatDouble, entrants: 4,
+			upsets: map[MatchKey]bool{winnersFinal: true, {BracketFinal, 2, 1}: true},
+			played: []MatchKey{{BracketWinners, 1, 1}, {BracketWinners, 1, 2}, winnersFinal, {BracketLosers, 1, 1},
+				{BracketLosers, 2, 1}, grandFinal, {BracketFinal, 2, 1}},
+			champion: 2,
+		},
+		{
+			// The top seed's bye leaves the losers bracket's first match a bye too, so the third seed goes straight to its final.
+			name: "double elimination with a bye", format: FormatDouble, entrants: 3,
+			played:   []MatchKey{{BracketWinners, 1, 2}, winnersFinal, {BracketLosers, 2, 1}, grandFinal},
+			champion: 1,
+		},
+		{
+			name: "double elimination rematch", format: FormatDouble, entrants: 2, upsets: map[MatchKey]bool{{BracketWinners, 1, 1}: true},
+			played:   []MatchKey{{BracketWinners, 1, 1}, grandFinal, {BracketFinal, 2, 1}},
+			champion: 1,
+		},
+	}
+	for _, test := range tests {
+		bracket, played := playBracket(test.format, testEntrants(test.entrants), test.upsets)
+		if !reflect.DeepEqual(played, test.played) {
+			t.Errorf("%s: played %v, want %v", test.name, played, test.played)
+		}
+		if bracket.Champion.Seed != test.champion {
+			t.Errorf("%s: champion is seed %d, want %d", test.name, bracket.Champion.Seed, test.champion)
+		}
+	}
+}
+
+// TestBuildBracketStaleMatch ignores a result for players the bracket no longer puts in the match,
+// and locks results that later matches were decided from.
+func TestBuildBracketStaleMatch(t *testing.T) {
+	entrants := testEntrants(4)
+	played := []TournamentMatch{
+		{Side: BracketWinners, Round: 1, Position: 1, Players: [2]int{101, 104}, WinnerID: 101},
+		{Side: BracketWinners, Round: 1, Position: 2, Players: [2]int{102, 103}, WinnerID: 102},
+		{Side: BracketWinners, Round: 2, Position: 1, Players: [2]int{101, 103}, WinnerID: 103},
+	}
+	bracket := BuildBracket(FormatSingle, entrants, played)
+	final, _ := bracket.Match(MatchKey{BracketWinners, 2, 1})
+	if final.State != MatchReady || bracket.Champion.User.ID != 0 {
+		t.Errorf("final with the wrong players is %s with champion %d, want it still to be played", final.State, bracket.Champion.User.ID)
+	}
+	for _, m := range bracket.Winners[0].Matches {
+		if m.Locked {
+			t.Errorf("%v is locked before the final's been decided", m.Key)
+		}
+	}
+
+	played[2].Players = [2]int{101, 102}
+	played[2].WinnerID = 102
+	bracket = BuildBracket(FormatSingle, entrants, played)
+	if bracket.Champion.Seed != 2 {
+		t.Errorf("champion is seed %d, want 2", bracket.Champion.Seed)
+	}
+	for _, m := range bracket.Winners[0].Matches {
+		if !m.Locked {
+			t.Errorf("%v isn't locked once the final's been decided", m.Key)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"html"
+	"log"
+	"time"
+)
+
+// podiumPlacements is how many placements count as a podium finish.
+const podiumPlacements = 3
+
+// ChampionshipRecord is an entry's final placement in a complete battle. A placement of 0 means disqualified.
+type ChampionshipRecord struct {
+	BeatID     int
+	BattleID   int
+	UserID     int
+	Placement  int
+	FinishedAt time.Time
+	// Title is the battle's title, filled in when listing a user's records.
+	Title string
+}
+
+// ChampionshipHistory sums up a user's championship records for their profile.
+type ChampionshipHistory struct {
+	Battles       int
+	Wins          int
+	Podiums       int
+	CurrentStreak int
+	BestStreak    int
+	// Finishes are the podium finishes, newest first.
+	Finishes []ChampionshipRecord
+}
+
+// History sums up championship records given oldest first. A win streak counts battles won in a row,
+// so any battle entered and not won ends it, disqualifications included.
+func History(records []ChampionshipRecord) ChampionshipHistory {
+	history := ChampionshipHistory{Finishes: []ChampionshipRecord{}}
+	for _, record := range records {
+		history.Battles++
+		if record.Placement == 1 {
+			history.Wins++
+			history.CurrentStreak++
+		} else {
+			history.CurrentStreak = 0
+		}
+		if history.CurrentStreak > history.BestStreak {
+			history.BestStreak = history.CurrentStreak
+		}
+
+		if record.Placement >= 1 && record.Placement <= podiumPlacements {
+			history.Podiums++
+			record.Title = html.UnescapeString(record.Title)
+			history.Finishes = append([]ChampionshipRecord{record}, history.Finishes...)
+		}
+	}
+
+	return history
+}
+
+// RecordChampionships writes a complete battle's final placements to the championship records and
+// sets its winner. Co-winners share 1st place in the records, and the earliest submission is the winner.
+func (app *App) RecordChampionships(battle Battle) error {
+	beats, err := app.Beats.ListByBattle(battle.ID)
+	if err != nil {
+		return err
+	}
+
+	winnerID := 0
+	records := []ChampionshipRecord{}
+	for _, beat := range beats {
+		records = append(records, ChampionshipRecord{
+			BeatID:     beat.ID,
+			BattleID:   battle.ID,
+			UserID:     beat.Artist.ID,
+			Placement:  beat.Placement,
+			FinishedAt: battle.VotingDeadline,
+		})
+		if beat.Placement == 1 && winnerID == 0 {
+			winnerID = beat.Artist.ID
+		}
+	}
+
+	return app.Results.SaveRecords(battle.ID, winnerID, records)
+}
+
+// UserHistory returns a user's championship history, or an empty one if it can't be read.
+func (app *App) UserHistory(userID int) ChampionshipHistory {
+	records, err := app.Results.UserRecords(userID)
+	if err != nil {
+		log.Println(err)
+		return ChampionshipHistory{Finishes: []ChampionshipRecord{}}
+	}
+	return History(records)
+}
@@ -52,6 +52,48 @@ func GetToast(c echo.Context) [2]string {
 	case "maxvotes":
 		html = "You're at your max votes for this battle."
 		class = "toast-error"
+	case "notranked":
+		html = "This battle doesn't use ranked voting."
+		class = "toast-error"
+	case "rankedonly":
+		html = "This battle uses ranked voting, rank entries instead."
+		class = "toast-error"
+	case "scoreonly":
+		html = "This battle uses score voting, score entries instead."
+		class = "toast-error"
+	case "notscored":
+		html = "This battle doesn't use score voting."
+		class = "toast-error"
+	case "invalidscore":
+		html = "Scores must be between 1 and 10."
+		class = "toast-error"
+	case "entrantsonly":
+		html = "Only entrants & judges can vote in this battle."
+		class = "toast-error"
+	case "nouser":
+		html = "That user couldn't be found."
+		class = "toast-error"
+	case "notinvited":
+		html = "You haven't been invited to judge this battle."
+		class = "toast-error"
+	case "judgingclosed":
+		html = "Judging has closed for this battle."
+		class = "toast-error"
+	case "noteams":
+		html = "This battle doesn't allow team entries."
+		class = "toast-error"
+	case "teamsclosed":
+		html = "Teams can only change while the battle is open for entries."
+		class = "toast-error"
+	case "alreadycredited":
+		html = "Users can only be credited on one entry per battle."
+		class = "toast-error"
+	case "teamfull":
+		html = "This entry's team is full."
+		class = "toast-error"
+	case "noteaminvite":
+		html = "You haven't been invited onto this entry."
+		class = "toast-error"
 	case "voteb4":
 		html = "The voting deadline cannot be before the deadline."
 		class = "toast-error"
@@ -64,6 +106,48 @@ func GetToast(c echo.Context) [2]string {
 	case "sconly":
 		html = "You must submit a SoundCloud link."
 		class = "toast-error"
+	case "badurl":
+		html = "Your track link must be a full http or https address."
+		class = "toast-error"
+	case "trackhost":
+		html = "This battle doesn't accept tracks from that site. Check the link field for the sites it does."
+		class = "toast-error"
+	case "notrack":
+		html = "Your link must be to a single track, not a profile, album or playlist."
+		class = "toast-error"
+	case "badattachment":
+		html = "Your attachment must be a full http or https address."
+		class = "toast-error"
+	case "attachmenthost":
+		html = "Attachments must be linked from a supported file host like Google Drive, Dropbox or Mega."
+		class = "toast-error"
+	case "uploadsize":
+		html = "That file is too big. Uploads can be up to 25MB as MP3, 100MB as FLAC or 150MB as WAV."
+		class = "toast-error"
+	case "badaudio":
+		html = "Uploads must be MP3, WAV or FLAC audio."
+		class = "toast-error"
+	case "noupload":
+		html = "This battle doesn't accept uploads. Link your entry instead."
+		class = "toast-error"
+	case "notracks":
+		html = "Link your track or upload it as MP3, WAV or FLAC."
+		class = "toast-error"
+	case "badlength":
+		html = "Lengths must be written like 2:30, and the minimum can't be longer than the maximum."
+		class = "toast-error"
+	case "tooshort":
+		html = "Your track is shorter than this battle allows."
+		class = "toast-error"
+	case "toolong":
+		html = "Your track is longer than this battle allows."
+		class = "toast-error"
+	case "noentries":
+		html = "There aren't any entries to download yet."
+		class = "toast-error"
+	case "tracksites":
+		html = "One of those track sites isn't supported for this battle type."
+		class = "toast-error"
 	case "cache":
 	case "cachesave":
 		html = "If this happens again, try clearing your cache."
@@ -74,6 +158,9 @@ func GetToast(c echo.Context) [2]string {
 	case "invalidtype":
 		html = "That is not a valid battle type."
 		class = "toast-error"
+	case "invalidstatus":
+		html = "The battle can't be moved to that status."
+		class = "toast-error"
 	case "liked":
 		html = "Submission loved."
 		class = "toast-success"
@@ -86,6 +173,39 @@ func GetToast(c echo.Context) [2]string {
 	case "successdelvote":
 		html = "Vote successfully removed."
 		class = "toast-success"
+	case "successballot":
+		html = "Ballot saved."
+		class = "toast-success"
+	case "successscore":
+		html = "Score saved."
+		class = "toast-success"
+	case "judgeinvited":
+		html = "Judge invited."
+		class = "toast-success"
+	case "judgeremoved":
+		html = "Judge removed."
+		class = "toast-success"
+	case "judgeaccepted":
+		html = "You're judging this battle."
+		class = "toast-success"
+	case "judgedeclined":
+		html = "Invitation declined."
+		class = "toast-success"
+	case "memberinvited":
+		html = "Team member invited."
+		class = "toast-success"
+	case "memberremoved":
+		html = "Team member removed."
+		class = "toast-success"
+	case "memberaccepted":
+		html = "You've joined the team."
+		class = "toast-success"
+	case "memberdeclined":
+		html = "Invitation declined."
+		class = "toast-success"
+	case "teamleft":
+		html = "You've left the team."
+		class = "toast-success"
 	case "successdel":
 		html = "Successfully deleted."
 		class = "toast-success"
@@ -119,6 +239,54 @@ func GetToast(c echo.Context) [2]string {
 	case "placement":
 		html = "Changed placement."
 		class = "toast-success"
+	case "seriesadded":
+		html = "Series started."
+		class = "toast-success"
+	case "seasonadded":
+		html = "Season added."
+		class = "toast-success"
+	case "noseason":
+		html = "Pick one of this series' seasons."
+		class = "toast-error"
+	case "noseriesbattle":
+		html = "Put a battle in this series first, its settings are copied to the next one."
+		class = "toast-error"
+	case "notinmatch":
+		html = "Only this match's players can enter."
+		class = "toast-error"
+	case "signupsclosed":
+		html = "Signups for this tournament are closed."
+		class = "toast-error"
+	case "tournamentfull":
+		html = "This tournament is full."
+		class = "toast-error"
+	case "tournamentjoined":
+		html = "You're signed up."
+		class = "toast-success"
+	case "tournamentleft":
+		html = "You're no longer signed up."
+		class = "toast-success"
+	case "fewentrants":
+		html = "A tournament needs at least 2 entrants to start."
+		class = "toast-error"
+	case "tournamentstarted":
+		html = "Tournament started, the first matches are open."
+		class = "toast-success"
+	case "matchlocked":
+		html = "A later match depending on this one has already been decided."
+		class = "toast-error"
+	case "scheduleadded":
+		html = "Schedule set up, its battles will open automatically."
+		class = "toast-success"
+	case "scheduledeleted":
+		html = "Schedule deleted."
+		class = "toast-success"
+	case "templatesaved":
+		html = "Template saved."
+		class = "toast-success"
+	case "templatedeleted":
+		html = "Template deleted."
+		class = "toast-success"
 	}
 
 	sess.Values["error"] = ""
@@ -131,34 +299,13 @@ func GetToast(c echo.Context) [2]string {
 	return [2]string{}
 }
 
-// GetAdvertisements returns an array of the current active ads.
+// GetAdvertisements returns a random active ad.
 // TODO - Can store this in cache?
-func GetAdvertisements() Advertisement {
-	query := `SELECT id, url, image FROM ads WHERE active = 1`
-
-	rows, err := dbRead.Query(query)
+func (app *App) GetAdvertisements() Advertisement {
+	advertisements, err := app.Ads.Active()
 	if err != nil {
-		return Advertisement{}
-	}
-	defer rows.Close()
-
-	advertisement := Advertisement{}
-	advertisements := []Advertisement{}
-	for rows.Next() {
-		err = rows.Scan(&advertisement.ID, &advertisement.URL, &advertisement.Image)
-		if err != nil {
-			return Advertisement{}
-		}
-
-		advertisements = append(advertisements, advertisement)
-	}
-
-	// Reference: http://go-database-sql.org/errors.html - I'm not really sure if this does anything positive lmao.
-	if err = rows.Err(); err != nil {
-		log.Println(err)
-	}
-	if err = rows.Close(); err != nil {
 		log.Println(err)
+		return Advertisement{}
 	}
 
 	if len(advertisements) > 0 {
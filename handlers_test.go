@@ -0,0 +1,445 @@
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+)
+
+// testApp builds an App on the in-memory stores, with its sessions and uploads kept to the test.
+func testApp(t *testing.T) *App {
+	t.Helper()
+	gob.Register(User{})
+	store = sessions.NewCookieStore([]byte("beatbattle-test-authentication!!"))
+
+	app := NewApp(NewMemoryStores())
+	app.Files = NewLocalStorage(t.TempDir())
+	return app
+}
+
+// testUser adds a user and returns them logged in.
+func testUser(t *testing.T, app *App, name string) User {
+	t.Helper()
+	user := User{Name: name, Provider: "discord", AccessToken: "token-" + name, ExpiresAt: time.Now().Add(time.Hour)}
+	id, err := app.Users.Insert(user, HashAndSalt([]byte(user.AccessToken)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.ID = id
+	user.Authenticated = true
+	return user
+}
+
+// testBattle adds a battle hosted by host in the given status, with deadlines to match.
+func testBattle(t *testing.T, app *App, host User, status BattleStatus) Battle {
+	t.Helper()
+	battle := Battle{
+		Title:          "Test Battle",
+		Rules:          "Flip the sample.",
+		Host:           host,
+		Type:           "beat",
+		Status:         status,
+		MaxVotes:       1,
+		Deadline:       time.Now().Add(time.Hour),
+		VotingDeadline: time.Now().Add(2 * time.Hour),
+	}
+	if status == StatusVoting {
+		battle.Deadline = time.Now().Add(-time.Hour)
+	}
+
+	var err error
+	battle.ID, err = app.Battles.Insert(battle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return battle
+}
+
+// testEntry enters a linked track into a battle for user.
+func testEntry(t *testing.T, app *App, battle Battle, user User) Beat {
+	t.Helper()
+	beat := Beat{BattleID: battle.ID, Artist: user, URL: "https://soundcloud.com/" + strings.ToLower(user.Name) + "/entry"}
+
+	var err error
+	beat.ID, err = app.Beats.Insert(beat)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return beat
+}
+
+// testRequest calls a handler as user, who may be a zero User to call it logged out.
+// params are the route's parameters as name, value pairs.
+func testRequest(t *testing.T, handler echo.HandlerFunc, user User, method string, target string, form url.Values, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+	if form != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	}
+	return serveRequest(t, handler, user, req, params...)
+}
+
+// serveRequest calls a handler with req as user, like testRequest, for requests it can't build.
+func serveRequest(t *testing.T, handler echo.HandlerFunc, user User, req *http.Request, params ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	if user.ID != 0 {
+		login := httptest.NewRecorder()
+		sess, _ := store.Get(req, "beatbattleapp")
+		sess.Values["user"] = user
+		err := sess.Save(req, login)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cookie := range login.Result().Cookies() {
+			req.AddCookie(cookie)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+	names, values := []string{}, []string{}
+	for i := 0; i+1 < len(params); i += 2 {
+		names = append(names, params[i])
+		values = append(values, params[i+1])
+	}
+	c.SetParamNames(names...)
+	c.SetParamValues(values...)
+
+	err := handler(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+// ajaxToast is the toast an AjaxResponse asked for.
+func ajaxToast(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	data := struct{ ToastQuery string }{}
+	err := json.Unmarshal(rec.Body.Bytes(), &data)
+	if err != nil {
+		t.Fatalf("%v: %s", err, rec.Body.String())
+	}
+	return data.ToastQuery
+}
+
+// redirectToast is the toast a redirecting handler set in the session.
+func redirectToast(t *testing.T, rec *httptest.ResponseRecorder) string {
+	t.Helper()
+	// The session is saved each time it changes, so the last cookie is the one the browser keeps.
+	var session *http.Cookie
+	for _, cookie := range rec.Result().Cookies() {
+		if cookie.Name == "beatbattleapp" {
+			session = cookie
+		}
+	}
+	if session == nil {
+		return ""
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(session)
+	sess, _ := store.Get(req, "beatbattleapp")
+	toast, _ := sess.Values["error"].(string)
+	return toast
+}
+
+func TestInsertBattle(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	deadline := time.Now().Add(24 * time.Hour).UTC()
+	form := url.Values{
+		"title":               {"Sample Flip"},
+		"rules":               {"Flip the sample."},
+		"type":                {"beat"},
+		"timezone":            {"UTC"},
+		"deadline-date":       {deadline.Format("Jan 2, 2006")},
+		"deadline-time":       {deadline.Format("03:04 PM")},
+		"votingdeadline-date": {deadline.Add(24 * time.Hour).Format("Jan 2, 2006")},
+		"votingdeadline-time": {deadline.Format("03:04 PM")},
+		"maxvotes":            {"2"},
+		"tags":                {"Lofi, drill"},
+		"max_length":          {"2:30"},
+	}
+
+	rec := testRequest(t, app.InsertBattle, User{}, http.MethodPost, "/battle/submit", form)
+	if toast := ajaxToast(t, rec); toast != "noauth" {
+		t.Fatalf("logged out toast = %q, want noauth", toast)
+	}
+
+	rec = testRequest(t, app.InsertBattle, host, http.MethodPost, "/battle/submit", form)
+	if toast := ajaxToast(t, rec); toast != "successadd" {
+		t.Fatalf("toast = %q, want successadd", toast)
+	}
+
+	battles, err := app.Battles.List(BattleQuery{HostID: host.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(battles) != 1 {
+		t.Fatalf("host has %d battles, want 1", len(battles))
+	}
+	battle, err := app.Battles.Get(battles[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if battle.Title != "Sample Flip" || battle.Status != StatusEntry || battle.MaxVotes != 2 || battle.Length.Max != 150 {
+		t.Errorf("battle = %+v", battle)
+	}
+	if strings.Join(battle.Tags, ",") != "lofi,drill" {
+		t.Errorf("tags = %v, want [lofi drill]", battle.Tags)
+	}
+
+	transitions, err := app.Battles.Transitions(battle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transitions) != 1 || transitions[0].To != StatusEntry {
+		t.Errorf("transitions = %+v, want one into entry", transitions)
+	}
+
+	form.Set("votingdeadline-date", deadline.Add(-48*time.Hour).Format("Jan 2, 2006"))
+	rec = testRequest(t, app.InsertBattle, host, http.MethodPost, "/battle/submit", form)
+	if toast := ajaxToast(t, rec); toast != "voteb4" {
+		t.Fatalf("voting before the deadline toast = %q, want voteb4", toast)
+	}
+}
+
+func TestAddVote(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	bob := testUser(t, app, "Bob")
+	battle := testBattle(t, app, host, StatusVoting)
+	aliceBeat := testEntry(t, app, battle, alice)
+	bobBeat := testEntry(t, app, battle, bob)
+
+	vote := func(voter User, beat Beat) string {
+		form := url.Values{
+			"beatID":   {strconv.Itoa(beat.ID)},
+			"battleID": {strconv.Itoa(battle.ID)},
+			"userID":   {strconv.Itoa(beat.Artist.ID)},
+		}
+		return ajaxToast(t, testRequest(t, app.AddVote, voter, http.MethodPost, "/feedback", form))
+	}
+
+	if toast := vote(alice, aliceBeat); toast != "owntrack" {
+		t.Errorf("voting for your own entry toast = %q, want owntrack", toast)
+	}
+	if toast := vote(alice, bobBeat); toast != "successvote" {
+		t.Fatalf("toast = %q, want successvote", toast)
+	}
+	votes, err := app.Votes.UserVotes(battle.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 1 || votes[0] != bobBeat.ID {
+		t.Fatalf("votes = %v, want [%d]", votes, bobBeat.ID)
+	}
+
+	if toast := vote(alice, bobBeat); toast != "successdelvote" {
+		t.Errorf("voting again toast = %q, want successdelvote", toast)
+	}
+	votes, err = app.Votes.UserVotes(battle.ID, alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(votes) != 0 {
+		t.Errorf("votes after withdrawing = %v, want none", votes)
+	}
+
+	entry := testBattle(t, app, host, StatusEntry)
+	entryBeat := testEntry(t, app, entry, bob)
+	form := url.Values{"beatID": {strconv.Itoa(entryBeat.ID)}, "battleID": {strconv.Itoa(entry.ID)}, "userID": {strconv.Itoa(bob.ID)}}
+	if toast := ajaxToast(t, testRequest(t, app.AddVote, alice, http.MethodPost, "/feedback", form)); toast != "302" {
+		t.Errorf("voting before voting opens toast = %q, want 302", toast)
+	}
+}
+
+func TestAddVoteVotingModes(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	bob := testUser(t, app, "Bob")
+
+	for mode, want := range map[VotingMode]string{VotingRanked: "rankedonly", VotingScore: "scoreonly"} {
+		battle := testBattle(t, app, host, StatusVoting)
+		battle.VotingMode = mode
+		err := app.Battles.Update(battle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		beat := testEntry(t, app, battle, bob)
+
+		form := url.Values{"beatID": {strconv.Itoa(beat.ID)}, "battleID": {strconv.Itoa(battle.ID)}, "userID": {strconv.Itoa(bob.ID)}}
+		if toast := ajaxToast(t, testRequest(t, app.AddVote, alice, http.MethodPost, "/feedback", form)); toast != want {
+			t.Errorf("%s battle toast = %q, want %q", mode, toast, want)
+		}
+		votes, err := app.Votes.UserVotes(battle.ID, alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(votes) != 0 {
+			t.Errorf("%s battle took approval votes %v", mode, votes)
+		}
+	}
+}
+
+func TestDeleteBeat(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	battle := testBattle(t, app, host, StatusEntry)
+	testEntry(t, app, battle, alice)
+
+	rec := testRequest(t, app.DeleteBeat, alice, http.MethodPost, "/beat/delete", nil, "id", strconv.Itoa(battle.ID))
+	if rec.Code != http.StatusFound || redirectToast(t, rec) != "successdel" {
+		t.Fatalf("code = %d, toast = %q", rec.Code, redirectToast(t, rec))
+	}
+	_, err := app.Beats.GetByUser(battle.ID, alice.ID)
+	if err != ErrNotFound {
+		t.Errorf("entry after deleting: err = %v, want ErrNotFound", err)
+	}
+}
+
+// TestEntriesClosed refuses entries and updates once a battle's entries close.
+func TestEntriesClosed(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	battle := testBattle(t, app, host, StatusVoting)
+	form := url.Values{"link": {"https://soundcloud.com/alice/late"}}
+
+	rec := testRequest(t, app.InsertBeat, alice, http.MethodPost, "/beat/submit", form, "id", strconv.Itoa(battle.ID))
+	if toast := redirectToast(t, rec); toast != "notopen" {
+		t.Errorf("entering a closed battle: toast = %q, want notopen", toast)
+	}
+	_, err := app.Beats.GetByUser(battle.ID, alice.ID)
+	if err != ErrNotFound {
+		t.Errorf("entry in a closed battle: err = %v, want ErrNotFound", err)
+	}
+
+	testEntry(t, app, battle, alice)
+	rec = testRequest(t, app.UpdateBeat, alice, http.MethodPost, "/beat/update", form, "id", strconv.Itoa(battle.ID))
+	if toast := redirectToast(t, rec); toast != "notopen" {
+		t.Errorf("updating in a closed battle: toast = %q, want notopen", toast)
+	}
+}
+
+func TestBattlesJSONTag(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	for _, status := range []BattleStatus{StatusDraft, StatusEntry, StatusComplete} {
+		battle := testBattle(t, app, host, status)
+		err := app.Battles.SetTags(battle.ID, []string{"lofi"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rec := testRequest(t, app.BattlesJSON, User{}, http.MethodGet, "/api/battles?list=tag", nil)
+	if rec.Code != http.StatusBadRequest {
+		t.Errorf("without a tag code = %d, want 400", rec.Code)
+	}
+
+	rec = testRequest(t, app.BattlesJSON, User{}, http.MethodGet, "/api/battles?list=tag&tag=lofi", nil)
+	page := BattlePage{}
+	err := json.Unmarshal(rec.Body.Bytes(), &page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Battles) != 2 {
+		t.Fatalf("got %d battles, want the entry and complete ones", len(page.Battles))
+	}
+	for _, battle := range page.Battles {
+		if battle.Status == StatusDraft {
+			t.Errorf("draft battle %d listed under its tag", battle.ID)
+		}
+	}
+}
+
+func TestBattlesJSONUser(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	testBattle(t, app, host, StatusDraft)
+	public := testBattle(t, app, host, StatusEntry)
+	private := Battle{Title: "Private Battle", Host: host, Type: "beat", Status: StatusEntry, Deadline: time.Now().Add(time.Hour), VotingDeadline: time.Now().Add(2 * time.Hour)}
+	settingsID, err := app.Battles.SaveSettings(BattleSettings{Private: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	private.Settings.ID = settingsID
+	_, err = app.Battles.Insert(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	target := "/api/battles?list=user&user=" + strconv.Itoa(host.ID)
+	for _, viewer := range []struct {
+		name  string
+		user  User
+		count int
+	}{{"logged out", User{}, 1}, {"alice", alice, 1}, {"host", host, 3}} {
+		rec := testRequest(t, app.BattlesJSON, viewer.user, http.MethodGet, target, nil)
+		page := BattlePage{}
+		err = json.Unmarshal(rec.Body.Bytes(), &page)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Battles) != viewer.count {
+			t.Errorf("%s sees %d of the host's battles, want %d", viewer.name, len(page.Battles), viewer.count)
+		}
+		if viewer.count == 1 && len(page.Battles) == 1 && page.Battles[0].ID != public.ID {
+			t.Errorf("%s sees battle %d, want the public one (%d)", viewer.name, page.Battles[0].ID, public.ID)
+		}
+	}
+}
+
+// TestUpdateBattleVotingFixed keeps how votes are counted once a battle is in voting.
+func TestUpdateBattleVotingFixed(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	battle := testBattle(t, app, host, StatusVoting)
+	battle.VotingMode = VotingScore
+	err := app.Battles.Update(battle)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deadline, votingDeadline := battle.Deadline.UTC(), battle.VotingDeadline.UTC()
+	form := url.Values{
+		"title":               {"Test Battle"},
+		"rules":               {"Flip the sample."},
+		"type":                {"beat"},
+		"timezone":            {"UTC"},
+		"deadline-date":       {deadline.Format("Jan 2, 2006")},
+		"deadline-time":       {deadline.Format("03:04 PM")},
+		"votingdeadline-date": {votingDeadline.Format("Jan 2, 2006")},
+		"votingdeadline-time": {votingDeadline.Format("03:04 PM")},
+		"maxvotes":            {"1"},
+		"voting_mode":         {string(VotingApproval)},
+		"trim_scores":         {"1"},
+	}
+	rec := testRequest(t, app.UpdateBattleDB, host, http.MethodPost, "/battle/update", form, "id", strconv.Itoa(battle.ID))
+	if toast := redirectToast(t, rec); toast != "successupdate" {
+		t.Fatalf("toast = %q, want successupdate", toast)
+	}
+
+	updated, err := app.Battles.Get(battle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Status != StatusVoting || updated.VotingMode != VotingScore || updated.TrimScores {
+		t.Errorf("battle in voting became %s, %s voting, trimming scores %t; want voting with untrimmed scores", updated.Status, updated.VotingMode, updated.TrimScores)
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JudgeStatus is where a judging invitation stands.
+type JudgeStatus string
+
+// Judge statuses. Only accepted judges' votes count as judge votes.
+const (
+	JudgeInvited  JudgeStatus = "invited"
+	JudgeAccepted JudgeStatus = "accepted"
+	JudgeDeclined JudgeStatus = "declined"
+)
+
+// Judge is a user invited to judge a battle. Finished is set once an accepted judge has cast every vote they can.
+type Judge struct {
+	User      User
+	Status    JudgeStatus
+	InvitedAt time.Time
+	Finished  bool
+}
+
+// JudgeTally is an entry's share of the judge vote and of the public vote, each from 0 to 1, and their blend.
+type JudgeTally struct {
+	BeatID int
+	Judges float64
+	Public float64
+	Score  float64
+}
+
+// TallyRow is an entry's line in a complete judged battle's tallies.
+type TallyRow struct {
+	Artist    User
+	Placement int
+	Judges    string
+	Public    string
+	Score     string
+}
+
+// ParseJudgeWeight reads the judges' share of the result from a battle form, as a percentage.
+func ParseJudgeWeight(value string) int {
+	weight, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || weight < 0 {
+		return 0
+	}
+	if weight > 100 {
+		return 100
+	}
+	return weight
+}
+
+// acceptedJudges returns the IDs of the users who accepted an invitation to judge a battle.
+func (app *App) acceptedJudges(battleID int) (map[int]bool, error) {
+	judges, err := app.Judges.List(battleID)
+	if err != nil {
+		return nil, err
+	}
+
+	accepted := map[int]bool{}
+	for _, judge := range judges {
+		if judge.Status == JudgeAccepted {
+			accepted[judge.User.ID] = true
+		}
+	}
+
+	return accepted, nil
+}
+
+// judgedResults re-places a judged battle's entries by blending the judges' votes with the public's,
+// and saves both tallies. If only one side voted, that side decides. Entries stay disqualified as the
+// voting mode left them.
+func (app *App) judgedResults(battle Battle, beats []Beat, results []BeatResult) ([]BeatResult, error) {
+	accepted, err := app.acceptedJudges(battle.ID)
+	if err != nil || len(accepted) == 0 {
+		return results, err
+	}
+
+	var judges, public map[int]float64
+	switch battle.VotingMode {
+	case VotingRanked:
+		judges, public, err = app.rankedTallies(battle.ID, beats, results, accepted)
+	case VotingScore:
+		judges, public, err = app.scoreTallies(battle, accepted)
+	default:
+		judges, public, err = app.approvalTallies(battle.ID, accepted)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	weight := float64(battle.JudgeWeight) / 100
+	if judges == nil {
+		weight = 0
+	} else if public == nil {
+		weight = 1
+	}
+
+	tallies := []JudgeTally{}
+	blended := map[int]float64{}
+	for _, beat := range beats {
+		tally := JudgeTally{BeatID: beat.ID, Judges: judges[beat.ID], Public: public[beat.ID]}
+		tally.Score = weight*tally.Judges + (1-weight)*tally.Public
+		blended[beat.ID] = tally.Score
+		tallies = append(tallies, tally)
+	}
+
+	err = app.Results.SaveTallies(battle.ID, tallies)
+	if err != nil {
+		return nil, err
+	}
+
+	return app.placeResults(battle, beats, results, blended)
+}
+
+// approvalTallies splits an approval battle's votes between judges and the public. An entry's
+// tally is the share of that side's voters who voted for it. A side that didn't vote gets nil.
+func (app *App) approvalTallies(battleID int, accepted map[int]bool) (map[int]float64, map[int]float64, error) {
+	voters, err := app.Votes.Voters(battleID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts := map[bool]map[int]int{true: {}, false: {}}
+	totals := map[bool]int{}
+	for userID, beatIDs := range voters {
+		judge := accepted[userID]
+		totals[judge]++
+		for _, beatID := range beatIDs {
+			counts[judge][beatID]++
+		}
+	}
+
+	tallies := map[bool]map[int]float64{}
+	for _, judge := range []bool{true, false} {
+		if totals[judge] == 0 {
+			continue
+		}
+		tallies[judge] = map[int]float64{}
+		for beatID, count := range counts[judge] {
+			tallies[judge][beatID] = float64(count) / float64(totals[judge])
+		}
+	}
+
+	return tallies[true], tallies[false], nil
+}
+
+// rankedTallies runs a separate instant runoff for the judges' ballots and the public's between the
+// qualified entries. An entry's tally runs from 1 for the winner down to 0 for last place.
+func (app *App) rankedTallies(battleID int, beats []Beat, results []BeatResult, accepted map[int]bool) (map[int]float64, map[int]float64, error) {
+	ballots, err := app.Votes.Ballots(battleID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	qualified := map[int]bool{}
+	for _, result := range results {
+		qualified[result.BeatID] = result.Voted
+	}
+	candidates := []int{}
+	for _, beat := range beats {
+		if qualified[beat.ID] {
+			candidates = append(candidates, beat.ID)
+		}
+	}
+
+	voters := []int{}
+	for userID := range ballots {
+		voters = append(voters, userID)
+	}
+	sort.Ints(voters)
+
+	tallies := map[bool]map[int]float64{}
+	for _, judge := range []bool{true, false} {
+		ranked := [][]int{}
+		for _, userID := range voters {
+			if accepted[userID] == judge && len(ballots[userID]) > 0 {
+				ranked = append(ranked, ballots[userID])
+			}
+		}
+		if len(ranked) == 0 {
+			continue
+		}
+
+		order, _ := InstantRunoff(candidates, ranked)
+		tallies[judge] = map[int]float64{}
+		for i, beatID := range order {
+			tallies[judge][beatID] = 1
+			if len(order) > 1 {
+				tallies[judge][beatID] = float64(len(order)-1-i) / float64(len(order)-1)
+			}
+		}
+	}
+
+	return tallies[true], tallies[false], nil
+}
+
+// scoreTallies takes the judges' and the public's weighted mean scores separately, out of the top score.
+func (app *App) scoreTallies(battle Battle, accepted map[int]bool) (map[int]float64, map[int]float64, error) {
+	criteria, err := app.Battles.Criteria(battle.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	scores, err := app.Votes.Scores(battle.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	split := map[bool][]Score{}
+	for _, score := range scores {
+		split[accepted[score.UserID]] = append(split[accepted[score.UserID]], score)
+	}
+
+	tallies := map[bool]map[int]float64{}
+	for _, judge := range []bool{true, false} {
+		if len(split[judge]) == 0 {
+			continue
+		}
+		tallies[judge] = map[int]float64{}
+		for beatID, score := range WeightedScores(criteria, MeanScores(split[judge], battle.TrimScores)) {
+			tallies[judge][beatID] = score / maxScore
+		}
+	}
+
+	return tallies[true], tallies[false], nil
+}
+
+// BattleJudges returns a battle's judges, marking the accepted judges who've cast every vote they can.
+func (app *App) BattleJudges(battle Battle, beats []Beat) []Judge {
+	judges, err := app.Judges.List(battle.ID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+	if len(judges) == 0 || battle.Status == StatusDraft || battle.Status == StatusEntry {
+		return judges
+	}
+
+	cast, err := app.votesCast(battle)
+	if err != nil {
+		log.Println(err)
+		return judges
+	}
+
+	credits, err := app.teamCredits(battle.ID)
+	if err != nil {
+		log.Println(err)
+		return judges
+	}
+
+	for i, judge := range judges {
+		if judge.Status != JudgeAccepted {
+			continue
+		}
+
+		// Judges can't vote for an entry they're credited on.
+		eligible := 0
+		for _, beat := range beats {
+			if beat.Artist.ID != judge.User.ID && !credits[beat.ID][judge.User.ID] {
+				eligible++
+			}
+		}
+
+		// Score battles need every entry scored. Otherwise a judge is done at the battle's max votes.
+		needed := eligible
+		if battle.VotingMode != VotingScore && battle.MaxVotes < needed {
+			needed = battle.MaxVotes
+		}
+		judges[i].Finished = needed > 0 && cast[judge.User.ID] >= needed
+	}
+
+	return judges
+}
+
+// BattleTallies returns a complete judged battle's judge & public tallies in placement order.
+func (app *App) BattleTallies(battleID int, beats []Beat) []TallyRow {
+	tallies, err := app.Results.Tallies(battleID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	beatTallies := map[int]JudgeTally{}
+	for _, tally := range tallies {
+		beatTallies[tally.BeatID] = tally
+	}
+	if len(beatTallies) == 0 {
+		return nil
+	}
+
+	placed := append([]Beat(nil), beats...)
+	sort.SliceStable(placed, func(i, j int) bool {
+		a, b := placed[i].Placement, placed[j].Placement
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+
+	rows := []TallyRow{}
+	for _, beat := range placed {
+		tally := beatTallies[beat.ID]
+		rows = append(rows, TallyRow{
+			Artist:    beat.Artist,
+			Placement: beat.Placement,
+			Judges:    strconv.FormatFloat(tally.Judges*100, 'f', 1, 64) + "%",
+			Public:    strconv.FormatFloat(tally.Public*100, 'f', 1, 64) + "%",
+			Score:     strconv.FormatFloat(tally.Score*100, 'f', 1, 64) + "%",
+		})
+	}
+
+	return rows
+}
+
+// judgeBattle loads the battle a judging form was posted to, setting a toast when it can't be used.
+func (app *App) judgeBattle(c echo.Context) (Battle, bool) {
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return Battle{}, false
+	}
+
+	battle := app.GetBattle(battleID)
+	if battle.Title == "" {
+		SetToast(c, "404")
+		return battle, false
+	}
+
+	if battle.Status == StatusComplete {
+		SetToast(c, "judgingclosed")
+		return battle, false
+	}
+
+	return battle, true
+}
+
+// InviteJudge - Lets a battle's host invite a user to judge it, by profile link or user ID.
+func (app *App) InviteJudge(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battle, ok := app.judgeBattle(c)
+	if !ok {
+		return c.Redirect(302, "/battle/"+c.Param("id"))
+	}
+	redirectURL := "/battle/" + strconv.Itoa(battle.ID)
+
+	if battle.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	// Take the last part of a link like https://beatbattle.app/user/12.
+	user := strings.TrimRight(strings.TrimSpace(c.FormValue("user")), "/")
+	userID, err := strconv.Atoi(user[strings.LastIndex(user, "/")+1:])
+	if err != nil {
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	_, err = app.Users.Get(userID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err = app.Judges.Invite(battle.ID, userID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "judgeinvited")
+	return c.Redirect(302, redirectURL)
+}
+
+// RemoveJudge - Lets a battle's host take back a judge's invitation.
+func (app *App) RemoveJudge(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battle, ok := app.judgeBattle(c)
+	if !ok {
+		return c.Redirect(302, "/battle/"+c.Param("id"))
+	}
+	redirectURL := "/battle/" + strconv.Itoa(battle.ID)
+
+	if battle.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	userID, err := strconv.Atoi(c.FormValue("userID"))
+	if err != nil {
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err = app.Judges.Remove(battle.ID, userID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "judgeremoved")
+	return c.Redirect(302, redirectURL)
+}
+
+// RespondJudge - Accepts or declines the logged in user's invitation to judge a battle.
+func (app *App) RespondJudge(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battle, ok := app.judgeBattle(c)
+	if !ok {
+		return c.Redirect(302, "/battle/"+c.Param("id"))
+	}
+	redirectURL := "/battle/" + strconv.Itoa(battle.ID)
+
+	status, toast := JudgeAccepted, "judgeaccepted"
+	if c.FormValue("response") == "decline" {
+		status, toast = JudgeDeclined, "judgedeclined"
+	}
+
+	err := app.Judges.Respond(battle.ID, me.ID, status)
+	if err == ErrNotFound {
+		SetToast(c, "notinvited")
+		return c.Redirect(302, redirectURL)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, toast)
+	return c.Redirect(302, redirectURL)
+}
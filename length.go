@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TrackLength is a track's length in seconds, written m:ss.
+type TrackLength int
+
+func (length TrackLength) String() string {
+	if length <= 0 {
+		return ""
+	}
+	seconds := strconv.Itoa(int(length % 60))
+	if len(seconds) == 1 {
+		seconds = "0" + seconds
+	}
+	return strconv.Itoa(int(length/60)) + ":" + seconds
+}
+
+// ParseTrackLength reads a length written m:ss or in whole minutes. Blank is no length.
+func ParseTrackLength(text string) (TrackLength, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return 0, true
+	}
+
+	minutes, seconds, hasSeconds := strings.Cut(text, ":")
+	m, err := strconv.Atoi(minutes)
+	if err != nil || m < 0 || m > 999 {
+		return 0, false
+	}
+	s := 0
+	if hasSeconds {
+		s, err = strconv.Atoi(seconds)
+		if err != nil || len(seconds) != 2 || s < 0 || s > 59 {
+			return 0, false
+		}
+	}
+	return TrackLength(m*60 + s), true
+}
+
+// LengthLimits are the shortest and longest entries a battle accepts. Zero is no limit.
+type LengthLimits struct {
+	Min TrackLength `gorm:"column:min_length" json:"min_length"`
+	Max TrackLength `gorm:"column:max_length" json:"max_length"`
+}
+
+// String describes the limits for the battle's header, like "1:00 - 2:00" or "Max 2:00".
+func (limits LengthLimits) String() string {
+	switch {
+	case limits.Min > 0 && limits.Max > 0:
+		return limits.Min.String() + " - " + limits.Max.String()
+	case limits.Max > 0:
+		return "Max " + limits.Max.String()
+	case limits.Min > 0:
+		return "Min " + limits.Min.String()
+	}
+	return ""
+}
+
+// Unverified reports whether an entry's audio couldn't be checked against the limits.
+func (limits LengthLimits) Unverified(info AudioInfo) bool {
+	return (limits.Min > 0 || limits.Max > 0) && !info.Analysed()
+}
+
+// ParseLengthLimits reads a battle form's length limits. It returns the toast for limits that can't be used.
+func ParseLengthLimits(c echo.Context) (LengthLimits, string) {
+	min, ok := ParseTrackLength(c.FormValue("min_length"))
+	if !ok {
+		return LengthLimits{}, "badlength"
+	}
+	max, ok := ParseTrackLength(c.FormValue("max_length"))
+	if !ok || (max > 0 && min > max) {
+		return LengthLimits{}, "badlength"
+	}
+	return LengthLimits{Min: min, Max: max}, ""
+}
+
+// Check returns the toast for an entry's audio the limits don't allow, or "" if it's fine.
+// Audio that couldn't be analysed, like a link to a site that doesn't allow downloads, can't be checked,
+// so it's let in and shown as unverified.
+func (limits LengthLimits) Check(info AudioInfo) string {
+	if (limits.Min == 0 && limits.Max == 0) || !info.Analysed() {
+		return ""
+	}
+
+	length := TrackLength((info.Duration + 500) / 1000)
+	if limits.Min > 0 && length < limits.Min {
+		return "tooshort"
+	}
+	if limits.Max > 0 && length > limits.Max {
+		return "toolong"
+	}
+	return ""
+}
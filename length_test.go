@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestLengthLimitsCheck(t *testing.T) {
+	limits := LengthLimits{Min: 60, Max: 120}
+	tests := []struct {
+		limits     LengthLimits
+		info       AudioInfo
+		toast      string
+		unverified bool
+	}{
+		{LengthLimits{}, AudioInfo{}, "", false},
+		{LengthLimits{}, AudioInfo{Duration: 5000}, "", false},
+		{limits, AudioInfo{Duration: 90000}, "", false},
+		// Lengths are rounded to the second before they're checked.
+		{limits, AudioInfo{Duration: 59500}, "", false},
+		{limits, AudioInfo{Duration: 59499}, "tooshort", false},
+		{limits, AudioInfo{Duration: 120499}, "", false},
+		{limits, AudioInfo{Duration: 120500}, "toolong", false},
+		{LengthLimits{Max: 120}, AudioInfo{Duration: 1000}, "", false},
+		{LengthLimits{Min: 60}, AudioInfo{Duration: 600000}, "", false},
+		// Links whose audio can't be analysed are let in unverified.
+		{limits, AudioInfo{}, "", true},
+		{LengthLimits{Max: 120}, AudioInfo{}, "", true},
+	}
+	for _, test := range tests {
+		if toast := test.limits.Check(test.info); toast != test.toast {
+			t.Errorf("%+v.Check(%dms) = %q, want %q", test.limits, test.info.Duration, toast, test.toast)
+		}
+		if unverified := test.limits.Unverified(test.info); unverified != test.unverified {
+			t.Errorf("%+v.Unverified(%dms) = %t, want %t", test.limits, test.info.Duration, unverified, test.unverified)
+		}
+	}
+}
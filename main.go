@@ -1,7 +1,6 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/gob"
 	"fmt"
 	"html/template"
@@ -23,7 +22,6 @@ import (
 	"github.com/markbates/goth/providers/twitch"
 	"github.com/microcosm-cc/bluemonday"
 
-	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 )
 
@@ -39,10 +37,8 @@ var redditAuth *reddit.Authenticator
 
 var policy *bluemonday.Policy
 
-var whitelist []string
 var state string
 var analyticsKey string
-var dbWrite, dbRead *sql.DB
 var e *echo.Echo
 
 /*-------
@@ -50,8 +46,6 @@ Help Actions
 --------*/
 
 func init() {
-	// TODO - BREAK WHITELIST UP INTO TWO (TRACK WHITELIST, ATTACHMENT WHITELIST)
-	whitelist = []string{"audius.co", "archive.org", "f1eightco-my.sharepoint.com", "sharepoint.com", "drive.google.com", "youtube.com", "bandcamp.com", "soundcloud.com", "sellfy.com", "onedrive.com", "dropbox.com", "mega.nz", "amazon.com/clouddrive", "filetransfer.io", "wetransfer.com", "we.tt"}
 	/*
 	   Safety net for 'too many open files' issue on legacy code.
 	   Set a sane timeout duration for the http.DefaultClient, to ensure idle connections are terminated.
@@ -64,6 +58,14 @@ func init() {
 		log.Print("No .env file found")
 	}
 
+	// URL policy defaults. See urlpolicy.go.
+	if hosts := ParseHosts(os.Getenv("TRACK_HOSTS")); len(hosts) > 0 {
+		trackHosts = hosts
+	}
+	if hosts := ParseHosts(os.Getenv("ATTACHMENT_HOSTS")); len(hosts) > 0 {
+		attachmentHosts = hosts
+	}
+
 	policy = bluemonday.UGCPolicy()
 	//policy.AllowStandardURLs()
 
@@ -81,8 +83,6 @@ func init() {
 
 	gob.Register(User{})
 
-	dbRead, dbWrite = dbInit()
-
 	e = echo.New()
 
 	e.Server.WriteTimeout = 10 * time.Second
@@ -138,10 +138,10 @@ func StringWithCharset(length int, charset string) string {
 }
 
 // FrequentQuestions ...
-func FrequentQuestions(c echo.Context) error {
-	me := GetUser(c, false)
+func (app *App) FrequentQuestions(c echo.Context) error {
+	me := app.GetUser(c, false)
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 
 	m := map[string]interface{}{
 		"Meta": map[string]interface{}{
@@ -162,8 +162,35 @@ func RandString(length int) string {
 }
 
 func main() {
+	// `beatbattle.app migrate up|down|status` manages the schema instead of serving.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		RunMigrate(os.Args[2:])
+		return
+	}
+
+	dbRead, dbWrite := dbInit()
 	defer dbWrite.Close()
 	defer dbRead.Close()
+
+	// Handlers only reach the database through the app's stores.
+	app := NewApp(NewSQLStores(dbRead, dbWrite))
+	app.Files = storageInit()
+
+	// Maintenance commands run against the stores and exit.
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "tags":
+			RunTags(app, os.Args[2:])
+			return
+		case "search":
+			RunSearch(app, os.Args[2:])
+			return
+		case "ratings":
+			RunRatings(app, os.Args[2:])
+			return
+		}
+	}
+
 	// TODO - IS IT SAFE TO STORE STATE?
 	state = os.Getenv("REDDIT_STATE")
 
@@ -181,46 +208,98 @@ func main() {
 	goth.UseProviders(twitchProvider)
 
 	// Handlers for users & auth
-	e.GET("/auth/callback", Callback)
+	e.GET("/auth/callback", app.Callback)
 	e.GET("/auth", Auth)
 	e.GET("/logout/:provider", Logout)
 	e.GET("/logout", Logout)
-	e.POST("/feedback", AddFeedback)
-	e.POST("/like", AddLike)
-	e.POST("/placement", SetPlacement)
-	e.POST("/disqualify", DisqualifyBeat)
-	e.POST("/vote", AddVote)
+	e.POST("/feedback", app.AddFeedback)
+	e.POST("/like", app.AddLike)
+	e.POST("/placement", app.SetPlacement)
+	e.POST("/disqualify", app.DisqualifyBeat)
+	e.POST("/vote", app.AddVote)
+	e.POST("/ballot", app.SaveBallot)
+	e.POST("/score", app.SaveScore)
 	e.GET("/login", Login)
-	e.GET("/faq", FrequentQuestions)
+	e.GET("/faq", app.FrequentQuestions)
 
 	// Me
-	e.GET("/user/:id/submissions", UserSubmissions)
-	e.GET("/user/:id", UserBattles)
+	e.GET("/user/:id/submissions", app.UserSubmissions)
+	e.GET("/user/:id/series", app.UserSeries)
+	e.GET("/user/:id/schedules", app.UserSchedules)
+	e.GET("/user/:id/templates", app.UserTemplates)
+	e.GET("/user/:id", app.UserBattles)
 	
 	// Battles
-	e.GET("/battles/:tag", ViewTaggedBattles)
+	e.GET("/battles/:tag", app.ViewTaggedBattles)
+	e.GET("/api/battles", app.BattlesJSON)
+	e.GET("/tags", app.ViewTags)
+	e.GET("/api/tags", app.TagsJSON)
+	e.GET("/search", app.ViewSearch)
+	e.GET("/api/search", app.SearchJSON)
+	e.GET("/leaderboard", app.ViewLeaderboard)
+
+	// Series
+	e.POST("/series", app.InsertSeries)
+	e.GET("/series/:id", app.ViewSeries)
+	e.POST("/series/:id/update", app.UpdateSeries)
+	e.POST("/series/:id/seasons", app.InsertSeason)
+	e.POST("/series/:id/next", app.NextBattle)
+	e.GET("/season/:id", app.ViewSeason)
+
+	// Tournaments
+	e.GET("/tournaments", app.ViewTournaments)
+	e.POST("/tournaments", app.InsertTournament)
+	e.GET("/tournament/:id", app.ViewTournament)
+	e.POST("/tournament/:id/join", app.JoinTournament)
+	e.POST("/tournament/:id/leave", app.JoinTournament)
+	e.POST("/tournament/:id/start", app.StartTournament)
+	e.POST("/tournament/:id/override", app.OverrideMatch)
+
+	// Schedules
+	e.POST("/schedules", app.InsertSchedule)
+	e.POST("/schedule/:id/pause", app.PauseSchedule)
+	e.POST("/schedule/:id/resume", app.PauseSchedule)
+	e.POST("/schedule/:id/delete", app.DeleteSchedule)
+
+	// Templates
+	e.GET("/templates/new", app.ViewTemplate)
+	e.POST("/templates", app.InsertTemplate)
+	e.GET("/template/:id", app.ViewTemplate)
+	e.POST("/template/:id/update", app.UpdateTemplate)
+	e.POST("/template/:id/delete", app.DeleteTemplate)
 
 	// Battle
-	e.GET("/battle/:id/update/timezone/:region/:country", UpdateBattle) // Timezone
-	e.POST("/battle/:id/update", UpdateBattleDB)                        // Update in db
-	e.GET("/battle/:id/update", UpdateBattle)                           // Update page
-	e.POST("/battle/:id/delete", DeleteBattle)                  
-	e.POST("/battle/:id/close", CloseBattle)
-	e.GET("/battle/:id/feedback", ViewFeedback)
-
-	e.POST("/battle/submit", InsertBattle)
-	e.GET("/battle/submit", SubmitBattle)
-	e.GET("/battle/:id", BattleHTTP)
+	e.GET("/battle/:id/update/timezone/:region/:country", app.UpdateBattle) // Timezone
+	e.POST("/battle/:id/update", app.UpdateBattleDB)                        // Update in db
+	e.GET("/battle/:id/update", app.UpdateBattle)                           // Update page
+	e.POST("/battle/:id/delete", app.DeleteBattle)                  
+	e.POST("/battle/:id/close", app.CloseBattle)
+	e.POST("/battle/:id/template", app.InsertTemplate)
+	e.POST("/battle/:id/status", app.AdminTransitionBattle)
+	e.POST("/battle/:id/judges", app.InviteJudge)
+	e.POST("/battle/:id/judges/remove", app.RemoveJudge)
+	e.POST("/battle/:id/judge", app.RespondJudge)
+	e.GET("/battle/:id/qualification", app.QualificationJSON)
+	e.GET("/battle/:id/feedback", app.ViewFeedback)
+	e.GET("/battle/:id/audio/:beat", app.StreamBeat, LongTransfer)
+	e.GET("/battle/:id/download", app.DownloadEntries, LongTransfer)
+
+	e.POST("/battle/submit", app.InsertBattle)
+	e.GET("/battle/submit", app.SubmitBattle)
+	e.GET("/battle/:id", app.BattleHTTP)
 
 	// Beat
-	e.GET("/beat/:id/submit", SubmitBeat)
-	e.POST("/beat/:id/submit", InsertBeat)
-	e.POST("/beat/:id/update", UpdateBeat)
-	e.GET("/beat/:id/update", SubmitBeat)
-	e.GET("/beat/:id/delete", DeleteBeat)
-
-	e.GET("/past", ViewBattles)
-	e.GET("/", ViewBattles)
+	e.GET("/beat/:id/submit", app.SubmitBeat)
+	e.POST("/beat/:id/submit", app.InsertBeat, LongTransfer)
+	e.POST("/beat/:id/update", app.UpdateBeat, LongTransfer)
+	e.GET("/beat/:id/update", app.SubmitBeat)
+	e.GET("/beat/:id/delete", app.DeleteBeat)
+	e.POST("/beat/:id/members", app.InviteMember)
+	e.POST("/beat/:id/members/remove", app.RemoveMember)
+	e.POST("/beat/:id/member", app.RespondMember)
+
+	e.GET("/past", app.ViewBattles)
+	e.GET("/", app.ViewBattles)
 
 	e.GET("/request", func(c echo.Context) error {
 		req := c.Request()
@@ -236,6 +315,9 @@ func main() {
 		return c.HTML(http.StatusOK, fmt.Sprintf(format, req.Proto, req.Host, req.RemoteAddr, req.Method, req.URL.Path))
 	})
 	
+	// Battles move between stages in the background, not when a page is loaded.
+	go app.RunScheduler()
+
 	// We should try to make the alive check only respond to http to unrequire this.
 	go ListenHTTP()
 
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// migrationFiles holds the numbered schema migrations, one folder per driver.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Migration is one numbered schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// LoadMigrations reads the embedded migrations for a driver, oldest first.
+// Files are named 0001_name.up.sql and 0001_name.down.sql.
+func LoadMigrations(driver string) ([]Migration, error) {
+	dir := "migrations/" + driver
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		parts := strings.SplitN(entry.Name(), "_", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("migration %s has no version", entry.Name())
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has no version", entry.Name())
+		}
+
+		script, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version}
+			byVersion[version] = migration
+		}
+
+		switch {
+		case strings.HasSuffix(parts[1], ".up.sql"):
+			migration.Name = strings.TrimSuffix(parts[1], ".up.sql")
+			migration.Up = string(script)
+		case strings.HasSuffix(parts[1], ".down.sql"):
+			migration.Down = string(script)
+		default:
+			return nil, fmt.Errorf("migration %s isn't .up.sql or .down.sql", entry.Name())
+		}
+	}
+
+	migrations := []Migration{}
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %04d needs both an up and a down file", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// AppliedMigrations returns when each recorded version was applied, creating schema_migrations if needed.
+func AppliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+						version int NOT NULL PRIMARY KEY,
+						name varchar(128) NOT NULL,
+						applied_at datetime NOT NULL)`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		err = rows.Scan(&version, &appliedAt)
+		if err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+
+	return applied, rows.Err()
+}
+
+// MigrateUp applies pending migrations in order. A steps of 0 applies all of them.
+func MigrateUp(db *sql.DB, driver string, steps int) error {
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	ran := 0
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+		if steps > 0 && ran == steps {
+			break
+		}
+
+		err = runMigration(db, migration, true)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s: %v", migration.Version, migration.Name, err)
+		}
+		fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		ran++
+	}
+
+	return nil
+}
+
+// MigrateDown rolls back the most recently applied migrations, newest first.
+func MigrateDown(db *sql.DB, driver string, steps int) error {
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	ran := 0
+	for i := len(migrations) - 1; i >= 0 && ran < steps; i-- {
+		migration := migrations[i]
+		if _, ok := applied[migration.Version]; !ok {
+			continue
+		}
+
+		err = runMigration(db, migration, false)
+		if err != nil {
+			return fmt.Errorf("migration %04d_%s: %v", migration.Version, migration.Name, err)
+		}
+		fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+		ran++
+	}
+
+	return nil
+}
+
+// runMigration runs one direction of a migration and updates schema_migrations to match.
+// MySQL commits DDL as it goes, so a failed MySQL migration may need cleaning up by hand.
+func runMigration(db *sql.DB, migration Migration, up bool) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script := migration.Down
+	if up {
+		script = migration.Up
+	}
+
+	for _, statement := range splitStatements(script) {
+		_, err = tx.Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations(version, name, applied_at) VALUES(?,?,?)",
+			migration.Version, migration.Name, utc(time.Now()))
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", migration.Version)
+	}
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// splitStatements splits a migration into statements. Statements end with a semicolon at the end of a line.
+func splitStatements(script string) []string {
+	statements := []string{}
+	current := []string{}
+	for _, line := range strings.Split(script, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			statements = append(statements, strings.TrimSuffix(strings.Join(current, "\n"), ";"))
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		statements = append(statements, strings.Join(current, "\n"))
+	}
+
+	return statements
+}
+
+// RunMigrate is the `migrate up|down|status [steps]` command.
+// up applies every pending migration unless given a number of steps, down rolls back one.
+func RunMigrate(args []string) {
+	if len(args) == 0 {
+		fmt.Println("usage: migrate up|down|status [steps]")
+		os.Exit(2)
+	}
+
+	steps := 0
+	if len(args) > 1 {
+		var err error
+		steps, err = strconv.Atoi(args[1])
+		if err != nil || steps < 1 {
+			log.Fatal("steps must be a positive number")
+		}
+	}
+
+	driver, dsn, err := parseDatabaseURL(os.Getenv("DATABASE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	switch args[0] {
+	case "up":
+		err = MigrateUp(db, driver, steps)
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		err = MigrateDown(db, driver, steps)
+	case "status":
+		err = printMigrationStatus(db, driver)
+	default:
+		err = fmt.Errorf("unknown migrate command %q, use up, down or status", args[0])
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printMigrationStatus lists every migration and when it was applied.
+func printMigrationStatus(db *sql.DB, driver string) error {
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		return err
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		status := "pending"
+		if appliedAt, ok := applied[migration.Version]; ok {
+			status = "applied " + appliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%04d_%-32s %s\n", migration.Version, migration.Name, status)
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	names := map[string][]string{}
+	for _, driver := range []string{"mysql", "sqlite"} {
+		migrations, err := LoadMigrations(driver)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, migration := range migrations {
+			if migration.Version != i+1 {
+				t.Errorf("%s migration %d is version %d, want versions numbered from 1 without gaps", driver, i, migration.Version)
+			}
+			names[driver] = append(names[driver], migration.Name)
+		}
+	}
+	if !reflect.DeepEqual(names["mysql"], names["sqlite"]) {
+		t.Errorf("mysql migrations %v don't match sqlite migrations %v", names["mysql"], names["sqlite"])
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		script     string
+		statements []string
+	}{
+		{"", []string{}},
+		{"-- Just a comment.\n", []string{}},
+		{"CREATE TABLE a (id int);\nDROP TABLE b;\n", []string{"CREATE TABLE a (id int)", "DROP TABLE b"}},
+		{"-- Comments and blank lines are left out.\n\nCREATE TABLE a (\n  id int\n);\n", []string{"CREATE TABLE a (\n  id int\n)"}},
+		// Semicolons only end a statement at the end of a line.
+		{"UPDATE a SET note = 'one; two'\nWHERE id = 1;\n", []string{"UPDATE a SET note = 'one; two'\nWHERE id = 1"}},
+		{"DROP TABLE a", []string{"DROP TABLE a"}},
+	}
+	for _, test := range tests {
+		statements := splitStatements(test.script)
+		if !reflect.DeepEqual(statements, test.statements) {
+			t.Errorf("splitStatements(%q) = %q, want %q", test.script, statements, test.statements)
+		}
+	}
+}
+
+// sqliteSchema lists the SQL that made every table & index, apart from schema_migrations and SQLite's own.
+func sqliteSchema(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query(`SELECT sql FROM sqlite_master
+		WHERE sql IS NOT NULL AND name NOT IN ('schema_migrations', 'sqlite_sequence') ORDER BY type, name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	schema := []string{}
+	for rows.Next() {
+		var statement string
+		err = rows.Scan(&statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, statement)
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// TestMigrateRoundTrip rolls every migration back and applies them again, which should leave the same schema.
+func TestMigrateRoundTrip(t *testing.T) {
+	driver, dsn, err := parseDatabaseURL("sqlite:" + t.TempDir() + "/migrate.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	migrations, err := LoadMigrations(driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = MigrateUp(db, driver, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := AppliedMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 2 {
+		t.Fatalf("migrating up 2 steps applied %d migrations", len(applied))
+	}
+
+	err = MigrateUp(db, driver, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	migrated := sqliteSchema(t, db)
+
+	err = MigrateDown(db, driver, len(migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err = AppliedMigrations(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("%d migrations still applied after rolling them all back", len(applied))
+	}
+	for _, statement := range sqliteSchema(t, db) {
+		t.Errorf("left behind after rolling back: %s", statement)
+	}
+
+	err = MigrateUp(db, driver, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if remigrated := sqliteSchema(t, db); !reflect.DeepEqual(remigrated, migrated) {
+		t.Errorf("migrating again made\n%q\nwant\n%q", remigrated, migrated)
+	}
+}
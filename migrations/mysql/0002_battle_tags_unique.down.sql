@@ -0,0 +1 @@
+ALTER TABLE `battles_tags` DROP INDEX `battles_tags_battle_tag`;
@@ -0,0 +1,2 @@
+-- A battle links to each tag once. Run `beatbattle.app tags reindex` afterwards to fill battles_tags.
+ALTER TABLE `battles_tags` ADD UNIQUE KEY `battles_tags_battle_tag` (`battle_id`, `tag_id`);
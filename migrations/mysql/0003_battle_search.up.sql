@@ -0,0 +1,9 @@
+-- Search terms of each battle's title, tags and rules. Run `beatbattle.app search reindex` afterwards to fill it.
+CREATE TABLE IF NOT EXISTS `battle_search` (
+  `battle_id` int NOT NULL,
+  `term` varchar(64) CHARACTER SET utf8mb4 COLLATE utf8mb4_bin NOT NULL,
+  `weight` int NOT NULL DEFAULT '1',
+  PRIMARY KEY (`battle_id`, `term`),
+  KEY `battle_search_term` (`term`),
+  CONSTRAINT `fk_battle_search_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,27 @@
+-- How a battle's entries are ranked: approval votes or an instant-runoff ranked ballot.
+ALTER TABLE `battles` ADD COLUMN `voting_mode` varchar(16) NOT NULL DEFAULT 'approval';
+
+-- A voter's ranked ballot, one row per entry with 1 as their first choice.
+CREATE TABLE IF NOT EXISTS `ballots` (
+  `battle_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `beat_id` int NOT NULL,
+  `preference` int NOT NULL,
+  PRIMARY KEY (`battle_id`, `user_id`, `preference`),
+  KEY `ballots_beat_id_idx` (`beat_id`),
+  CONSTRAINT `fk_ballots_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_ballots_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Each count of an instant-runoff result, kept so the rounds can be shown once the battle is complete.
+CREATE TABLE IF NOT EXISTS `battle_rounds` (
+  `battle_id` int NOT NULL,
+  `round` int NOT NULL,
+  `beat_id` int NOT NULL,
+  `votes` int NOT NULL DEFAULT '0',
+  `eliminated` tinyint NOT NULL DEFAULT '0',
+  PRIMARY KEY (`battle_id`, `round`, `beat_id`),
+  KEY `battle_rounds_beat_id_idx` (`beat_id`),
+  CONSTRAINT `fk_battle_rounds_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_battle_rounds_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,44 @@
+-- Drop each entry's highest and lowest score per criterion before averaging.
+ALTER TABLE `battles` ADD COLUMN `trim_scores` tinyint NOT NULL DEFAULT '0';
+
+-- What a score battle's entries are judged on, and how much each counts.
+CREATE TABLE IF NOT EXISTS `battle_criteria` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `battle_id` int NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `weight` int NOT NULL DEFAULT '1',
+  `position` int NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id`),
+  KEY `battle_criteria_battle_id_idx` (`battle_id`),
+  CONSTRAINT `fk_battle_criteria_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- A voter's 1-10 score for an entry on one criterion.
+CREATE TABLE IF NOT EXISTS `scores` (
+  `battle_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `beat_id` int NOT NULL,
+  `criterion_id` int NOT NULL,
+  `score` int NOT NULL,
+  PRIMARY KEY (`user_id`, `beat_id`, `criterion_id`),
+  KEY `scores_battle_id_idx` (`battle_id`),
+  KEY `scores_beat_id_idx` (`beat_id`),
+  KEY `scores_criterion_id_idx` (`criterion_id`),
+  CONSTRAINT `fk_scores_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_scores_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_scores_criterion_id` FOREIGN KEY (`criterion_id`) REFERENCES `battle_criteria` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Each entry's mean score per criterion, saved with the battle's results.
+CREATE TABLE IF NOT EXISTS `criterion_scores` (
+  `battle_id` int NOT NULL,
+  `beat_id` int NOT NULL,
+  `criterion_id` int NOT NULL,
+  `score` double NOT NULL DEFAULT '0',
+  PRIMARY KEY (`beat_id`, `criterion_id`),
+  KEY `criterion_scores_battle_id_idx` (`battle_id`),
+  KEY `criterion_scores_criterion_id_idx` (`criterion_id`),
+  CONSTRAINT `fk_criterion_scores_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_criterion_scores_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_criterion_scores_criterion_id` FOREIGN KEY (`criterion_id`) REFERENCES `battle_criteria` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
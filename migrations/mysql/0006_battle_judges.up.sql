@@ -0,0 +1,27 @@
+-- The percentage of a judged battle's result that comes from its judges. The public decides the rest.
+ALTER TABLE `battles` ADD COLUMN `judge_weight` int NOT NULL DEFAULT '0';
+
+-- Users a host has invited to judge a battle, and whether they accepted.
+CREATE TABLE IF NOT EXISTS `battle_judges` (
+  `battle_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `status` varchar(16) NOT NULL DEFAULT 'invited',
+  `invited_at` datetime NOT NULL,
+  PRIMARY KEY (`battle_id`, `user_id`),
+  KEY `battle_judges_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_battle_judges_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_battle_judges_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- The judge and public tallies of a judged battle's entries, each from 0 to 1, and their blend.
+CREATE TABLE IF NOT EXISTS `battle_tallies` (
+  `battle_id` int NOT NULL,
+  `beat_id` int NOT NULL,
+  `judge_score` double NOT NULL DEFAULT '0',
+  `public_score` double NOT NULL DEFAULT '0',
+  `score` double NOT NULL DEFAULT '0',
+  PRIMARY KEY (`beat_id`),
+  KEY `battle_tallies_battle_id_idx` (`battle_id`),
+  CONSTRAINT `fk_battle_tallies_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_battle_tallies_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
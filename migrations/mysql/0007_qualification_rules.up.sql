@@ -0,0 +1,5 @@
+-- What an entrant has to do during voting for their entry to place. One vote was always required.
+ALTER TABLE `battles` ADD COLUMN `min_votes` int NOT NULL DEFAULT '1';
+ALTER TABLE `battles` ADD COLUMN `require_feedback` tinyint NOT NULL DEFAULT '0';
+-- Whether only entrants & judges may vote.
+ALTER TABLE `battles` ADD COLUMN `entrants_only` tinyint NOT NULL DEFAULT '0';
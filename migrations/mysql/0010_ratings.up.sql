@@ -0,0 +1,27 @@
+-- Each producer's current skill rating, overall ('all') and per battle type.
+CREATE TABLE IF NOT EXISTS `ratings` (
+  `user_id` int NOT NULL,
+  `category` varchar(16) NOT NULL,
+  `rating` double NOT NULL DEFAULT '1500',
+  `battles` int NOT NULL DEFAULT '0',
+  `updated_at` datetime NOT NULL,
+  PRIMARY KEY (`user_id`, `category`),
+  KEY `ratings_category_idx` (`category`, `rating`),
+  CONSTRAINT `fk_ratings_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- How every rated battle moved its entrants' ratings.
+CREATE TABLE IF NOT EXISTS `rating_history` (
+  `battle_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `category` varchar(16) NOT NULL,
+  `placement` int NOT NULL DEFAULT '0',
+  `rating_before` double NOT NULL,
+  `rating_after` double NOT NULL,
+  `finished_at` datetime NOT NULL,
+  PRIMARY KEY (`battle_id`, `user_id`, `category`),
+  KEY `rating_history_user_id_idx` (`user_id`, `category`, `finished_at`),
+  KEY `rating_history_finished_at_idx` (`category`, `finished_at`),
+  CONSTRAINT `fk_rating_history_battle_id` FOREIGN KEY (`battle_id`) REFERENCES `battles` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_rating_history_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,28 @@
+-- A league of battles run by one host. Placements earn points from the comma separated table,
+-- 1st place first, and each entrant's drop_lowest worst results don't count.
+CREATE TABLE IF NOT EXISTS `series` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `title` varchar(64) NOT NULL,
+  `points` varchar(256) NOT NULL DEFAULT '25,18,15,12,10,8,6,4,2,1',
+  `drop_lowest` int NOT NULL DEFAULT '0',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `series_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_series_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- A stretch of a series, e.g. a month, with its own standings.
+CREATE TABLE IF NOT EXISTS `seasons` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `series_id` int NOT NULL,
+  `title` varchar(64) NOT NULL,
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `seasons_series_id_idx` (`series_id`),
+  CONSTRAINT `fk_seasons_series_id` FOREIGN KEY (`series_id`) REFERENCES `series` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- The season a battle counts towards. 0 is a standalone battle.
+ALTER TABLE `battles` ADD COLUMN `season_id` int NOT NULL DEFAULT '0';
+ALTER TABLE `battles` ADD KEY `battles_season_id_idx` (`season_id`);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS `tournament_matches`;
+DROP TABLE IF EXISTS `tournament_entrants`;
+DROP TABLE IF EXISTS `tournaments`;
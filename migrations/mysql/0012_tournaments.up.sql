@@ -0,0 +1,51 @@
+-- An elimination bracket of head-to-head battles. Each match's battle is open for entry_hours,
+-- then voting_hours, and winner_id is set once the last match is decided.
+CREATE TABLE IF NOT EXISTS `tournaments` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `title` varchar(64) NOT NULL,
+  `rules` text NOT NULL,
+  `type` varchar(8) NOT NULL DEFAULT 'beat',
+  `format` varchar(8) NOT NULL DEFAULT 'single',
+  `seeding` varchar(8) NOT NULL DEFAULT 'signup',
+  `entry_hours` int NOT NULL DEFAULT '72',
+  `voting_hours` int NOT NULL DEFAULT '48',
+  `status` varchar(16) NOT NULL DEFAULT 'signup',
+  `winner_id` int NOT NULL DEFAULT '0',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `tournaments_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_tournaments_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Users signed up to a tournament. Seeds are 0 until it starts, 1 being the top seed.
+CREATE TABLE IF NOT EXISTS `tournament_entrants` (
+  `tournament_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `seed` int NOT NULL DEFAULT '0',
+  `joined_at` datetime NOT NULL,
+  PRIMARY KEY (`tournament_id`, `user_id`),
+  KEY `tournament_entrants_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_tournament_entrants_tournament_id` FOREIGN KEY (`tournament_id`) REFERENCES `tournaments` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_tournament_entrants_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- The matches of a tournament that have been played, or are being, and the battles deciding them.
+-- Matches that are byes or still waiting on their players are worked out from the seeds instead.
+CREATE TABLE IF NOT EXISTS `tournament_matches` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `tournament_id` int NOT NULL,
+  `side` varchar(8) NOT NULL,
+  `round` int NOT NULL,
+  `position` int NOT NULL,
+  `battle_id` int NOT NULL DEFAULT '0',
+  `player1_id` int NOT NULL,
+  `player2_id` int NOT NULL,
+  `winner_id` int NOT NULL DEFAULT '0',
+  `decided_by` varchar(8) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  UNIQUE KEY `tournament_matches_key` (`tournament_id`, `side`, `round`, `position`),
+  KEY `tournament_matches_battle_id_idx` (`battle_id`),
+  CONSTRAINT `fk_tournament_matches_tournament_id` FOREIGN KEY (`tournament_id`) REFERENCES `tournaments` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
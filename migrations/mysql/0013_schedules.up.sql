@@ -0,0 +1,23 @@
+-- Opens a copy of battle_id every week or month, on the wall clock of timezone. runs counts the runs that
+-- have come round and next_run is when the next opens. packs are attachments handed out in turn, one per line.
+CREATE TABLE IF NOT EXISTS `schedules` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `battle_id` int NOT NULL,
+  `cadence` varchar(8) NOT NULL DEFAULT 'weekly',
+  `timezone` varchar(64) NOT NULL,
+  `starts_at` datetime NOT NULL,
+  `entry_hours` int NOT NULL DEFAULT '120',
+  `voting_hours` int NOT NULL DEFAULT '48',
+  `packs` text NOT NULL,
+  `runs` int NOT NULL DEFAULT '0',
+  `next_run` datetime NOT NULL,
+  `opened` int NOT NULL DEFAULT '0',
+  `last_battle_id` int NOT NULL DEFAULT '0',
+  `paused` tinyint NOT NULL DEFAULT '0',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `schedules_user_id_idx` (`user_id`),
+  KEY `schedules_next_run_idx` (`paused`, `next_run`),
+  CONSTRAINT `fk_schedules_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
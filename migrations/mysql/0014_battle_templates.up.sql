@@ -0,0 +1,24 @@
+-- A battle's setup saved by its host to start new battles from, settings included.
+CREATE TABLE IF NOT EXISTS `battle_templates` (
+  `id` int NOT NULL AUTO_INCREMENT,
+  `user_id` int NOT NULL,
+  `name` varchar(64) NOT NULL,
+  `title` varchar(256) NOT NULL,
+  `rules` text NOT NULL,
+  `type` varchar(8) NOT NULL DEFAULT 'beat',
+  `maxvotes` int NOT NULL DEFAULT '3',
+  `tags` varchar(256) NOT NULL DEFAULT '',
+  `logo` text NOT NULL,
+  `background` text NOT NULL,
+  `show_users` tinyint NOT NULL DEFAULT '0',
+  `show_entries` tinyint NOT NULL DEFAULT '0',
+  `tracking_id` varchar(128) NOT NULL DEFAULT '',
+  `private` tinyint NOT NULL DEFAULT '0',
+  `field_1` varchar(64) NOT NULL DEFAULT '',
+  `field_2` varchar(64) NOT NULL DEFAULT '',
+  `field_3` varchar(64) NOT NULL DEFAULT '',
+  `created_at` datetime NOT NULL,
+  PRIMARY KEY (`id`),
+  KEY `battle_templates_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_battle_templates_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
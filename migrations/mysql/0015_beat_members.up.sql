@@ -0,0 +1,16 @@
+-- Whether entrants can credit other users on their entry.
+ALTER TABLE `battles` ADD COLUMN `teams` tinyint NOT NULL DEFAULT '0';
+
+-- The users credited on a team entry and their roles, the entrant included. Invited users are only
+-- credited once they accept.
+CREATE TABLE IF NOT EXISTS `beat_members` (
+  `beat_id` int NOT NULL,
+  `user_id` int NOT NULL,
+  `role` varchar(16) NOT NULL DEFAULT 'producer',
+  `status` varchar(16) NOT NULL DEFAULT 'invited',
+  `invited_at` datetime NOT NULL,
+  PRIMARY KEY (`beat_id`, `user_id`),
+  KEY `beat_members_user_id_idx` (`user_id`),
+  CONSTRAINT `fk_beat_members_beat_id` FOREIGN KEY (`beat_id`) REFERENCES `beats` (`id`) ON DELETE CASCADE,
+  CONSTRAINT `fk_beat_members_user_id` FOREIGN KEY (`user_id`) REFERENCES `users` (`id`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
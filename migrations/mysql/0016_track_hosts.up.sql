@@ -0,0 +1,2 @@
+-- Comma separated hosts a battle narrows its entries to, blank for every host its type allows.
+ALTER TABLE `battles` ADD COLUMN `track_hosts` varchar(255) NOT NULL DEFAULT '';
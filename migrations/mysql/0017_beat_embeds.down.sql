@@ -0,0 +1,5 @@
+ALTER TABLE `beats` DROP COLUMN `embed_height`;
+ALTER TABLE `beats` DROP COLUMN `embed_url`;
+ALTER TABLE `beats` DROP COLUMN `secret_token`;
+ALTER TABLE `beats` DROP COLUMN `track_id`;
+ALTER TABLE `beats` DROP COLUMN `track_provider`;
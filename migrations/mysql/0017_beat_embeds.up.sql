@@ -0,0 +1,6 @@
+-- How each entry's track plays, worked out by its provider's resolver. Blank for entries from before.
+ALTER TABLE `beats` ADD COLUMN `track_provider` varchar(16) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `track_id` varchar(128) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `secret_token` varchar(64) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `embed_url` varchar(512) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `embed_height` int NOT NULL DEFAULT '0';
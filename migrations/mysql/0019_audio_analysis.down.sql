@@ -0,0 +1,10 @@
+ALTER TABLE `beats` DROP COLUMN `loudness`;
+ALTER TABLE `beats` DROP COLUMN `bitrate`;
+ALTER TABLE `beats` DROP COLUMN `channels`;
+ALTER TABLE `beats` DROP COLUMN `sample_rate`;
+ALTER TABLE `beats` DROP COLUMN `duration_ms`;
+ALTER TABLE `beats` DROP COLUMN `audio_codec`;
+ALTER TABLE `beats` DROP COLUMN `audio_container`;
+
+ALTER TABLE `battles` DROP COLUMN `max_length`;
+ALTER TABLE `battles` DROP COLUMN `min_length`;
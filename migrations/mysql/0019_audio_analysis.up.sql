@@ -0,0 +1,12 @@
+-- Shortest & longest entries a battle accepts, in seconds. 0 is no limit.
+ALTER TABLE `battles` ADD COLUMN `min_length` int NOT NULL DEFAULT '0';
+ALTER TABLE `battles` ADD COLUMN `max_length` int NOT NULL DEFAULT '0';
+
+-- What analysing an entry's audio found. A duration of 0 means it wasn't analysed.
+ALTER TABLE `beats` ADD COLUMN `audio_container` varchar(16) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `audio_codec` varchar(32) NOT NULL DEFAULT '';
+ALTER TABLE `beats` ADD COLUMN `duration_ms` int NOT NULL DEFAULT '0';
+ALTER TABLE `beats` ADD COLUMN `sample_rate` int NOT NULL DEFAULT '0';
+ALTER TABLE `beats` ADD COLUMN `channels` int NOT NULL DEFAULT '0';
+ALTER TABLE `beats` ADD COLUMN `bitrate` int NOT NULL DEFAULT '0';
+ALTER TABLE `beats` ADD COLUMN `loudness` double NOT NULL DEFAULT '0';
@@ -0,0 +1 @@
+-- Nothing reads results any more, and status holds everything it did, so it isn't brought back.
@@ -0,0 +1,17 @@
+-- Databases from before battles had a status added the status column next to results, which recorded
+-- a battle's state as -1 for a draft, 1 once results were in and 0 otherwise. Battles nothing has moved
+-- since, with no transitions, take their status from results. Open battles stay in entry for the
+-- scheduler to move on. Databases made by these migrations have no results column, so this does nothing.
+SET @has_results = (SELECT COUNT(*) FROM information_schema.columns
+  WHERE table_schema = DATABASE() AND table_name = 'battles' AND column_name = 'results');
+SET @convert_results = IF(@has_results > 0,
+  'UPDATE `battles` SET `status` = CASE `results` WHEN -1 THEN ''draft'' WHEN 1 THEN ''complete'' ELSE `status` END
+   WHERE NOT EXISTS (SELECT 1 FROM `battle_transitions` WHERE `battle_transitions`.`battle_id` = `battles`.`id`)',
+  'DO 0');
+PREPARE convert_results FROM @convert_results;
+EXECUTE convert_results;
+DEALLOCATE PREPARE convert_results;
+SET @drop_results = IF(@has_results > 0, 'ALTER TABLE `battles` DROP COLUMN `results`', 'DO 0');
+PREPARE drop_results FROM @drop_results;
+EXECUTE drop_results;
+DEALLOCATE PREPARE drop_results;
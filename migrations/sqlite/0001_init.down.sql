@@ -0,0 +1,11 @@
+DROP TABLE IF EXISTS votes;
+DROP TABLE IF EXISTS likes;
+DROP TABLE IF EXISTS feedback;
+DROP TABLE IF EXISTS beats;
+DROP TABLE IF EXISTS battles_tags;
+DROP TABLE IF EXISTS tags;
+DROP TABLE IF EXISTS battle_transitions;
+DROP TABLE IF EXISTS battles;
+DROP TABLE IF EXISTS battle_settings;
+DROP TABLE IF EXISTS ads;
+DROP TABLE IF EXISTS users;
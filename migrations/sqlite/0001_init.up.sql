@@ -0,0 +1,119 @@
+CREATE TABLE IF NOT EXISTS users (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  provider varchar(64) NOT NULL,
+  provider_id varchar(64) NOT NULL,
+  nickname varchar(64) NOT NULL,
+  access_token char(60) DEFAULT '',
+  expiry datetime DEFAULT CURRENT_TIMESTAMP,
+  flair varchar(64) NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS ads (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  active tinyint NOT NULL DEFAULT 0,
+  startdate datetime NOT NULL,
+  enddate datetime NOT NULL,
+  url text NOT NULL,
+  clicks int NOT NULL DEFAULT 0,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  image text NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fk_user_id_ad_idx ON ads (user_id);
+
+CREATE TABLE IF NOT EXISTS battle_settings (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  logo text,
+  background text,
+  show_users tinyint DEFAULT 0,
+  show_entries tinyint DEFAULT 0,
+  tracking_id varchar(128) DEFAULT '',
+  private tinyint DEFAULT 0,
+  field_1 varchar(64) DEFAULT '',
+  field_2 varchar(64) DEFAULT '',
+  field_3 varchar(64) DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS battles (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  title varchar(256) NOT NULL,
+  rules text NOT NULL,
+  deadline datetime NOT NULL,
+  attachment text,
+  password varchar(64) DEFAULT NULL,
+  status varchar(16) NOT NULL DEFAULT 'entry',
+  user_id int NOT NULL,
+  type varchar(16) NOT NULL DEFAULT 'beat',
+  voting_deadline datetime DEFAULT NULL,
+  maxvotes int DEFAULT 1,
+  winner_id int NOT NULL DEFAULT 0,
+  settings_id int DEFAULT 0,
+  tags varchar(256) DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS battles_idx_status ON battles (status);
+
+CREATE TABLE IF NOT EXISTS battle_transitions (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  from_status varchar(16) NOT NULL DEFAULT '',
+  to_status varchar(16) NOT NULL,
+  trigger_type varchar(16) NOT NULL,
+  user_id int DEFAULT NULL,
+  note varchar(256) NOT NULL DEFAULT '',
+  created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS fk_battle_transitions_battle_idx ON battle_transitions (battle_id);
+
+CREATE TABLE IF NOT EXISTS tags (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  tag varchar(64) NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS battles_tags (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  tag_id int NOT NULL REFERENCES tags (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS fk_challenges_tags_tag_id_idx ON battles_tags (tag_id);
+CREATE INDEX IF NOT EXISTS fk_challenges_tags_challenges_idx ON battles_tags (battle_id);
+
+CREATE TABLE IF NOT EXISTS beats (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  url text NOT NULL,
+  votes int NOT NULL DEFAULT 0,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  voted tinyint NOT NULL DEFAULT 0,
+  placement int DEFAULT 0,
+  field_1 varchar(256) DEFAULT '',
+  field_2 varchar(256) DEFAULT '',
+  field_3 varchar(256) DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS fk_user_id_beats_idx ON beats (user_id);
+CREATE INDEX IF NOT EXISTS fk_challenge_id_beats ON beats (battle_id);
+
+CREATE TABLE IF NOT EXISTS feedback (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  feedback varchar(512) NOT NULL,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS fk_feedback_user_idx ON feedback (user_id);
+CREATE INDEX IF NOT EXISTS fk_feedback_beat_idx ON feedback (beat_id);
+
+CREATE TABLE IF NOT EXISTS likes (
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE ON UPDATE CASCADE,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS fk_user_likes_idx ON likes (user_id);
+CREATE INDEX IF NOT EXISTS fk_beat_likes_idx ON likes (beat_id);
+CREATE INDEX IF NOT EXISTS likes_idx_user_id_beat_id ON likes (user_id, beat_id);
+CREATE INDEX IF NOT EXISTS fk_challenge_likes ON likes (battle_id);
+
+CREATE TABLE IF NOT EXISTS votes (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS fk_beat_id_idx ON votes (beat_id);
+CREATE INDEX IF NOT EXISTS fk_customer_id_idx ON votes (battle_id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS battles_tags_battle_tag;
@@ -0,0 +1,2 @@
+-- A battle links to each tag once. Run `beatbattle.app tags reindex` afterwards to fill battles_tags.
+CREATE UNIQUE INDEX IF NOT EXISTS battles_tags_battle_tag ON battles_tags (battle_id, tag_id);
@@ -0,0 +1,8 @@
+-- Search terms of each battle's title, tags and rules. Run `beatbattle.app search reindex` afterwards to fill it.
+CREATE TABLE IF NOT EXISTS battle_search (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  term varchar(64) NOT NULL,
+  weight int NOT NULL DEFAULT 1,
+  PRIMARY KEY (battle_id, term)
+);
+CREATE INDEX IF NOT EXISTS battle_search_term ON battle_search (term);
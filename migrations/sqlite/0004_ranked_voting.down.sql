@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS battle_rounds;
+DROP TABLE IF EXISTS ballots;
+ALTER TABLE battles DROP COLUMN voting_mode;
@@ -0,0 +1,23 @@
+-- How a battle's entries are ranked: approval votes or an instant-runoff ranked ballot.
+ALTER TABLE battles ADD COLUMN voting_mode varchar(16) NOT NULL DEFAULT 'approval';
+
+-- A voter's ranked ballot, one row per entry with 1 as their first choice.
+CREATE TABLE IF NOT EXISTS ballots (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  preference int NOT NULL,
+  PRIMARY KEY (battle_id, user_id, preference)
+);
+CREATE INDEX IF NOT EXISTS ballots_beat_id_idx ON ballots (beat_id);
+
+-- Each count of an instant-runoff result, kept so the rounds can be shown once the battle is complete.
+CREATE TABLE IF NOT EXISTS battle_rounds (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  round int NOT NULL,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  votes int NOT NULL DEFAULT 0,
+  eliminated tinyint NOT NULL DEFAULT 0,
+  PRIMARY KEY (battle_id, round, beat_id)
+);
+CREATE INDEX IF NOT EXISTS battle_rounds_beat_id_idx ON battle_rounds (beat_id);
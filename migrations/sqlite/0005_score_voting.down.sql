@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS criterion_scores;
+DROP TABLE IF EXISTS scores;
+DROP TABLE IF EXISTS battle_criteria;
+ALTER TABLE battles DROP COLUMN trim_scores;
@@ -0,0 +1,34 @@
+-- Drop each entry's highest and lowest score per criterion before averaging.
+ALTER TABLE battles ADD COLUMN trim_scores tinyint NOT NULL DEFAULT 0;
+
+-- What a score battle's entries are judged on, and how much each counts.
+CREATE TABLE IF NOT EXISTS battle_criteria (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  name varchar(64) NOT NULL,
+  weight int NOT NULL DEFAULT 1,
+  position int NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS battle_criteria_battle_id_idx ON battle_criteria (battle_id);
+
+-- A voter's 1-10 score for an entry on one criterion.
+CREATE TABLE IF NOT EXISTS scores (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  criterion_id int NOT NULL REFERENCES battle_criteria (id) ON DELETE CASCADE,
+  score int NOT NULL,
+  PRIMARY KEY (user_id, beat_id, criterion_id)
+);
+CREATE INDEX IF NOT EXISTS scores_battle_id_idx ON scores (battle_id);
+CREATE INDEX IF NOT EXISTS scores_beat_id_idx ON scores (beat_id);
+
+-- Each entry's mean score per criterion, saved with the battle's results.
+CREATE TABLE IF NOT EXISTS criterion_scores (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  criterion_id int NOT NULL REFERENCES battle_criteria (id) ON DELETE CASCADE,
+  score double NOT NULL DEFAULT 0,
+  PRIMARY KEY (beat_id, criterion_id)
+);
+CREATE INDEX IF NOT EXISTS criterion_scores_battle_id_idx ON criterion_scores (battle_id);
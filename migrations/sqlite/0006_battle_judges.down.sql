@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS battle_tallies;
+DROP TABLE IF EXISTS battle_judges;
+ALTER TABLE battles DROP COLUMN judge_weight;
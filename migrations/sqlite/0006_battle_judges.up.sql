@@ -0,0 +1,23 @@
+-- The percentage of a judged battle's result that comes from its judges. The public decides the rest.
+ALTER TABLE battles ADD COLUMN judge_weight int NOT NULL DEFAULT 0;
+
+-- Users a host has invited to judge a battle, and whether they accepted.
+CREATE TABLE IF NOT EXISTS battle_judges (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  status varchar(16) NOT NULL DEFAULT 'invited',
+  invited_at datetime NOT NULL,
+  PRIMARY KEY (battle_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS battle_judges_user_id_idx ON battle_judges (user_id);
+
+-- The judge and public tallies of a judged battle's entries, each from 0 to 1, and their blend.
+CREATE TABLE IF NOT EXISTS battle_tallies (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  judge_score double NOT NULL DEFAULT 0,
+  public_score double NOT NULL DEFAULT 0,
+  score double NOT NULL DEFAULT 0,
+  PRIMARY KEY (beat_id)
+);
+CREATE INDEX IF NOT EXISTS battle_tallies_battle_id_idx ON battle_tallies (battle_id);
@@ -0,0 +1,3 @@
+ALTER TABLE battles DROP COLUMN entrants_only;
+ALTER TABLE battles DROP COLUMN require_feedback;
+ALTER TABLE battles DROP COLUMN min_votes;
@@ -0,0 +1,2 @@
+-- The comma separated tie-breakers a battle applies in order. Entries still tied share a placement.
+ALTER TABLE battles ADD COLUMN tie_breakers varchar(64) NOT NULL DEFAULT '';
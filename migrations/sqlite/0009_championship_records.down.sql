@@ -0,0 +1,2 @@
+UPDATE battles SET winner_id = 0;
+DROP TABLE IF EXISTS championship_records;
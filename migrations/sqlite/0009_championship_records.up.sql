@@ -0,0 +1,23 @@
+-- Every entry's final placement, written when a battle's results are finalized. 0 means disqualified.
+CREATE TABLE IF NOT EXISTS championship_records (
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  placement int NOT NULL DEFAULT 0,
+  finished_at datetime NOT NULL,
+  PRIMARY KEY (beat_id)
+);
+CREATE INDEX IF NOT EXISTS championship_records_battle_id_idx ON championship_records (battle_id);
+CREATE INDEX IF NOT EXISTS championship_records_user_id_idx ON championship_records (user_id, finished_at);
+
+-- Record the battles that were already complete.
+INSERT INTO championship_records (beat_id, battle_id, user_id, placement, finished_at)
+SELECT beats.id, beats.battle_id, beats.user_id, IFNULL(beats.placement, 0), IFNULL(battles.voting_deadline, battles.deadline)
+FROM beats
+INNER JOIN battles ON battles.id = beats.battle_id
+WHERE battles.status = 'complete';
+
+-- The first entry placed 1st wins. Co-winners are in the records.
+UPDATE battles SET winner_id = IFNULL((SELECT beats.user_id FROM beats
+  WHERE beats.battle_id = battles.id AND beats.placement = 1 ORDER BY beats.id LIMIT 1), 0)
+WHERE status = 'complete';
@@ -0,0 +1,24 @@
+-- Each producer's current skill rating, overall ('all') and per battle type.
+CREATE TABLE IF NOT EXISTS ratings (
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  category varchar(16) NOT NULL,
+  rating double NOT NULL DEFAULT 1500,
+  battles int NOT NULL DEFAULT 0,
+  updated_at datetime NOT NULL,
+  PRIMARY KEY (user_id, category)
+);
+CREATE INDEX IF NOT EXISTS ratings_category_idx ON ratings (category, rating);
+
+-- How every rated battle moved its entrants' ratings.
+CREATE TABLE IF NOT EXISTS rating_history (
+  battle_id int NOT NULL REFERENCES battles (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  category varchar(16) NOT NULL,
+  placement int NOT NULL DEFAULT 0,
+  rating_before double NOT NULL,
+  rating_after double NOT NULL,
+  finished_at datetime NOT NULL,
+  PRIMARY KEY (battle_id, user_id, category)
+);
+CREATE INDEX IF NOT EXISTS rating_history_user_id_idx ON rating_history (user_id, category, finished_at);
+CREATE INDEX IF NOT EXISTS rating_history_finished_at_idx ON rating_history (category, finished_at);
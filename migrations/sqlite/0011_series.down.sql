@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS battles_season_id_idx;
+ALTER TABLE battles DROP COLUMN season_id;
+DROP TABLE IF EXISTS seasons;
+DROP TABLE IF EXISTS series;
@@ -0,0 +1,24 @@
+-- A league of battles run by one host. Placements earn points from the comma separated table,
+-- 1st place first, and each entrant's drop_lowest worst results don't count.
+CREATE TABLE IF NOT EXISTS series (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  title varchar(64) NOT NULL,
+  points varchar(256) NOT NULL DEFAULT '25,18,15,12,10,8,6,4,2,1',
+  drop_lowest int NOT NULL DEFAULT 0,
+  created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS series_user_id_idx ON series (user_id);
+
+-- A stretch of a series, e.g. a month, with its own standings.
+CREATE TABLE IF NOT EXISTS seasons (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  series_id int NOT NULL REFERENCES series (id) ON DELETE CASCADE,
+  title varchar(64) NOT NULL,
+  created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS seasons_series_id_idx ON seasons (series_id);
+
+-- The season a battle counts towards. 0 is a standalone battle.
+ALTER TABLE battles ADD COLUMN season_id int NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS battles_season_id_idx ON battles (season_id);
@@ -0,0 +1,45 @@
+-- An elimination bracket of head-to-head battles. Each match's battle is open for entry_hours,
+-- then voting_hours, and winner_id is set once the last match is decided.
+CREATE TABLE IF NOT EXISTS tournaments (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  title varchar(64) NOT NULL,
+  rules text NOT NULL,
+  type varchar(8) NOT NULL DEFAULT 'beat',
+  format varchar(8) NOT NULL DEFAULT 'single',
+  seeding varchar(8) NOT NULL DEFAULT 'signup',
+  entry_hours int NOT NULL DEFAULT 72,
+  voting_hours int NOT NULL DEFAULT 48,
+  status varchar(16) NOT NULL DEFAULT 'signup',
+  winner_id int NOT NULL DEFAULT 0,
+  created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tournaments_user_id_idx ON tournaments (user_id);
+
+-- Users signed up to a tournament. Seeds are 0 until it starts, 1 being the top seed.
+CREATE TABLE IF NOT EXISTS tournament_entrants (
+  tournament_id int NOT NULL REFERENCES tournaments (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  seed int NOT NULL DEFAULT 0,
+  joined_at datetime NOT NULL,
+  PRIMARY KEY (tournament_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS tournament_entrants_user_id_idx ON tournament_entrants (user_id);
+
+-- The matches of a tournament that have been played, or are being, and the battles deciding them.
+-- Matches that are byes or still waiting on their players are worked out from the seeds instead.
+CREATE TABLE IF NOT EXISTS tournament_matches (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  tournament_id int NOT NULL REFERENCES tournaments (id) ON DELETE CASCADE,
+  side varchar(8) NOT NULL,
+  round int NOT NULL,
+  position int NOT NULL,
+  battle_id int NOT NULL DEFAULT 0,
+  player1_id int NOT NULL,
+  player2_id int NOT NULL,
+  winner_id int NOT NULL DEFAULT 0,
+  decided_by varchar(8) NOT NULL DEFAULT '',
+  created_at datetime NOT NULL
+);
+CREATE UNIQUE INDEX IF NOT EXISTS tournament_matches_key ON tournament_matches (tournament_id, side, round, position);
+CREATE INDEX IF NOT EXISTS tournament_matches_battle_id_idx ON tournament_matches (battle_id);
@@ -0,0 +1,22 @@
+-- A battle's setup saved by its host to start new battles from, settings included.
+CREATE TABLE IF NOT EXISTS battle_templates (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  name varchar(64) NOT NULL,
+  title varchar(256) NOT NULL,
+  rules text NOT NULL,
+  type varchar(8) NOT NULL DEFAULT 'beat',
+  maxvotes int NOT NULL DEFAULT 3,
+  tags varchar(256) NOT NULL DEFAULT '',
+  logo text NOT NULL,
+  background text NOT NULL,
+  show_users tinyint NOT NULL DEFAULT 0,
+  show_entries tinyint NOT NULL DEFAULT 0,
+  tracking_id varchar(128) NOT NULL DEFAULT '',
+  private tinyint NOT NULL DEFAULT 0,
+  field_1 varchar(64) NOT NULL DEFAULT '',
+  field_2 varchar(64) NOT NULL DEFAULT '',
+  field_3 varchar(64) NOT NULL DEFAULT '',
+  created_at datetime NOT NULL
+);
+CREATE INDEX IF NOT EXISTS battle_templates_user_id_idx ON battle_templates (user_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS beat_members;
+ALTER TABLE battles DROP COLUMN teams;
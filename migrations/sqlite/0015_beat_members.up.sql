@@ -0,0 +1,14 @@
+-- Whether entrants can credit other users on their entry.
+ALTER TABLE battles ADD COLUMN teams tinyint NOT NULL DEFAULT 0;
+
+-- The users credited on a team entry and their roles, the entrant included. Invited users are only
+-- credited once they accept.
+CREATE TABLE IF NOT EXISTS beat_members (
+  beat_id int NOT NULL REFERENCES beats (id) ON DELETE CASCADE,
+  user_id int NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+  role varchar(16) NOT NULL DEFAULT 'producer',
+  status varchar(16) NOT NULL DEFAULT 'invited',
+  invited_at datetime NOT NULL,
+  PRIMARY KEY (beat_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS beat_members_user_id_idx ON beat_members (user_id);
@@ -0,0 +1 @@
+ALTER TABLE battles DROP COLUMN track_hosts;
@@ -0,0 +1,4 @@
+ALTER TABLE beats DROP COLUMN file_type;
+ALTER TABLE beats DROP COLUMN file_size;
+ALTER TABLE beats DROP COLUMN file_name;
+ALTER TABLE beats DROP COLUMN file_key;
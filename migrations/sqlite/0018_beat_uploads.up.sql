@@ -0,0 +1,5 @@
+-- Audio uploaded straight to the site for an entry, kept in file storage. Blank for linked entries.
+ALTER TABLE beats ADD COLUMN file_key varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE beats ADD COLUMN file_name varchar(255) NOT NULL DEFAULT '';
+ALTER TABLE beats ADD COLUMN file_size bigint NOT NULL DEFAULT 0;
+ALTER TABLE beats ADD COLUMN file_type varchar(32) NOT NULL DEFAULT '';
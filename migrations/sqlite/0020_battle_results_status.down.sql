@@ -0,0 +1 @@
+-- Nothing to undo: SQLite databases never had a results column.
@@ -0,0 +1 @@
+-- SQLite support came after battles had a status, so no SQLite database has a results column to convert.
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// QualificationRules are what an entrant has to do during voting for their entry to place.
+type QualificationRules struct {
+	// MinVotes is how many entries an entrant has to vote for, rank or fully score.
+	MinVotes int `gorm:"column:min_votes" json:"min_votes"`
+	// RequireFeedback has entrants also leave feedback on as many entries as they have to vote for.
+	RequireFeedback bool `gorm:"column:require_feedback" json:"require_feedback"`
+	// EntrantsOnly stops anyone but entrants & accepted judges from voting.
+	EntrantsOnly bool `gorm:"column:entrants_only" json:"entrants_only"`
+}
+
+// QualificationStatus is where an entrant stands against their battle's qualification rules.
+type QualificationStatus struct {
+	Qualified      bool   `json:"qualified"`
+	VotesNeeded    int    `json:"votes_needed"`
+	FeedbackNeeded int    `json:"feedback_needed"`
+	Message        string `json:"message"`
+}
+
+// ParseQualificationRules reads the qualification rules from a battle form. A battle without a
+// minimum keeps the old rule of one vote.
+func ParseQualificationRules(c echo.Context) QualificationRules {
+	minVotes, err := strconv.Atoi(strings.TrimSpace(c.FormValue("min_votes")))
+	if err != nil || minVotes < 0 {
+		minVotes = 1
+	}
+
+	return QualificationRules{
+		MinVotes:        minVotes,
+		RequireFeedback: c.FormValue("require_feedback") == "1",
+		EntrantsOnly:    c.FormValue("entrants_only") == "1",
+	}
+}
+
+// CheckQualification compares what an entrant has done with their battle's rules. cast is how many entries
+// they've voted for, ranked or fully scored, feedback how many they've left feedback on and eligible how many
+// they can vote for. The minimum is lowered to what the battle allows, so every entrant can still qualify.
+func CheckQualification(battle Battle, cast int, feedback int, eligible int) QualificationStatus {
+	required := battle.Qualification.MinVotes
+	if required > eligible {
+		required = eligible
+	}
+	if battle.VotingMode != VotingScore && required > battle.MaxVotes {
+		required = battle.MaxVotes
+	}
+
+	requiredFeedback := 0
+	if battle.Qualification.RequireFeedback {
+		requiredFeedback = required
+		if requiredFeedback == 0 && eligible > 0 {
+			requiredFeedback = 1
+		}
+	}
+
+	status := QualificationStatus{}
+	if cast < required {
+		status.VotesNeeded = required - cast
+	}
+	if feedback < requiredFeedback {
+		status.FeedbackNeeded = requiredFeedback - feedback
+	}
+	status.Qualified = status.VotesNeeded == 0 && status.FeedbackNeeded == 0
+
+	if status.Qualified {
+		status.Message = "Qualified"
+		return status
+	}
+
+	needed := []string{}
+	if status.VotesNeeded > 0 {
+		verb := "Vote For"
+		switch battle.VotingMode {
+		case VotingRanked:
+			verb = "Rank"
+		case VotingScore:
+			verb = "Score"
+		}
+		needed = append(needed, verb+" "+strconv.Itoa(status.VotesNeeded)+" More")
+	}
+	if status.FeedbackNeeded > 0 {
+		needed = append(needed, "Give Feedback On "+strconv.Itoa(status.FeedbackNeeded)+" More")
+	}
+	status.Message = "Not Yet Qualified: " + strings.Join(needed, ", ")
+
+	return status
+}
+
+// votesCast counts how many entries each user has voted for, ranked or scored on every criterion in a battle.
+func (app *App) votesCast(battle Battle) (map[int]int, error) {
+	cast := map[int]int{}
+	switch battle.VotingMode {
+	case VotingRanked:
+		ballots, err := app.Votes.Ballots(battle.ID)
+		if err != nil {
+			return nil, err
+		}
+		for userID, ballot := range ballots {
+			cast[userID] = len(ballot)
+		}
+	case VotingScore:
+		criteria, err := app.Battles.Criteria(battle.ID)
+		if err != nil {
+			return nil, err
+		}
+		scores, err := app.Votes.Scores(battle.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		scored := map[[2]int]int{}
+		for _, score := range scores {
+			scored[[2]int{score.UserID, score.BeatID}]++
+		}
+		for key, count := range scored {
+			if count >= len(criteria) {
+				cast[key[0]]++
+			}
+		}
+	default:
+		voters, err := app.Votes.Voters(battle.ID)
+		if err != nil {
+			return nil, err
+		}
+		for userID, beatIDs := range voters {
+			cast[userID] = len(beatIDs)
+		}
+	}
+
+	return cast, nil
+}
+
+// Qualifications checks every entrant of a battle against its rules, keyed by artist ID. Team members are
+// keyed in with their entry's status.
+func (app *App) Qualifications(battle Battle, beats []Beat) (map[int]QualificationStatus, error) {
+	cast, err := app.votesCast(battle)
+	if err != nil {
+		return nil, err
+	}
+
+	feedback, err := app.Feedback.Counts(battle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	credits, err := app.teamCredits(battle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[int]QualificationStatus{}
+	for _, beat := range beats {
+		// A team entry counts the most votes & feedback any of its members has given, and they all share its status.
+		votes, given := cast[beat.Artist.ID], feedback[beat.Artist.ID]
+		for userID := range credits[beat.ID] {
+			votes = max(votes, cast[userID])
+			given = max(given, feedback[userID])
+		}
+
+		// Entrants can't vote for their own entry.
+		status := CheckQualification(battle, votes, given, len(beats)-1)
+		statuses[beat.Artist.ID] = status
+		for userID := range credits[beat.ID] {
+			statuses[userID] = status
+		}
+	}
+
+	return statuses, nil
+}
+
+// mayVote reports whether a user can vote in a battle. Entrants-only battles let in entrants, their team
+// members & accepted judges.
+func (app *App) mayVote(battle Battle, userID int) (bool, error) {
+	if !battle.Qualification.EntrantsOnly {
+		return true, nil
+	}
+
+	_, err := app.Beats.GetByUser(battle.ID, userID)
+	if err == nil {
+		return true, nil
+	}
+	if err != ErrNotFound {
+		return false, err
+	}
+
+	credits, err := app.teamCredits(battle.ID)
+	if err != nil {
+		return false, err
+	}
+	for _, members := range credits {
+		if members[userID] {
+			return true, nil
+		}
+	}
+
+	accepted, err := app.acceptedJudges(battle.ID)
+	if err != nil {
+		return false, err
+	}
+	return accepted[userID], nil
+}
+
+// QualificationJSON - Returns the logged in entrant's qualification status, so the battle page can update it after every vote.
+func (app *App) QualificationJSON(c echo.Context) error {
+	me := app.GetUser(c, false)
+	if !me.Authenticated {
+		return c.JSON(http.StatusUnauthorized, QualificationStatus{})
+	}
+
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, QualificationStatus{})
+	}
+
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		return c.JSON(http.StatusNotFound, QualificationStatus{})
+	}
+
+	beats, err := app.Beats.ListByBattle(battleID)
+	if err != nil {
+		log.Println(err)
+		return c.JSON(http.StatusInternalServerError, QualificationStatus{})
+	}
+
+	statuses, err := app.Qualifications(battle, beats)
+	if err != nil {
+		log.Println(err)
+		return c.JSON(http.StatusInternalServerError, QualificationStatus{})
+	}
+
+	status, ok := statuses[me.ID]
+	if !ok {
+		return c.JSON(http.StatusNotFound, QualificationStatus{})
+	}
+
+	return c.JSON(http.StatusOK, status)
+}
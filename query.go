@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BattleSort is the order a battle listing comes back in.
+type BattleSort string
+
+// Battle sort orders. Ties are always broken by newest battle first.
+const (
+	SortDeadline BattleSort = "deadline"
+	SortNewest   BattleSort = "newest"
+	SortEntries  BattleSort = "entries"
+	SortTitle    BattleSort = "title"
+)
+
+// BattleQuery describes which battles to list. Zero values don't filter.
+type BattleQuery struct {
+	Status     []BattleStatus
+	PublicOnly bool
+	HostID     int
+	Tag        string
+	Type       string
+	// Battles whose deadline falls in [DeadlineFrom, DeadlineTo).
+	DeadlineFrom time.Time
+	DeadlineTo   time.Time
+	MinEntries   int
+	MaxEntries   int
+	// Text matches the title or rules.
+	Text string
+	Sort BattleSort
+	// After continues a listing from the cursor of the previous page.
+	After  *BattleCursor
+	Limit  int
+	Offset int
+}
+
+// BattleCursor is the sort position of the last battle on a page.
+// Only the field for the query's sort is set, with the ID breaking ties.
+type BattleCursor struct {
+	ID       int       `json:"i"`
+	Deadline time.Time `json:"d,omitempty"`
+	Entries  int       `json:"e,omitempty"`
+	Title    string    `json:"t,omitempty"`
+}
+
+// CursorAfter returns the cursor that continues a listing after battle.
+func CursorAfter(sort BattleSort, battle Battle) BattleCursor {
+	cursor := BattleCursor{ID: battle.ID}
+	switch sort {
+	case SortNewest:
+	case SortEntries:
+		cursor.Entries = battle.Entries
+	case SortTitle:
+		cursor.Title = battle.Title
+	default:
+		cursor.Deadline = battle.Deadline
+	}
+	return cursor
+}
+
+// String encodes the cursor for a URL.
+func (cursor BattleCursor) String() string {
+	cursorJSON, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+// ParseBattleCursor decodes a cursor made by BattleCursor.String.
+func ParseBattleCursor(value string) (BattleCursor, error) {
+	cursor := BattleCursor{}
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(cursorJSON, &cursor)
+	return cursor, err
+}
+
+// OpenBattles lists public battles taking entries or votes.
+func OpenBattles() BattleQuery {
+	return BattleQuery{Status: []BattleStatus{StatusEntry, StatusVoting}, PublicOnly: true}
+}
+
+// TaggedBattles lists the public battles under a tag, leaving out drafts.
+func TaggedBattles(tag string) BattleQuery {
+	return BattleQuery{Status: []BattleStatus{StatusEntry, StatusVoting, StatusComplete}, PublicOnly: true, Tag: tag}
+}
+
+// HostBattles lists the battles a user hosts. Other viewers don't see their drafts or private battles.
+func HostBattles(hostID int, viewerID int) BattleQuery {
+	if viewerID == hostID {
+		return BattleQuery{HostID: hostID}
+	}
+	return BattleQuery{Status: []BattleStatus{StatusEntry, StatusVoting, StatusComplete}, PublicOnly: true, HostID: hostID}
+}
+
+// PastBattles lists complete battles.
+func PastBattles() BattleQuery {
+	return BattleQuery{Status: []BattleStatus{StatusComplete}}
+}
+
+// ParseBattleQuery narrows a page's base query with the request's query string.
+//
+//	?type=rap&tag=lofi&q=drums&sort=entries&min_entries=5&from=2020-01-01&limit=20&cursor=...
+func ParseBattleQuery(c echo.Context, query BattleQuery) BattleQuery {
+	if tag := NormalizeTag(policy.Sanitize(c.QueryParam("tag"))); tag != "" {
+		query.Tag = tag
+	}
+
+	switch battleType := c.QueryParam("type"); battleType {
+	case "beat", "rap", "art":
+		query.Type = battleType
+	}
+
+	if text := strings.TrimSpace(policy.Sanitize(c.QueryParam("q"))); text != "" {
+		query.Text = text
+	}
+
+	switch sort := BattleSort(c.QueryParam("sort")); sort {
+	case SortDeadline, SortNewest, SortEntries, SortTitle:
+		query.Sort = sort
+	}
+
+	if cursor, err := ParseBattleCursor(c.QueryParam("cursor")); err == nil && cursor.ID > 0 {
+		query.After = &cursor
+	}
+
+	query.MinEntries = queryInt(c, "min_entries", query.MinEntries)
+	query.MaxEntries = queryInt(c, "max_entries", query.MaxEntries)
+	query.Limit = queryInt(c, "limit", query.Limit)
+	query.Offset = queryInt(c, "offset", query.Offset)
+
+	layoutISO := "2006-01-02"
+	if from, err := time.Parse(layoutISO, c.QueryParam("from")); err == nil {
+		query.DeadlineFrom = from
+	}
+	if to, err := time.Parse(layoutISO, c.QueryParam("to")); err == nil {
+		// "to" is inclusive of the whole day.
+		query.DeadlineTo = to.AddDate(0, 0, 1)
+	}
+
+	return query
+}
+
+// queryInt reads a non-negative integer query parameter, keeping fallback if it's missing or invalid.
+func queryInt(c echo.Context, name string, fallback int) int {
+	value, err := strconv.Atoi(c.QueryParam(name))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
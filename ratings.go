@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RatingAll is the rating category every battle counts towards. Each battle type is a category too.
+const RatingAll = "all"
+
+// ratingCategories are the categories in the order the leaderboard lists them.
+var ratingCategories = []string{RatingAll, "beat", "rap", "art"}
+
+// Elo constants. Every producer starts at initialRating, and ratingK is the most a battle can move a rating.
+const (
+	initialRating = 1500.0
+	ratingK       = 32.0
+)
+
+// ErrRatingsStale is returned for a battle that can't be rated in order. Running `ratings recompute` rates it.
+var ErrRatingsStale = errors.New("ratings are out of order, run ratings recompute")
+
+// ratingWindows are the leaderboard's time windows. A zero duration means all time.
+var ratingWindows = map[string]time.Duration{
+	"month": 30 * 24 * time.Hour,
+	"year":  365 * 24 * time.Hour,
+	"all":   0,
+}
+
+// Rating is a user's current rating in a category.
+type Rating struct {
+	UserID    int
+	Category  string
+	Rating    float64
+	Battles   int
+	UpdatedAt time.Time
+}
+
+// RatingChange is how a battle moved an entrant's rating in a category.
+type RatingChange struct {
+	BattleID   int
+	UserID     int
+	Category   string
+	Placement  int
+	Before     float64
+	After      float64
+	FinishedAt time.Time
+	// Title is the battle's title, filled in when listing a user's history.
+	Title string
+}
+
+// Delta is how far the battle moved the rating.
+func (change RatingChange) Delta() float64 {
+	return change.After - change.Before
+}
+
+// LeaderboardQuery picks the leaderboard's category and window. Users rated before Since are left out.
+type LeaderboardQuery struct {
+	Category string
+	Since    time.Time
+	Limit    int
+}
+
+// LeaderboardRow is a user's line on the leaderboard. Battles and Change only count the window.
+type LeaderboardRow struct {
+	Rank    int
+	User    User
+	Rating  float64
+	Battles int
+	Change  float64
+}
+
+// isRatingCategory checks if the category is one the leaderboard lists.
+func isRatingCategory(category string) bool {
+	for _, c := range ratingCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// RateMatch treats a battle as a multiplayer Elo match: every placed entrant plays every other, winning
+// against the entrants they placed above and drawing with the ones they tied. Each result is worth
+// ratingK/(n-1), so a battle moves a rating by at most ratingK however many entered.
+func RateMatch(ratings map[int]float64, placements map[int]int) map[int]float64 {
+	rated := map[int]float64{}
+	if len(placements) < 2 {
+		return rated
+	}
+
+	k := ratingK / float64(len(placements)-1)
+	for userID, placement := range placements {
+		delta := 0.0
+		for opponentID, opponentPlacement := range placements {
+			if opponentID == userID {
+				continue
+			}
+
+			expected := 1 / (1 + math.Pow(10, (ratings[opponentID]-ratings[userID])/400))
+			actual := 0.5
+			if placement < opponentPlacement {
+				actual = 1
+			} else if placement > opponentPlacement {
+				actual = 0
+			}
+			delta += actual - expected
+		}
+		rated[userID] = ratings[userID] + k*delta
+	}
+
+	return rated
+}
+
+// RateBattle updates the ratings of a complete battle's entrants from its final placements. Ratings have to
+// be applied in the order battles finish, so a battle that was already rated, or that finished before the
+// last rated battle, is left for `ratings recompute` and ErrRatingsStale is returned.
+func (app *App) RateBattle(battle Battle) error {
+	stale, err := app.Ratings.RatedAfter(battle.ID, battle.VotingDeadline)
+	if err != nil {
+		return err
+	}
+	if stale {
+		return ErrRatingsStale
+	}
+	return app.rateBattle(battle)
+}
+
+// rateBattle applies a battle's placements to its entrants' overall and battle type ratings.
+// Disqualified entries don't count.
+func (app *App) rateBattle(battle Battle) error {
+	beats, err := app.Beats.ListByBattle(battle.ID)
+	if err != nil {
+		return err
+	}
+
+	placements := map[int]int{}
+	userIDs := []int{}
+	for _, beat := range beats {
+		if beat.Placement > 0 {
+			placements[beat.Artist.ID] = beat.Placement
+			userIDs = append(userIDs, beat.Artist.ID)
+		}
+	}
+	if len(placements) < 2 {
+		return nil
+	}
+
+	changes := []RatingChange{}
+	for _, category := range []string{RatingAll, strings.ToLower(battle.Type)} {
+		current, err := app.Ratings.Get(category, userIDs)
+		if err != nil {
+			return err
+		}
+
+		ratings := map[int]float64{}
+		for _, userID := range userIDs {
+			ratings[userID] = initialRating
+			if rating, ok := current[userID]; ok {
+				ratings[userID] = rating.Rating
+			}
+		}
+
+		for userID, rating := range RateMatch(ratings, placements) {
+			changes = append(changes, RatingChange{
+				BattleID:   battle.ID,
+				UserID:     userID,
+				Category:   category,
+				Placement:  placements[userID],
+				Before:     ratings[userID],
+				After:      rating,
+				FinishedAt: battle.VotingDeadline,
+			})
+		}
+	}
+
+	return app.Ratings.SaveChanges(changes)
+}
+
+// RecomputeRatings throws every rating away and rates the complete battles again in the order they finished.
+func (app *App) RecomputeRatings() error {
+	start := time.Now()
+
+	battles, err := app.Battles.List(BattleQuery{Status: []BattleStatus{StatusComplete}})
+	if err != nil {
+		return err
+	}
+	sort.Slice(battles, func(i, j int) bool {
+		if !battles[i].VotingDeadline.Equal(battles[j].VotingDeadline) {
+			return battles[i].VotingDeadline.Before(battles[j].VotingDeadline)
+		}
+		return battles[i].ID < battles[j].ID
+	})
+
+	err = app.Ratings.Reset()
+	if err != nil {
+		return err
+	}
+
+	for _, battle := range battles {
+		err = app.rateBattle(battle)
+		if err != nil {
+			return err
+		}
+	}
+
+	duration := time.Since(start)
+	fmt.Println("RecomputeRatings time: " + duration.String())
+	return nil
+}
+
+// UserRatings returns a user's current rating in every category they've been rated in, and their recent overall rating history.
+func (app *App) UserRatings(userID int) ([]Rating, []RatingChange) {
+	ratings := []Rating{}
+	for _, category := range ratingCategories {
+		current, err := app.Ratings.Get(category, []int{userID})
+		if err != nil {
+			log.Println(err)
+			return []Rating{}, []RatingChange{}
+		}
+		if rating, ok := current[userID]; ok {
+			ratings = append(ratings, rating)
+		}
+	}
+
+	history, err := app.Ratings.History(userID, RatingAll, 10)
+	if err != nil {
+		log.Println(err)
+		return ratings, []RatingChange{}
+	}
+	for i := range history {
+		history[i].Title = html.UnescapeString(history[i].Title)
+	}
+
+	return ratings, history
+}
+
+// ViewLeaderboard - Shows the highest rated producers, filtered by ?type= and ?window=.
+func (app *App) ViewLeaderboard(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	category := strings.ToLower(c.QueryParam("type"))
+	if !isRatingCategory(category) {
+		category = RatingAll
+	}
+
+	window := strings.ToLower(c.QueryParam("window"))
+	if _, ok := ratingWindows[window]; !ok {
+		window = "all"
+	}
+
+	q := LeaderboardQuery{Category: category, Limit: 100}
+	if ratingWindows[window] > 0 {
+		q.Since = time.Now().Add(-ratingWindows[window])
+	}
+
+	rows, err := app.Ratings.Leaderboard(q)
+	if err != nil {
+		log.Println(err)
+		rows = []LeaderboardRow{}
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     "Beatbattle.app - Leaderboard",
+			"Analytics": analyticsKey,
+		},
+		"Rows":       rows,
+		"Category":   category,
+		"Categories": ratingCategories,
+		"Window":     window,
+		"Me":         me,
+		"Toast":      toast,
+		"Ads":        ads,
+	}
+
+	duration := time.Since(start)
+	fmt.Println("ViewLeaderboard time: " + duration.String())
+
+	return c.Render(http.StatusOK, "Leaderboard", m)
+}
+
+// RunRatings is the `ratings recompute` command, which rebuilds every rating from the complete battles.
+func RunRatings(app *App, args []string) {
+	if len(args) == 0 || args[0] != "recompute" {
+		fmt.Println("usage: ratings recompute")
+		return
+	}
+
+	err := app.RecomputeRatings()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("Recomputed ratings")
+}
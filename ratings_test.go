@@ -0,0 +1,119 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRateMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		ratings    map[int]float64
+		placements map[int]int
+		rated      map[int]float64
+	}{
+		{"nobody", map[int]float64{}, map[int]int{}, map[int]float64{}},
+		{"unopposed", map[int]float64{1: 1500}, map[int]int{1: 1}, map[int]float64{}},
+		{"even win", map[int]float64{1: 1500, 2: 1500}, map[int]int{1: 1, 2: 2}, map[int]float64{1: 1516, 2: 1484}},
+		{"even tie", map[int]float64{1: 1500, 2: 1500}, map[int]int{1: 1, 2: 1}, map[int]float64{1: 1500, 2: 1500}},
+		{"upset", map[int]float64{1: 1400, 2: 1600}, map[int]int{1: 1, 2: 2}, map[int]float64{1: 1424.3119016527346, 2: 1575.6880983472654}},
+		{"favourite wins", map[int]float64{1: 1600, 2: 1400}, map[int]int{1: 1, 2: 2}, map[int]float64{1: 1607.6880983472654, 2: 1392.3119016527346}},
+		// Each of the two results is worth half as much, so the winner still gains at most ratingK.
+		{"three entrants", map[int]float64{1: 1500, 2: 1500, 3: 1500}, map[int]int{1: 1, 2: 2, 3: 3}, map[int]float64{1: 1516, 2: 1500, 3: 1484}},
+		{"tied for second", map[int]float64{1: 1500, 2: 1500, 3: 1400}, map[int]int{1: 1, 2: 2, 3: 2},
+			map[int]float64{1: 1513.7589600031538, 2: 1489.7589600031538, 3: 1396.4820799936924}},
+	}
+	for _, test := range tests {
+		rated := RateMatch(test.ratings, test.placements)
+		if len(rated) != len(test.rated) {
+			t.Errorf("%s: rated %v, want %v", test.name, rated, test.rated)
+			continue
+		}
+		before, after := 0.0, 0.0
+		for userID, want := range test.rated {
+			if math.Abs(rated[userID]-want) > 1e-9 {
+				t.Errorf("%s: user %d rated %v, want %v", test.name, userID, rated[userID], want)
+			}
+			before += test.ratings[userID]
+			after += rated[userID]
+		}
+		// Every point one entrant gains, another loses.
+		if math.Abs(after-before) > 1e-9 {
+			t.Errorf("%s: ratings total %v after the battle, want %v", test.name, after, before)
+		}
+	}
+}
+
+// TestRecomputeRatings rates battles that were completed out of order as if they'd finished in order.
+func TestRecomputeRatings(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	bob := testUser(t, app, "Bob")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	battles := []Battle{}
+	winners := []User{alice, bob}
+	for i, winner := range winners {
+		battle := Battle{Title: "Test Battle", Host: host, Type: "beat", Status: StatusComplete,
+			Deadline: now.Add(time.Duration(i-3) * time.Hour), VotingDeadline: now.Add(time.Duration(i-2) * time.Hour)}
+		var err error
+		battle.ID, err = app.Battles.Insert(battle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results := []BeatResult{}
+		for _, user := range []User{alice, bob} {
+			beat := testEntry(t, app, battle, user)
+			placement := 2
+			if user.ID == winner.ID {
+				placement = 1
+			}
+			results = append(results, BeatResult{BeatID: beat.ID, Voted: true, Placement: placement})
+		}
+		err = app.Beats.SaveResults(results)
+		if err != nil {
+			t.Fatal(err)
+		}
+		battles = append(battles, battle)
+	}
+
+	// The later battle is rated first, which leaves the earlier one to the recompute.
+	err := app.RateBattle(battles[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.RateBattle(battles[0])
+	if err != ErrRatingsStale {
+		t.Fatalf("rating an earlier battle: err = %v, want ErrRatingsStale", err)
+	}
+
+	err = app.RecomputeRatings()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[int]float64{alice.ID: initialRating, bob.ID: initialRating}
+	want = RateMatch(want, map[int]int{alice.ID: 1, bob.ID: 2})
+	want = RateMatch(want, map[int]int{alice.ID: 2, bob.ID: 1})
+	for _, category := range []string{RatingAll, "beat"} {
+		ratings, err := app.Ratings.Get(category, []int{alice.ID, bob.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for userID, rating := range want {
+			if math.Abs(ratings[userID].Rating-rating) > 1e-9 || ratings[userID].Battles != 2 {
+				t.Errorf("%s: user %d rated %v after %d battles, want %v after 2", category, userID, ratings[userID].Rating, ratings[userID].Battles, rating)
+			}
+		}
+	}
+
+	history, err := app.Ratings.History(alice.ID, RatingAll, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 || history[0].BattleID != battles[1].ID || history[1].BattleID != battles[0].ID {
+		t.Errorf("alice's history = %+v, want the later battle then the earlier one", history)
+	}
+}
@@ -0,0 +1,403 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ErrNotTrack is returned when a link is to a provider's site but not to one of its tracks, like a profile or playlist.
+var ErrNotTrack = errors.New("link is not to a track")
+
+// maxResolveBody caps how much of a provider's response is read when looking up a track.
+const maxResolveBody = 1 << 20
+
+// maxShortLinkHops caps how many redirects a short link can take to reach its track.
+const maxShortLinkHops = 5
+
+// audioTimeout is how long downloading a track's audio for analysis can take. It's longer than a lookup,
+// but the entrant waits on it, so audio that's slower than this is left unanalysed and its length unverified.
+const audioTimeout = 15 * time.Second
+
+// shortLinkHosts only redirect to tracks, so they're followed before a link is checked against a battle's URL policy.
+var shortLinkHosts = []string{"goo.gl", "on.soundcloud.com"}
+
+// TrackEmbed is how a beat's track plays on the site, worked out by its provider's resolver when it's entered.
+type TrackEmbed struct {
+	Provider string `json:"provider"`
+	// TrackID is the provider's ID for the track, or its permalink path when the provider couldn't be reached.
+	TrackID string `json:"track_id"`
+	// Secret is the token private tracks are shared with.
+	Secret string `json:"secret,omitempty"`
+	// URL is the provider's player for the track. Tracks without one open their link instead.
+	URL    string `json:"url"`
+	Height int    `json:"height"`
+}
+
+// ResolvedTrack is a track link in its canonical form, with how to embed it.
+type ResolvedTrack struct {
+	URL   string
+	Embed TrackEmbed
+	// Audio is where the track's audio can be downloaded for analysis, for providers that allow it.
+	Audio string
+}
+
+// TrackResolver works out one provider's tracks from links to them.
+type TrackResolver interface {
+	// Match reports whether a link is on the provider's site.
+	Match(link *url.URL) bool
+	// Resolve canonicalizes a link and works out its track's ID and embed, looking the track up with client.
+	// A nil client resolves what it can without lookups. When a lookup fails the track is still returned,
+	// embedded from its link where the provider allows it, along with the error.
+	Resolve(client *http.Client, link *url.URL) (ResolvedTrack, error)
+}
+
+// TrackResolvers picks the resolver for a track link. Links no resolver matches are kept as they are.
+type TrackResolvers struct {
+	// Client makes the lookups. Swap it for one with a recording transport to resolve without the network.
+	Client *http.Client
+	// AudioClient downloads audio to analyse. It's Client with audioTimeout, since audio can be megabytes.
+	AudioClient *http.Client
+	Resolvers   []TrackResolver
+}
+
+// NewTrackResolvers returns the resolvers for every provider the site embeds.
+func NewTrackResolvers(client *http.Client) *TrackResolvers {
+	var audioClient *http.Client
+	if client != nil {
+		copied := *client
+		copied.Timeout = audioTimeout
+		audioClient = &copied
+	}
+	return &TrackResolvers{
+		Client:      client,
+		AudioClient: audioClient,
+		Resolvers:   []TrackResolver{soundCloudResolver{}, audiusResolver{}, youTubeResolver{}, bandcampResolver{}},
+	}
+}
+
+// Expand follows a short link to the track it leads to. Other links are returned as they are.
+func (r *TrackResolvers) Expand(link *url.URL) (*url.URL, error) {
+	client := *r.Client
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	for hops := 0; HostAllowed(link, shortLinkHosts); hops++ {
+		if hops == maxShortLinkHops {
+			return nil, fmt.Errorf("short link %s redirects too many times", link)
+		}
+
+		resp, err := client.Get(link.String())
+		if err != nil {
+			return nil, err
+		}
+		resp.Body.Close()
+
+		location, err := resp.Location()
+		if err != nil {
+			return nil, fmt.Errorf("short link %s doesn't redirect: %s", link, resp.Status)
+		}
+		next, ok := ParseLink(location.String())
+		if !ok {
+			return nil, fmt.Errorf("short link %s redirects to %s", link, location)
+		}
+		link = next
+	}
+
+	return link, nil
+}
+
+// Resolve works out a track link with its provider's resolver.
+func (r *TrackResolvers) Resolve(link *url.URL) (ResolvedTrack, error) {
+	for _, resolver := range r.Resolvers {
+		if resolver.Match(link) {
+			return resolver.Resolve(r.Client, link)
+		}
+	}
+	return ResolvedTrack{URL: link.String()}, nil
+}
+
+// Analyse downloads a resolved track's audio and analyses it. Tracks whose provider doesn't allow
+// downloads, or that are bigger than an MP3 upload can be, aren't analysed.
+func (r *TrackResolvers) Analyse(track ResolvedTrack) (AudioInfo, error) {
+	if track.Audio == "" || r.AudioClient == nil {
+		return AudioInfo{}, nil
+	}
+
+	resp, err := r.AudioClient.Get(track.Audio)
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return AudioInfo{}, fmt.Errorf("audio for %s: %s", track.URL, resp.Status)
+	}
+
+	// Analysis seeks around the file, so the download is kept in memory.
+	limit := uploadFormats[0].Limit
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return AudioInfo{}, err
+	}
+	if int64(len(data)) > limit {
+		return AudioInfo{}, fmt.Errorf("audio for %s is over %d bytes", track.URL, limit)
+	}
+	return AnalyseAudio(bytes.NewReader(data))
+}
+
+// Offline works out the embed for a beat entered before tracks were resolved, without any lookups.
+func (r *TrackResolvers) Offline(beat Beat) TrackEmbed {
+	if beat.Embed.Provider != "" {
+		return beat.Embed
+	}
+
+	link, ok := ParseLink(beat.URL)
+	if !ok {
+		return TrackEmbed{}
+	}
+	for _, resolver := range r.Resolvers {
+		if resolver.Match(link) {
+			track, _ := resolver.Resolve(nil, link)
+			return track.Embed
+		}
+	}
+	return TrackEmbed{}
+}
+
+// lookup GETs a provider URL, reading up to maxResolveBody of the response.
+func lookup(client *http.Client, target string) ([]byte, error) {
+	resp, err := client.Get(target)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("lookup %s: %s", target, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxResolveBody))
+}
+
+// pathSegments splits a link's path, dropping empty segments.
+func pathSegments(link *url.URL) []string {
+	segments := []string{}
+	for _, segment := range strings.Split(link.Path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+/*-------
+SoundCloud
+-------*/
+
+// soundCloudPages are the first path segments under a SoundCloud user that aren't tracks.
+var soundCloudPages = []string{"sets", "likes", "tracks", "reposts", "albums", "popular-tracks", "followers", "following", "comments"}
+
+// soundCloudTrackID finds the track ID in the player SoundCloud's oEmbed returns.
+var soundCloudTrackID = regexp.MustCompile(`tracks(?:%2F|/)(\d+)`)
+
+type soundCloudResolver struct{}
+
+func (soundCloudResolver) Match(link *url.URL) bool {
+	return HostAllowed(link, []string{"soundcloud.com"})
+}
+
+// Resolve reads tracks like soundcloud.com/user/track, with private tracks' secret token either as a third segment
+// or a secret_token parameter. The track ID comes from SoundCloud's oEmbed.
+func (soundCloudResolver) Resolve(client *http.Client, link *url.URL) (ResolvedTrack, error) {
+	segments := pathSegments(link)
+	if len(segments) < 2 || containsTag(soundCloudPages, segments[1]) {
+		return ResolvedTrack{}, ErrNotTrack
+	}
+
+	permalink := "https://soundcloud.com/" + segments[0] + "/" + segments[1]
+	secret := link.Query().Get("secret_token")
+	if len(segments) > 2 && strings.HasPrefix(segments[2], "s-") {
+		secret = segments[2]
+	}
+
+	track := ResolvedTrack{URL: permalink}
+	if secret != "" {
+		track.URL += "/" + secret
+	}
+
+	embed := TrackEmbed{Provider: "soundcloud", TrackID: segments[0] + "/" + segments[1], Secret: secret, Height: 20}
+	player := permalink
+	var err error
+	if client != nil {
+		var body []byte
+		body, err = lookup(client, "https://soundcloud.com/oembed?format=json&url="+url.QueryEscape(track.URL))
+		if err == nil {
+			oembed := struct {
+				HTML string `json:"html"`
+			}{}
+			err = json.Unmarshal(body, &oembed)
+			if match := soundCloudTrackID.FindStringSubmatch(oembed.HTML); err == nil && match != nil {
+				embed.TrackID = match[1]
+				player = "https://api.soundcloud.com/tracks/" + match[1]
+			} else if err == nil {
+				err = fmt.Errorf("soundcloud oembed for %s has no track ID", track.URL)
+			}
+		}
+	}
+
+	embed.URL = "https://w.soundcloud.com/player/?url=" + url.QueryEscape(player)
+	if secret != "" {
+		embed.URL += "&secret_token=" + url.QueryEscape(secret)
+	}
+	embed.URL += "&color=%23ff5500&inverse=true&auto_play=true&show_user=false"
+	track.Embed = embed
+
+	return track, err
+}
+
+/*-------
+Audius
+-------*/
+
+// AudiusResolve is the response from Audius' resolve endpoint.
+type AudiusResolve struct {
+	Data AudiusResolveData `json:"data"`
+}
+
+// AudiusResolveData is the track an Audius link resolves to.
+type AudiusResolveData struct {
+	ID string `json:"id"`
+}
+
+type audiusResolver struct{}
+
+func (audiusResolver) Match(link *url.URL) bool {
+	return HostAllowed(link, []string{"audius.co"})
+}
+
+// Resolve reads tracks like audius.co/user/track. Audius only embeds by track ID, which comes from its API.
+func (audiusResolver) Resolve(client *http.Client, link *url.URL) (ResolvedTrack, error) {
+	segments := pathSegments(link)
+	if len(segments) != 2 {
+		return ResolvedTrack{}, ErrNotTrack
+	}
+
+	track := ResolvedTrack{
+		URL:   "https://audius.co/" + segments[0] + "/" + segments[1],
+		Embed: TrackEmbed{Provider: "audius", TrackID: segments[0] + "/" + segments[1]},
+	}
+	if client == nil {
+		return track, nil
+	}
+
+	body, err := lookup(client, "https://api.audius.co/v1/resolve?url="+url.QueryEscape(track.URL)+"&app_name=beatbattle.app")
+	if err != nil {
+		return track, err
+	}
+	resolved := AudiusResolve{}
+	err = json.Unmarshal(body, &resolved)
+	if err != nil {
+		return track, err
+	}
+	if resolved.Data.ID == "" {
+		return track, fmt.Errorf("audius resolve for %s has no track ID", track.URL)
+	}
+
+	track.Embed.TrackID = resolved.Data.ID
+	track.Embed.URL = "https://audius.co/embed/track/" + url.PathEscape(resolved.Data.ID) + "?flavor=compact"
+	track.Embed.Height = 120
+	track.Audio = "https://api.audius.co/v1/tracks/" + url.PathEscape(resolved.Data.ID) + "/stream?app_name=beatbattle.app"
+	return track, nil
+}
+
+/*-------
+YouTube
+-------*/
+
+// youTubeID is the shape of a YouTube video ID.
+var youTubeID = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+
+type youTubeResolver struct{}
+
+func (youTubeResolver) Match(link *url.URL) bool {
+	return HostAllowed(link, []string{"youtube.com", "youtu.be"})
+}
+
+// Resolve reads videos from watch, shorts, embed and live links, and youtu.be short links. It never needs a lookup.
+func (youTubeResolver) Resolve(client *http.Client, link *url.URL) (ResolvedTrack, error) {
+	segments := pathSegments(link)
+	videoID := link.Query().Get("v")
+	switch {
+	case HostAllowed(link, []string{"youtu.be"}) && len(segments) == 1:
+		videoID = segments[0]
+	case len(segments) == 2 && (segments[0] == "shorts" || segments[0] == "embed" || segments[0] == "live" || segments[0] == "v"):
+		videoID = segments[1]
+	case len(segments) != 1 || segments[0] != "watch":
+		videoID = ""
+	}
+	if !youTubeID.MatchString(videoID) {
+		return ResolvedTrack{}, ErrNotTrack
+	}
+
+	return ResolvedTrack{
+		URL: "https://www.youtube.com/watch?v=" + videoID,
+		Embed: TrackEmbed{
+			Provider: "youtube",
+			TrackID:  videoID,
+			URL:      "https://www.youtube-nocookie.com/embed/" + videoID + "?autoplay=1",
+			Height:   200,
+		},
+	}, nil
+}
+
+/*-------
+Bandcamp
+-------*/
+
+// bandcampTrackID finds the track ID in a Bandcamp track page's player or page properties.
+var bandcampTrackID = regexp.MustCompile(`EmbeddedPlayer/v=2/track=(\d+)|item_id(?:&quot;|"):(\d+)`)
+
+type bandcampResolver struct{}
+
+func (bandcampResolver) Match(link *url.URL) bool {
+	return HostAllowed(link, []string{"bandcamp.com"})
+}
+
+// Resolve reads tracks like artist.bandcamp.com/track/name. Bandcamp only embeds by track ID, which is on the track's page.
+func (bandcampResolver) Resolve(client *http.Client, link *url.URL) (ResolvedTrack, error) {
+	artist := strings.TrimSuffix(strings.ToLower(link.Hostname()), ".bandcamp.com")
+	segments := pathSegments(link)
+	if artist == "" || strings.Contains(artist, ".") || artist == "www" || len(segments) != 2 || segments[0] != "track" {
+		return ResolvedTrack{}, ErrNotTrack
+	}
+
+	track := ResolvedTrack{
+		URL:   "https://" + artist + ".bandcamp.com/track/" + segments[1],
+		Embed: TrackEmbed{Provider: "bandcamp", TrackID: artist + "/" + segments[1]},
+	}
+	if client == nil {
+		return track, nil
+	}
+
+	body, err := lookup(client, track.URL)
+	if err != nil {
+		return track, err
+	}
+	match := bandcampTrackID.FindSubmatch(body)
+	if match == nil {
+		return track, fmt.Errorf("bandcamp page %s has no track ID", track.URL)
+	}
+
+	trackID := string(match[1]) + string(match[2])
+	track.Embed.TrackID = trackID
+	track.Embed.URL = "https://bandcamp.com/EmbeddedPlayer/track=" + trackID + "/size=small/bgcol=ffffff/linkcol=0687f5/transparent=true/"
+	track.Embed.Height = 42
+	return track, nil
+}
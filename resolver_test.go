@@ -0,0 +1,343 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixture is a recorded provider response, served from testdata/resolver.
+type fixture struct {
+	Status   int
+	File     string
+	Location string
+}
+
+// resolverFixtures are the recorded responses, keyed by host and path, and for lookups of a link by its url parameter.
+var resolverFixtures = map[string]fixture{
+	"soundcloud.com/oembed?https://soundcloud.com/producer/sample-flip":        {Status: 200, File: "soundcloud_oembed.json"},
+	"soundcloud.com/oembed?https://soundcloud.com/producer/unreleased/s-AbCdE": {Status: 200, File: "soundcloud_oembed_private.json"},
+	"soundcloud.com/oembed?https://soundcloud.com/producer/loops":              {Status: 200, File: "soundcloud_oembed_playlist.json"},
+	"api.audius.co/v1/resolve?https://audius.co/producer/sample-flip":          {Status: 200, File: "audius_resolve.json"},
+	"api.audius.co/v1/resolve?https://audius.co/producer/deleted":              {Status: 404, File: "audius_not_found.json"},
+	"api.audius.co/v1/resolve?https://audius.co/producer/unlisted":             {Status: 200, File: "audius_not_found.json"},
+	"producer.bandcamp.com/track/sample-flip":                                  {Status: 200, File: "bandcamp_track.html"},
+	"producer.bandcamp.com/track/night-drive":                                  {Status: 200, File: "bandcamp_track_properties.html"},
+	"producer.bandcamp.com/track/removed":                                      {Status: 200, File: "bandcamp_removed.html"},
+	"api.audius.co/v1/tracks/D7KyD/stream":                                     {Status: 200, File: "audius_stream.wav"},
+	"on.soundcloud.com/Ab12C":                                                  {Status: 302, Location: "https://soundcloud.com/producer/sample-flip?si=abc123"},
+	"on.soundcloud.com/Loop1":                                                  {Status: 302, Location: "https://on.soundcloud.com/Loop2"},
+	"on.soundcloud.com/Loop2":                                                  {Status: 302, Location: "https://on.soundcloud.com/Loop1"},
+	"on.soundcloud.com/Away1":                                                  {Status: 302, Location: "ftp://files.example.com/flip.mp3"},
+}
+
+// fixtureTransport sends every request to the fixture server, keeping the host it was for.
+type fixtureTransport struct {
+	server *httptest.Server
+}
+
+func (f fixtureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	target, err := url.Parse(f.server.URL)
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme, req.URL.Host = target.Scheme, target.Host
+	return f.server.Client().Transport.RoundTrip(req)
+}
+
+// serveFixture answers a request with its recorded response. Anything that wasn't recorded is a 404.
+func serveFixture(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Host + r.URL.Path
+		if link := r.URL.Query().Get("url"); link != "" {
+			key += "?" + link
+		}
+		recorded, ok := resolverFixtures[key]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if recorded.Location != "" {
+			w.Header().Set("Location", recorded.Location)
+		}
+		body := []byte{}
+		if recorded.File != "" {
+			var err error
+			body, err = os.ReadFile("testdata/resolver/" + recorded.File)
+			if err != nil {
+				t.Error(err)
+			}
+		}
+		w.WriteHeader(recorded.Status)
+		w.Write(body)
+	}
+}
+
+// fixtureResolvers returns the site's resolvers looking tracks up in the recorded responses.
+func fixtureResolvers(t *testing.T) *TrackResolvers {
+	server := httptest.NewServer(serveFixture(t))
+	t.Cleanup(server.Close)
+	return NewTrackResolvers(&http.Client{Transport: fixtureTransport{server}})
+}
+
+func mustParseLink(t *testing.T, text string) *url.URL {
+	t.Helper()
+	link, ok := ParseLink(text)
+	if !ok {
+		t.Fatalf("%s isn't a link", text)
+	}
+	return link
+}
+
+func TestResolveTracks(t *testing.T) {
+	resolvers := fixtureResolvers(t)
+	tests := []struct {
+		link  string
+		url   string
+		embed TrackEmbed
+		audio string
+	}{
+		{
+			link: "https://soundcloud.com/producer/sample-flip?utm_source=clipboard",
+			url:  "https://soundcloud.com/producer/sample-flip",
+			embed: TrackEmbed{Provider: "soundcloud", TrackID: "123456789", Height: 20,
+				URL: "https://w.soundcloud.com/player/?url=https%3A%2F%2Fapi.soundcloud.com%2Ftracks%2F123456789&color=%23ff5500&inverse=true&auto_play=true&show_user=false"},
+		},
+		{
+			link: "https://m.soundcloud.com/producer/unreleased/s-AbCdE",
+			url:  "https://soundcloud.com/producer/unreleased/s-AbCdE",
+			embed: TrackEmbed{Provider: "soundcloud", TrackID: "987654321", Secret: "s-AbCdE", Height: 20,
+				URL: "https://w.soundcloud.com/player/?url=https%3A%2F%2Fapi.soundcloud.com%2Ftracks%2F987654321&secret_token=s-AbCdE&color=%23ff5500&inverse=true&auto_play=true&show_user=false"},
+		},
+		{
+			link: "https://audius.co/producer/sample-flip",
+			url:  "https://audius.co/producer/sample-flip",
+			embed: TrackEmbed{Provider: "audius", TrackID: "D7KyD", Height: 120,
+				URL: "https://audius.co/embed/track/D7KyD?flavor=compact"},
+			audio: "https://api.audius.co/v1/tracks/D7KyD/stream?app_name=beatbattle.app",
+		},
+		{
+			link: "https://youtu.be/dQw4w9WgXcQ?t=42",
+			url:  "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			embed: TrackEmbed{Provider: "youtube", TrackID: "dQw4w9WgXcQ", Height: 200,
+				URL: "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?autoplay=1"},
+		},
+		{
+			link: "https://www.youtube.com/shorts/dQw4w9WgXcQ",
+			url:  "https://www.youtube.com/watch?v=dQw4w9WgXcQ",
+			embed: TrackEmbed{Provider: "youtube", TrackID: "dQw4w9WgXcQ", Height: 200,
+				URL: "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?autoplay=1"},
+		},
+		{
+			link: "https://producer.bandcamp.com/track/sample-flip",
+			url:  "https://producer.bandcamp.com/track/sample-flip",
+			embed: TrackEmbed{Provider: "bandcamp", TrackID: "2748119397", Height: 42,
+				URL: "https://bandcamp.com/EmbeddedPlayer/track=2748119397/size=small/bgcol=ffffff/linkcol=0687f5/transparent=true/"},
+		},
+		{
+			link: "https://Producer.Bandcamp.com/track/night-drive",
+			url:  "https://producer.bandcamp.com/track/night-drive",
+			embed: TrackEmbed{Provider: "bandcamp", TrackID: "3141592653", Height: 42,
+				URL: "https://bandcamp.com/EmbeddedPlayer/track=3141592653/size=small/bgcol=ffffff/linkcol=0687f5/transparent=true/"},
+		},
+		{
+			link: "https://drive.google.com/file/d/abc/view",
+			url:  "https://drive.google.com/file/d/abc/view",
+		},
+	}
+
+	for _, test := range tests {
+		track, err := resolvers.Resolve(mustParseLink(t, test.link))
+		if err != nil {
+			t.Errorf("%s: %v", test.link, err)
+			continue
+		}
+		if track.URL != test.url {
+			t.Errorf("%s: url = %s, want %s", test.link, track.URL, test.url)
+		}
+		if track.Embed != test.embed {
+			t.Errorf("%s: embed = %+v, want %+v", test.link, track.Embed, test.embed)
+		}
+		if track.Audio != test.audio {
+			t.Errorf("%s: audio = %q, want %q", test.link, track.Audio, test.audio)
+		}
+	}
+}
+
+func TestResolveNotTracks(t *testing.T) {
+	resolvers := fixtureResolvers(t)
+	for _, link := range []string{
+		"https://soundcloud.com/producer",
+		"https://soundcloud.com/producer/sets/loops",
+		"https://soundcloud.com/producer/likes",
+		"https://audius.co/producer",
+		"https://audius.co/producer/playlist/loops",
+		"https://www.youtube.com/@producer",
+		"https://www.youtube.com/watch?v=short",
+		"https://www.youtube.com/playlist?list=PL123",
+		"https://producer.bandcamp.com/album/loops",
+		"https://bandcamp.com/track/sample-flip",
+	} {
+		_, err := resolvers.Resolve(mustParseLink(t, link))
+		if err != ErrNotTrack {
+			t.Errorf("%s: err = %v, want ErrNotTrack", link, err)
+		}
+	}
+}
+
+// TestResolveLookupErrors keeps tracks whose provider lookup fails, embedded from their link where the
+// provider allows it, and returns the error to be logged.
+func TestResolveLookupErrors(t *testing.T) {
+	resolvers := fixtureResolvers(t)
+	tests := []struct {
+		link  string
+		url   string
+		embed TrackEmbed
+	}{
+		{
+			// The oEmbed is for a playlist, so it has no track ID.
+			link: "https://soundcloud.com/producer/loops",
+			url:  "https://soundcloud.com/producer/loops",
+			embed: TrackEmbed{Provider: "soundcloud", TrackID: "producer/loops", Height: 20,
+				URL: "https://w.soundcloud.com/player/?url=https%3A%2F%2Fsoundcloud.com%2Fproducer%2Floops&color=%23ff5500&inverse=true&auto_play=true&show_user=false"},
+		},
+		{
+			// SoundCloud doesn't know the track.
+			link: "https://soundcloud.com/producer/deleted",
+			url:  "https://soundcloud.com/producer/deleted",
+			embed: TrackEmbed{Provider: "soundcloud", TrackID: "producer/deleted", Height: 20,
+				URL: "https://w.soundcloud.com/player/?url=https%3A%2F%2Fsoundcloud.com%2Fproducer%2Fdeleted&color=%23ff5500&inverse=true&auto_play=true&show_user=false"},
+		},
+		{
+			link:  "https://audius.co/producer/deleted",
+			url:   "https://audius.co/producer/deleted",
+			embed: TrackEmbed{Provider: "audius", TrackID: "producer/deleted"},
+		},
+		{
+			// Audius answers without a track.
+			link:  "https://audius.co/producer/unlisted",
+			url:   "https://audius.co/producer/unlisted",
+			embed: TrackEmbed{Provider: "audius", TrackID: "producer/unlisted"},
+		},
+		{
+			// The page has no player.
+			link:  "https://producer.bandcamp.com/track/removed",
+			url:   "https://producer.bandcamp.com/track/removed",
+			embed: TrackEmbed{Provider: "bandcamp", TrackID: "producer/removed"},
+		},
+		{
+			link:  "https://producer.bandcamp.com/track/gone",
+			url:   "https://producer.bandcamp.com/track/gone",
+			embed: TrackEmbed{Provider: "bandcamp", TrackID: "producer/gone"},
+		},
+	}
+
+	for _, test := range tests {
+		track, err := resolvers.Resolve(mustParseLink(t, test.link))
+		if err == nil || err == ErrNotTrack {
+			t.Errorf("%s: err = %v, want a lookup error", test.link, err)
+		}
+		if track.URL != test.url || track.Embed != test.embed || track.Audio != "" {
+			t.Errorf("%s: track = %+v, want %s embedded as %+v", test.link, track, test.url, test.embed)
+		}
+	}
+}
+
+func TestResolveUnreachable(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	resolvers := NewTrackResolvers(&http.Client{Transport: fixtureTransport{server}})
+
+	track, err := resolvers.Resolve(mustParseLink(t, "https://soundcloud.com/producer/sample-flip"))
+	if err == nil {
+		t.Error("resolving with SoundCloud down: want an error")
+	}
+	if track.URL != "https://soundcloud.com/producer/sample-flip" || !strings.Contains(track.Embed.URL, "soundcloud.com%2Fproducer%2Fsample-flip") {
+		t.Errorf("track = %+v, want it playing from its link", track)
+	}
+}
+
+func TestExpandShortLinks(t *testing.T) {
+	resolvers := fixtureResolvers(t)
+
+	link, err := resolvers.Expand(mustParseLink(t, "https://on.soundcloud.com/Ab12C"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.String() != "https://soundcloud.com/producer/sample-flip?si=abc123" {
+		t.Errorf("expanded to %s", link)
+	}
+
+	link, err = resolvers.Expand(mustParseLink(t, "https://audius.co/producer/sample-flip"))
+	if err != nil || link.String() != "https://audius.co/producer/sample-flip" {
+		t.Errorf("expanding a full link: %v, %v", link, err)
+	}
+
+	for _, short := range []string{"https://on.soundcloud.com/Loop1", "https://on.soundcloud.com/Away1", "https://on.soundcloud.com/Gone1"} {
+		_, err = resolvers.Expand(mustParseLink(t, short))
+		if err == nil {
+			t.Errorf("%s: want an error", short)
+		}
+	}
+}
+
+func TestOfflineEmbeds(t *testing.T) {
+	resolvers := fixtureResolvers(t)
+	tests := []struct {
+		url   string
+		embed TrackEmbed
+	}{
+		{"https://soundcloud.com/producer/sample-flip", TrackEmbed{Provider: "soundcloud", TrackID: "producer/sample-flip", Height: 20,
+			URL: "https://w.soundcloud.com/player/?url=https%3A%2F%2Fsoundcloud.com%2Fproducer%2Fsample-flip&color=%23ff5500&inverse=true&auto_play=true&show_user=false"}},
+		{"https://audius.co/producer/sample-flip", TrackEmbed{Provider: "audius", TrackID: "producer/sample-flip"}},
+		{"https://www.youtube.com/watch?v=dQw4w9WgXcQ", TrackEmbed{Provider: "youtube", TrackID: "dQw4w9WgXcQ", Height: 200,
+			URL: "https://www.youtube-nocookie.com/embed/dQw4w9WgXcQ?autoplay=1"}},
+		{"https://producer.bandcamp.com/track/sample-flip", TrackEmbed{Provider: "bandcamp", TrackID: "producer/sample-flip"}},
+		{"https://drive.google.com/file/d/abc/view", TrackEmbed{}},
+		{"not a link", TrackEmbed{}},
+	}
+
+	for _, test := range tests {
+		embed := resolvers.Offline(Beat{URL: test.url})
+		if embed != test.embed {
+			t.Errorf("%s: embed = %+v, want %+v", test.url, embed, test.embed)
+		}
+	}
+
+	stored := TrackEmbed{Provider: "audius", TrackID: "D7KyD", URL: "https://audius.co/embed/track/D7KyD?flavor=compact", Height: 120}
+	if embed := resolvers.Offline(Beat{URL: "https://audius.co/producer/sample-flip", Embed: stored}); embed != stored {
+		t.Errorf("stored embed replaced with %+v", embed)
+	}
+}
+
+// TestAnalyseSlowAudio gives downloading audio longer than a lookup, which would time out first.
+func TestAnalyseSlowAudio(t *testing.T) {
+	fixtures := serveFixture(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fixtures(w, r)
+	}))
+	t.Cleanup(server.Close)
+	resolvers := NewTrackResolvers(&http.Client{Transport: fixtureTransport{server}, Timeout: 100 * time.Millisecond})
+
+	track := ResolvedTrack{URL: "https://audius.co/producer/sample-flip", Audio: "https://api.audius.co/v1/tracks/D7KyD/stream?app_name=beatbattle.app"}
+	info, err := resolvers.Analyse(track)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Container != "WAV" || info.Duration != 1000 {
+		t.Errorf("analysed %s audio lasting %dms, want one second of WAV", info.Container, info.Duration)
+	}
+
+	_, err = resolvers.Client.Get(track.Audio)
+	if err == nil {
+		t.Error("lookup client waited for the audio, want it to time out")
+	}
+}
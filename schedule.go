@@ -0,0 +1,398 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ScheduleCadence is how often a schedule opens a battle.
+type ScheduleCadence string
+
+// Schedule cadences. Monthly schedules open on the same day of the month as their first battle.
+const (
+	CadenceWeekly  ScheduleCadence = "weekly"
+	CadenceMonthly ScheduleCadence = "monthly"
+)
+
+// maxScheduleHours caps how long a scheduled battle's entry & voting periods can each be.
+const maxScheduleHours = 31 * 24
+
+// maxSchedulePacks is how many attachments a schedule's queue can hold.
+const maxSchedulePacks = 52
+
+// ErrStaleSchedule is returned when another pass already moved a schedule on from the run it was claiming.
+var ErrStaleSchedule = errors.New("schedule already moved on")
+
+// Schedule opens a copy of one of its host's battles on a cadence, e.g. a weekly beat battle.
+type Schedule struct {
+	ID   int
+	Host User
+	// BattleID is the battle every run is copied from. Its title is joined in as Title.
+	BattleID int
+	Title    string
+	Cadence  ScheduleCadence
+	// Timezone keeps runs on the same wall clock time through daylight saving changes.
+	Timezone string
+	// StartsAt is when the first run opens for entries.
+	StartsAt    time.Time
+	EntryHours  int
+	VotingHours int
+	// Packs are attachments handed out in turn, one per battle opened. Without any, the battle's own is kept.
+	Packs []string
+	// Runs counts the runs that have come round, including ones skipped while paused. NextRun is when the next opens.
+	Runs    int
+	NextRun time.Time
+	// Opened counts the battles the schedule has opened. LastBattleID is the latest of them.
+	Opened       int
+	LastBattleID int
+	Paused       bool
+	CreatedAt    time.Time
+}
+
+// ParseCadence reads a cadence from a form, defaulting to weekly.
+func ParseCadence(text string) ScheduleCadence {
+	if ScheduleCadence(text) == CadenceMonthly {
+		return CadenceMonthly
+	}
+	return CadenceWeekly
+}
+
+// ParsePacks reads a schedule's attachment queue, one URL per line.
+func ParsePacks(text string) []string {
+	packs := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(policy.Sanitize(line))
+		if line != "" && len(packs) < maxSchedulePacks {
+			packs = append(packs, line)
+		}
+	}
+	return packs
+}
+
+// parseScheduleHours reads an entry or voting period from a form, from 1 hour up to maxScheduleHours.
+func parseScheduleHours(text string, fallback int) int {
+	hours, err := strconv.Atoi(text)
+	if err != nil || hours < 1 {
+		return fallback
+	}
+	if hours > maxScheduleHours {
+		return maxScheduleHours
+	}
+	return hours
+}
+
+// Location returns the schedule's timezone, or UTC if it no longer loads.
+func (schedule Schedule) Location() *time.Location {
+	loc, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// RunAt returns when a run opens, counting from 0. Monthly runs fall on the last day of months too short
+// for the first run's day.
+func (schedule Schedule) RunAt(run int) time.Time {
+	first := schedule.StartsAt.In(schedule.Location())
+	year, month, day := first.Date()
+
+	if schedule.Cadence == CadenceMonthly {
+		month += time.Month(run)
+		if last := time.Date(year, month+1, 0, 0, 0, 0, 0, first.Location()).Day(); day > last {
+			day = last
+		}
+	} else {
+		day += 7 * run
+	}
+
+	return time.Date(year, month, day, first.Hour(), first.Minute(), 0, 0, first.Location())
+}
+
+// Pack returns the attachment for the schedule's next battle, or "" to keep the battle's own.
+func (schedule Schedule) Pack() string {
+	if len(schedule.Packs) == 0 {
+		return ""
+	}
+	return schedule.Packs[schedule.Opened%len(schedule.Packs)]
+}
+
+// RunSchedules opens a battle for every schedule that's due.
+func (app *App) RunSchedules(now time.Time) {
+	due, err := app.Schedules.Due(now)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	for _, schedule := range due {
+		err = app.runSchedule(schedule, now)
+		if err != nil && err != ErrStaleSchedule {
+			log.Println(err)
+		}
+	}
+}
+
+// runSchedule opens a schedule's due battle and moves it on to its next run. Runs whose entry period is
+// already over, e.g. while the schedule was paused or the server was down, are skipped.
+func (app *App) runSchedule(schedule Schedule, now time.Time) error {
+	entry := time.Duration(schedule.EntryHours) * time.Hour
+	run := schedule.Runs
+	opens := schedule.NextRun
+	for !opens.Add(entry).After(now) {
+		run++
+		opens = schedule.RunAt(run)
+	}
+
+	// Only catching up, nothing to open yet.
+	if opens.After(now) {
+		return app.Schedules.Claim(schedule.ID, schedule.Runs, run, opens)
+	}
+
+	// Claim the run before opening its battle so two servers never open it twice.
+	err := app.Schedules.Claim(schedule.ID, schedule.Runs, run+1, schedule.RunAt(run+1))
+	if err != nil {
+		return err
+	}
+
+	battle, err := app.Battles.Get(schedule.BattleID)
+	if err == ErrNotFound {
+		return app.Schedules.SetPaused(schedule.ID, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	battle.Status = StatusEntry
+	battle.Deadline = opens.Add(entry)
+	battle.VotingDeadline = battle.Deadline.Add(time.Duration(schedule.VotingHours) * time.Hour)
+	if pack := schedule.Pack(); pack != "" {
+		battle.Attachment = pack
+	}
+
+	battleID, err := app.CopyBattle(battle)
+	if err != nil {
+		return err
+	}
+
+	err = app.Battles.RecordTransition(battleID, "", StatusEntry, TriggerScheduler, 0, "Schedule")
+	if err != nil {
+		log.Println(err)
+	}
+	app.WakeScheduler()
+
+	return app.Schedules.RecordBattle(schedule.ID, battleID)
+}
+
+// requestSchedule loads the schedule a form is for, as long as the logged in user runs it.
+func (app *App) requestSchedule(c echo.Context, me User) (Schedule, bool) {
+	scheduleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return Schedule{}, false
+	}
+
+	schedule, err := app.Schedules.Get(scheduleID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return Schedule{}, false
+	}
+
+	if schedule.Host.ID != me.ID {
+		SetToast(c, "403")
+		return Schedule{}, false
+	}
+
+	return schedule, true
+}
+
+// UserSchedules - Lists the logged in user's schedules, with a form to set one up from their battles.
+func (app *App) UserSchedules(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	userID, _ := strconv.Atoi(c.Param("id"))
+	if !me.Authenticated || me.ID != userID {
+		SetToast(c, "403")
+		return c.Redirect(302, "/user/"+c.Param("id"))
+	}
+
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+	user := app.GetUserDB(userID)
+
+	schedules, err := app.Schedules.ListByHost(me.ID)
+	if err != nil {
+		log.Println(err)
+		schedules = []Schedule{}
+	}
+	for i := range schedules {
+		schedules[i].Title = html.UnescapeString(schedules[i].Title)
+		schedules[i].NextRun = schedules[i].NextRun.In(schedules[i].Location())
+	}
+
+	battles, err := app.Battles.List(BattleQuery{HostID: me.ID, Sort: SortNewest, Limit: 100})
+	if err != nil {
+		log.Println(err)
+		battles = []Battle{}
+	}
+	for i := range battles {
+		battles[i].Title = html.UnescapeString(battles[i].Title)
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     user.Name + "'s Schedules",
+			"Analytics": analyticsKey,
+		},
+		"Page":      "schedules",
+		"Schedules": schedules,
+		"Battles":   battles,
+		"Me":        me,
+		"User":      user,
+		"Toast":     toast,
+		"Ads":       ads,
+	}
+
+	return c.Render(http.StatusOK, "UserSchedules", m)
+}
+
+// InsertSchedule - Sets up a schedule for one of the logged in user's battles.
+func (app *App) InsertSchedule(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/schedules"
+
+	battleID, _ := strconv.Atoi(c.FormValue("battle_id"))
+	battle, err := app.Battles.Get(battleID)
+	if err != nil || battle.Host.ID != me.ID {
+		SetToast(c, "404")
+		return c.Redirect(302, redirectURL)
+	}
+
+	loc, err := time.LoadLocation(policy.Sanitize(c.FormValue("timezone")))
+	if err != nil {
+		log.Println(err)
+		loc, _ = time.LoadLocation("America/Toronto")
+	}
+
+	layout := "Jan 2, 2006 03:04 PM"
+	startsAt, err := time.ParseInLocation(layout, policy.Sanitize(c.FormValue("starts-date")+" "+c.FormValue("starts-time")), loc)
+	if err != nil {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	// Packs become battle attachments, so they're held to the same URL policy.
+	packs := ParsePacks(c.FormValue("packs"))
+	for _, pack := range packs {
+		if toast := TypeURLPolicy(battle.Type).CheckAttachment(pack); toast != "" {
+			SetToast(c, toast)
+			return c.Redirect(302, redirectURL)
+		}
+	}
+
+	schedule := Schedule{
+		Host:        me,
+		BattleID:    battle.ID,
+		Cadence:     ParseCadence(c.FormValue("cadence")),
+		Timezone:    loc.String(),
+		StartsAt:    startsAt,
+		EntryHours:  parseScheduleHours(c.FormValue("entry_hours"), 5*24),
+		VotingHours: parseScheduleHours(c.FormValue("voting_hours"), 48),
+		Packs:       packs,
+		NextRun:     startsAt,
+		CreatedAt:   time.Now(),
+	}
+
+	_, err = app.Schedules.Insert(schedule)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	app.WakeScheduler()
+
+	duration := time.Since(start)
+	fmt.Println("InsertSchedule time: " + duration.String())
+
+	SetToast(c, "scheduleadded")
+	return c.Redirect(302, redirectURL)
+}
+
+// PauseSchedule - Pauses or resumes one of the logged in user's schedules, depending on the route.
+// Runs missed while paused are skipped.
+func (app *App) PauseSchedule(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/schedules"
+
+	schedule, ok := app.requestSchedule(c, me)
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+
+	paused := strings.HasSuffix(c.Path(), "/pause")
+	err := app.Schedules.SetPaused(schedule.ID, paused)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	app.WakeScheduler()
+
+	SetToast(c, "successupdate")
+	return c.Redirect(302, redirectURL)
+}
+
+// DeleteSchedule - Stops one of the logged in user's schedules for good. Battles it opened are kept.
+func (app *App) DeleteSchedule(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/schedules"
+
+	schedule, ok := app.requestSchedule(c, me)
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+
+	err := app.Schedules.Delete(schedule.ID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "scheduledeleted")
+	return c.Redirect(302, redirectURL)
+}
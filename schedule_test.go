@@ -0,0 +1,133 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleRunAt(t *testing.T) {
+	toronto, err := time.LoadLocation("America/Toronto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		cadence  ScheduleCadence
+		timezone string
+		starts   time.Time
+		run      int
+		want     time.Time
+	}{
+		{"first run", CadenceWeekly, "UTC", time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC), 0, time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC)},
+		{"weekly", CadenceWeekly, "UTC", time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC), 4, time.Date(2026, 2, 2, 18, 0, 0, 0, time.UTC)},
+		// Clocks go forward on March 8th and back on November 1st, and runs keep to the wall clock.
+		{"weekly into daylight saving", CadenceWeekly, "America/Toronto", time.Date(2026, 3, 2, 20, 0, 0, 0, toronto), 1, time.Date(2026, 3, 9, 20, 0, 0, 0, toronto)},
+		{"weekly out of daylight saving", CadenceWeekly, "America/Toronto", time.Date(2026, 10, 26, 20, 0, 0, 0, toronto), 1, time.Date(2026, 11, 2, 20, 0, 0, 0, toronto)},
+		{"monthly into daylight saving", CadenceMonthly, "America/Toronto", time.Date(2026, 2, 15, 12, 30, 0, 0, toronto), 1, time.Date(2026, 3, 15, 12, 30, 0, 0, toronto)},
+		{"monthly", CadenceMonthly, "UTC", time.Date(2026, 1, 15, 18, 0, 0, 0, time.UTC), 2, time.Date(2026, 3, 15, 18, 0, 0, 0, time.UTC)},
+		{"day 31 in February", CadenceMonthly, "UTC", time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC), 1, time.Date(2026, 2, 28, 18, 0, 0, 0, time.UTC)},
+		{"day 31 in a leap February", CadenceMonthly, "UTC", time.Date(2028, 1, 31, 18, 0, 0, 0, time.UTC), 1, time.Date(2028, 2, 29, 18, 0, 0, 0, time.UTC)},
+		{"day 31 back in a long month", CadenceMonthly, "UTC", time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC), 2, time.Date(2026, 3, 31, 18, 0, 0, 0, time.UTC)},
+		{"day 31 in April", CadenceMonthly, "UTC", time.Date(2026, 1, 31, 18, 0, 0, 0, time.UTC), 3, time.Date(2026, 4, 30, 18, 0, 0, 0, time.UTC)},
+		{"day 30 over the new year", CadenceMonthly, "UTC", time.Date(2026, 11, 30, 18, 0, 0, 0, time.UTC), 3, time.Date(2027, 2, 28, 18, 0, 0, 0, time.UTC)},
+		{"unknown timezone", CadenceWeekly, "Nowhere/Special", time.Date(2026, 1, 5, 18, 0, 0, 0, time.UTC), 1, time.Date(2026, 1, 12, 18, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		// Schedules store when they start in UTC.
+		schedule := Schedule{Cadence: test.cadence, Timezone: test.timezone, StartsAt: test.starts.UTC()}
+		if got := schedule.RunAt(test.run); !got.Equal(test.want) {
+			t.Errorf("%s: run %d opens %s, want %s", test.name, test.run, got, test.want)
+		}
+	}
+}
+
+func TestRunSchedules(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Minute)
+	week := 7 * 24 * time.Hour
+	tests := []struct {
+		name string
+		// starts is how long before now the first run opened.
+		starts time.Duration
+		// opens is the run whose battle should open, or -1 if none should.
+		opens   int
+		runs    int
+		nextRun int
+	}{
+		{"due", time.Hour, 0, 1, 1},
+		// Runs whose entry period is already over are skipped, and the latest one that's still open opens.
+		{"catching up", 3*week + time.Hour, 3, 4, 4},
+		{"catching up with nothing open", 2*week + 2*24*time.Hour, -1, 3, 3},
+	}
+	for _, test := range tests {
+		app := testApp(t)
+		host := testUser(t, app, "Host")
+		battle := testBattle(t, app, host, StatusComplete)
+		starts := now.Add(-test.starts)
+		scheduleID, err := app.Schedules.Insert(Schedule{Host: host, BattleID: battle.ID, Cadence: CadenceWeekly, Timezone: "UTC",
+			StartsAt: starts, EntryHours: 24, VotingHours: 24, NextRun: starts})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		app.RunSchedules(now)
+
+		schedule, err := app.Schedules.Get(scheduleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if schedule.Runs != test.runs || !schedule.NextRun.Equal(schedule.RunAt(test.nextRun)) {
+			t.Errorf("%s: schedule at run %d next opening %s, want run %d next opening %s", test.name, schedule.Runs, schedule.NextRun, test.runs, schedule.RunAt(test.nextRun))
+		}
+
+		battles, err := app.Battles.List(BattleQuery{HostID: host.ID, Status: []BattleStatus{StatusEntry}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if test.opens < 0 {
+			if len(battles) != 0 || schedule.Opened != 0 {
+				t.Errorf("%s: opened %d battles, want none", test.name, len(battles))
+			}
+			continue
+		}
+		if len(battles) != 1 || schedule.Opened != 1 || schedule.LastBattleID != battles[0].ID {
+			t.Fatalf("%s: opened %d battles and recorded %d, want 1", test.name, len(battles), schedule.Opened)
+		}
+		if deadline := schedule.RunAt(test.opens).Add(24 * time.Hour); !battles[0].Deadline.Equal(deadline) {
+			t.Errorf("%s: battle's entries close %s, want %s", test.name, battles[0].Deadline, deadline)
+		}
+	}
+}
+
+// TestRunScheduleClaimed doesn't open a run again once another pass has claimed it.
+func TestRunScheduleClaimed(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	battle := testBattle(t, app, host, StatusComplete)
+	now := time.Now().UTC()
+	starts := now.Add(-time.Hour)
+	scheduleID, err := app.Schedules.Insert(Schedule{Host: host, BattleID: battle.ID, Cadence: CadenceWeekly, Timezone: "UTC",
+		StartsAt: starts, EntryHours: 24, VotingHours: 24, NextRun: starts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := app.Schedules.Get(scheduleID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.runSchedule(schedule, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = app.runSchedule(schedule, now)
+	if err != ErrStaleSchedule {
+		t.Errorf("running a claimed run: err = %v, want ErrStaleSchedule", err)
+	}
+	battles, err := app.Battles.List(BattleQuery{HostID: host.ID, Status: []BattleStatus{StatusEntry}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(battles) != 1 {
+		t.Errorf("opened %d battles, want 1", len(battles))
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// schedulerMaxWait is the longest the scheduler sleeps between passes.
+// Deadlines changed by another server instance are picked up within this window.
+const schedulerMaxWait = time.Minute
+
+// WakeScheduler asks the scheduler to recalculate its next deadline.
+func (app *App) WakeScheduler() {
+	select {
+	case app.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunScheduler opens scheduled battles and moves battles from entry to voting to complete as their deadlines pass.
+// It sleeps until the next deadline instead of waiting for someone to load a page.
+func (app *App) RunScheduler() {
+	for {
+		now := time.Now()
+		app.AdvanceBattles(now)
+
+		wait := schedulerMaxWait
+		next, ok, err := app.Battles.NextDeadline()
+		if err != nil {
+			log.Println(err)
+		} else if ok && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		next, ok, err = app.Schedules.NextRun()
+		if err != nil {
+			log.Println(err)
+		} else if ok && next.Sub(now) < wait {
+			wait = next.Sub(now)
+		}
+		// A deadline in the past means the last pass failed, don't spin on it.
+		if wait <= 0 {
+			wait = time.Second
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-app.wake:
+			timer.Stop()
+		}
+	}
+}
+
+// AdvanceBattles opens the battles of due schedules and runs every transition that is due at the given time.
+func (app *App) AdvanceBattles(now time.Time) {
+	start := time.Now()
+	app.RunSchedules(now)
+
+	// Entry -> voting.
+	due, err := app.Battles.Due(StatusEntry, now)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	advanced := len(due)
+	for _, battleID := range due {
+		err = app.TransitionBattle(battleID, StatusEntry, StatusVoting, TriggerScheduler, 0, "")
+		if err != nil && err != ErrStaleTransition {
+			log.Println(err)
+		}
+	}
+
+	// Voting -> complete.
+	due, err = app.Battles.Due(StatusVoting, now)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	advanced += len(due)
+	for _, battleID := range due {
+		err = app.CompleteBattle(battleID, TriggerScheduler, 0, "")
+		if err != nil && err != ErrStaleTransition {
+			log.Println(err)
+		}
+	}
+
+	if advanced > 0 {
+		duration := time.Since(start)
+		fmt.Println("AdvanceBattles time: " + duration.String())
+	}
+}
+
+// CompleteBattle calculates the results of a battle in voting, marks it complete, rates its entrants and
+// moves a tournament match's winner on. BattleResults runs before the transition so a failed calculation
+// is retried on the next pass.
+func (app *App) CompleteBattle(battleID int, trigger TransitionTrigger, userID int, note string) error {
+	err := app.BattleResults(battleID)
+	if err != nil {
+		return err
+	}
+
+	err = app.TransitionBattle(battleID, StatusVoting, StatusComplete, trigger, userID, note)
+	if err != nil {
+		return err
+	}
+
+	// Ratings only count complete battles, so they move once the transition has gone through.
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		return err
+	}
+	// Nothing retries a complete battle, so a rating that fails is left for `ratings recompute`
+	// instead of holding up its tournament.
+	err = app.RateBattle(battle)
+	if err != nil {
+		log.Println(fmt.Sprintf("Battle %d: %s", battleID, err))
+	}
+	return app.AdvanceTournament(battle)
+}
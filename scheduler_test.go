@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// TestAdvanceBattlesRatesInOrder completes battles that finish in the same pass in the order they finished,
+// whatever order they were made in, so each is rated without a recompute.
+func TestAdvanceBattlesRatesInOrder(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	bob := testUser(t, app, "Bob")
+
+	now := time.Now()
+	battleIDs := []int{}
+	for _, finished := range []time.Duration{time.Hour, 2 * time.Hour} {
+		battleID, err := app.Battles.Insert(Battle{
+			Title:          "Test Battle",
+			Rules:          "Flip the sample.",
+			Host:           host,
+			Type:           "beat",
+			Status:         StatusVoting,
+			MaxVotes:       1,
+			Deadline:       now.Add(-finished - time.Hour),
+			VotingDeadline: now.Add(-finished),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		battle := Battle{ID: battleID}
+		aliceBeat := testEntry(t, app, battle, alice)
+		testEntry(t, app, battle, bob)
+		err = app.Votes.Add(battleID, aliceBeat.ID, host.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		battleIDs = append(battleIDs, battleID)
+	}
+
+	app.AdvanceBattles(now)
+
+	for _, battleID := range battleIDs {
+		battle, err := app.Battles.Get(battleID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if battle.Status != StatusComplete {
+			t.Errorf("battle %d is %s, want complete", battleID, battle.Status)
+		}
+	}
+
+	history, err := app.Ratings.History(alice.ID, RatingAll, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("alice has %d rating changes, want one for each battle", len(history))
+	}
+	// Newest first: the battle made first finished last.
+	if history[0].BattleID != battleIDs[0] || history[1].BattleID != battleIDs[1] {
+		t.Errorf("rated battles %d then %d, want %d then %d", history[1].BattleID, history[0].BattleID, battleIDs[1], battleIDs[0])
+	}
+	if history[0].Before != history[1].After {
+		t.Errorf("second rating started from %v, want %v", history[0].Before, history[1].After)
+	}
+}
+
+// failingRatings is a rating store that can't be reached.
+type failingRatings struct {
+	RatingStore
+}
+
+func (failingRatings) RatedAfter(battleID int, finishedAt time.Time) (bool, error) {
+	return false, errors.New("ratings unavailable")
+}
+
+// TestCompleteBattleAdvancesTournament moves a match's winner on even when the battle can't be rated,
+// since nothing retries a battle once it's complete.
+func TestCompleteBattleAdvancesTournament(t *testing.T) {
+	app := testApp(t)
+	app.Ratings = failingRatings{app.Ratings}
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	bob := testUser(t, app, "Bob")
+
+	tournamentID, err := app.Tournaments.Insert(Tournament{Host: host, Title: "Cup", Type: "beat", Format: FormatSingle, EntryHours: 1, VotingHours: 1, Status: TournamentSignup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, user := range []User{alice, bob} {
+		err = app.Tournaments.Join(tournamentID, user.ID, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = app.Tournaments.Start(tournamentID, []int{alice.ID, bob.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	battle := testBattle(t, app, host, StatusVoting)
+	_, err = app.Tournaments.InsertMatch(TournamentMatch{TournamentID: tournamentID, Round: 1, BattleID: battle.ID, Players: [2]int{alice.ID, bob.ID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceBeat := testEntry(t, app, battle, alice)
+	testEntry(t, app, battle, bob)
+	err = app.Votes.Add(battle.ID, aliceBeat.ID, host.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = app.CompleteBattle(battle.ID, TriggerScheduler, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	match, err := app.Tournaments.MatchByBattle(battle.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.WinnerID != alice.ID {
+		t.Errorf("match winner = %d, want alice (%d)", match.WinnerID, alice.ID)
+	}
+}
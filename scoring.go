@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// VotingScore has voters score every entry from 1 to 10 on each of the battle's criteria.
+const VotingScore VotingMode = "score"
+
+// Score limits.
+const (
+	minScore = 1
+	maxScore = 10
+)
+
+// maxCriteria is how many criteria a score battle can have.
+const maxCriteria = 6
+
+// maxCriterionLength is the width of battle_criteria.name.
+const maxCriterionLength = 64
+
+// Criterion is something a score battle's entries are judged on. Weight is relative to the other criteria.
+type Criterion struct {
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Weight int    `json:"weight"`
+}
+
+// Score is one voter's score for an entry on a criterion.
+type Score struct {
+	UserID      int
+	BeatID      int
+	CriterionID int
+	Score       int
+}
+
+// CriterionScore is an entry's mean score on a criterion.
+type CriterionScore struct {
+	BeatID      int
+	CriterionID int
+	Score       float64
+}
+
+// BreakdownRow is an entry's line in a complete score battle's breakdown, with Scores in criteria order.
+type BreakdownRow struct {
+	Artist    User
+	Placement int
+	Scores    []string
+	Overall   string
+}
+
+// ParseCriteria reads the criteria from a battle form, written as "Mixdown:2, Sample Usage, Creativity:1".
+// A criterion without a weight counts once. A score battle without criteria is scored overall.
+func ParseCriteria(text string) []Criterion {
+	criteria := []Criterion{}
+	seen := map[string]bool{}
+	for _, field := range strings.Split(policy.Sanitize(text), ",") {
+		name, weight := field, 1
+		if i := strings.LastIndex(field, ":"); i >= 0 {
+			name = field[:i]
+			parsed, err := strconv.Atoi(strings.TrimSpace(field[i+1:]))
+			if err == nil && parsed > 0 {
+				weight = parsed
+			}
+		}
+		if weight > maxScore {
+			weight = maxScore
+		}
+
+		name = strings.Join(strings.Fields(name), " ")
+		if name == "" || utf8.RuneCountInString(name) > maxCriterionLength || seen[strings.ToLower(name)] {
+			continue
+		}
+
+		seen[strings.ToLower(name)] = true
+		criteria = append(criteria, Criterion{Name: name, Weight: weight})
+		if len(criteria) == maxCriteria {
+			break
+		}
+	}
+
+	if len(criteria) == 0 {
+		criteria = append(criteria, Criterion{Name: "Overall", Weight: 1})
+	}
+	return criteria
+}
+
+// CriteriaString writes criteria back out the way ParseCriteria reads them.
+func CriteriaString(criteria []Criterion) string {
+	fields := []string{}
+	for _, criterion := range criteria {
+		fields = append(fields, criterion.Name+":"+strconv.Itoa(criterion.Weight))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// MeanScores averages each entry's scores per criterion. With trim set, an entry's highest and
+// lowest score on a criterion are dropped first, as long as at least three voters scored it.
+func MeanScores(scores []Score, trim bool) []CriterionScore {
+	type key struct{ beatID, criterionID int }
+	given := map[key][]int{}
+	keys := []key{}
+	for _, score := range scores {
+		k := key{score.BeatID, score.CriterionID}
+		if _, ok := given[k]; !ok {
+			keys = append(keys, k)
+		}
+		given[k] = append(given[k], score.Score)
+	}
+
+	means := []CriterionScore{}
+	for _, k := range keys {
+		values := given[k]
+		sort.Ints(values)
+		if trim && len(values) >= 3 {
+			values = values[1 : len(values)-1]
+		}
+
+		total := 0
+		for _, value := range values {
+			total += value
+		}
+		means = append(means, CriterionScore{BeatID: k.beatID, CriterionID: k.criterionID, Score: float64(total) / float64(len(values))})
+	}
+
+	return means
+}
+
+// WeightedScores combines each entry's mean criterion scores into one score using the criteria weights.
+// A criterion nobody scored an entry on doesn't count against it.
+func WeightedScores(criteria []Criterion, means []CriterionScore) map[int]float64 {
+	weights := map[int]int{}
+	for _, criterion := range criteria {
+		weights[criterion.ID] = criterion.Weight
+	}
+
+	totals := map[int]float64{}
+	totalWeights := map[int]int{}
+	for _, mean := range means {
+		weight, ok := weights[mean.CriterionID]
+		if !ok {
+			continue
+		}
+		totals[mean.BeatID] += mean.Score * float64(weight)
+		totalWeights[mean.BeatID] += weight
+	}
+
+	overall := map[int]float64{}
+	for beatID, total := range totals {
+		if totalWeights[beatID] > 0 {
+			overall[beatID] = total / float64(totalWeights[beatID])
+		}
+	}
+
+	return overall
+}
+
+// scoreResults places the qualified artists' entries by their weighted mean score and saves the breakdown.
+// Votes is how many voters scored an entry.
+func (app *App) scoreResults(battle Battle, beats []Beat, qualified map[int]bool) ([]BeatResult, error) {
+	criteria, err := app.Battles.Criteria(battle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	scores, err := app.Votes.Scores(battle.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	scoredBy := map[int]map[int]bool{}
+	for _, score := range scores {
+		if scoredBy[score.BeatID] == nil {
+			scoredBy[score.BeatID] = map[int]bool{}
+		}
+		scoredBy[score.BeatID][score.UserID] = true
+	}
+
+	means := MeanScores(scores, battle.TrimScores)
+	err = app.Results.SaveBreakdown(battle.ID, means)
+	if err != nil {
+		return nil, err
+	}
+	overall := WeightedScores(criteria, means)
+
+	results := make([]BeatResult, len(beats))
+	for i, beat := range beats {
+		results[i] = BeatResult{
+			BeatID: beat.ID,
+			Votes:  len(scoredBy[beat.ID]),
+			Voted:  qualified[beat.Artist.ID],
+		}
+	}
+
+	return app.placeResults(battle, beats, results, overall)
+}
+
+// BattleBreakdown returns a complete score battle's mean scores per criterion, in placement order.
+func (app *App) BattleBreakdown(battleID int, criteria []Criterion, beats []Beat) []BreakdownRow {
+	means, err := app.Results.Breakdown(battleID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	perBeat := map[int]map[int]float64{}
+	for _, mean := range means {
+		if perBeat[mean.BeatID] == nil {
+			perBeat[mean.BeatID] = map[int]float64{}
+		}
+		perBeat[mean.BeatID][mean.CriterionID] = mean.Score
+	}
+	overall := WeightedScores(criteria, means)
+
+	placed := append([]Beat(nil), beats...)
+	sort.SliceStable(placed, func(i, j int) bool {
+		a, b := placed[i].Placement, placed[j].Placement
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+
+	rows := []BreakdownRow{}
+	for _, beat := range placed {
+		row := BreakdownRow{Artist: beat.Artist, Placement: beat.Placement, Overall: "-"}
+		for _, criterion := range criteria {
+			score, ok := perBeat[beat.ID][criterion.ID]
+			if !ok {
+				row.Scores = append(row.Scores, "-")
+				continue
+			}
+			row.Scores = append(row.Scores, strconv.FormatFloat(score, 'f', 2, 64))
+		}
+		if score, ok := overall[beat.ID]; ok {
+			row.Overall = strconv.FormatFloat(score, 'f', 2, 64)
+		}
+		rows = append(rows, row)
+	}
+
+	return rows
+}
+
+// SaveScore sets the logged in user's score for an entry on one criterion.
+func (app *App) SaveScore(c echo.Context) error {
+	start := time.Now()
+
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+
+	// Get user, return if not auth.
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		return AjaxResponse(c, true, "/login/", "noauth")
+	}
+
+	beatID, err := strconv.Atoi(c.FormValue("beatID"))
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, "/", "404")
+	}
+
+	criterionID, err := strconv.Atoi(c.FormValue("criterionID"))
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, "/", "404")
+	}
+
+	beat, err := app.Beats.Get(beatID)
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if err == ErrNotFound {
+		return AjaxResponse(c, false, "/", "404")
+	}
+
+	redirectURL := "/battle/" + strconv.Itoa(beat.BattleID) + "/"
+
+	// Reject if user ID matches the track.
+	if beat.Artist.ID == me.ID {
+		return AjaxResponse(c, false, redirectURL, "owntrack")
+	}
+
+	battle, err := app.Battles.Get(beat.BattleID)
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+
+	// Reject if not currently in voting stage or if battle is invalid.
+	if err == ErrNotFound || battle.Status != StatusVoting || time.Until(battle.VotingDeadline) < 0 {
+		return AjaxResponse(c, true, redirectURL, "notvoting")
+	}
+	if battle.VotingMode != VotingScore {
+		return AjaxResponse(c, false, redirectURL, "notscored")
+	}
+
+	allowed, err := app.mayVote(battle, me.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if !allowed {
+		return AjaxResponse(c, false, redirectURL, "entrantsonly")
+	}
+
+	// Team members can't vote for the entry they're credited on either.
+	credits, err := app.teamCredits(battle.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if credits[beat.ID][me.ID] {
+		return AjaxResponse(c, false, redirectURL, "owntrack")
+	}
+
+	criteria, err := app.Battles.Criteria(battle.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	found := false
+	for _, criterion := range criteria {
+		if criterion.ID == criterionID {
+			found = true
+		}
+	}
+	if !found {
+		return AjaxResponse(c, false, redirectURL, "404")
+	}
+
+	score, err := strconv.Atoi(c.FormValue("score"))
+	if err != nil || score < minScore || score > maxScore {
+		return AjaxResponse(c, false, redirectURL, "invalidscore")
+	}
+
+	err = app.Votes.SaveScore(battle.ID, beat.ID, me.ID, criterionID, score)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, redirectURL, "502")
+	}
+
+	duration := time.Since(start)
+	fmt.Println("SaveScore time: " + duration.String())
+
+	return AjaxResponse(c, false, redirectURL, "successscore")
+}
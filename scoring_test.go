@@ -0,0 +1,90 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// scoresFor is one score from each of a run of voters for an entry on a criterion.
+func scoresFor(beatID int, criterionID int, values ...int) []Score {
+	scores := []Score{}
+	for i, value := range values {
+		scores = append(scores, Score{UserID: i + 1, BeatID: beatID, CriterionID: criterionID, Score: value})
+	}
+	return scores
+}
+
+func TestMeanScores(t *testing.T) {
+	tests := []struct {
+		name   string
+		scores []Score
+		trim   bool
+		means  []CriterionScore
+	}{
+		{"no scores", nil, true, []CriterionScore{}},
+		{"untrimmed", scoresFor(1, 1, 2, 9, 10), false, []CriterionScore{{1, 1, 7}}},
+		{"trimmed", scoresFor(1, 1, 10, 2, 9), true, []CriterionScore{{1, 1, 9}}},
+		{"trims one of each extreme", scoresFor(1, 1, 1, 1, 5, 10, 10), true, []CriterionScore{{1, 1, 16.0 / 3}}},
+		// Two scores would leave nothing to average.
+		{"too few to trim", scoresFor(1, 1, 2, 9), true, []CriterionScore{{1, 1, 5.5}}},
+		{"one score", scoresFor(1, 1, 8), true, []CriterionScore{{1, 1, 8}}},
+		{
+			"each entry and criterion apart, in the order first scored",
+			append(append(scoresFor(2, 1, 4, 6), scoresFor(1, 1, 10)...), scoresFor(2, 3, 1, 1, 10)...),
+			true,
+			[]CriterionScore{{2, 1, 5}, {1, 1, 10}, {2, 3, 1}},
+		},
+	}
+	for _, test := range tests {
+		means := MeanScores(test.scores, test.trim)
+		if !reflect.DeepEqual(means, test.means) {
+			t.Errorf("%s: means = %v, want %v", test.name, means, test.means)
+		}
+	}
+}
+
+func TestWeightedScores(t *testing.T) {
+	criteria := []Criterion{{ID: 1, Name: "Mixdown", Weight: 2}, {ID: 2, Name: "Creativity", Weight: 1}}
+	tests := []struct {
+		name    string
+		means   []CriterionScore
+		overall map[int]float64
+	}{
+		{"nothing scored", nil, map[int]float64{}},
+		{"weighted", []CriterionScore{{1, 1, 9}, {1, 2, 6}}, map[int]float64{1: 8}},
+		// Entry 2 wasn't scored on creativity, so its mixdown is all that counts.
+		{"unscored criterion", []CriterionScore{{1, 1, 6}, {1, 2, 9}, {2, 1, 7}}, map[int]float64{1: 7, 2: 7}},
+		{"unknown criterion", []CriterionScore{{1, 1, 5}, {1, 9, 10}}, map[int]float64{1: 5}},
+		{"only unknown criteria", []CriterionScore{{1, 9, 10}}, map[int]float64{}},
+	}
+	for _, test := range tests {
+		overall := WeightedScores(criteria, test.means)
+		if !reflect.DeepEqual(overall, test.overall) {
+			t.Errorf("%s: overall = %v, want %v", test.name, overall, test.overall)
+		}
+	}
+}
+
+func TestParseCriteria(t *testing.T) {
+	tests := []struct {
+		text     string
+		criteria []Criterion
+	}{
+		{"", []Criterion{{Name: "Overall", Weight: 1}}},
+		{" , ", []Criterion{{Name: "Overall", Weight: 1}}},
+		{"Mixdown:2, Sample  Usage, Creativity:1", []Criterion{{Name: "Mixdown", Weight: 2}, {Name: "Sample Usage", Weight: 1}, {Name: "Creativity", Weight: 1}}},
+		// Weights are capped at the top score, and bad ones count once.
+		{"Mixdown:50, Flow:0, Bars:x", []Criterion{{Name: "Mixdown", Weight: 10}, {Name: "Flow", Weight: 1}, {Name: "Bars", Weight: 1}}},
+		{"Mixdown, mixdown:3", []Criterion{{Name: "Mixdown", Weight: 1}}},
+		{"A, B, C, D, E, F, G", []Criterion{{Name: "A", Weight: 1}, {Name: "B", Weight: 1}, {Name: "C", Weight: 1}, {Name: "D", Weight: 1}, {Name: "E", Weight: 1}, {Name: "F", Weight: 1}}},
+	}
+	for _, test := range tests {
+		criteria := ParseCriteria(test.text)
+		if !reflect.DeepEqual(criteria, test.criteria) {
+			t.Errorf("ParseCriteria(%q) = %v, want %v", test.text, criteria, test.criteria)
+		}
+		if again := ParseCriteria(CriteriaString(criteria)); !reflect.DeepEqual(again, criteria) {
+			t.Errorf("CriteriaString(%v) parses back as %v", criteria, again)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+	"github.com/microcosm-cc/bluemonday"
+)
+
+// Search weights per field. A term that matches exactly counts double a prefix match.
+const (
+	searchWeightTitle = 5
+	searchWeightTag   = 4
+	searchWeightHost  = 3
+	searchWeightRules = 1
+)
+
+// maxSearchTerms caps how many terms a search looks up.
+const maxSearchTerms = 8
+
+// maxSearchTermLength is the width of battle_search.term. Longer words aren't indexed.
+const maxSearchTermLength = 64
+
+// searchStopWords are too common to say anything about a battle.
+var searchStopWords = map[string]bool{
+	"a": true, "an": true, "and": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"for": true, "from": true, "has": true, "in": true, "is": true, "it": true, "its": true, "of": true,
+	"on": true, "one": true, "or": true, "that": true, "the": true, "this": true, "to": true, "was": true,
+	"with": true, "you": true, "your": true, "my": true, "battle": true, "battles": true,
+}
+
+// SearchTerms splits text into lowercase search terms, dropping stop words and duplicates.
+func SearchTerms(text string) []string {
+	terms := []string{}
+	seen := map[string]bool{}
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		if len(word) < 2 || len(word) > maxSearchTermLength || searchStopWords[word] || seen[word] {
+			continue
+		}
+
+		seen[word] = true
+		terms = append(terms, word)
+	}
+
+	return terms
+}
+
+// SearchDocument weighs the terms of a battle's title, tags and rendered rules.
+// Host nicknames can change, so they're matched when searching instead.
+func SearchDocument(battle Battle) map[string]int {
+	rules := html.UnescapeString(bluemonday.StrictPolicy().Sanitize(string(battle.RulesHTML)))
+
+	document := map[string]int{}
+	fields := []struct {
+		text   string
+		weight int
+	}{
+		{battle.Title, searchWeightTitle},
+		{strings.Join(battle.Tags, " "), searchWeightTag},
+		{rules, searchWeightRules},
+	}
+	for _, field := range fields {
+		for _, term := range SearchTerms(field.text) {
+			document[term] += field.weight
+		}
+	}
+
+	return document
+}
+
+// IndexBattle updates a battle's search terms. It's called whenever a battle is saved.
+func (app *App) IndexBattle(battleID int) {
+	battle := app.GetBattle(battleID)
+	if battle.ID == 0 {
+		return
+	}
+
+	err := app.Search.Index(battleID, SearchDocument(battle))
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// SearchBattles returns a page of public battles matching the text, best match first.
+// The page cursor is the offset of the next page.
+func (app *App) SearchBattles(text string, cursor string) BattlePage {
+	start := time.Now()
+
+	terms := SearchTerms(text)
+	if len(terms) > maxSearchTerms {
+		terms = terms[:maxSearchTerms]
+	}
+	if len(terms) == 0 {
+		return BattlePage{Battles: []Battle{}}
+	}
+
+	offset, _ := strconv.Atoi(cursor)
+	if offset < 0 {
+		offset = 0
+	}
+
+	// Fetch one extra battle to find out if there's another page.
+	battles, err := app.Search.Search(terms, battlePageSize+1, offset)
+	if err != nil {
+		log.Println(err)
+		return BattlePage{Battles: []Battle{}}
+	}
+
+	page := BattlePage{Battles: battles}
+	if len(battles) > battlePageSize {
+		page.Battles = battles[:battlePageSize]
+		page.Next = strconv.Itoa(offset + battlePageSize)
+	}
+
+	for i := range page.Battles {
+		page.Battles[i].Title = html.UnescapeString(page.Battles[i].Title)
+		page.Battles[i].ParsedDeadline = DeadlineString(page.Battles[i])
+	}
+
+	duration := time.Since(start)
+	fmt.Println("SearchBattles time: " + duration.String())
+
+	return page
+}
+
+// ViewSearch - Shows the battles matching ?q=.
+func (app *App) ViewSearch(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	text := strings.TrimSpace(c.QueryParam("q"))
+	battles := app.SearchBattles(text, "")
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     "Beatbattle.app - Search",
+			"Analytics": analyticsKey,
+		},
+		"Battles":    battles,
+		"BattlesURL": "/api/search?" + url.Values{"q": {text}}.Encode(),
+		"Query":      text,
+		"Me":         me,
+		"Toast":      toast,
+		"Ads":        ads,
+	}
+
+	return c.Render(http.StatusOK, "Search", m)
+}
+
+// SearchJSON - Returns a page of search results for the search page's grid.
+func (app *App) SearchJSON(c echo.Context) error {
+	return c.JSON(http.StatusOK, app.SearchBattles(c.QueryParam("q"), c.QueryParam("cursor")))
+}
+
+// RunSearch is the `search reindex` command, which rebuilds the search terms of every battle.
+func RunSearch(app *App, args []string) {
+	if len(args) == 0 || args[0] != "reindex" {
+		fmt.Println("usage: search reindex")
+		return
+	}
+
+	battles, err := app.Battles.List(BattleQuery{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, battle := range battles {
+		app.IndexBattle(battle.ID)
+	}
+
+	fmt.Printf("Reindexed search on %d battles\n", len(battles))
+}
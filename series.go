@@ -0,0 +1,698 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// defaultPoints is the points table a new series starts with, 1st place first.
+var defaultPoints = []int{25, 18, 15, 12, 10, 8, 6, 4, 2, 1}
+
+// maxScoredPlaces is how many placements a points table can cover.
+const maxScoredPlaces = 32
+
+// maxSeriesTitleLength is the width of series.title and seasons.title.
+const maxSeriesTitleLength = 64
+
+// defaultSeriesGap is how far apart a series' battles are until it has two to go by.
+const defaultSeriesGap = 7 * 24 * time.Hour
+
+// Series is a league of battles run by one host, split into seasons with their own standings.
+type Series struct {
+	ID    int
+	Host  User
+	Title string
+	// Points are what each placement earns, 1st place first. Placements past the end earn nothing.
+	Points []int
+	// DropLowest is how many of an entrant's worst results in a season don't count.
+	DropLowest int
+	CreatedAt  time.Time
+}
+
+// Season is a stretch of a series, e.g. a month.
+type Season struct {
+	ID        int
+	SeriesID  int
+	Title     string
+	CreatedAt time.Time
+}
+
+// SeasonOption is a season as the battle forms list it.
+type SeasonOption struct {
+	ID   int
+	Name string
+}
+
+// StandingResult is what an entrant got from one of a season's battles.
+type StandingResult struct {
+	Entered   bool
+	Placement int
+	Points    int
+	// Dropped results are among the entrant's worst and don't count towards their total.
+	Dropped bool
+}
+
+// Standing is an entrant's line in a season's standings, with Results in battle order.
+type Standing struct {
+	Rank    int
+	User    User
+	Points  int
+	Battles int
+	Wins    int
+	Results []StandingResult
+}
+
+// ParsePoints reads a points table written as "25, 18, 15". A table without any points falls back to the default.
+func ParsePoints(text string) []int {
+	points := []int{}
+	for _, field := range strings.Split(text, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || value < 0 {
+			continue
+		}
+
+		points = append(points, value)
+		if len(points) == maxScoredPlaces {
+			break
+		}
+	}
+
+	if len(points) == 0 {
+		return append([]int(nil), defaultPoints...)
+	}
+	return points
+}
+
+// PointsString writes a points table back out the way ParsePoints reads it.
+func PointsString(points []int) string {
+	fields := []string{}
+	for _, value := range points {
+		fields = append(fields, strconv.Itoa(value))
+	}
+	return strings.Join(fields, ", ")
+}
+
+// PlacementPoints returns what a placement earns in a series. Disqualified entries earn nothing.
+func (series Series) PlacementPoints(placement int) int {
+	if placement < 1 || placement > len(series.Points) {
+		return 0
+	}
+	return series.Points[placement-1]
+}
+
+// parseSeriesTitle cleans up a series or season title, returning "" when it's unusable.
+func parseSeriesTitle(text string) string {
+	title := strings.Join(strings.Fields(policy.Sanitize(text)), " ")
+	if utf8.RuneCountInString(title) > maxSeriesTitleLength {
+		return ""
+	}
+	return title
+}
+
+// SeasonStandings totals up the points of a season's complete battles, given in order. A battle an entrant
+// missed counts as nothing, so dropping their lowest results forgives missed battles first. At least one
+// result always counts. Entrants level on points and wins share a rank.
+func SeasonStandings(series Series, battles []Battle, records []ChampionshipRecord, users map[int]User) []Standing {
+	index := map[int]int{}
+	for i, battle := range battles {
+		index[battle.ID] = i
+	}
+
+	standings := map[int]*Standing{}
+	for _, record := range records {
+		i, ok := index[record.BattleID]
+		if !ok {
+			continue
+		}
+
+		standing := standings[record.UserID]
+		if standing == nil {
+			standing = &Standing{User: users[record.UserID], Results: make([]StandingResult, len(battles))}
+			standings[record.UserID] = standing
+		}
+
+		standing.Results[i] = StandingResult{
+			Entered:   true,
+			Placement: record.Placement,
+			Points:    series.PlacementPoints(record.Placement),
+		}
+		standing.Battles++
+		if record.Placement == 1 {
+			standing.Wins++
+		}
+	}
+
+	drop := series.DropLowest
+	if drop > len(battles)-1 {
+		drop = len(battles) - 1
+	}
+
+	table := []Standing{}
+	for _, standing := range standings {
+		order := make([]int, len(standing.Results))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ra, rb := standing.Results[order[a]], standing.Results[order[b]]
+			if ra.Points != rb.Points {
+				return ra.Points < rb.Points
+			}
+			return !ra.Entered && rb.Entered
+		})
+		for i, result := range order {
+			if i < drop {
+				standing.Results[result].Dropped = true
+				continue
+			}
+			standing.Points += standing.Results[result].Points
+		}
+
+		table = append(table, *standing)
+	}
+
+	sort.Slice(table, func(i, j int) bool {
+		if table[i].Points != table[j].Points {
+			return table[i].Points > table[j].Points
+		}
+		if table[i].Wins != table[j].Wins {
+			return table[i].Wins > table[j].Wins
+		}
+		return table[i].User.ID < table[j].User.ID
+	})
+	for i := range table {
+		table[i].Rank = i + 1
+		if i > 0 && table[i].Points == table[i-1].Points && table[i].Wins == table[i-1].Wins {
+			table[i].Rank = table[i-1].Rank
+		}
+	}
+
+	return table
+}
+
+// HostSeasons lists the seasons of every series a host runs for the battle forms.
+func (app *App) HostSeasons(hostID int) []SeasonOption {
+	options := []SeasonOption{}
+	series, err := app.Series.ListByHost(hostID)
+	if err != nil {
+		log.Println(err)
+		return options
+	}
+
+	for _, s := range series {
+		seasons, err := app.Series.Seasons(s.ID)
+		if err != nil {
+			log.Println(err)
+			return options
+		}
+		for _, season := range seasons {
+			options = append(options, SeasonOption{
+				ID:   season.ID,
+				Name: html.UnescapeString(s.Title) + " - " + html.UnescapeString(season.Title),
+			})
+		}
+	}
+
+	return options
+}
+
+// BattleSeason names the season a battle counts towards for its page. Standalone battles get an empty option.
+func (app *App) BattleSeason(seasonID int) SeasonOption {
+	if seasonID == 0 {
+		return SeasonOption{}
+	}
+
+	season, err := app.Series.GetSeason(seasonID)
+	if err != nil {
+		log.Println(err)
+		return SeasonOption{}
+	}
+
+	series, err := app.Series.Get(season.SeriesID)
+	if err != nil {
+		log.Println(err)
+		return SeasonOption{}
+	}
+
+	return SeasonOption{ID: season.ID, Name: html.UnescapeString(series.Title) + " - " + html.UnescapeString(season.Title)}
+}
+
+// FormSeason reads the season picked on a battle form. Hosts can only put battles in their own series.
+func (app *App) FormSeason(c echo.Context, hostID int) int {
+	seasonID, err := strconv.Atoi(c.FormValue("season_id"))
+	if err != nil || seasonID <= 0 {
+		return 0
+	}
+
+	season, err := app.Series.GetSeason(seasonID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		return 0
+	}
+
+	series, err := app.Series.Get(season.SeriesID)
+	if err != nil || series.Host.ID != hostID {
+		return 0
+	}
+
+	return seasonID
+}
+
+// requestSeries loads the series a page or form is for, setting a toast when it doesn't exist.
+func (app *App) requestSeries(c echo.Context) (Series, bool) {
+	seriesID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return Series{}, false
+	}
+
+	series, err := app.Series.Get(seriesID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return Series{}, false
+	}
+
+	series.Title = html.UnescapeString(series.Title)
+	return series, true
+}
+
+// UserSeries - Lists the series a user runs, with a form to start one on their own page.
+func (app *App) UserSeries(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	userID, _ := strconv.Atoi(c.Param("id"))
+	user := app.GetUserDB(userID)
+
+	series := []Series{}
+	if userID > 0 {
+		var err error
+		series, err = app.Series.ListByHost(userID)
+		if err != nil {
+			log.Println(err)
+			series = []Series{}
+		}
+	}
+	for i := range series {
+		series[i].Title = html.UnescapeString(series[i].Title)
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     user.Name + "'s Series",
+			"Analytics": analyticsKey,
+		},
+		"Page":          "series",
+		"Series":        series,
+		"DefaultPoints": PointsString(defaultPoints),
+		"IsOwner":       me.Authenticated && me.ID == userID,
+		"Me":            me,
+		"User":          user,
+		"Toast":         toast,
+		"Ads":           ads,
+	}
+
+	return c.Render(http.StatusOK, "UserSeries", m)
+}
+
+// InsertSeries - Starts a series for the logged in user along with its first season.
+func (app *App) InsertSeries(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/series"
+
+	title := parseSeriesTitle(c.FormValue("title"))
+	seasonTitle := parseSeriesTitle(c.FormValue("season"))
+	if title == "" || seasonTitle == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	dropLowest, err := strconv.Atoi(c.FormValue("drop_lowest"))
+	if err != nil || dropLowest < 0 {
+		dropLowest = 0
+	}
+
+	seriesID, err := app.Series.Insert(Series{
+		Host:       me,
+		Title:      title,
+		Points:     ParsePoints(c.FormValue("points")),
+		DropLowest: dropLowest,
+		CreatedAt:  time.Now(),
+	})
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	_, err = app.Series.InsertSeason(Season{SeriesID: seriesID, Title: seasonTitle, CreatedAt: time.Now()})
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "seriesadded")
+	return c.Redirect(302, "/series/"+strconv.Itoa(seriesID))
+}
+
+// ViewSeries - Shows a series' scoring and seasons, with the host's forms to run it.
+func (app *App) ViewSeries(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+
+	series, ok := app.requestSeries(c)
+	if !ok {
+		return c.Redirect(302, "/")
+	}
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	seasons, err := app.Series.Seasons(series.ID)
+	if err != nil {
+		log.Println(err)
+		seasons = []Season{}
+	}
+
+	battles, err := app.Series.Battles(series.ID)
+	if err != nil {
+		log.Println(err)
+		battles = []Battle{}
+	}
+
+	counts := map[int]int{}
+	for _, battle := range battles {
+		counts[battle.SeasonID]++
+	}
+	for i := range seasons {
+		seasons[i].Title = html.UnescapeString(seasons[i].Title)
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     series.Title,
+			"Analytics": analyticsKey,
+		},
+		"Series":  series,
+		"Points":  PointsString(series.Points),
+		"Seasons": seasons,
+		"Counts":  counts,
+		"IsOwner": me.Authenticated && me.ID == series.Host.ID,
+		"Me":      me,
+		"Toast":   toast,
+		"Ads":     ads,
+	}
+
+	duration := time.Since(start)
+	fmt.Println("ViewSeries time: " + duration.String())
+
+	return c.Render(http.StatusOK, "Series", m)
+}
+
+// UpdateSeries - Lets a series' host rename it and change its scoring.
+func (app *App) UpdateSeries(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	series, ok := app.requestSeries(c)
+	if !ok {
+		return c.Redirect(302, "/")
+	}
+	redirectURL := "/series/" + strconv.Itoa(series.ID)
+
+	if series.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	series.Title = parseSeriesTitle(c.FormValue("title"))
+	if series.Title == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	series.Points = ParsePoints(c.FormValue("points"))
+	series.DropLowest, _ = strconv.Atoi(c.FormValue("drop_lowest"))
+	if series.DropLowest < 0 {
+		series.DropLowest = 0
+	}
+
+	err := app.Series.Update(series)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "successupdate")
+	return c.Redirect(302, redirectURL)
+}
+
+// InsertSeason - Lets a series' host start its next season.
+func (app *App) InsertSeason(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	series, ok := app.requestSeries(c)
+	if !ok {
+		return c.Redirect(302, "/")
+	}
+	redirectURL := "/series/" + strconv.Itoa(series.ID)
+
+	if series.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	title := parseSeriesTitle(c.FormValue("title"))
+	if title == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	_, err := app.Series.InsertSeason(Season{SeriesID: series.ID, Title: title, CreatedAt: time.Now()})
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "seasonadded")
+	return c.Redirect(302, redirectURL)
+}
+
+// NextBattle - Drafts a series' next battle from its latest one, with the same rules, voting and settings,
+// deadlines moved on by the gap between its last two battles and a fresh attachment. The host finishes it
+// off on the update page.
+func (app *App) NextBattle(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	series, ok := app.requestSeries(c)
+	if !ok {
+		return c.Redirect(302, "/")
+	}
+	redirectURL := "/series/" + strconv.Itoa(series.ID)
+
+	if series.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	seasonID := app.FormSeason(c, me.ID)
+	season, err := app.Series.GetSeason(seasonID)
+	if err != nil || season.SeriesID != series.ID {
+		SetToast(c, "noseason")
+		return c.Redirect(302, redirectURL)
+	}
+
+	battles, err := app.Series.Battles(series.ID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	if len(battles) == 0 {
+		SetToast(c, "noseriesbattle")
+		return c.Redirect(302, redirectURL)
+	}
+
+	latest := battles[len(battles)-1]
+	gap := defaultSeriesGap
+	if len(battles) > 1 {
+		if between := latest.Deadline.Sub(battles[len(battles)-2].Deadline); between > 0 {
+			gap = between
+		}
+	}
+
+	battle, err := app.Battles.Get(latest.ID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	battle.Status = StatusDraft
+	battle.SeasonID = season.ID
+	battle.Attachment = ""
+	battle.Deadline = battle.Deadline.Add(gap)
+	battle.VotingDeadline = battle.VotingDeadline.Add(gap)
+	// A series that took a break picks up from now.
+	for battle.Deadline.Before(time.Now()) {
+		battle.Deadline = battle.Deadline.Add(gap)
+		battle.VotingDeadline = battle.VotingDeadline.Add(gap)
+	}
+
+	battleID, err := app.CopyBattle(battle)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err = app.Battles.RecordTransition(battleID, "", StatusDraft, TriggerHost, me.ID, "")
+	if err != nil {
+		log.Println(err)
+	}
+
+	duration := time.Since(start)
+	fmt.Println("NextBattle time: " + duration.String())
+
+	SetToast(c, "successadd")
+	return c.Redirect(302, "/battle/"+strconv.Itoa(battleID)+"/update")
+}
+
+// ViewSeason - Shows a season's standings and battles.
+func (app *App) ViewSeason(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+
+	seasonID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+
+	season, err := app.Series.GetSeason(seasonID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+	season.Title = html.UnescapeString(season.Title)
+
+	series, err := app.Series.Get(season.SeriesID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+	series.Title = html.UnescapeString(series.Title)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	all, err := app.Series.Battles(series.ID)
+	if err != nil {
+		log.Println(err)
+		all = []Battle{}
+	}
+
+	// Only complete battles are in the standings, the rest are still to come.
+	battles, complete := []Battle{}, []Battle{}
+	for _, battle := range all {
+		// Drafts stay with the host until they're published.
+		if battle.SeasonID != season.ID || (battle.Status == StatusDraft && me.ID != series.Host.ID) {
+			continue
+		}
+		battle.Title = html.UnescapeString(battle.Title)
+		battles = append(battles, battle)
+		if battle.Status == StatusComplete {
+			complete = append(complete, battle)
+		}
+	}
+
+	records, err := app.Series.Records(season.ID)
+	if err != nil {
+		log.Println(err)
+		records = []ChampionshipRecord{}
+	}
+
+	users := map[int]User{}
+	for _, record := range records {
+		if _, ok := users[record.UserID]; !ok {
+			users[record.UserID] = app.GetUserDB(record.UserID)
+		}
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     series.Title + " - " + season.Title,
+			"Analytics": analyticsKey,
+		},
+		"Series":    series,
+		"Season":    season,
+		"Battles":   battles,
+		"Complete":  complete,
+		"Standings": SeasonStandings(series, complete, records, users),
+		"Me":        me,
+		"Toast":     toast,
+		"Ads":       ads,
+	}
+
+	duration := time.Since(start)
+	fmt.Println("ViewSeason time: " + duration.String())
+
+	return c.Render(http.StatusOK, "Season", m)
+}
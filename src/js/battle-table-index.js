@@ -15,10 +15,11 @@ angular
 
   .controller("BeatBattleController", [
     "$mdEditDialog",
+    "$http",
     "$q",
     "$scope",
     "$timeout",
-    function ($mdEditDialog, $q, $scope, $timeout) {
+    function ($mdEditDialog, $http, $q, $scope, $timeout) {
       "use strict";
 
       $scope.selected = [];
@@ -31,10 +32,39 @@ angular
       };
 
       $scope.battles = {
-        count: battlesJSON.length,
-        data: battlesJSON
+        data: battlesJSON.battles,
+        next: battlesJSON.next
       };
 
+      // While there's another page on the server, count one extra so the pager can move onto it.
+      function setCount() {
+        $scope.battles.count = $scope.battles.data.length + ($scope.battles.next ? 1 : 0);
+      }
+      setCount();
+
+      // Load the next page of battles once the table pages past the ones already loaded.
+      function loadMore() {
+        if (!$scope.battles.next || $scope.promise) {
+          return;
+        }
+
+        if ($scope.query.page * $scope.query.limit < $scope.battles.data.length) {
+          return;
+        }
+
+        $scope.promise = $http.get(battlesURL, { params: { cursor: $scope.battles.next } })
+          .then(function (response) {
+            $scope.battles.data = $scope.battles.data.concat(response.data.battles);
+            $scope.battles.next = response.data.next;
+            setCount();
+            $timeout(onChange);
+          })
+          .finally(function () {
+            $scope.promise = null;
+            loadMore();
+          });
+      }
+
       $scope.toggleLimitOptions = function () {
         $scope.limitOptions = $scope.limitOptions ? undefined : [10, 25, 100];
       };
@@ -45,6 +75,7 @@ angular
 
       $scope.tableChange = function () {
         console.log("changed");
+        loadMore();
         onChange();
       };
     }
@@ -1,31 +1,37 @@
+// Swaps the play button for the track's player, worked out by its provider when it was entered.
+// Uploaded tracks play in the browser's own player, and tracks without a player open their link instead.
 function embed(button) {
-  /* Todo - width */
-  embedUrl = button.data("embed")
-  if(getHostnameFromRegex(embedUrl) == "soundcloud.com") {
-      console.log("soundcloud")
-      var urlSplit = embedUrl.split("/")
-      console.log(urlSplit)
-
-      embedData = `<iframe height='20' scrolling='no' frameborder='no' allow='autoplay' src='https://w.soundcloud.com/player/?url=`
-      // If secret URL
-      if(urlSplit.length >= 6) {
-          embedUrl = "https://soundcloud.com/" + urlSplit[3] + "/" + urlSplit[4] + `?secret_token=` + urlSplit[5]
-      }
-
-      embedData += embedUrl
-      embedData += `&color=%23ff5500&inverse=true&auto_play=true&show_user=false'></iframe>`
-      var toembed = button.closest(".embedded-track");
-      toembed.html(embedData);
-  } else if(getHostnameFromRegex(embedUrl) == "audius.co") {
+  var player = button.data("player");
+  if(!player) {
+    window.open(button.data("embed"), "_blank", "noopener");
+    return;
+  }
 
+  if(button.data("provider") == "upload") {
+    var audio = $("<audio>").attr({src: player, controls: true, autoplay: true, preload: "none"});
+    button.closest(".embedded-track").html(audio);
+    return;
   }
+
+  var iframe = $("<iframe>").attr({
+    src: player,
+    height: button.data("height"),
+    scrolling: "no",
+    frameborder: "no",
+    allow: "autoplay; encrypted-media"
+  });
+  button.closest(".embedded-track").html(iframe);
 }
 
-const getHostnameFromRegex = (url) => {
-  // run against regex
-  const matches = url.match(/^https?\:\/\/([^\/?#]+)(?:[\/?#]|$)/i);
-  // extract hostname (will be null if no match is found)
-  return matches && matches[1];
+// Updates the entrant's qualification status after they vote or leave feedback.
+function refreshQualification(battleID) {
+  if(!$(".qualification").length) {
+    return;
+  }
+
+  $.get("/battle/" + battleID + "/qualification", function (status) {
+    $(".qualification").html(status.message).attr("style", status.qualified ? "" : "color: #ff5800");
+  });
 }
 
 function onChange() {
@@ -154,6 +160,7 @@ angular
                       classes: t.ToastClass,
                       displayLength: 1500,
                   }))
+                  refreshQualification(beat.battle_id);
                 }
             });
             battleEntries[beat.index].feedback = input.$modelValue;
@@ -173,6 +180,52 @@ angular
         });
       };
 
+      $scope.editScore = function (event, beat, criterionID) {
+        event.stopPropagation();
+
+        var promise = $mdEditDialog.small({
+          modelValue: beat.user_scores ? beat.user_scores[criterionID] : '',
+          placeholder: 'Score 1-10',
+          type: 'number',
+          save: function (input) {
+            var score = parseInt(input.$modelValue);
+            $.ajax({
+                "url": "/score",
+                "data": "beatID=" + beat.id + "&criterionID=" + criterionID + "&score=" + score,
+                "type": "post",
+                "success": function(t) {
+                  t.Redirect ? window.location.replace(t.RedirectPath) : (M.toast({
+                      html: t.ToastHTML,
+                      classes: t.ToastClass,
+                      displayLength: 1500,
+                  }));
+
+                  if(t.ToastQuery == "successscore") {
+                    $scope.$apply(function () {
+                      beat.user_scores = beat.user_scores || {};
+                      beat.user_scores[criterionID] = score;
+                    });
+                    refreshQualification(beat.battle_id);
+                  }
+                }
+            });
+          },
+          targetEvent: event,
+          validators: {
+            'min': 1,
+            'max': 10
+          }
+        });
+
+        promise.then(function (ctrl) {
+          var input = ctrl.getInput();
+
+          input.$viewChangeListeners.push(function () {
+            input.$setValidity('test', input.$modelValue !== 'test');
+          });
+        });
+      };
+
       $scope.likeBeat = function (event, beat) {
         event.stopPropagation();
         if(beat.user_like == 1) {
@@ -217,15 +270,57 @@ angular
             if(t.ToastQuery == "successvote") {
                 votesRemaining -= 1;
                 $(".votes-remaining").html(votesRemaining);
+                refreshQualification(beat.battle_id);
               }
               if(t.ToastQuery == "successdelvote") {
                 votesRemaining += 1;
                 $(".votes-remaining").html(votesRemaining);
+                refreshQualification(beat.battle_id);
               }
             } 
         });
       };
 
+      $scope.rankBeat = function (event, beat) {
+        event.stopPropagation();
+
+        // Rebuild the ballot in rank order, then add or drop this beat.
+        var ballot = $scope.beats.data.filter(function (entry) {
+          return entry.user_vote > 0;
+        }).sort(function (a, b) {
+          return a.user_vote - b.user_vote;
+        });
+        var ranked = ballot.length;
+        if(beat.user_vote > 0) {
+          ballot.splice(beat.user_vote - 1, 1);
+        } else {
+          ballot.push(beat);
+        }
+
+        $.ajax({
+            "url": "/ballot",
+            "data": "battleID=" + beat.battle_id + "&beats=" + ballot.map(function (entry) { return entry.id; }).join(","),
+            "type": "post",
+            "success": function(t) {
+                t.Redirect ? window.location.replace(t.RedirectPath) : (M.toast({
+                    html: t.ToastHTML,
+                    classes: t.ToastClass,
+                    displayLength: 1500,
+                }));
+              if(t.ToastQuery == "successballot") {
+                $scope.$apply(function () {
+                  for(var i = 0; i < $scope.beats.data.length; i++) {
+                    $scope.beats.data[i].user_vote = ballot.indexOf($scope.beats.data[i]) + 1;
+                  }
+                });
+                votesRemaining += ranked - ballot.length;
+                $(".votes-remaining").html(votesRemaining);
+                refreshQualification(beat.battle_id);
+              }
+            }
+        });
+      };
+
       $scope.disqualifyBeat = function (event, beat) {
         event.stopPropagation();
 
@@ -1 +1 @@
-function onChange(){$(".tooltipped").tooltip(),$(".deadline").each(function(t,e){$(this).countdown($(this).attr("deadline"),function(t){$(this).text(t.strftime("%Dd %Hh %Mm %Ss"))})})}angular.module("BeatBattle",["ngMaterial","md.data.table"]).controller("BeatBattleController",["$mdEditDialog","$q","$scope","$timeout",function(t,e,n,o){"use strict";n.selected=[],n.limitOptions=[10,25,100],n.query={order:"name",limit:10,page:1},n.battles={count:battlesJSON.length,data:battlesJSON},n.toggleLimitOptions=function(){n.limitOptions=n.limitOptions?void 0:[10,25,100]},n.logOrder=function(t){console.log("order: ",t)},n.tableChange=function(){console.log("changed"),onChange()}}]),$(document).ready(function(){onChange()});
\ No newline at end of file
+function onChange(){$(".tooltipped").tooltip(),$(".deadline").each(function(){$(this).countdown($(this).attr("deadline"),function(e){$(this).text(e.strftime("%Dd %Hh %Mm %Ss"))})})}angular.module("BeatBattle",["ngMaterial","md.data.table"]).controller("BeatBattleController",["$mdEditDialog","$http","$q","$scope","$timeout",function(e,t,n,s,o){"use strict";s.selected=[],s.limitOptions=[10,25,100],s.query={order:"name",limit:10,page:1},s.battles={data:battlesJSON.battles,next:battlesJSON.next};function i(){s.battles.count=s.battles.data.length+(s.battles.next?1:0)}i();function a(){if(!s.battles.next||s.promise)return;if(s.query.page*s.query.limit<s.battles.data.length)return;s.promise=t.get(battlesURL,{params:{cursor:s.battles.next}}).then(function(e){s.battles.data=s.battles.data.concat(e.data.battles),s.battles.next=e.data.next,i(),o(onChange)}).finally(function(){s.promise=null,a()})}s.toggleLimitOptions=function(){s.limitOptions=s.limitOptions?0[0]:[10,25,100]},s.logOrder=function(e){console.log("order: ",e)},s.tableChange=function(){console.log("changed"),a(),onChange()}}]),$(document).ready(function(){onChange()})
\ No newline at end of file
@@ -1 +1 @@
-function embed(e){if(embedUrl=e.data("embed"),"soundcloud.com"==getHostnameFromRegex(embedUrl)){console.log("soundcloud");var t=embedUrl.split("/");console.log(t),embedData="<iframe height='20' scrolling='no' frameborder='no' allow='autoplay' src='https://w.soundcloud.com/player/?url=",t.length>=6&&(embedUrl="https://soundcloud.com/"+t[3]+"/"+t[4]+"?secret_token="+t[5]),embedData+=embedUrl,embedData+="&color=%23ff5500&inverse=true&auto_play=true&show_user=false'></iframe>",e.closest(".embedded-track").html(embedData)}else getHostnameFromRegex(embedUrl)}const getHostnameFromRegex=e=>{const t=e.match(/^https?\:\/\/([^\/?#]+)(?:[\/?#]|$)/i);return t&&t[1]};function onChange(){$(".tooltipped").tooltip(),$(".playButton").click(function(){embed($(this))})}angular.module("BeatBattle",["ngMaterial","md.data.table"]).config(["$mdThemingProvider",function(e){"use strict";e.theme("default")}]).controller("BeatBattleController",["$mdEditDialog","$q","$scope","$timeout",function(e,t,a,o){"use strict";a.drawTable=!0,a.selected=[],a.limitOptions=[10,25,100],a.query={order:"name",limit:10,page:1},a.beats={count:battleEntries.length,data:battleEntries},a.toggleLimitOptions=function(){a.limitOptions=a.limitOptions?void 0:[10,25,100]},a.editPlacement=function(t,o){t.stopPropagation(),e.small({modelValue:o.placement,save:function(e){o.placement=parseInt(e.$modelValue),$.ajax({url:"/placement",data:"battleID="+o.battle_id+"&beatID="+o.id+"&placement="+o.placement,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),"placement"==e.ToastQuery&&function(e){var t=JSON.parse(JSON.stringify(a.beats.data));t.splice(e.index,1),t.splice(e.placement-1,0,e);for(var o=0;o<t.length;o++)1==t[o].voted&&(a.beats.data[t[o].index].placement=o+1);a.refreshTable()}(o)}})},targetEvent:t,validators:{"md-maxlength":4}}).then(function(e){var t=e.getInput();t.$viewChangeListeners.push(function(){t.$setValidity("test","test"!==t.$modelValue)})})},a.editFeedback=function(t,a){t.stopPropagation(),e.small({modelValue:a.feedback,placeholder:"Add feedback",save:function(e){$.ajax({url:"/feedback",data:"beatID="+a.id+"&feedback="+e.$modelValue,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500})}}),battleEntries[a.index].feedback=e.$modelValue},targetEvent:t,validators:{"md-maxlength":256}}).then(function(e){var t=e.getInput();t.$viewChangeListeners.push(function(){t.$setValidity("test","test"!==t.$modelValue)})})},a.likeBeat=function(e,t){e.stopPropagation(),1==t.user_like?battleEntries[t.index].user_like=0:battleEntries[t.index].user_like=1,$.ajax({url:"/like",data:"beatID="+t.id+"&battleID="+t.battle_id+"&userID="+t.artist.id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500})}})},a.voteBeat=function(e,t){e.stopPropagation(),console.log(t.artist.id),1==t.user_vote?battleEntries[t.index].user_vote=0:0==t.user_vote&&votesRemaining>0&&(battleEntries[t.index].user_vote=1),$.ajax({url:"/vote",data:"beatID="+t.id+"&battleID="+t.battle_id+"&userID="+t.artist.id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),"successvote"==e.ToastQuery&&(votesRemaining-=1,$(".votes-remaining").html(votesRemaining)),"successdelvote"==e.ToastQuery&&(votesRemaining+=1,$(".votes-remaining").html(votesRemaining))}})},a.disqualifyBeat=function(e,t){e.stopPropagation(),battleEntries[t.index].voted=!t.voted,battleEntries[t.index].placement=999,$.ajax({url:"/disqualify",data:"beatID="+t.id+"&battleID="+t.battle_id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),"disqualified"==e.ToastQuery&&i.attr("style","color: #ff5800"),"requalified"==e.ToastQuery&&i.attr("style","")}})},a.logOrder=function(e){console.log("order: ",e)},a.tableChange=function(){console.log("changed"),onChange()},a.refreshTable=function(){var e=JSON.parse(JSON.stringify(a.beats.data));a.beats.data=[],o(function(){a.beats.data=e},50)}}]),$(document).ready(function(){onChange(),$(".deadline").each(function(e,t){$(this).countdown($(this).attr("deadline"),function(e){$(this).text(e.strftime("%Dd %Hh %Mm %Ss"))})})});
\ No newline at end of file
+function embed(e){var n,s,t=e.data("player");if(!t){window.open(e.data("embed"),"_blank","noopener");return}if(e.data("provider")=="upload"){n=$("<audio>").attr({src:t,controls:!0,autoplay:!0,preload:"none"}),e.closest(".embedded-track").html(n);return}s=$("<iframe>").attr({src:t,height:e.data("height"),scrolling:"no",frameborder:"no",allow:"autoplay; encrypted-media"}),e.closest(".embedded-track").html(s)}function refreshQualification(e){if(!$(".qualification").length)return;$.get("/battle/"+e+"/qualification",function(e){$(".qualification").html(e.message).attr("style",e.qualified?"":"color: #ff5800")})}function onChange(){$(".tooltipped").tooltip(),$(".playButton").click(function(){var e=$(this);embed(e)})}angular.module("BeatBattle",["ngMaterial","md.data.table"]).config(["$mdThemingProvider",function(e){"use strict";e.theme("default")}]).controller("BeatBattleController",["$mdEditDialog","$q","$scope","$timeout",function(e,t,n,s){"use strict";n.drawTable=!0,n.selected=[],n.limitOptions=[10,25,100],n.query={order:"name",limit:10,page:1},n.beats={count:battleEntries.length,data:battleEntries},n.toggleLimitOptions=function(){n.limitOptions=n.limitOptions?0[0]:[10,25,100]},n.editPlacement=function(t,s){t.stopPropagation();function o(e){var t,s=JSON.parse(JSON.stringify(n.beats.data));s.splice(e.index,1),s.splice(e.placement-1,0,e);for(t=0;t<s.length;t++)s[t].voted==1&&(n.beats.data[s[t].index].placement=t+1);n.refreshTable()}var i=e.small({modelValue:s.placement,save:function(e){s.placement=parseInt(e.$modelValue),$.ajax({url:"/placement",data:"battleID="+s.battle_id+"&beatID="+s.id+"&placement="+s.placement,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),e.ToastQuery=="placement"&&o(s)}})},targetEvent:t,validators:{"md-maxlength":4}});i.then(function(e){var t=e.getInput();t.$viewChangeListeners.push(function(){t.$setValidity("test",t.$modelValue!=="test")})})},n.editFeedback=function(t,n){t.stopPropagation();var s=e.small({modelValue:n.feedback,placeholder:"Add feedback",save:function(e){$.ajax({url:"/feedback",data:"beatID="+n.id+"&feedback="+e.$modelValue,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),refreshQualification(n.battle_id)}}),battleEntries[n.index].feedback=e.$modelValue},targetEvent:t,validators:{"md-maxlength":256}});s.then(function(e){var t=e.getInput();t.$viewChangeListeners.push(function(){t.$setValidity("test",t.$modelValue!=="test")})})},n.editScore=function(t,s,o){t.stopPropagation();var i=e.small({modelValue:s.user_scores?s.user_scores[o]:"",placeholder:"Score 1-10",type:"number",save:function(e){var t=parseInt(e.$modelValue);$.ajax({url:"/score",data:"beatID="+s.id+"&criterionID="+o+"&score="+t,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),e.ToastQuery=="successscore"&&(n.$apply(function(){s.user_scores=s.user_scores||{},s.user_scores[o]=t}),refreshQualification(s.battle_id))}})},targetEvent:t,validators:{min:1,max:10}});i.then(function(e){var t=e.getInput();t.$viewChangeListeners.push(function(){t.$setValidity("test",t.$modelValue!=="test")})})},n.likeBeat=function(e,t){e.stopPropagation(),t.user_like==1?battleEntries[t.index].user_like=0:battleEntries[t.index].user_like=1,$.ajax({url:"/like",data:"beatID="+t.id+"&battleID="+t.battle_id+"&userID="+t.artist.id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500})}})},n.voteBeat=function(e,t){e.stopPropagation(),console.log(t.artist.id),t.user_vote==1?battleEntries[t.index].user_vote=0:t.user_vote==0&&votesRemaining>0&&(battleEntries[t.index].user_vote=1),$.ajax({url:"/vote",data:"beatID="+t.id+"&battleID="+t.battle_id+"&userID="+t.artist.id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),e.ToastQuery=="successvote"&&(votesRemaining-=1,$(".votes-remaining").html(votesRemaining),refreshQualification(t.battle_id)),e.ToastQuery=="successdelvote"&&(votesRemaining+=1,$(".votes-remaining").html(votesRemaining),refreshQualification(t.battle_id))}})},n.rankBeat=function(e,t){e.stopPropagation();var s=n.beats.data.filter(function(e){return e.user_vote>0}).sort(function(e,t){return e.user_vote-t.user_vote}),o=s.length;t.user_vote>0?s.splice(t.user_vote-1,1):s.push(t),$.ajax({url:"/ballot",data:"battleID="+t.battle_id+"&beats="+s.map(function(e){return e.id}).join(","),type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),e.ToastQuery=="successballot"&&(n.$apply(function(){for(var e=0;e<n.beats.data.length;e++)n.beats.data[e].user_vote=s.indexOf(n.beats.data[e])+1}),votesRemaining+=o-s.length,$(".votes-remaining").html(votesRemaining),refreshQualification(t.battle_id))}})},n.disqualifyBeat=function(e,t){e.stopPropagation(),battleEntries[t.index].voted=!t.voted,battleEntries[t.index].placement=999,$.ajax({url:"/disqualify",data:"beatID="+t.id+"&battleID="+t.battle_id,type:"post",success:function(e){e.Redirect?window.location.replace(e.RedirectPath):M.toast({html:e.ToastHTML,classes:e.ToastClass,displayLength:1500}),e.ToastQuery=="disqualified"&&i.attr("style","color: #ff5800"),e.ToastQuery=="requalified"&&i.attr("style","")}})},n.logOrder=function(e){console.log("order: ",e)},n.tableChange=function(){console.log("changed"),onChange()},n.refreshTable=function(){var e=JSON.parse(JSON.stringify(n.beats.data));n.beats.data=[],s(function(){n.beats.data=e},50)}}]),$(document).ready(function(){onChange(),$(".deadline").each(function(){$(this).countdown($(this).attr("deadline"),function(e){$(this).text(e.strftime("%Dd %Hh %Mm %Ss"))})})})
\ No newline at end of file
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BattleStatus is the stage a battle is in.
+type BattleStatus string
+
+// Battle statuses, in lifecycle order.
+const (
+	StatusDraft    BattleStatus = "draft"
+	StatusEntry    BattleStatus = "entry"
+	StatusVoting   BattleStatus = "voting"
+	StatusComplete BattleStatus = "complete"
+)
+
+// TransitionTrigger is who or what moved a battle between statuses.
+type TransitionTrigger string
+
+// Transition triggers.
+const (
+	TriggerHost      TransitionTrigger = "host"
+	TriggerClose     TransitionTrigger = "close"
+	TriggerScheduler TransitionTrigger = "scheduler"
+	TriggerAdmin     TransitionTrigger = "admin"
+)
+
+// allowedTransitions lists the statuses each status can move to.
+// Voting can go back to entry when the host pushes the deadline back.
+var allowedTransitions = map[BattleStatus][]BattleStatus{
+	StatusDraft:    {StatusEntry},
+	StatusEntry:    {StatusDraft, StatusVoting},
+	StatusVoting:   {StatusEntry, StatusComplete},
+	StatusComplete: {},
+}
+
+// ErrInvalidTransition is returned when a status change isn't allowed.
+var ErrInvalidTransition = errors.New("invalid battle status transition")
+
+// ErrStaleTransition is returned when the battle changed status before the transition ran.
+var ErrStaleTransition = errors.New("battle status changed before transition")
+
+// BattleTransition is a row in a battle's status history.
+type BattleTransition struct {
+	From      BattleStatus      `json:"from"`
+	To        BattleStatus      `json:"to"`
+	Trigger   TransitionTrigger `json:"trigger"`
+	User      User              `json:"user"`
+	Note      string            `json:"note"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// ValidStatus checks if the string is a known battle status.
+func ValidStatus(status string) bool {
+	_, ok := allowedTransitions[BattleStatus(status)]
+	return ok
+}
+
+// CanTransition checks if a battle in this status may move to the next one.
+func (status BattleStatus) CanTransition(next BattleStatus) bool {
+	for _, allowed := range allowedTransitions[status] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// TransitionBattle moves a battle from one status to another and records the change.
+// The update only applies if the battle is still in the from status.
+func (app *App) TransitionBattle(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	if !from.CanTransition(to) {
+		return ErrInvalidTransition
+	}
+
+	return app.Battles.Transition(battleID, from, to, trigger, userID, note)
+}
+
+// GetBattleTransitions returns a battle's status history, oldest first.
+func (app *App) GetBattleTransitions(battleID int) []BattleTransition {
+	transitions, err := app.Battles.Transitions(battleID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	return transitions
+}
+
+// IsAdmin checks the user against the comma separated ADMIN_IDS env variable.
+func IsAdmin(user User) bool {
+	if !user.Authenticated {
+		return false
+	}
+
+	for _, id := range strings.Split(os.Getenv("ADMIN_IDS"), ",") {
+		adminID, err := strconv.Atoi(strings.TrimSpace(id))
+		if err == nil && adminID == user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminTransitionBattle lets an admin move a battle to another status.
+func (app *App) AdminTransitionBattle(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+	redirectURL := "/battle/" + strconv.Itoa(battleID)
+
+	if !IsAdmin(me) {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	status := policy.Sanitize(c.FormValue("status"))
+	if !ValidStatus(status) {
+		SetToast(c, "invalidstatus")
+		return c.Redirect(302, redirectURL)
+	}
+
+	battle := app.GetBattle(battleID)
+	if battle.Title == "" {
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+
+	note := policy.Sanitize(c.FormValue("note"))
+	if BattleStatus(status) == StatusComplete {
+		err = app.CompleteBattle(battleID, TriggerAdmin, me.ID, note)
+	} else {
+		err = app.TransitionBattle(battleID, battle.Status, BattleStatus(status), TriggerAdmin, me.ID, note)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "invalidstatus")
+		return c.Redirect(302, redirectURL)
+	}
+
+	app.WakeScheduler()
+	SetToast(c, "successupdate")
+	return c.Redirect(302, redirectURL)
+}
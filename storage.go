@@ -0,0 +1,424 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileStorage keeps uploaded files, like entries' audio, under keys the app picks.
+type FileStorage interface {
+	// Put stores a file, replacing any already under the key.
+	Put(key string, body io.Reader, size int64, contentType string) error
+	// Open returns a stored file for reading. It returns ErrNotFound if there isn't one.
+	Open(key string) (StoredFile, error)
+	// Delete removes a stored file. Removing one that isn't there isn't an error.
+	Delete(key string) error
+}
+
+// StoredFile is a stored file opened for reading. Seeking lets it serve Range requests.
+type StoredFile struct {
+	io.ReadSeekCloser
+	Size    int64
+	ModTime time.Time
+}
+
+// storageInit opens the file storage described by STORAGE_URL, which defaults to an uploads folder.
+//
+//	file:uploads
+//	s3://bucket?region=us-east-1
+//	s3://bucket?endpoint=https://minio.example.com&region=us-east-1
+//
+// S3 credentials come from AWS_ACCESS_KEY_ID & AWS_SECRET_ACCESS_KEY.
+func storageInit() FileStorage {
+	storage, err := parseStorageURL(os.Getenv("STORAGE_URL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	return storage
+}
+
+// parseStorageURL turns a STORAGE_URL into the storage it describes.
+func parseStorageURL(storageURL string) (FileStorage, error) {
+	if storageURL == "" {
+		storageURL = "file:uploads"
+	}
+	if strings.HasPrefix(storageURL, "file:") {
+		return NewLocalStorage(strings.TrimPrefix(strings.TrimPrefix(storageURL, "file:"), "//")), nil
+	}
+
+	u, err := url.Parse(storageURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("unsupported storage %q, use file: or s3://bucket", storageURL)
+	}
+
+	params := u.Query()
+	return NewS3Storage(u.Host, params.Get("region"), params.Get("endpoint"),
+		os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"))
+}
+
+// validKey reports whether a key is a relative, slash separated path that stays inside the storage.
+func validKey(key string) bool {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+/*-------
+Local
+-------*/
+
+type localStorage struct {
+	dir string
+}
+
+// NewLocalStorage returns storage that keeps files in a folder on disk, created when the first file is stored.
+func NewLocalStorage(dir string) FileStorage {
+	return &localStorage{dir: dir}
+}
+
+func (s *localStorage) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *localStorage) Put(key string, body io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed upload never replaces a stored one.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = io.Copy(tmp, body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *localStorage) Open(key string) (StoredFile, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return StoredFile{}, ErrNotFound
+	}
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return StoredFile{}, err
+	}
+
+	return StoredFile{ReadSeekCloser: file, Size: info.Size(), ModTime: info.ModTime()}, nil
+}
+
+func (s *localStorage) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+/*-------
+S3
+-------*/
+
+// s3Storage keeps files in an S3 compatible bucket, signing requests with AWS Signature Version 4.
+type s3Storage struct {
+	// base is the bucket's URL that keys are appended to.
+	base                 *url.URL
+	region               string
+	accessKey, secretKey string
+	client               *http.Client
+	now                  func() time.Time
+}
+
+// NewS3Storage returns storage backed by an S3 bucket. Without an endpoint it's AWS, addressed by virtual host.
+// Other providers, like MinIO or R2, are addressed by path under their endpoint.
+func NewS3Storage(bucket, region, endpoint, accessKey, secretKey string) (FileStorage, error) {
+	if region == "" {
+		region = "us-east-1"
+	}
+	if accessKey == "" || secretKey == "" {
+		return nil, errors.New("s3 storage needs AWS_ACCESS_KEY_ID & AWS_SECRET_ACCESS_KEY")
+	}
+
+	base := "https://" + bucket + ".s3." + region + ".amazonaws.com/"
+	if endpoint != "" {
+		base = strings.TrimSuffix(endpoint, "/") + "/" + bucket + "/"
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	// Uploads can be large, so S3 requests don't share the default client's short timeout.
+	return &s3Storage{
+		base:      u,
+		region:    region,
+		accessKey: accessKey,
+		secretKey: secretKey,
+		client:    &http.Client{},
+		now:       time.Now,
+	}, nil
+}
+
+// request builds a signed request for a key. Payloads aren't hashed so uploads can stream.
+func (s *s3Storage) request(method, key string, body io.Reader, size int64) (*http.Request, error) {
+	if !validKey(key) {
+		return nil, fmt.Errorf("invalid storage key %q", key)
+	}
+
+	req, err := http.NewRequest(method, s.base.String()+key, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	return req, nil
+}
+
+// do signs and sends a request, turning error responses into errors.
+func (s *s3Storage) do(req *http.Request, ok ...int) (*http.Response, error) {
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	signS3(req, s.accessKey, s.secretKey, s.region, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, status := range ok {
+		if resp.StatusCode == status {
+			return resp, nil
+		}
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+}
+
+func (s *s3Storage) Put(key string, body io.Reader, size int64, contentType string) error {
+	req, err := s.request(http.MethodPut, key, body, size)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s *s3Storage) Open(key string) (StoredFile, error) {
+	req, err := s.request(http.MethodHead, key, nil, 0)
+	if err != nil {
+		return StoredFile{}, err
+	}
+
+	resp, err := s.do(req, http.StatusOK)
+	if err != nil {
+		return StoredFile{}, err
+	}
+	resp.Body.Close()
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return StoredFile{
+		ReadSeekCloser: &s3Object{storage: s, key: key, size: resp.ContentLength},
+		Size:           resp.ContentLength,
+		ModTime:        modTime,
+	}, nil
+}
+
+func (s *s3Storage) Delete(key string) error {
+	req, err := s.request(http.MethodDelete, key, nil, 0)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.do(req, http.StatusOK, http.StatusNoContent, http.StatusNotFound)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// s3Object reads a stored object with ranged GETs from wherever it was last seeked to.
+type s3Object struct {
+	storage *s3Storage
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func (o *s3Object) Read(p []byte) (int, error) {
+	if o.offset >= o.size {
+		return 0, io.EOF
+	}
+
+	if o.body == nil {
+		req, err := o.storage.request(http.MethodGet, o.key, nil, 0)
+		if err != nil {
+			return 0, err
+		}
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(o.offset, 10)+"-")
+
+		resp, err := o.storage.do(req, http.StatusPartialContent)
+		if err != nil {
+			return 0, err
+		}
+		o.body = resp.Body
+	}
+
+	n, err := o.body.Read(p)
+	o.offset += int64(n)
+	return n, err
+}
+
+func (o *s3Object) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += o.offset
+	case io.SeekEnd:
+		offset += o.size
+	}
+	if offset < 0 {
+		return 0, errors.New("s3 object: negative position")
+	}
+
+	if offset != o.offset {
+		o.Close()
+		o.offset = offset
+	}
+	return offset, nil
+}
+
+func (o *s3Object) Close() error {
+	if o.body == nil {
+		return nil
+	}
+	err := o.body.Close()
+	o.body = nil
+	return err
+}
+
+// signS3 signs a request for S3 with AWS Signature Version 4, covering the host and every header already set.
+// The payload hash has to be in X-Amz-Content-Sha256 first.
+func signS3(req *http.Request, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	canonicalHeaders := ""
+	for _, name := range names {
+		canonicalHeaders += name + ":" + headers[name] + "\n"
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscapePath(req.URL.Path),
+		req.URL.Query().Encode(),
+		canonicalHeaders,
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// awsEscapePath escapes a path the way Signature Version 4 expects, leaving only unreserved characters and slashes.
+func awsEscapePath(path string) string {
+	escaped := strings.Builder{}
+	for _, b := range []byte(path) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || strings.IndexByte("-_.~/", b) >= 0 {
+			escaped.WriteByte(b)
+		} else {
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound is returned by a store when the requested row doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// BattleStore reads & writes battles, their settings and their status history.
+type BattleStore interface {
+	// Get returns a battle with its host and settings.
+	Get(battleID int) (Battle, error)
+	// List returns the battles matching a query.
+	List(query BattleQuery) ([]Battle, error)
+	Insert(battle Battle) (int, error)
+	// Update saves the host-editable fields of a battle owned by battle.Host.
+	Update(battle Battle) error
+	Delete(battleID int, hostID int) error
+	// SaveSettings inserts the settings if they have no ID yet, otherwise updates them.
+	SaveSettings(settings BattleSettings) (int, error)
+	SetDeadlines(battleID int, deadline time.Time, votingDeadline time.Time) error
+	// SetTags replaces a battle's tags, which must already be normalized.
+	SetTags(battleID int, tags []string) error
+	// Criteria returns a score battle's criteria in the order the host listed them.
+	Criteria(battleID int) ([]Criterion, error)
+	// SetCriteria replaces a battle's criteria, dropping any scores given on the old ones.
+	SetCriteria(battleID int, criteria []Criterion) error
+
+	// Transition moves a battle between statuses if it is still in the from status, and records it.
+	Transition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error
+	// RecordTransition records a history row without changing the battle.
+	RecordTransition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error
+	Transitions(battleID int) ([]BattleTransition, error)
+	// Due returns the battles in a status whose deadline for that status has passed.
+	Due(status BattleStatus, now time.Time) ([]int, error)
+	// NextDeadline returns the earliest deadline of a battle in entry or voting.
+	NextDeadline() (time.Time, bool, error)
+}
+
+// BeatStore reads & writes battle entries.
+type BeatStore interface {
+	Get(beatID int) (Beat, error)
+	GetByUser(battleID int, userID int) (Beat, error)
+	// ListByBattle returns a battle's entries with their artists, in submission order.
+	ListByBattle(battleID int) ([]Beat, error)
+	// ListByUser returns the entries a user submitted or is an accepted team member of, with their artist
+	// and their battle's title, status and teams setting.
+	ListByUser(userID int) ([]Beat, error)
+	Insert(beat Beat) (int, error)
+	// Update saves the URL and custom fields of the user's entry to a battle.
+	Update(beat Beat) error
+	Delete(battleID int, userID int) error
+	// SetVoted qualifies or disqualifies an entry. Disqualified entries lose their placement.
+	SetVoted(beatID int, voted bool) error
+	SaveResults(results []BeatResult) error
+
+	// Members returns the credits & invitations on a battle's team entries with their users, oldest first.
+	Members(battleID int) ([]BeatMember, error)
+	// SaveMember adds or replaces a user's credit on an entry.
+	SaveMember(member BeatMember) error
+	// RespondMember sets the status of a user's invitation to an entry. It returns ErrNotFound if they weren't invited.
+	RespondMember(beatID int, userID int, status MemberStatus) error
+	RemoveMember(beatID int, userID int) error
+}
+
+// UserStore reads & writes user accounts.
+type UserStore interface {
+	Get(userID int) (User, error)
+	// FindByProvider returns the ID of the user for an oAuth account, or ErrNotFound.
+	FindByProvider(provider string, providerID string) (int, error)
+	Insert(user User, tokenHash string) (int, error)
+	UpdateLogin(userID int, name string, tokenHash string, expiry time.Time) error
+	Token(userID int) (string, time.Time, error)
+	UpdateToken(userID int, tokenHash string, expiry time.Time) error
+}
+
+// VoteStore reads & writes votes and likes.
+type VoteStore interface {
+	// UserVotes returns the IDs of the beats a user voted for in a battle.
+	UserVotes(battleID int, userID int) ([]int, error)
+	Add(battleID int, beatID int, userID int) error
+	Remove(battleID int, beatID int, userID int) error
+	Tally(battleID int) (VoteTally, error)
+	// Voters returns the beats each user voted for in a battle, keyed by voter.
+	Voters(battleID int) (map[int][]int, error)
+
+	// Ballot returns the beats a user ranked in a battle, first choice first.
+	Ballot(battleID int, userID int) ([]int, error)
+	// SaveBallot replaces a user's ranked ballot. An empty ballot withdraws it.
+	SaveBallot(battleID int, userID int, beatIDs []int) error
+	// Ballots returns every ranked ballot in a battle, keyed by voter.
+	Ballots(battleID int) (map[int][]int, error)
+
+	// UserScores returns the scores a user gave in a battle, keyed by beat then criterion.
+	UserScores(battleID int, userID int) (map[int]map[int]int, error)
+	// SaveScore adds or replaces a user's score for a beat on one criterion.
+	SaveScore(battleID int, beatID int, userID int, criterionID int, score int) error
+	// Scores returns every score given in a battle.
+	Scores(battleID int) ([]Score, error)
+
+	// UserLikes returns the IDs of the beats a user liked in a battle.
+	UserLikes(battleID int, userID int) ([]int, error)
+	AddLike(battleID int, beatID int, userID int) error
+	RemoveLike(battleID int, beatID int, userID int) error
+	// LikeCounts returns how many likes each of a battle's beats has, keyed by beat ID.
+	LikeCounts(battleID int) (map[int]int, error)
+}
+
+// FeedbackStore reads & writes feedback left on entries.
+type FeedbackStore interface {
+	// Save adds or replaces a user's feedback on a beat and reports whether it was added.
+	Save(beatID int, userID int, feedback string) (bool, error)
+	// Counts returns how many of a battle's entries each user left feedback on, keyed by user ID.
+	Counts(battleID int) (map[int]int, error)
+	// Given returns the feedback a user left in a battle, keyed by beat ID.
+	Given(battleID int, userID int) (map[int]string, error)
+	// Received returns the feedback left on a user's entry to a battle.
+	Received(battleID int, userID int) ([]Feedback, error)
+}
+
+// AdStore reads advertisements.
+type AdStore interface {
+	Active() ([]Advertisement, error)
+}
+
+// TagStore reads the tags used by public battles.
+type TagStore interface {
+	// Search returns the tags starting with prefix, most used first.
+	Search(prefix string, limit int) ([]TagCount, error)
+	// Cloud returns the most used tags, alphabetically.
+	Cloud(limit int) ([]TagCount, error)
+}
+
+// SearchStore indexes battles and finds them by their terms.
+type SearchStore interface {
+	// Index replaces a battle's search terms and their weights.
+	Index(battleID int, terms map[string]int) error
+	// Search returns public battles matching any of the terms or their host's nickname,
+	// those matching the most terms first, then by weight.
+	Search(terms []string, limit int, offset int) ([]Battle, error)
+}
+
+// ResultStore keeps the working behind a battle's results.
+type ResultStore interface {
+	// SaveRounds replaces the instant-runoff rounds of a battle.
+	SaveRounds(battleID int, rounds []RoundCount) error
+	// Rounds returns a battle's instant-runoff rounds in order.
+	Rounds(battleID int) ([]RoundCount, error)
+	// SaveBreakdown replaces the mean criterion scores of a battle's entries.
+	SaveBreakdown(battleID int, breakdown []CriterionScore) error
+	Breakdown(battleID int) ([]CriterionScore, error)
+	// SaveTallies replaces the judge and public tallies of a judged battle's entries.
+	SaveTallies(battleID int, tallies []JudgeTally) error
+	Tallies(battleID int) ([]JudgeTally, error)
+	// SaveRecords replaces a battle's championship records and sets its winner.
+	SaveRecords(battleID int, winnerID int, records []ChampionshipRecord) error
+	// UserRecords returns a user's championship records with their battles' titles, oldest first.
+	UserRecords(userID int) ([]ChampionshipRecord, error)
+}
+
+// JudgeStore reads & writes the judges invited to battles.
+type JudgeStore interface {
+	// Invite adds a pending invitation. A user who was already invited keeps their status.
+	Invite(battleID int, userID int) error
+	// Respond sets the status of a user's invitation. It returns ErrNotFound if they weren't invited.
+	Respond(battleID int, userID int, status JudgeStatus) error
+	Remove(battleID int, userID int) error
+	// List returns a battle's judges and invitations with their users, oldest invitation first.
+	List(battleID int) ([]Judge, error)
+}
+
+// RatingStore keeps producers' skill ratings and how every rated battle moved them.
+type RatingStore interface {
+	// Get returns users' current ratings in a category, keyed by user ID. Unrated users are left out.
+	Get(category string, userIDs []int) (map[int]Rating, error)
+	// SaveChanges records a battle's rating changes and moves each user's rating to where their change left it.
+	SaveChanges(changes []RatingChange) error
+	// RatedAfter reports whether a battle, or any battle that finished after it, has been rated already.
+	RatedAfter(battleID int, finishedAt time.Time) (bool, error)
+	// Reset deletes every rating and rating change.
+	Reset() error
+	// Leaderboard returns the highest rated users in a category who were rated since q.Since.
+	Leaderboard(q LeaderboardQuery) ([]LeaderboardRow, error)
+	// History returns a user's rating changes in a category with their battles' titles, newest first.
+	History(userID int, category string, limit int) ([]RatingChange, error)
+}
+
+// SeriesStore reads & writes series and their seasons.
+type SeriesStore interface {
+	Insert(series Series) (int, error)
+	Get(seriesID int) (Series, error)
+	// Update saves a series' title & scoring. Only its host can.
+	Update(series Series) error
+	// ListByHost returns the series a user runs, newest first.
+	ListByHost(userID int) ([]Series, error)
+	InsertSeason(season Season) (int, error)
+	GetSeason(seasonID int) (Season, error)
+	// Seasons returns a series' seasons, oldest first.
+	Seasons(seriesID int) ([]Season, error)
+	// Battles returns the battles in a series' seasons, earliest deadline first.
+	Battles(seriesID int) ([]Battle, error)
+	// Records returns the championship records of a season's battles.
+	Records(seasonID int) ([]ChampionshipRecord, error)
+}
+
+// TournamentStore reads & writes tournaments, their entrants and their matches.
+type TournamentStore interface {
+	Insert(tournament Tournament) (int, error)
+	// Get returns a tournament with its host.
+	Get(tournamentID int) (Tournament, error)
+	// List returns the latest tournaments with their hosts, newest first.
+	List(limit int) ([]Tournament, error)
+	// SetStatus moves a started tournament between running and complete and sets its winner.
+	SetStatus(tournamentID int, status TournamentStatus, winnerID int) error
+
+	Join(tournamentID int, userID int, joinedAt time.Time) error
+	Leave(tournamentID int, userID int) error
+	// Entrants returns a tournament's entrants with their users, by seed once it has started, otherwise by signup.
+	Entrants(tournamentID int) ([]TournamentEntrant, error)
+	// Start closes a tournament's signups and seeds the entrants given top seed first.
+	// It returns ErrTournamentStarted if signups were already closed.
+	Start(tournamentID int, userIDs []int) error
+
+	// Matches returns a tournament's played matches.
+	Matches(tournamentID int) ([]TournamentMatch, error)
+	InsertMatch(match TournamentMatch) (int, error)
+	// UpdateMatch saves a match's players and result.
+	UpdateMatch(match TournamentMatch) error
+	// MatchByBattle returns the match a battle decides, or ErrNotFound.
+	MatchByBattle(battleID int) (TournamentMatch, error)
+}
+
+// ScheduleStore reads & writes recurring battle schedules.
+type ScheduleStore interface {
+	Insert(schedule Schedule) (int, error)
+	// Get returns a schedule with its host and its battle's title.
+	Get(scheduleID int) (Schedule, error)
+	// ListByHost returns the schedules a user runs with their battles' titles, newest first.
+	ListByHost(userID int) ([]Schedule, error)
+	SetPaused(scheduleID int, paused bool) error
+	Delete(scheduleID int) error
+	// Due returns the schedules that aren't paused whose next run has come round.
+	Due(now time.Time) ([]Schedule, error)
+	// NextRun returns the earliest next run of a schedule that isn't paused.
+	NextRun() (time.Time, bool, error)
+	// Claim moves a schedule on to the given run if it's still at the one it was read at.
+	// It returns ErrStaleSchedule if it isn't.
+	Claim(scheduleID int, from int, to int, nextRun time.Time) error
+	// RecordBattle counts a battle the schedule opened and keeps it as the latest.
+	RecordBattle(scheduleID int, battleID int) error
+}
+
+// TemplateStore reads & writes hosts' battle templates.
+type TemplateStore interface {
+	Insert(template BattleTemplate) (int, error)
+	// Get returns a template with its host.
+	Get(templateID int) (BattleTemplate, error)
+	// ListByHost returns the templates a user saved, by name.
+	ListByHost(userID int) ([]BattleTemplate, error)
+	// Update saves a template owned by template.Host.
+	Update(template BattleTemplate) error
+	Delete(templateID int, hostID int) error
+}
+
+// Stores holds one implementation of every store.
+type Stores struct {
+	Battles     BattleStore
+	Beats       BeatStore
+	Users       UserStore
+	Votes       VoteStore
+	Feedback    FeedbackStore
+	Ads         AdStore
+	Tags        TagStore
+	Search      SearchStore
+	Results     ResultStore
+	Judges      JudgeStore
+	Ratings     RatingStore
+	Series      SeriesStore
+	Tournaments TournamentStore
+	Schedules   ScheduleStore
+	Templates   TemplateStore
+}
+
+// App is handed to every handler so they never touch the database directly.
+type App struct {
+	Stores
+
+	// Tracks resolve entries' links with their providers.
+	Tracks *TrackResolvers
+	// Files keeps uploaded entries.
+	Files FileStorage
+
+	// wake nudges the scheduler when a battle's deadlines change.
+	wake chan struct{}
+}
+
+// NewApp returns an App backed by the given stores.
+func NewApp(stores Stores) *App {
+	return &App{
+		Stores: stores,
+		Tracks: NewTrackResolvers(http.DefaultClient),
+		Files:  NewLocalStorage("uploads"),
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// BeatResult is the outcome of a battle for a single entry.
+type BeatResult struct {
+	BeatID    int
+	Votes     int
+	Voted     bool
+	Placement int
+}
+
+// VoteTally counts a battle's votes per beat and records who voted.
+type VoteTally struct {
+	Votes  map[int]int
+	Voters map[int]bool
+}
+
+// Feedback is a comment left on an entry.
+type Feedback struct {
+	From     string `json:"from"`
+	Feedback string `json:"feedback"`
+}
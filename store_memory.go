@@ -0,0 +1,2164 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NewMemoryStores returns stores that keep everything in memory, for tests and local development.
+func NewMemoryStores() Stores {
+	db := &memoryDB{
+		battles:     map[int]Battle{},
+		settings:    map[int]BattleSettings{},
+		beats:       map[int]Beat{},
+		users:       map[int]memoryUser{},
+		search:      map[int]map[string]int{},
+		rounds:      map[int][]RoundCount{},
+		criteria:    map[int][]Criterion{},
+		breakdown:   map[int][]CriterionScore{},
+		tallies:     map[int][]JudgeTally{},
+		records:     map[int][]ChampionshipRecord{},
+		ratings:     map[memoryRatingKey]Rating{},
+		series:      map[int]Series{},
+		seasons:     map[int]Season{},
+		tournaments: map[int]Tournament{},
+		matches:     map[int]TournamentMatch{},
+		schedules:   map[int]Schedule{},
+		templates:   map[int]BattleTemplate{},
+	}
+
+	return Stores{
+		Battles:     &memoryBattleStore{db},
+		Beats:       &memoryBeatStore{db},
+		Users:       &memoryUserStore{db},
+		Votes:       &memoryVoteStore{db},
+		Feedback:    &memoryFeedbackStore{db},
+		Ads:         &memoryAdStore{db},
+		Tags:        &memoryTagStore{db},
+		Search:      &memorySearchStore{db},
+		Results:     &memoryResultStore{db},
+		Judges:      &memoryJudgeStore{db},
+		Ratings:     &memoryRatingStore{db},
+		Series:      &memorySeriesStore{db},
+		Tournaments: &memoryTournamentStore{db},
+		Schedules:   &memoryScheduleStore{db},
+		Templates:   &memoryTemplateStore{db},
+	}
+}
+
+// memoryDB is the shared state behind the memory stores, so joins between them still work.
+type memoryDB struct {
+	sync.Mutex
+	lastID int
+
+	battles       map[int]Battle
+	settings      map[int]BattleSettings
+	transitions   []memoryTransition
+	beats         map[int]Beat
+	users         map[int]memoryUser
+	votes         []memoryVote
+	likes         []memoryVote
+	feedback      []memoryFeedback
+	ads           []Advertisement
+	search        map[int]map[string]int
+	ballots       []memoryBallot
+	rounds        map[int][]RoundCount
+	criteria      map[int][]Criterion
+	scores        []memoryScore
+	breakdown     map[int][]CriterionScore
+	judges        []memoryJudge
+	members       []memoryMember
+	tallies       map[int][]JudgeTally
+	records       map[int][]ChampionshipRecord
+	ratings       map[memoryRatingKey]Rating
+	ratingHistory []RatingChange
+	series        map[int]Series
+	seasons       map[int]Season
+	tournaments   map[int]Tournament
+	entrants      []memoryEntrant
+	matches       map[int]TournamentMatch
+	schedules     map[int]Schedule
+	templates     map[int]BattleTemplate
+}
+
+type memoryRatingKey struct {
+	userID   int
+	category string
+}
+
+type memoryTransition struct {
+	BattleTransition
+	battleID int
+}
+
+type memoryUser struct {
+	User
+	tokenHash string
+}
+
+type memoryVote struct {
+	battleID, beatID, userID int
+}
+
+type memoryBallot struct {
+	battleID, userID, beatID, preference int
+}
+
+type memoryScore struct {
+	battleID int
+	Score
+}
+
+type memoryJudge struct {
+	battleID, userID int
+	status           JudgeStatus
+	invitedAt        time.Time
+}
+
+type memoryMember struct {
+	beatID, userID int
+	role           MemberRole
+	status         MemberStatus
+	invitedAt      time.Time
+}
+
+type memoryEntrant struct {
+	tournamentID int
+	TournamentEntrant
+}
+
+type memoryFeedback struct {
+	beatID, userID int
+	feedback       string
+}
+
+// nextID hands out IDs the way an auto increment column would. The lock must be held.
+func (db *memoryDB) nextID() int {
+	db.lastID++
+	return db.lastID
+}
+
+// user returns the public fields of a user. The lock must be held.
+func (db *memoryDB) user(userID int) User {
+	user := db.users[userID].User
+	return User{ID: user.ID, Provider: user.Provider, ProviderID: user.ProviderID, Name: user.Name, Flair: user.Flair}
+}
+
+/*-------
+Battles
+-------*/
+
+type memoryBattleStore struct {
+	*memoryDB
+}
+
+// battle joins a battle with its host and settings. The lock must be held.
+func (s *memoryBattleStore) battle(battleID int) Battle {
+	battle := s.battles[battleID]
+	battle.Host = s.user(battle.Host.ID)
+	battle.Settings = s.settings[battle.Settings.ID]
+	battle.Tags = append([]string(nil), battle.Tags...)
+	return battle
+}
+
+func (s *memoryBattleStore) Get(battleID int) (Battle, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.battles[battleID]; !ok {
+		return Battle{}, ErrNotFound
+	}
+
+	return s.battle(battleID), nil
+}
+
+func (s *memoryBattleStore) List(q BattleQuery) ([]Battle, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	battles := []Battle{}
+	for battleID := range s.battles {
+		battle := s.battle(battleID)
+		for _, beat := range s.beats {
+			if beat.BattleID == battleID {
+				battle.Entries++
+			}
+		}
+
+		if matchesBattleQuery(q, battle) {
+			battles = append(battles, battle)
+		}
+	}
+
+	sort.Slice(battles, func(i, j int) bool {
+		a, b := battles[i], battles[j]
+		switch q.Sort {
+		case SortNewest:
+		case SortEntries:
+			if a.Entries != b.Entries {
+				return a.Entries > b.Entries
+			}
+		case SortTitle:
+			if a.Title != b.Title {
+				return a.Title < b.Title
+			}
+		default:
+			if !a.Deadline.Equal(b.Deadline) {
+				return a.Deadline.After(b.Deadline)
+			}
+		}
+		return a.ID > b.ID
+	})
+
+	if q.Offset >= len(battles) {
+		return []Battle{}, nil
+	}
+	battles = battles[q.Offset:]
+	if q.Limit > 0 && q.Limit < len(battles) {
+		battles = battles[:q.Limit]
+	}
+
+	return battles, nil
+}
+
+// containsTag reports whether a battle has exactly the tag.
+func containsTag(tags []string, tag string) bool {
+	for _, battleTag := range tags {
+		if battleTag == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesBattleQuery mirrors the SQL store's filters, including its case-insensitive LIKE.
+func matchesBattleQuery(q BattleQuery, battle Battle) bool {
+	if len(q.Status) > 0 {
+		match := false
+		for _, status := range q.Status {
+			match = match || battle.Status == status
+		}
+		if !match {
+			return false
+		}
+	}
+
+	contains := func(s string, substr string) bool {
+		return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+	}
+
+	switch {
+	case q.PublicOnly && battle.Settings.Private,
+		q.HostID > 0 && battle.Host.ID != q.HostID,
+		q.Tag != "" && !containsTag(battle.Tags, q.Tag),
+		q.Type != "" && battle.Type != q.Type,
+		!q.DeadlineFrom.IsZero() && battle.Deadline.Before(q.DeadlineFrom),
+		!q.DeadlineTo.IsZero() && !battle.Deadline.Before(q.DeadlineTo),
+		q.Text != "" && !contains(battle.Title, q.Text) && !contains(battle.Rules, q.Text),
+		q.MinEntries > 0 && battle.Entries < q.MinEntries,
+		q.MaxEntries > 0 && battle.Entries > q.MaxEntries:
+		return false
+	}
+
+	if q.After != nil {
+		after := q.After
+		switch q.Sort {
+		case SortNewest:
+			return battle.ID < after.ID
+		case SortEntries:
+			return battle.Entries < after.Entries || (battle.Entries == after.Entries && battle.ID < after.ID)
+		case SortTitle:
+			return battle.Title > after.Title || (battle.Title == after.Title && battle.ID < after.ID)
+		default:
+			return battle.Deadline.Before(after.Deadline) || (battle.Deadline.Equal(after.Deadline) && battle.ID < after.ID)
+		}
+	}
+
+	return true
+}
+
+func (s *memoryBattleStore) Insert(battle Battle) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	battle.ID = s.nextID()
+	battle.Host = User{ID: battle.Host.ID}
+	battle.Settings = BattleSettings{ID: battle.Settings.ID}
+	battle.Entries = 0
+	s.battles[battle.ID] = battle
+
+	return battle.ID, nil
+}
+
+func (s *memoryBattleStore) Update(battle Battle) error {
+	s.Lock()
+	defer s.Unlock()
+
+	current, ok := s.battles[battle.ID]
+	if !ok || current.Host.ID != battle.Host.ID {
+		return nil
+	}
+
+	current.Title = battle.Title
+	current.Rules = battle.Rules
+	current.Deadline = battle.Deadline
+	current.Attachment = battle.Attachment
+	current.Password = battle.Password
+	current.VotingDeadline = battle.VotingDeadline
+	current.MaxVotes = battle.MaxVotes
+	current.Type = battle.Type
+	current.Settings = BattleSettings{ID: battle.Settings.ID}
+	current.Tags = battle.Tags
+	current.VotingMode = battle.VotingMode
+	current.TrimScores = battle.TrimScores
+	current.JudgeWeight = battle.JudgeWeight
+	current.Teams = battle.Teams
+	current.TrackHosts = battle.TrackHosts
+	current.Length = battle.Length
+	current.Qualification = battle.Qualification
+	current.TieBreakers = battle.TieBreakers
+	current.SeasonID = battle.SeasonID
+	s.battles[battle.ID] = current
+
+	return nil
+}
+
+func (s *memoryBattleStore) Delete(battleID int, hostID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if battle, ok := s.battles[battleID]; ok && battle.Host.ID == hostID {
+		delete(s.battles, battleID)
+		for beatID, beat := range s.beats {
+			if beat.BattleID == battleID {
+				delete(s.beats, beatID)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryBattleStore) SaveSettings(settings BattleSettings) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if settings.ID == 0 {
+		settings.ID = s.nextID()
+	}
+	s.settings[settings.ID] = settings
+
+	return settings.ID, nil
+}
+
+func (s *memoryBattleStore) SetDeadlines(battleID int, deadline time.Time, votingDeadline time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if battle, ok := s.battles[battleID]; ok {
+		battle.Deadline = deadline
+		battle.VotingDeadline = votingDeadline
+		s.battles[battleID] = battle
+	}
+
+	return nil
+}
+
+func (s *memoryBattleStore) SetTags(battleID int, tags []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if battle, ok := s.battles[battleID]; ok {
+		battle.Tags = append([]string(nil), tags...)
+		s.battles[battleID] = battle
+	}
+
+	return nil
+}
+
+func (s *memoryBattleStore) Criteria(battleID int) ([]Criterion, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Criterion{}, s.criteria[battleID]...), nil
+}
+
+func (s *memoryBattleStore) SetCriteria(battleID int, criteria []Criterion) error {
+	s.Lock()
+	defer s.Unlock()
+
+	kept := s.scores[:0]
+	for _, score := range s.scores {
+		if score.battleID != battleID {
+			kept = append(kept, score)
+		}
+	}
+	s.scores = kept
+
+	s.criteria[battleID] = nil
+	for _, criterion := range criteria {
+		criterion.ID = s.nextID()
+		s.criteria[battleID] = append(s.criteria[battleID], criterion)
+	}
+
+	return nil
+}
+
+func (s *memoryBattleStore) Transition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	battle, ok := s.battles[battleID]
+	if !ok || battle.Status != from {
+		return ErrStaleTransition
+	}
+
+	battle.Status = to
+	s.battles[battleID] = battle
+	s.recordTransition(battleID, from, to, trigger, userID, note)
+
+	return nil
+}
+
+func (s *memoryBattleStore) RecordTransition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.recordTransition(battleID, from, to, trigger, userID, note)
+	return nil
+}
+
+// recordTransition appends to the status history. The lock must be held.
+func (s *memoryBattleStore) recordTransition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) {
+	s.transitions = append(s.transitions, memoryTransition{
+		BattleTransition: BattleTransition{
+			From:      from,
+			To:        to,
+			Trigger:   trigger,
+			User:      User{ID: userID},
+			Note:      note,
+			CreatedAt: time.Now(),
+		},
+		battleID: battleID,
+	})
+}
+
+func (s *memoryBattleStore) Transitions(battleID int) ([]BattleTransition, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	transitions := []BattleTransition{}
+	for _, transition := range s.transitions {
+		if transition.battleID == battleID {
+			user := s.user(transition.User.ID)
+			transition.User = User{ID: user.ID, Name: user.Name}
+			transitions = append(transitions, transition.BattleTransition)
+		}
+	}
+
+	return transitions, nil
+}
+
+// deadlineFor returns the deadline that ends the status a battle is in.
+func deadlineFor(battle Battle) time.Time {
+	if battle.Status == StatusVoting {
+		return battle.VotingDeadline
+	}
+	return battle.Deadline
+}
+
+func (s *memoryBattleStore) Due(status BattleStatus, now time.Time) ([]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	due := []Battle{}
+	for _, battle := range s.battles {
+		if battle.Status == status && !deadlineFor(battle).After(now) {
+			due = append(due, battle)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !deadlineFor(due[i]).Equal(deadlineFor(due[j])) {
+			return deadlineFor(due[i]).Before(deadlineFor(due[j]))
+		}
+		return due[i].ID < due[j].ID
+	})
+
+	battleIDs := []int{}
+	for _, battle := range due {
+		battleIDs = append(battleIDs, battle.ID)
+	}
+
+	return battleIDs, nil
+}
+
+func (s *memoryBattleStore) NextDeadline() (time.Time, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var next time.Time
+	found := false
+	for _, battle := range s.battles {
+		if battle.Status != StatusEntry && battle.Status != StatusVoting {
+			continue
+		}
+		if deadline := deadlineFor(battle); !found || deadline.Before(next) {
+			next = deadline
+			found = true
+		}
+	}
+
+	return next, found, nil
+}
+
+/*-------
+Beats
+-------*/
+
+type memoryBeatStore struct {
+	*memoryDB
+}
+
+func (s *memoryBeatStore) Get(beatID int) (Beat, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	beat, ok := s.beats[beatID]
+	if !ok {
+		return Beat{}, ErrNotFound
+	}
+
+	return beat, nil
+}
+
+func (s *memoryBeatStore) GetByUser(battleID int, userID int) (Beat, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, beat := range s.beats {
+		if beat.BattleID == battleID && beat.Artist.ID == userID {
+			return beat, nil
+		}
+	}
+
+	return Beat{}, ErrNotFound
+}
+
+// sortedBeats returns the beats matched by keep in submission order. The lock must be held.
+func (s *memoryBeatStore) sortedBeats(keep func(Beat) bool) []Beat {
+	beats := []Beat{}
+	for _, beat := range s.beats {
+		if keep(beat) {
+			beats = append(beats, beat)
+		}
+	}
+	sort.Slice(beats, func(i, j int) bool {
+		return beats[i].ID < beats[j].ID
+	})
+
+	return beats
+}
+
+func (s *memoryBeatStore) ListByBattle(battleID int) ([]Beat, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	beats := s.sortedBeats(func(beat Beat) bool {
+		return beat.BattleID == battleID
+	})
+	for i := range beats {
+		beats[i].Artist = s.user(beats[i].Artist.ID)
+	}
+
+	return beats, nil
+}
+
+func (s *memoryBeatStore) ListByUser(userID int) ([]Beat, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	credited := map[int]bool{}
+	for _, member := range s.members {
+		if member.userID == userID && member.status == MemberAccepted {
+			credited[member.beatID] = true
+		}
+	}
+
+	beats := s.sortedBeats(func(beat Beat) bool {
+		return beat.Artist.ID == userID || credited[beat.ID]
+	})
+	for i := range beats {
+		battle := s.battles[beats[i].BattleID]
+		beats[i].Artist = s.user(beats[i].Artist.ID)
+		beats[i].Battle = Battle{ID: battle.ID, Title: battle.Title, Status: battle.Status, Teams: battle.Teams}
+	}
+	sort.SliceStable(beats, func(i, j int) bool {
+		return beats[i].Placement < beats[j].Placement
+	})
+
+	return beats, nil
+}
+
+func (s *memoryBeatStore) Insert(beat Beat) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	beat.ID = s.nextID()
+	beat.Artist = User{ID: beat.Artist.ID}
+	beat.Battle = Battle{}
+	s.beats[beat.ID] = beat
+
+	return beat.ID, nil
+}
+
+func (s *memoryBeatStore) Update(beat Beat) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for beatID, current := range s.beats {
+		if current.BattleID == beat.BattleID && current.Artist.ID == beat.Artist.ID {
+			current.URL = beat.URL
+			current.Embed = beat.Embed
+			current.File = beat.File
+			current.Audio = beat.Audio
+			current.Field1 = beat.Field1
+			current.Field2 = beat.Field2
+			current.Field3 = beat.Field3
+			s.beats[beatID] = current
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryBeatStore) Delete(battleID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for beatID, beat := range s.beats {
+		if beat.BattleID == battleID && beat.Artist.ID == userID {
+			delete(s.beats, beatID)
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryBeatStore) SetVoted(beatID int, voted bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if beat, ok := s.beats[beatID]; ok {
+		beat.Voted = voted
+		if !voted {
+			beat.Placement = 0
+		}
+		s.beats[beatID] = beat
+	}
+
+	return nil
+}
+
+func (s *memoryBeatStore) SaveResults(results []BeatResult) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, result := range results {
+		if beat, ok := s.beats[result.BeatID]; ok {
+			beat.Votes = result.Votes
+			beat.Voted = result.Voted
+			beat.Placement = result.Placement
+			s.beats[result.BeatID] = beat
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryBeatStore) Members(battleID int) ([]BeatMember, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	members := []BeatMember{}
+	for _, member := range s.members {
+		if beat, ok := s.beats[member.beatID]; ok && beat.BattleID == battleID {
+			members = append(members, BeatMember{
+				BeatID:    member.beatID,
+				User:      s.user(member.userID),
+				Role:      member.role,
+				Status:    member.status,
+				InvitedAt: member.invitedAt,
+			})
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		if !members[i].InvitedAt.Equal(members[j].InvitedAt) {
+			return members[i].InvitedAt.Before(members[j].InvitedAt)
+		}
+		return members[i].User.ID < members[j].User.ID
+	})
+
+	return members, nil
+}
+
+func (s *memoryBeatStore) SaveMember(member BeatMember) error {
+	s.Lock()
+	defer s.Unlock()
+
+	saved := memoryMember{
+		beatID:    member.BeatID,
+		userID:    member.User.ID,
+		role:      member.Role,
+		status:    member.Status,
+		invitedAt: member.InvitedAt,
+	}
+	for i, current := range s.members {
+		if current.beatID == member.BeatID && current.userID == member.User.ID {
+			s.members[i] = saved
+			return nil
+		}
+	}
+	s.members = append(s.members, saved)
+
+	return nil
+}
+
+func (s *memoryBeatStore) RespondMember(beatID int, userID int, status MemberStatus) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, member := range s.members {
+		if member.beatID == beatID && member.userID == userID {
+			s.members[i].status = status
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryBeatStore) RemoveMember(beatID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	kept := s.members[:0]
+	for _, member := range s.members {
+		if member.beatID != beatID || member.userID != userID {
+			kept = append(kept, member)
+		}
+	}
+	s.members = kept
+
+	return nil
+}
+
+/*-------
+Users
+-------*/
+
+type memoryUserStore struct {
+	*memoryDB
+}
+
+func (s *memoryUserStore) Get(userID int) (User, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, ok := s.users[userID]; !ok {
+		return User{}, ErrNotFound
+	}
+
+	return s.user(userID), nil
+}
+
+func (s *memoryUserStore) FindByProvider(provider string, providerID string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for userID, user := range s.users {
+		if user.Provider == provider && user.ProviderID == providerID {
+			return userID, nil
+		}
+	}
+
+	return 0, ErrNotFound
+}
+
+func (s *memoryUserStore) Insert(user User, tokenHash string) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	user.ID = s.nextID()
+	s.users[user.ID] = memoryUser{User: user, tokenHash: tokenHash}
+
+	return user.ID, nil
+}
+
+func (s *memoryUserStore) UpdateLogin(userID int, name string, tokenHash string, expiry time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if user, ok := s.users[userID]; ok {
+		user.Name = name
+		user.tokenHash = tokenHash
+		user.ExpiresAt = expiry
+		s.users[userID] = user
+	}
+
+	return nil
+}
+
+func (s *memoryUserStore) Token(userID int) (string, time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return "", time.Time{}, ErrNotFound
+	}
+
+	return user.tokenHash, user.ExpiresAt, nil
+}
+
+func (s *memoryUserStore) UpdateToken(userID int, tokenHash string, expiry time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if user, ok := s.users[userID]; ok {
+		user.tokenHash = tokenHash
+		user.ExpiresAt = expiry
+		s.users[userID] = user
+	}
+
+	return nil
+}
+
+/*-------
+Votes & Likes
+-------*/
+
+type memoryVoteStore struct {
+	*memoryDB
+}
+
+// userBeats returns the beats a user voted for or liked in a battle, in beat order.
+func userBeats(votes []memoryVote, battleID int, userID int) []int {
+	beatIDs := []int{}
+	for _, vote := range votes {
+		if vote.battleID == battleID && vote.userID == userID {
+			beatIDs = append(beatIDs, vote.beatID)
+		}
+	}
+	sort.Ints(beatIDs)
+
+	return beatIDs
+}
+
+// removeVote drops a vote or like from the list.
+func removeVote(votes []memoryVote, battleID int, beatID int, userID int) []memoryVote {
+	kept := votes[:0]
+	for _, vote := range votes {
+		if vote != (memoryVote{battleID, beatID, userID}) {
+			kept = append(kept, vote)
+		}
+	}
+
+	return kept
+}
+
+func (s *memoryVoteStore) UserVotes(battleID int, userID int) ([]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return userBeats(s.votes, battleID, userID), nil
+}
+
+func (s *memoryVoteStore) Add(battleID int, beatID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.votes = append(s.votes, memoryVote{battleID, beatID, userID})
+	return nil
+}
+
+func (s *memoryVoteStore) Remove(battleID int, beatID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.votes = removeVote(s.votes, battleID, beatID, userID)
+	return nil
+}
+
+func (s *memoryVoteStore) Tally(battleID int) (VoteTally, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tally := VoteTally{Votes: map[int]int{}, Voters: map[int]bool{}}
+	for _, vote := range s.votes {
+		if vote.battleID == battleID {
+			tally.Votes[vote.beatID]++
+			tally.Voters[vote.userID] = true
+		}
+	}
+
+	return tally, nil
+}
+
+func (s *memoryVoteStore) Voters(battleID int) (map[int][]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	voters := map[int][]int{}
+	for _, vote := range s.votes {
+		if vote.battleID == battleID {
+			voters[vote.userID] = append(voters[vote.userID], vote.beatID)
+		}
+	}
+	for _, beats := range voters {
+		sort.Ints(beats)
+	}
+
+	return voters, nil
+}
+
+// sortedBallots returns the ballot rows of a battle ordered by voter, then preference. The lock must be held.
+func (s *memoryVoteStore) sortedBallots(battleID int) []memoryBallot {
+	ballots := []memoryBallot{}
+	for _, ballot := range s.ballots {
+		if ballot.battleID == battleID {
+			ballots = append(ballots, ballot)
+		}
+	}
+	sort.Slice(ballots, func(i, j int) bool {
+		if ballots[i].userID != ballots[j].userID {
+			return ballots[i].userID < ballots[j].userID
+		}
+		return ballots[i].preference < ballots[j].preference
+	})
+
+	return ballots
+}
+
+func (s *memoryVoteStore) Ballot(battleID int, userID int) ([]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	beatIDs := []int{}
+	for _, ballot := range s.sortedBallots(battleID) {
+		if ballot.userID == userID {
+			beatIDs = append(beatIDs, ballot.beatID)
+		}
+	}
+
+	return beatIDs, nil
+}
+
+func (s *memoryVoteStore) SaveBallot(battleID int, userID int, beatIDs []int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	kept := s.ballots[:0]
+	for _, ballot := range s.ballots {
+		if ballot.battleID != battleID || ballot.userID != userID {
+			kept = append(kept, ballot)
+		}
+	}
+	for i, beatID := range beatIDs {
+		kept = append(kept, memoryBallot{battleID, userID, beatID, i + 1})
+	}
+	s.ballots = kept
+
+	return nil
+}
+
+func (s *memoryVoteStore) Ballots(battleID int) (map[int][]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ballots := map[int][]int{}
+	for _, ballot := range s.sortedBallots(battleID) {
+		ballots[ballot.userID] = append(ballots[ballot.userID], ballot.beatID)
+	}
+
+	return ballots, nil
+}
+
+func (s *memoryVoteStore) UserScores(battleID int, userID int) (map[int]map[int]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	scores := map[int]map[int]int{}
+	for _, score := range s.scores {
+		if score.battleID != battleID || score.UserID != userID {
+			continue
+		}
+		if scores[score.BeatID] == nil {
+			scores[score.BeatID] = map[int]int{}
+		}
+		scores[score.BeatID][score.CriterionID] = score.Score.Score
+	}
+
+	return scores, nil
+}
+
+func (s *memoryVoteStore) SaveScore(battleID int, beatID int, userID int, criterionID int, score int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, saved := range s.scores {
+		if saved.UserID == userID && saved.BeatID == beatID && saved.CriterionID == criterionID {
+			s.scores[i].Score.Score = score
+			return nil
+		}
+	}
+	s.scores = append(s.scores, memoryScore{battleID, Score{UserID: userID, BeatID: beatID, CriterionID: criterionID, Score: score}})
+
+	return nil
+}
+
+func (s *memoryVoteStore) Scores(battleID int) ([]Score, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	scores := []Score{}
+	for _, score := range s.scores {
+		if score.battleID == battleID {
+			scores = append(scores, score.Score)
+		}
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		a, b := scores[i], scores[j]
+		switch {
+		case a.BeatID != b.BeatID:
+			return a.BeatID < b.BeatID
+		case a.CriterionID != b.CriterionID:
+			return a.CriterionID < b.CriterionID
+		}
+		return a.UserID < b.UserID
+	})
+
+	return scores, nil
+}
+
+func (s *memoryVoteStore) UserLikes(battleID int, userID int) ([]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return userBeats(s.likes, battleID, userID), nil
+}
+
+func (s *memoryVoteStore) AddLike(battleID int, beatID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.likes = append(s.likes, memoryVote{battleID, beatID, userID})
+	return nil
+}
+
+func (s *memoryVoteStore) LikeCounts(battleID int) (map[int]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	counts := map[int]int{}
+	for _, like := range s.likes {
+		if like.battleID == battleID {
+			counts[like.beatID]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (s *memoryVoteStore) RemoveLike(battleID int, beatID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.likes = removeVote(s.likes, battleID, beatID, userID)
+	return nil
+}
+
+/*-------
+Feedback
+-------*/
+
+type memoryFeedbackStore struct {
+	*memoryDB
+}
+
+func (s *memoryFeedbackStore) Save(beatID int, userID int, feedback string) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, current := range s.feedback {
+		if current.beatID == beatID && current.userID == userID {
+			s.feedback[i].feedback = feedback
+			return false, nil
+		}
+	}
+
+	s.feedback = append(s.feedback, memoryFeedback{beatID: beatID, userID: userID, feedback: feedback})
+	return true, nil
+}
+
+func (s *memoryFeedbackStore) Counts(battleID int) (map[int]int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	counts := map[int]int{}
+	for _, feedback := range s.feedback {
+		if feedback.feedback != "" && s.beats[feedback.beatID].BattleID == battleID {
+			counts[feedback.userID]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (s *memoryFeedbackStore) Given(battleID int, userID int) (map[int]string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	given := map[int]string{}
+	for _, feedback := range s.feedback {
+		if feedback.userID == userID && s.beats[feedback.beatID].BattleID == battleID {
+			given[feedback.beatID] = feedback.feedback
+		}
+	}
+
+	return given, nil
+}
+
+func (s *memoryFeedbackStore) Received(battleID int, userID int) ([]Feedback, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	received := []Feedback{}
+	for _, feedback := range s.feedback {
+		beat := s.beats[feedback.beatID]
+		if beat.BattleID == battleID && beat.Artist.ID == userID {
+			received = append(received, Feedback{From: s.users[feedback.userID].Name, Feedback: feedback.feedback})
+		}
+	}
+
+	return received, nil
+}
+
+/*-------
+Advertisements
+-------*/
+
+type memoryAdStore struct {
+	*memoryDB
+}
+
+func (s *memoryAdStore) Active() ([]Advertisement, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Advertisement(nil), s.ads...), nil
+}
+
+/*-------
+Tags
+-------*/
+
+type memoryTagStore struct {
+	*memoryDB
+}
+
+func (s *memoryTagStore) Search(prefix string, limit int) ([]TagCount, error) {
+	return s.counts(prefix, limit), nil
+}
+
+func (s *memoryTagStore) Cloud(limit int) ([]TagCount, error) {
+	tags := s.counts("", limit)
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+// counts returns the tags starting with prefix by how many public, non-draft battles use them.
+func (s *memoryTagStore) counts(prefix string, limit int) []TagCount {
+	s.Lock()
+	defer s.Unlock()
+
+	counts := map[string]int{}
+	for _, battle := range s.battles {
+		if battle.Status == StatusDraft || s.settings[battle.Settings.ID].Private {
+			continue
+		}
+		for _, tag := range battle.Tags {
+			if strings.HasPrefix(tag, prefix) {
+				counts[tag]++
+			}
+		}
+	}
+
+	tags := []TagCount{}
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if len(tags) > limit {
+		tags = tags[:limit]
+	}
+
+	return tags
+}
+
+/*-------
+Search
+-------*/
+
+type memorySearchStore struct {
+	*memoryDB
+}
+
+func (s *memorySearchStore) Index(battleID int, terms map[string]int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.search[battleID] = map[string]int{}
+	for term, weight := range terms {
+		s.search[battleID][term] = weight
+	}
+
+	return nil
+}
+
+func (s *memorySearchStore) Search(terms []string, limit int, offset int) ([]Battle, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	type match struct {
+		battle         Battle
+		matched, score int
+	}
+	matches := []match{}
+	for battleID, battle := range s.battles {
+		if battle.Status == StatusDraft || s.settings[battle.Settings.ID].Private {
+			continue
+		}
+
+		found := match{}
+		for _, term := range terms {
+			score := 0
+			for indexed, weight := range s.search[battleID] {
+				if indexed == term {
+					score += weight * 2
+				} else if strings.HasPrefix(indexed, term) {
+					score += weight
+				}
+			}
+			if strings.Contains(strings.ToLower(s.users[battle.Host.ID].Name), term) {
+				score += searchWeightHost
+			}
+			if score > 0 {
+				found.matched++
+				found.score += score
+			}
+		}
+		if found.matched == 0 {
+			continue
+		}
+
+		found.battle = Battle{ID: battleID, Title: battle.Title, Deadline: battle.Deadline, VotingDeadline: battle.VotingDeadline,
+			Type: battle.Type, Status: battle.Status, Tags: append([]string(nil), battle.Tags...), Host: s.user(battle.Host.ID)}
+		for _, beat := range s.beats {
+			if beat.BattleID == battleID {
+				found.battle.Entries++
+			}
+		}
+		matches = append(matches, found)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.matched != b.matched:
+			return a.matched > b.matched
+		case a.score != b.score:
+			return a.score > b.score
+		case !a.battle.Deadline.Equal(b.battle.Deadline):
+			return a.battle.Deadline.After(b.battle.Deadline)
+		}
+		return a.battle.ID > b.battle.ID
+	})
+
+	battles := []Battle{}
+	for i := offset; i < len(matches) && len(battles) < limit; i++ {
+		battles = append(battles, matches[i].battle)
+	}
+
+	return battles, nil
+}
+
+/*-------
+Results
+-------*/
+
+type memoryResultStore struct {
+	*memoryDB
+}
+
+func (s *memoryResultStore) SaveRounds(battleID int, rounds []RoundCount) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.rounds[battleID] = append([]RoundCount(nil), rounds...)
+	return nil
+}
+
+func (s *memoryResultStore) Rounds(battleID int) ([]RoundCount, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rounds := append([]RoundCount{}, s.rounds[battleID]...)
+	sort.SliceStable(rounds, func(i, j int) bool {
+		a, b := rounds[i], rounds[j]
+		switch {
+		case a.Round != b.Round:
+			return a.Round < b.Round
+		case a.Votes != b.Votes:
+			return a.Votes > b.Votes
+		}
+		return a.BeatID < b.BeatID
+	})
+
+	return rounds, nil
+}
+
+func (s *memoryResultStore) SaveBreakdown(battleID int, breakdown []CriterionScore) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.breakdown[battleID] = append([]CriterionScore(nil), breakdown...)
+	return nil
+}
+
+func (s *memoryResultStore) Breakdown(battleID int) ([]CriterionScore, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	breakdown := append([]CriterionScore{}, s.breakdown[battleID]...)
+	sort.Slice(breakdown, func(i, j int) bool {
+		if breakdown[i].BeatID != breakdown[j].BeatID {
+			return breakdown[i].BeatID < breakdown[j].BeatID
+		}
+		return breakdown[i].CriterionID < breakdown[j].CriterionID
+	})
+
+	return breakdown, nil
+}
+
+func (s *memoryResultStore) SaveTallies(battleID int, tallies []JudgeTally) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.tallies[battleID] = append([]JudgeTally(nil), tallies...)
+	return nil
+}
+
+func (s *memoryResultStore) Tallies(battleID int) ([]JudgeTally, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tallies := append([]JudgeTally{}, s.tallies[battleID]...)
+	sort.Slice(tallies, func(i, j int) bool {
+		if tallies[i].Score != tallies[j].Score {
+			return tallies[i].Score > tallies[j].Score
+		}
+		return tallies[i].BeatID < tallies[j].BeatID
+	})
+
+	return tallies, nil
+}
+
+func (s *memoryResultStore) SaveRecords(battleID int, winnerID int, records []ChampionshipRecord) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.records[battleID] = append([]ChampionshipRecord(nil), records...)
+	if battle, ok := s.battles[battleID]; ok {
+		battle.WinnerID = winnerID
+		s.battles[battleID] = battle
+	}
+
+	return nil
+}
+
+func (s *memoryResultStore) UserRecords(userID int) ([]ChampionshipRecord, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	records := []ChampionshipRecord{}
+	for battleID, battleRecords := range s.records {
+		for _, record := range battleRecords {
+			if record.UserID == userID {
+				record.Title = s.battles[battleID].Title
+				records = append(records, record)
+			}
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].FinishedAt.Equal(records[j].FinishedAt) {
+			return records[i].FinishedAt.Before(records[j].FinishedAt)
+		}
+		return records[i].BattleID < records[j].BattleID
+	})
+
+	return records, nil
+}
+
+/*-------
+Judges
+-------*/
+
+type memoryJudgeStore struct {
+	*memoryDB
+}
+
+func (s *memoryJudgeStore) Invite(battleID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, judge := range s.judges {
+		if judge.battleID == battleID && judge.userID == userID {
+			return nil
+		}
+	}
+	s.judges = append(s.judges, memoryJudge{battleID: battleID, userID: userID, status: JudgeInvited, invitedAt: time.Now()})
+
+	return nil
+}
+
+func (s *memoryJudgeStore) Respond(battleID int, userID int, status JudgeStatus) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for i, judge := range s.judges {
+		if judge.battleID == battleID && judge.userID == userID {
+			s.judges[i].status = status
+			return nil
+		}
+	}
+
+	return ErrNotFound
+}
+
+func (s *memoryJudgeStore) Remove(battleID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	kept := s.judges[:0]
+	for _, judge := range s.judges {
+		if judge.battleID != battleID || judge.userID != userID {
+			kept = append(kept, judge)
+		}
+	}
+	s.judges = kept
+
+	return nil
+}
+
+func (s *memoryJudgeStore) List(battleID int) ([]Judge, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	judges := []Judge{}
+	for _, judge := range s.judges {
+		if judge.battleID == battleID {
+			judges = append(judges, Judge{User: s.user(judge.userID), Status: judge.status, InvitedAt: judge.invitedAt})
+		}
+	}
+
+	return judges, nil
+}
+
+/*-------
+Ratings
+-------*/
+
+type memoryRatingStore struct {
+	*memoryDB
+}
+
+func (s *memoryRatingStore) Get(category string, userIDs []int) (map[int]Rating, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	ratings := map[int]Rating{}
+	for _, userID := range userIDs {
+		if rating, ok := s.ratings[memoryRatingKey{userID, category}]; ok {
+			ratings[userID] = rating
+		}
+	}
+
+	return ratings, nil
+}
+
+func (s *memoryRatingStore) SaveChanges(changes []RatingChange) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, change := range changes {
+		kept := s.ratingHistory[:0]
+		for _, old := range s.ratingHistory {
+			if old.BattleID != change.BattleID || old.UserID != change.UserID || old.Category != change.Category {
+				kept = append(kept, old)
+			}
+		}
+		s.ratingHistory = append(kept, change)
+
+		key := memoryRatingKey{change.UserID, change.Category}
+		rating := s.ratings[key]
+		s.ratings[key] = Rating{
+			UserID:    change.UserID,
+			Category:  change.Category,
+			Rating:    change.After,
+			Battles:   rating.Battles + 1,
+			UpdatedAt: change.FinishedAt,
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryRatingStore) RatedAfter(battleID int, finishedAt time.Time) (bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, change := range s.ratingHistory {
+		if change.BattleID == battleID || change.FinishedAt.After(finishedAt) ||
+			(change.FinishedAt.Equal(finishedAt) && change.BattleID > battleID) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *memoryRatingStore) Reset() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.ratings = map[memoryRatingKey]Rating{}
+	s.ratingHistory = nil
+
+	return nil
+}
+
+func (s *memoryRatingStore) Leaderboard(q LeaderboardQuery) ([]LeaderboardRow, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	rows := map[int]*LeaderboardRow{}
+	for _, change := range s.ratingHistory {
+		if change.Category != q.Category || change.FinishedAt.Before(q.Since) {
+			continue
+		}
+		if rows[change.UserID] == nil {
+			rows[change.UserID] = &LeaderboardRow{
+				User:   s.user(change.UserID),
+				Rating: s.ratings[memoryRatingKey{change.UserID, q.Category}].Rating,
+			}
+		}
+		rows[change.UserID].Battles++
+		rows[change.UserID].Change += change.After - change.Before
+	}
+
+	leaderboard := []LeaderboardRow{}
+	for _, row := range rows {
+		leaderboard = append(leaderboard, *row)
+	}
+	sort.Slice(leaderboard, func(i, j int) bool {
+		if leaderboard[i].Rating != leaderboard[j].Rating {
+			return leaderboard[i].Rating > leaderboard[j].Rating
+		}
+		return leaderboard[i].User.ID < leaderboard[j].User.ID
+	})
+	if q.Limit > 0 && len(leaderboard) > q.Limit {
+		leaderboard = leaderboard[:q.Limit]
+	}
+	for i := range leaderboard {
+		leaderboard[i].Rank = i + 1
+	}
+
+	return leaderboard, nil
+}
+
+func (s *memoryRatingStore) History(userID int, category string, limit int) ([]RatingChange, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	history := []RatingChange{}
+	for _, change := range s.ratingHistory {
+		if change.UserID == userID && change.Category == category {
+			change.Title = s.battles[change.BattleID].Title
+			history = append(history, change)
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if !history[i].FinishedAt.Equal(history[j].FinishedAt) {
+			return history[i].FinishedAt.After(history[j].FinishedAt)
+		}
+		return history[i].BattleID > history[j].BattleID
+	})
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return history, nil
+}
+
+/*-------
+Series
+-------*/
+
+type memorySeriesStore struct {
+	*memoryDB
+}
+
+func (s *memorySeriesStore) Insert(series Series) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	series.ID = s.nextID()
+	series.Host = User{ID: series.Host.ID}
+	s.series[series.ID] = series
+
+	return series.ID, nil
+}
+
+func (s *memorySeriesStore) Get(seriesID int) (Series, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	series, ok := s.series[seriesID]
+	if !ok {
+		return Series{}, ErrNotFound
+	}
+	series.Host = s.user(series.Host.ID)
+
+	return series, nil
+}
+
+func (s *memorySeriesStore) Update(series Series) error {
+	s.Lock()
+	defer s.Unlock()
+
+	current, ok := s.series[series.ID]
+	if !ok || current.Host.ID != series.Host.ID {
+		return nil
+	}
+
+	current.Title = series.Title
+	current.Points = series.Points
+	current.DropLowest = series.DropLowest
+	s.series[series.ID] = current
+
+	return nil
+}
+
+func (s *memorySeriesStore) ListByHost(userID int) ([]Series, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	list := []Series{}
+	for _, series := range s.series {
+		if series.Host.ID == userID {
+			series.Host = s.user(userID)
+			list = append(list, series)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+
+	return list, nil
+}
+
+func (s *memorySeriesStore) InsertSeason(season Season) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	season.ID = s.nextID()
+	s.seasons[season.ID] = season
+
+	return season.ID, nil
+}
+
+func (s *memorySeriesStore) GetSeason(seasonID int) (Season, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	season, ok := s.seasons[seasonID]
+	if !ok {
+		return Season{}, ErrNotFound
+	}
+
+	return season, nil
+}
+
+func (s *memorySeriesStore) Seasons(seriesID int) ([]Season, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	seasons := []Season{}
+	for _, season := range s.seasons {
+		if season.SeriesID == seriesID {
+			seasons = append(seasons, season)
+		}
+	}
+	sort.Slice(seasons, func(i, j int) bool { return seasons[i].ID < seasons[j].ID })
+
+	return seasons, nil
+}
+
+func (s *memorySeriesStore) Battles(seriesID int) ([]Battle, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	battles := []Battle{}
+	for _, battle := range s.battles {
+		if season, ok := s.seasons[battle.SeasonID]; ok && season.SeriesID == seriesID {
+			battles = append(battles, battle)
+		}
+	}
+	sort.Slice(battles, func(i, j int) bool {
+		if !battles[i].Deadline.Equal(battles[j].Deadline) {
+			return battles[i].Deadline.Before(battles[j].Deadline)
+		}
+		return battles[i].ID < battles[j].ID
+	})
+
+	return battles, nil
+}
+
+func (s *memorySeriesStore) Records(seasonID int) ([]ChampionshipRecord, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	records := []ChampionshipRecord{}
+	for battleID, battleRecords := range s.records {
+		if s.battles[battleID].SeasonID != seasonID {
+			continue
+		}
+		for _, record := range battleRecords {
+			record.Title = s.battles[battleID].Title
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if !records[i].FinishedAt.Equal(records[j].FinishedAt) {
+			return records[i].FinishedAt.Before(records[j].FinishedAt)
+		}
+		return records[i].BattleID < records[j].BattleID
+	})
+
+	return records, nil
+}
+
+/*-------
+Tournaments
+-------*/
+
+type memoryTournamentStore struct {
+	*memoryDB
+}
+
+func (s *memoryTournamentStore) Insert(tournament Tournament) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tournament.ID = s.nextID()
+	tournament.Host = User{ID: tournament.Host.ID}
+	s.tournaments[tournament.ID] = tournament
+
+	return tournament.ID, nil
+}
+
+func (s *memoryTournamentStore) Get(tournamentID int) (Tournament, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tournament, ok := s.tournaments[tournamentID]
+	if !ok {
+		return Tournament{}, ErrNotFound
+	}
+	tournament.Host = s.user(tournament.Host.ID)
+
+	return tournament, nil
+}
+
+func (s *memoryTournamentStore) List(limit int) ([]Tournament, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	tournaments := []Tournament{}
+	for _, tournament := range s.tournaments {
+		tournament.Host = s.user(tournament.Host.ID)
+		tournaments = append(tournaments, tournament)
+	}
+	sort.Slice(tournaments, func(i, j int) bool { return tournaments[i].ID > tournaments[j].ID })
+	if len(tournaments) > limit {
+		tournaments = tournaments[:limit]
+	}
+
+	return tournaments, nil
+}
+
+func (s *memoryTournamentStore) SetStatus(tournamentID int, status TournamentStatus, winnerID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if tournament, ok := s.tournaments[tournamentID]; ok {
+		tournament.Status = status
+		tournament.WinnerID = winnerID
+		s.tournaments[tournamentID] = tournament
+	}
+
+	return nil
+}
+
+func (s *memoryTournamentStore) Join(tournamentID int, userID int, joinedAt time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.entrants = append(s.entrants, memoryEntrant{tournamentID, TournamentEntrant{User: User{ID: userID}, JoinedAt: joinedAt}})
+	return nil
+}
+
+func (s *memoryTournamentStore) Leave(tournamentID int, userID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	entrants := s.entrants[:0]
+	for _, entrant := range s.entrants {
+		if entrant.tournamentID != tournamentID || entrant.User.ID != userID {
+			entrants = append(entrants, entrant)
+		}
+	}
+	s.entrants = entrants
+
+	return nil
+}
+
+func (s *memoryTournamentStore) Entrants(tournamentID int) ([]TournamentEntrant, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	entrants := []TournamentEntrant{}
+	for _, entrant := range s.entrants {
+		if entrant.tournamentID == tournamentID {
+			entrant.User = s.user(entrant.User.ID)
+			entrants = append(entrants, entrant.TournamentEntrant)
+		}
+	}
+	sort.SliceStable(entrants, func(i, j int) bool {
+		if entrants[i].Seed != entrants[j].Seed {
+			return entrants[i].Seed < entrants[j].Seed
+		}
+		if !entrants[i].JoinedAt.Equal(entrants[j].JoinedAt) {
+			return entrants[i].JoinedAt.Before(entrants[j].JoinedAt)
+		}
+		return entrants[i].User.ID < entrants[j].User.ID
+	})
+
+	return entrants, nil
+}
+
+func (s *memoryTournamentStore) Start(tournamentID int, userIDs []int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	tournament, ok := s.tournaments[tournamentID]
+	if !ok || tournament.Status != TournamentSignup {
+		return ErrTournamentStarted
+	}
+	tournament.Status = TournamentRunning
+	s.tournaments[tournamentID] = tournament
+
+	for seed, userID := range userIDs {
+		for i, entrant := range s.entrants {
+			if entrant.tournamentID == tournamentID && entrant.User.ID == userID {
+				s.entrants[i].Seed = seed + 1
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *memoryTournamentStore) Matches(tournamentID int) ([]TournamentMatch, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	matches := []TournamentMatch{}
+	for _, match := range s.matches {
+		if match.TournamentID == tournamentID {
+			matches = append(matches, match)
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].ID < matches[j].ID })
+
+	return matches, nil
+}
+
+func (s *memoryTournamentStore) InsertMatch(match TournamentMatch) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	match.ID = s.nextID()
+	s.matches[match.ID] = match
+
+	return match.ID, nil
+}
+
+func (s *memoryTournamentStore) UpdateMatch(match TournamentMatch) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if current, ok := s.matches[match.ID]; ok {
+		current.Players = match.Players
+		current.WinnerID = match.WinnerID
+		current.DecidedBy = match.DecidedBy
+		s.matches[match.ID] = current
+	}
+
+	return nil
+}
+
+func (s *memoryTournamentStore) MatchByBattle(battleID int) (TournamentMatch, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, match := range s.matches {
+		if match.BattleID == battleID && battleID != 0 {
+			return match, nil
+		}
+	}
+
+	return TournamentMatch{}, ErrNotFound
+}
+
+/*-------
+Schedules
+-------*/
+
+type memoryScheduleStore struct {
+	*memoryDB
+}
+
+// schedule returns a schedule with its host and its battle's title.
+func (s *memoryScheduleStore) schedule(schedule Schedule) Schedule {
+	schedule.Host = s.user(schedule.Host.ID)
+	schedule.Title = s.battles[schedule.BattleID].Title
+	schedule.Packs = append([]string{}, schedule.Packs...)
+	return schedule
+}
+
+func (s *memoryScheduleStore) Insert(schedule Schedule) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	schedule.ID = s.nextID()
+	schedule.Host = User{ID: schedule.Host.ID}
+	schedule.Title = ""
+	schedule.Packs = append([]string{}, schedule.Packs...)
+	s.schedules[schedule.ID] = schedule
+
+	return schedule.ID, nil
+}
+
+func (s *memoryScheduleStore) Get(scheduleID int) (Schedule, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	schedule, ok := s.schedules[scheduleID]
+	if !ok {
+		return Schedule{}, ErrNotFound
+	}
+
+	return s.schedule(schedule), nil
+}
+
+func (s *memoryScheduleStore) ListByHost(userID int) ([]Schedule, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	schedules := []Schedule{}
+	for _, schedule := range s.schedules {
+		if schedule.Host.ID == userID {
+			schedules = append(schedules, s.schedule(schedule))
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID > schedules[j].ID })
+
+	return schedules, nil
+}
+
+func (s *memoryScheduleStore) SetPaused(scheduleID int, paused bool) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if schedule, ok := s.schedules[scheduleID]; ok {
+		schedule.Paused = paused
+		s.schedules[scheduleID] = schedule
+	}
+
+	return nil
+}
+
+func (s *memoryScheduleStore) Delete(scheduleID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	delete(s.schedules, scheduleID)
+	return nil
+}
+
+func (s *memoryScheduleStore) Due(now time.Time) ([]Schedule, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	schedules := []Schedule{}
+	for _, schedule := range s.schedules {
+		if !schedule.Paused && !schedule.NextRun.After(now) {
+			schedules = append(schedules, s.schedule(schedule))
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].NextRun.Before(schedules[j].NextRun) })
+
+	return schedules, nil
+}
+
+func (s *memoryScheduleStore) NextRun() (time.Time, bool, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var next time.Time
+	found := false
+	for _, schedule := range s.schedules {
+		if !schedule.Paused && (!found || schedule.NextRun.Before(next)) {
+			next = schedule.NextRun
+			found = true
+		}
+	}
+
+	return next, found, nil
+}
+
+func (s *memoryScheduleStore) Claim(scheduleID int, from int, to int, nextRun time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	schedule, ok := s.schedules[scheduleID]
+	if !ok || schedule.Runs != from {
+		return ErrStaleSchedule
+	}
+	schedule.Runs = to
+	schedule.NextRun = nextRun
+	s.schedules[scheduleID] = schedule
+
+	return nil
+}
+
+func (s *memoryScheduleStore) RecordBattle(scheduleID int, battleID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if schedule, ok := s.schedules[scheduleID]; ok {
+		schedule.Opened++
+		schedule.LastBattleID = battleID
+		s.schedules[scheduleID] = schedule
+	}
+
+	return nil
+}
+
+/*-------
+Templates
+-------*/
+
+type memoryTemplateStore struct {
+	*memoryDB
+}
+
+func (s *memoryTemplateStore) Insert(template BattleTemplate) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	template.ID = s.nextID()
+	template.Host = User{ID: template.Host.ID}
+	template.Tags = append([]string{}, template.Tags...)
+	s.templates[template.ID] = template
+
+	return template.ID, nil
+}
+
+func (s *memoryTemplateStore) Get(templateID int) (BattleTemplate, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	template, ok := s.templates[templateID]
+	if !ok {
+		return BattleTemplate{}, ErrNotFound
+	}
+	template.Host = s.user(template.Host.ID)
+
+	return template, nil
+}
+
+func (s *memoryTemplateStore) ListByHost(userID int) ([]BattleTemplate, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	templates := []BattleTemplate{}
+	for _, template := range s.templates {
+		if template.Host.ID == userID {
+			template.Host = s.user(userID)
+			templates = append(templates, template)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].ID < templates[j].ID
+	})
+
+	return templates, nil
+}
+
+func (s *memoryTemplateStore) Update(template BattleTemplate) error {
+	s.Lock()
+	defer s.Unlock()
+
+	current, ok := s.templates[template.ID]
+	if !ok || current.Host.ID != template.Host.ID {
+		return nil
+	}
+	template.Host = current.Host
+	template.CreatedAt = current.CreatedAt
+	template.Tags = append([]string{}, template.Tags...)
+	s.templates[template.ID] = template
+
+	return nil
+}
+
+func (s *memoryTemplateStore) Delete(templateID int, hostID int) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if template, ok := s.templates[templateID]; ok && template.Host.ID == hostID {
+		delete(s.templates, templateID)
+	}
+	return nil
+}
@@ -0,0 +1,2467 @@
+package main
+
+import (
+	"database/sql"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NewSQLStores returns stores backed by MySQL or SQLite, reading from one connection pool and writing to another.
+func NewSQLStores(read *sql.DB, write *sql.DB) Stores {
+	return Stores{
+		Battles:     &sqlBattleStore{read: read, write: write},
+		Beats:       &sqlBeatStore{read: read, write: write},
+		Users:       &sqlUserStore{read: read, write: write},
+		Votes:       &sqlVoteStore{read: read, write: write},
+		Feedback:    &sqlFeedbackStore{read: read, write: write},
+		Ads:         &sqlAdStore{read: read},
+		Tags:        &sqlTagStore{read: read},
+		Search:      &sqlSearchStore{read: read, write: write},
+		Results:     &sqlResultStore{read: read, write: write},
+		Judges:      &sqlJudgeStore{read: read, write: write},
+		Ratings:     &sqlRatingStore{read: read, write: write},
+		Series:      &sqlSeriesStore{read: read, write: write},
+		Tournaments: &sqlTournamentStore{read: read, write: write},
+		Schedules:   &sqlScheduleStore{read: read, write: write},
+		Templates:   &sqlTemplateStore{read: read, write: write},
+	}
+}
+
+// notFound maps sql.ErrNoRows onto ErrNotFound.
+func notFound(err error) error {
+	if err == sql.ErrNoRows {
+		return ErrNotFound
+	}
+	return err
+}
+
+// utc normalises times before they're written. SQLite compares them as text.
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// nullableID stores 0 as NULL for optional foreign keys.
+func nullableID(id int) interface{} {
+	if id > 0 {
+		return id
+	}
+	return nil
+}
+
+/*-------
+Battles
+-------*/
+
+type sqlBattleStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlBattleStore) Get(battleID int) (Battle, error) {
+	battle := Battle{}
+	query := `
+			SELECT users.id, users.nickname, users.flair,
+			battles.id, battles.title, battles.rules, battles.deadline, battles.voting_deadline,
+			battles.attachment, battles.password, battles.maxvotes, battles.type, battles.status, battles.tags,
+			battles.voting_mode, battles.trim_scores, battles.judge_weight, battles.teams, battles.track_hosts,
+			battles.min_length, battles.max_length,
+			battles.min_votes, battles.require_feedback, battles.entrants_only, battles.tie_breakers, battles.winner_id, battles.season_id,
+			battles.settings_id, IFNULL(battle_settings.logo, ''), IFNULL(battle_settings.background, ''),
+			IFNULL(battle_settings.show_users, 0), IFNULL(battle_settings.show_entries, 0),
+			IFNULL(battle_settings.tracking_id, ''), IFNULL(battle_settings.private, 0),
+			IFNULL(battle_settings.field_1, ''), IFNULL(battle_settings.field_2, ''),
+			IFNULL(battle_settings.field_3, '')
+			FROM battles
+			INNER JOIN users ON users.id = battles.user_id
+			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id
+			WHERE battles.id = ?`
+
+	tags, tieBreakers, hosts := "", "", ""
+	err := s.read.QueryRow(query, battleID).Scan(
+		// Battle Host
+		&battle.Host.ID, &battle.Host.Name, &battle.Host.Flair,
+		// Battle
+		&battle.ID, &battle.Title, &battle.Rules, &battle.Deadline, &battle.VotingDeadline,
+		&battle.Attachment, &battle.Password, &battle.MaxVotes, &battle.Type, &battle.Status, &tags,
+		&battle.VotingMode, &battle.TrimScores, &battle.JudgeWeight, &battle.Teams, &hosts,
+		&battle.Length.Min, &battle.Length.Max,
+		&battle.Qualification.MinVotes, &battle.Qualification.RequireFeedback, &battle.Qualification.EntrantsOnly, &tieBreakers,
+		&battle.WinnerID, &battle.SeasonID,
+		&battle.Settings.ID, &battle.Settings.Logo, &battle.Settings.Background,
+		&battle.Settings.ShowUsers, &battle.Settings.ShowEntries,
+		&battle.Settings.TrackingID, &battle.Settings.Private,
+		&battle.Settings.Field1, &battle.Settings.Field2,
+		&battle.Settings.Field3)
+	if err != nil {
+		return Battle{}, notFound(err)
+	}
+
+	battle.Tags = SetTags(tags)
+	battle.TieBreakers = ParseTieBreakers(tieBreakers)
+	battle.TrackHosts = ParseHosts(hosts)
+	return battle, nil
+}
+
+func (s *sqlBattleStore) List(q BattleQuery) ([]Battle, error) {
+	query := `SELECT battles.id, battles.title, battles.deadline, battles.voting_deadline,
+			battles.type, battles.status, battles.tags, COUNT(DISTINCT beats.id) as entry_count,
+			users.id, users.nickname, users.flair, IFNULL(battle_settings.private, 0)
+			FROM battles
+			LEFT JOIN users ON users.id = battles.user_ID
+			LEFT JOIN beats ON battles.id = beats.battle_id
+			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id`
+
+	where, having, args := battleQueryFilters(q)
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " GROUP BY battles.id"
+	if len(having) > 0 {
+		query += " HAVING " + strings.Join(having, " AND ")
+	}
+	order, ok := battleSortColumns[q.Sort]
+	if !ok {
+		order = battleSortColumns[SortDeadline]
+	}
+	query += " ORDER BY " + order + ", battles.id DESC"
+
+	if q.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	}
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := ""
+	battle := Battle{}
+	battles := []Battle{}
+	for rows.Next() {
+		err = rows.Scan(&battle.ID, &battle.Title, &battle.Deadline, &battle.VotingDeadline,
+			&battle.Type, &battle.Status, &tags, &battle.Entries,
+			&battle.Host.ID, &battle.Host.Name, &battle.Host.Flair,
+			&battle.Settings.Private)
+		if err != nil {
+			return nil, err
+		}
+
+		battle.Tags = SetTags(tags)
+		battles = append(battles, battle)
+	}
+
+	return battles, rows.Err()
+}
+
+// battleSortColumns maps each sort onto its ORDER BY. Unknown sorts fall back to the deadline.
+var battleSortColumns = map[BattleSort]string{
+	SortDeadline: "battles.deadline DESC",
+	SortNewest:   "battles.id DESC",
+	SortEntries:  "entry_count DESC",
+	SortTitle:    "battles.title ASC",
+}
+
+// battleQueryFilters builds the WHERE and HAVING conditions for a query. Every value is bound.
+func battleQueryFilters(q BattleQuery) ([]string, []string, []interface{}) {
+	where := []string{}
+	having := []string{}
+	args := []interface{}{}
+
+	if len(q.Status) > 0 {
+		where = append(where, "battles.status IN (?"+strings.Repeat(", ?", len(q.Status)-1)+")")
+		for _, status := range q.Status {
+			args = append(args, status)
+		}
+	}
+	if q.PublicOnly {
+		where = append(where, "IFNULL(battle_settings.private, 0) = 0")
+	}
+	if q.HostID > 0 {
+		where = append(where, "battles.user_id = ?")
+		args = append(args, q.HostID)
+	}
+	if q.Tag != "" {
+		where = append(where, `battles.id IN (SELECT battles_tags.battle_id FROM battles_tags
+								INNER JOIN tags ON tags.id = battles_tags.tag_id WHERE tags.tag = ?)`)
+		args = append(args, q.Tag)
+	}
+	if q.Type != "" {
+		where = append(where, "battles.type = ?")
+		args = append(args, q.Type)
+	}
+	if !q.DeadlineFrom.IsZero() {
+		where = append(where, "battles.deadline >= ?")
+		args = append(args, utc(q.DeadlineFrom))
+	}
+	if !q.DeadlineTo.IsZero() {
+		where = append(where, "battles.deadline < ?")
+		args = append(args, utc(q.DeadlineTo))
+	}
+	if q.Text != "" {
+		where = append(where, "(battles.title LIKE ? ESCAPE '!' OR battles.rules LIKE ? ESCAPE '!')")
+		args = append(args, "%"+escapeLike(q.Text)+"%", "%"+escapeLike(q.Text)+"%")
+	}
+	if q.After != nil {
+		// Keyset pagination: continue strictly after the cursor in (sort, id DESC) order.
+		switch q.Sort {
+		case SortNewest:
+			where = append(where, "battles.id < ?")
+			args = append(args, q.After.ID)
+		case SortEntries:
+		case SortTitle:
+			where = append(where, "(battles.title > ? OR (battles.title = ? AND battles.id < ?))")
+			args = append(args, q.After.Title, q.After.Title, q.After.ID)
+		default:
+			where = append(where, "(battles.deadline < ? OR (battles.deadline = ? AND battles.id < ?))")
+			args = append(args, utc(q.After.Deadline), utc(q.After.Deadline), q.After.ID)
+		}
+	}
+	if q.MinEntries > 0 {
+		having = append(having, "COUNT(DISTINCT beats.id) >= ?")
+		args = append(args, q.MinEntries)
+	}
+	if q.MaxEntries > 0 {
+		having = append(having, "COUNT(DISTINCT beats.id) <= ?")
+		args = append(args, q.MaxEntries)
+	}
+	if q.After != nil && q.Sort == SortEntries {
+		having = append(having, "(COUNT(DISTINCT beats.id) < ? OR (COUNT(DISTINCT beats.id) = ? AND battles.id < ?))")
+		args = append(args, q.After.Entries, q.After.Entries, q.After.ID)
+	}
+
+	return where, having, args
+}
+
+// escapeLike escapes LIKE wildcards so user input matches literally, using ! as the escape character.
+func escapeLike(value string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(value)
+}
+
+func (s *sqlBattleStore) Insert(battle Battle) (int, error) {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO battles
+			(title, rules, status, deadline, attachment, password, user_id,
+			voting_deadline, maxvotes, type, settings_id, tags, voting_mode, trim_scores, judge_weight, teams, track_hosts,
+			min_length, max_length, min_votes, require_feedback, entrants_only, tie_breakers, season_id)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := tx.Exec(stmt, battle.Title, battle.Rules, battle.Status, utc(battle.Deadline), battle.Attachment, battle.Password,
+		battle.Host.ID, utc(battle.VotingDeadline), battle.MaxVotes, battle.Type, battle.Settings.ID, strings.Join(battle.Tags, ","),
+		battle.VotingMode, battle.TrimScores, battle.JudgeWeight, battle.Teams, strings.Join(battle.TrackHosts, ","),
+		battle.Length.Min, battle.Length.Max,
+		battle.Qualification.MinVotes, battle.Qualification.RequireFeedback, battle.Qualification.EntrantsOnly,
+		TieBreakersString(battle.TieBreakers), battle.SeasonID)
+	if err != nil {
+		return 0, err
+	}
+
+	battleID, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = replaceTags(tx, int(battleID), battle.Tags)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(battleID), tx.Commit()
+}
+
+func (s *sqlBattleStore) Update(battle Battle) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+			UPDATE battles
+			SET title = ?, rules = ?, deadline = ?, attachment = ?, password = ?, voting_deadline = ?, maxvotes = ?, type = ?, settings_id = ?, tags = ?, voting_mode = ?, trim_scores = ?, judge_weight = ?, teams = ?, track_hosts = ?,
+			min_length = ?, max_length = ?, min_votes = ?, require_feedback = ?, entrants_only = ?, tie_breakers = ?, season_id = ?
+			WHERE id = ? AND user_id = ?`
+
+	_, err = tx.Exec(query, battle.Title, battle.Rules, utc(battle.Deadline), battle.Attachment,
+		battle.Password, utc(battle.VotingDeadline), battle.MaxVotes,
+		battle.Type, battle.Settings.ID, strings.Join(battle.Tags, ","), battle.VotingMode, battle.TrimScores, battle.JudgeWeight, battle.Teams, strings.Join(battle.TrackHosts, ","),
+		battle.Length.Min, battle.Length.Max,
+		battle.Qualification.MinVotes, battle.Qualification.RequireFeedback, battle.Qualification.EntrantsOnly,
+		TieBreakersString(battle.TieBreakers), battle.SeasonID, battle.ID, battle.Host.ID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL doesn't count unchanged rows as affected, so check the host separately.
+	owned := 0
+	err = tx.QueryRow("SELECT COUNT(*) FROM battles WHERE id = ? AND user_id = ?", battle.ID, battle.Host.ID).Scan(&owned)
+	if err != nil || owned == 0 {
+		return err
+	}
+
+	err = replaceTags(tx, battle.ID, battle.Tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlBattleStore) Delete(battleID int, hostID int) error {
+	_, err := s.write.Exec("DELETE FROM battles WHERE user_id = ? AND id = ?", hostID, battleID)
+	return err
+}
+
+func (s *sqlBattleStore) SaveSettings(settings BattleSettings) (int, error) {
+	if settings.ID != 0 {
+		stmt := "UPDATE battle_settings SET logo = ?, background = ?, show_users = ?, show_entries = ?, tracking_id = ?, private = ?, field_1 = ?, field_2 = ?, field_3 = ? WHERE id = ?"
+		_, err := s.write.Exec(stmt, settings.Logo, settings.Background, settings.ShowUsers, settings.ShowEntries,
+			settings.TrackingID, settings.Private, settings.Field1, settings.Field2, settings.Field3, settings.ID)
+		return settings.ID, err
+	}
+
+	stmt := "INSERT INTO battle_settings(logo, background, show_users, show_entries, tracking_id, private, field_1, field_2, field_3) VALUES(?,?,?,?,?,?,?,?,?)"
+	res, err := s.write.Exec(stmt, settings.Logo, settings.Background, settings.ShowUsers, settings.ShowEntries,
+		settings.TrackingID, settings.Private, settings.Field1, settings.Field2, settings.Field3)
+	if err != nil {
+		return 0, err
+	}
+
+	settingsID, err := res.LastInsertId()
+	return int(settingsID), err
+}
+
+func (s *sqlBattleStore) SetDeadlines(battleID int, deadline time.Time, votingDeadline time.Time) error {
+	_, err := s.write.Exec("UPDATE battles SET deadline = ?, voting_deadline = ? WHERE id = ?", utc(deadline), utc(votingDeadline), battleID)
+	return err
+}
+
+func (s *sqlBattleStore) SetTags(battleID int, tags []string) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("UPDATE battles SET tags = ? WHERE id = ?", strings.Join(tags, ","), battleID)
+	if err != nil {
+		return err
+	}
+
+	err = replaceTags(tx, battleID, tags)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// replaceTags links a battle to its tags in battles_tags, creating any tags that don't exist yet.
+// battles.tags keeps a copy so listings don't need another query to show them.
+func replaceTags(tx *sql.Tx, battleID int, tags []string) error {
+	_, err := tx.Exec("DELETE FROM battles_tags WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range tags {
+		tagID := 0
+		err = tx.QueryRow("SELECT id FROM tags WHERE tag = ?", tag).Scan(&tagID)
+		if err == sql.ErrNoRows {
+			res, err := tx.Exec("INSERT INTO tags(tag) VALUES(?)", tag)
+			if err != nil {
+				return err
+			}
+			insertID, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			tagID = int(insertID)
+		} else if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("INSERT INTO battles_tags(battle_id, tag_id) VALUES(?,?)", battleID, tagID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *sqlBattleStore) Criteria(battleID int) ([]Criterion, error) {
+	rows, err := s.read.Query("SELECT id, name, weight FROM battle_criteria WHERE battle_id = ? ORDER BY position, id", battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	criteria := []Criterion{}
+	for rows.Next() {
+		criterion := Criterion{}
+		err = rows.Scan(&criterion.ID, &criterion.Name, &criterion.Weight)
+		if err != nil {
+			return nil, err
+		}
+		criteria = append(criteria, criterion)
+	}
+
+	return criteria, rows.Err()
+}
+
+func (s *sqlBattleStore) SetCriteria(battleID int, criteria []Criterion) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM battle_criteria WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for i, criterion := range criteria {
+		_, err = tx.Exec("INSERT INTO battle_criteria(battle_id, name, weight, position) VALUES(?,?,?,?)",
+			battleID, criterion.Name, criterion.Weight, i)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlBattleStore) Transition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE battles SET status = ? WHERE id = ? AND status = ?", to, battleID, from)
+	if err != nil {
+		return err
+	}
+	updated, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return ErrStaleTransition
+	}
+
+	err = insertTransition(tx, battleID, from, to, trigger, userID, note)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlBattleStore) RecordTransition(battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = insertTransition(tx, battleID, from, to, trigger, userID, note)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertTransition(tx *sql.Tx, battleID int, from BattleStatus, to BattleStatus, trigger TransitionTrigger, userID int, note string) error {
+	_, err := tx.Exec(`INSERT INTO battle_transitions(battle_id, from_status, to_status, trigger_type, user_id, note, created_at)
+						VALUES(?,?,?,?,?,?,?)`, battleID, from, to, trigger, nullableID(userID), note, utc(time.Now()))
+	return err
+}
+
+func (s *sqlBattleStore) Transitions(battleID int) ([]BattleTransition, error) {
+	query := `SELECT battle_transitions.from_status, battle_transitions.to_status, battle_transitions.trigger_type,
+				IFNULL(users.id, 0), IFNULL(users.nickname, ''), battle_transitions.note, battle_transitions.created_at
+				FROM battle_transitions
+				LEFT JOIN users ON users.id = battle_transitions.user_id
+				WHERE battle_transitions.battle_id = ?
+				ORDER BY battle_transitions.created_at, battle_transitions.id`
+
+	rows, err := s.read.Query(query, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transition := BattleTransition{}
+	transitions := []BattleTransition{}
+	for rows.Next() {
+		err = rows.Scan(&transition.From, &transition.To, &transition.Trigger,
+			&transition.User.ID, &transition.User.Name, &transition.Note, &transition.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		transitions = append(transitions, transition)
+	}
+
+	return transitions, rows.Err()
+}
+
+func (s *sqlBattleStore) Due(status BattleStatus, now time.Time) ([]int, error) {
+	// Oldest first, so battles finishing in the same pass complete in the order they're rated.
+	query := "SELECT id FROM battles WHERE status = ? AND deadline <= ? ORDER BY deadline, id"
+	if status == StatusVoting {
+		query = "SELECT id FROM battles WHERE status = ? AND voting_deadline <= ? ORDER BY voting_deadline, id"
+	}
+
+	rows, err := s.read.Query(query, status, utc(now))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	battleIDs := []int{}
+	for rows.Next() {
+		var battleID int
+		err = rows.Scan(&battleID)
+		if err != nil {
+			return nil, err
+		}
+		battleIDs = append(battleIDs, battleID)
+	}
+
+	return battleIDs, rows.Err()
+}
+
+func (s *sqlBattleStore) NextDeadline() (time.Time, bool, error) {
+	// Each status ends on a different column, so look up the earliest of each.
+	var next time.Time
+	found := false
+	queries := []string{
+		"SELECT deadline FROM battles WHERE status = ? ORDER BY deadline LIMIT 1",
+		"SELECT voting_deadline FROM battles WHERE status = ? ORDER BY voting_deadline LIMIT 1",
+	}
+	statuses := []BattleStatus{StatusEntry, StatusVoting}
+
+	for i, query := range queries {
+		var deadline time.Time
+		err := s.read.QueryRow(query, statuses[i]).Scan(&deadline)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+
+		if !found || deadline.Before(next) {
+			next = deadline
+			found = true
+		}
+	}
+
+	return next, found, nil
+}
+
+/*-------
+Beats
+-------*/
+
+type sqlBeatStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlBeatStore) Get(beatID int) (Beat, error) {
+	beat := Beat{}
+	query := `SELECT id, battle_id, user_id, url, votes, voted, placement, field_1, field_2, field_3,
+				track_provider, track_id, secret_token, embed_url, embed_height,
+				file_key, file_name, file_size, file_type,
+				audio_container, audio_codec, duration_ms, sample_rate, channels, bitrate, loudness
+				FROM beats
+				WHERE id = ?`
+
+	err := s.read.QueryRow(query, beatID).
+		Scan(&beat.ID, &beat.BattleID, &beat.Artist.ID, &beat.URL, &beat.Votes,
+			&beat.Voted, &beat.Placement, &beat.Field1,
+			&beat.Field2, &beat.Field3,
+			&beat.Embed.Provider, &beat.Embed.TrackID, &beat.Embed.Secret, &beat.Embed.URL, &beat.Embed.Height,
+			&beat.File.Key, &beat.File.Name, &beat.File.Size, &beat.File.Type,
+			&beat.Audio.Container, &beat.Audio.Codec, &beat.Audio.Duration, &beat.Audio.SampleRate,
+			&beat.Audio.Channels, &beat.Audio.Bitrate, &beat.Audio.Loudness)
+	return beat, notFound(err)
+}
+
+func (s *sqlBeatStore) GetByUser(battleID int, userID int) (Beat, error) {
+	beat := Beat{}
+	query := `SELECT id, battle_id, user_id, url, votes, voted, placement, field_1, field_2, field_3,
+				track_provider, track_id, secret_token, embed_url, embed_height,
+				file_key, file_name, file_size, file_type,
+				audio_container, audio_codec, duration_ms, sample_rate, channels, bitrate, loudness
+				FROM beats
+				WHERE beats.user_id = ?
+				AND beats.battle_id = ?`
+
+	err := s.read.QueryRow(query, userID, battleID).
+		Scan(&beat.ID, &beat.BattleID, &beat.Artist.ID, &beat.URL, &beat.Votes,
+			&beat.Voted, &beat.Placement, &beat.Field1,
+			&beat.Field2, &beat.Field3,
+			&beat.Embed.Provider, &beat.Embed.TrackID, &beat.Embed.Secret, &beat.Embed.URL, &beat.Embed.Height,
+			&beat.File.Key, &beat.File.Name, &beat.File.Size, &beat.File.Type,
+			&beat.Audio.Container, &beat.Audio.Codec, &beat.Audio.Duration, &beat.Audio.SampleRate,
+			&beat.Audio.Channels, &beat.Audio.Bitrate, &beat.Audio.Loudness)
+	return beat, notFound(err)
+}
+
+func (s *sqlBeatStore) ListByBattle(battleID int) ([]Beat, error) {
+	query := `SELECT
+			users.id, users.provider, users.provider_id, users.nickname, users.flair,
+			beats.id, beats.url, beats.votes, beats.voted, beats.placement,
+			beats.field_1, beats.field_2, beats.field_3,
+			beats.track_provider, beats.track_id, beats.secret_token, beats.embed_url, beats.embed_height,
+			beats.file_key, beats.file_name, beats.file_size, beats.file_type,
+			beats.audio_container, beats.audio_codec, beats.duration_ms, beats.sample_rate, beats.channels, beats.bitrate, beats.loudness
+			FROM beats
+			LEFT JOIN users ON beats.user_id = users.id
+			WHERE beats.battle_id = ?
+			ORDER BY beats.id`
+
+	rows, err := s.read.Query(query, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beat := Beat{}
+	beats := []Beat{}
+	for rows.Next() {
+		err = rows.Scan(
+			// Artist
+			&beat.Artist.ID, &beat.Artist.Provider, &beat.Artist.ProviderID,
+			&beat.Artist.Name, &beat.Artist.Flair,
+			// Beat
+			&beat.ID, &beat.URL, &beat.Votes,
+			&beat.Voted, &beat.Placement,
+			&beat.Field1, &beat.Field2, &beat.Field3,
+			// Embed
+			&beat.Embed.Provider, &beat.Embed.TrackID, &beat.Embed.Secret, &beat.Embed.URL, &beat.Embed.Height,
+			&beat.File.Key, &beat.File.Name, &beat.File.Size, &beat.File.Type,
+			&beat.Audio.Container, &beat.Audio.Codec, &beat.Audio.Duration, &beat.Audio.SampleRate,
+			&beat.Audio.Channels, &beat.Audio.Bitrate, &beat.Audio.Loudness)
+		if err != nil {
+			return nil, err
+		}
+
+		beat.BattleID = battleID
+		beats = append(beats, beat)
+	}
+
+	return beats, rows.Err()
+}
+
+func (s *sqlBeatStore) ListByUser(userID int) ([]Beat, error) {
+	query := `
+			SELECT beats.id, beats.url, beats.votes, beats.voted, beats.user_id, IFNULL(users.nickname, ''),
+			battles.id, battles.title, battles.status, battles.teams, beats.placement,
+			beats.track_provider, beats.track_id, beats.secret_token, beats.embed_url, beats.embed_height,
+			beats.file_key, beats.file_name, beats.file_size, beats.file_type,
+			beats.audio_container, beats.audio_codec, beats.duration_ms, beats.sample_rate, beats.channels, beats.bitrate, beats.loudness
+			FROM beats
+			LEFT JOIN battles on battles.id=beats.battle_id
+			LEFT JOIN users ON users.id = beats.user_id
+			WHERE beats.user_id=?
+			OR beats.id IN (SELECT beat_id FROM beat_members WHERE user_id = ? AND status = ?)
+			ORDER BY beats.placement ASC`
+
+	rows, err := s.read.Query(query, userID, userID, MemberAccepted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	beats := []Beat{}
+	for rows.Next() {
+		beat := Beat{}
+		err = rows.Scan(&beat.ID, &beat.URL, &beat.Votes, &beat.Voted, &beat.Artist.ID, &beat.Artist.Name,
+			&beat.BattleID, &beat.Battle.Title, &beat.Battle.Status, &beat.Battle.Teams, &beat.Placement,
+			&beat.Embed.Provider, &beat.Embed.TrackID, &beat.Embed.Secret, &beat.Embed.URL, &beat.Embed.Height,
+			&beat.File.Key, &beat.File.Name, &beat.File.Size, &beat.File.Type,
+			&beat.Audio.Container, &beat.Audio.Codec, &beat.Audio.Duration, &beat.Audio.SampleRate,
+			&beat.Audio.Channels, &beat.Audio.Bitrate, &beat.Audio.Loudness)
+		if err != nil {
+			return nil, err
+		}
+
+		beat.Battle.ID = beat.BattleID
+		beats = append(beats, beat)
+	}
+
+	return beats, rows.Err()
+}
+
+func (s *sqlBeatStore) Insert(beat Beat) (int, error) {
+	stmt := `INSERT INTO beats(url, battle_id, user_id, field_1, field_2, field_3,
+			track_provider, track_id, secret_token, embed_url, embed_height,
+			file_key, file_name, file_size, file_type,
+			audio_container, audio_codec, duration_ms, sample_rate, channels, bitrate, loudness)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+	res, err := s.write.Exec(stmt, beat.URL, beat.BattleID, beat.Artist.ID, beat.Field1, beat.Field2, beat.Field3,
+		beat.Embed.Provider, beat.Embed.TrackID, beat.Embed.Secret, beat.Embed.URL, beat.Embed.Height,
+		beat.File.Key, beat.File.Name, beat.File.Size, beat.File.Type,
+		beat.Audio.Container, beat.Audio.Codec, beat.Audio.Duration, beat.Audio.SampleRate,
+		beat.Audio.Channels, beat.Audio.Bitrate, beat.Audio.Loudness)
+	if err != nil {
+		return 0, err
+	}
+
+	beatID, err := res.LastInsertId()
+	return int(beatID), err
+}
+
+func (s *sqlBeatStore) Update(beat Beat) error {
+	stmt := `UPDATE beats SET url=?, field_1=?, field_2=?, field_3=?,
+			track_provider=?, track_id=?, secret_token=?, embed_url=?, embed_height=?,
+			file_key=?, file_name=?, file_size=?, file_type=?,
+			audio_container=?, audio_codec=?, duration_ms=?, sample_rate=?, channels=?, bitrate=?, loudness=?
+			WHERE battle_id=? AND user_id=?`
+	_, err := s.write.Exec(stmt, beat.URL, beat.Field1, beat.Field2, beat.Field3,
+		beat.Embed.Provider, beat.Embed.TrackID, beat.Embed.Secret, beat.Embed.URL, beat.Embed.Height,
+		beat.File.Key, beat.File.Name, beat.File.Size, beat.File.Type,
+		beat.Audio.Container, beat.Audio.Codec, beat.Audio.Duration, beat.Audio.SampleRate,
+		beat.Audio.Channels, beat.Audio.Bitrate, beat.Audio.Loudness,
+		beat.BattleID, beat.Artist.ID)
+	return err
+}
+
+func (s *sqlBeatStore) Delete(battleID int, userID int) error {
+	_, err := s.write.Exec("DELETE FROM beats WHERE user_id = ? AND battle_id = ?", userID, battleID)
+	return err
+}
+
+func (s *sqlBeatStore) SetVoted(beatID int, voted bool) error {
+	stmt := "UPDATE beats SET voted = 1 WHERE id = ?"
+	if !voted {
+		stmt = "UPDATE beats SET voted = 0, placement = 0 WHERE id = ?"
+	}
+
+	_, err := s.write.Exec(stmt, beatID)
+	return err
+}
+
+func (s *sqlBeatStore) SaveResults(results []BeatResult) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	upd, err := tx.Prepare("UPDATE beats SET votes = ?, voted = ?, placement = ? WHERE id = ?")
+	if err != nil {
+		return err
+	}
+	defer upd.Close()
+
+	for _, result := range results {
+		_, err = upd.Exec(result.Votes, result.Voted, result.Placement, result.BeatID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlBeatStore) Members(battleID int) ([]BeatMember, error) {
+	query := `SELECT beat_members.beat_id, users.id, users.nickname, users.flair,
+			beat_members.role, beat_members.status, beat_members.invited_at
+			FROM beat_members
+			INNER JOIN beats ON beats.id = beat_members.beat_id
+			INNER JOIN users ON users.id = beat_members.user_id
+			WHERE beats.battle_id = ?
+			ORDER BY beat_members.invited_at, users.id`
+
+	rows, err := s.read.Query(query, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []BeatMember{}
+	for rows.Next() {
+		member := BeatMember{}
+		err = rows.Scan(&member.BeatID, &member.User.ID, &member.User.Name, &member.User.Flair,
+			&member.Role, &member.Status, &member.InvitedAt)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+
+	return members, rows.Err()
+}
+
+func (s *sqlBeatStore) SaveMember(member BeatMember) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM beat_members WHERE beat_id = ? AND user_id = ?", member.BeatID, member.User.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO beat_members(beat_id, user_id, role, status, invited_at) VALUES(?,?,?,?,?)",
+		member.BeatID, member.User.ID, member.Role, member.Status, utc(member.InvitedAt))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlBeatStore) RespondMember(beatID int, userID int, status MemberStatus) error {
+	res, err := s.write.Exec("UPDATE beat_members SET status = ? WHERE beat_id = ? AND user_id = ?", status, beatID, userID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL doesn't count unchanged rows as affected, so check the invitation separately.
+	if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+	invited := 0
+	err = s.read.QueryRow("SELECT COUNT(*) FROM beat_members WHERE beat_id = ? AND user_id = ?", beatID, userID).Scan(&invited)
+	if err == nil && invited == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *sqlBeatStore) RemoveMember(beatID int, userID int) error {
+	_, err := s.write.Exec("DELETE FROM beat_members WHERE beat_id = ? AND user_id = ?", beatID, userID)
+	return err
+}
+
+/*-------
+Users
+-------*/
+
+type sqlUserStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlUserStore) Get(userID int) (User, error) {
+	query := "SELECT provider, provider_id, nickname, flair FROM users WHERE id = ?"
+	user := User{}
+	user.ID = userID
+
+	err := s.read.QueryRow(query, userID).Scan(&user.Provider, &user.ProviderID, &user.Name, &user.Flair)
+	if err != nil {
+		return User{}, notFound(err)
+	}
+
+	return user, nil
+}
+
+func (s *sqlUserStore) FindByProvider(provider string, providerID string) (int, error) {
+	userID := 0
+	err := s.read.QueryRow("SELECT id FROM users WHERE provider=? and provider_id=?", provider, providerID).Scan(&userID)
+	return userID, notFound(err)
+}
+
+func (s *sqlUserStore) Insert(user User, tokenHash string) (int, error) {
+	stmt := `INSERT INTO
+			users(provider, provider_id, nickname, access_token, expiry, flair)
+			VALUES
+			(?,?,?,?,?,?)`
+
+	res, err := s.write.Exec(stmt, user.Provider, user.ProviderID, user.Name, tokenHash, utc(user.ExpiresAt), user.Flair)
+	if err != nil {
+		return 0, err
+	}
+
+	userID, err := res.LastInsertId()
+	return int(userID), err
+}
+
+func (s *sqlUserStore) UpdateLogin(userID int, name string, tokenHash string, expiry time.Time) error {
+	stmt := `UPDATE
+			users
+			SET
+			nickname = ?, access_token = ?, expiry = ? WHERE id = ?`
+
+	_, err := s.write.Exec(stmt, name, tokenHash, utc(expiry), userID)
+	return err
+}
+
+func (s *sqlUserStore) Token(userID int) (string, time.Time, error) {
+	var tokenHash string
+	var expiry time.Time
+	err := s.read.QueryRow("SELECT access_token, expiry FROM users WHERE id = ?", userID).Scan(&tokenHash, &expiry)
+	return tokenHash, expiry, notFound(err)
+}
+
+func (s *sqlUserStore) UpdateToken(userID int, tokenHash string, expiry time.Time) error {
+	_, err := s.write.Exec("UPDATE users SET access_token = ?, expiry = ? WHERE id = ?", tokenHash, utc(expiry), userID)
+	return err
+}
+
+/*-------
+Votes & Likes
+-------*/
+
+type sqlVoteStore struct {
+	read, write *sql.DB
+}
+
+// beatIDs runs a query that selects a single column of beat IDs.
+func beatIDs(db *sql.DB, query string, args ...interface{}) ([]int, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var beatID int
+		err = rows.Scan(&beatID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, beatID)
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *sqlVoteStore) UserVotes(battleID int, userID int) ([]int, error) {
+	return beatIDs(s.read, "SELECT beat_id FROM votes WHERE user_id = ? AND battle_id = ? ORDER BY beat_id", userID, battleID)
+}
+
+func (s *sqlVoteStore) Add(battleID int, beatID int, userID int) error {
+	_, err := s.write.Exec("INSERT INTO votes(beat_id, user_id, battle_id) VALUES(?,?,?)", beatID, userID, battleID)
+	return err
+}
+
+func (s *sqlVoteStore) Remove(battleID int, beatID int, userID int) error {
+	_, err := s.write.Exec("DELETE FROM votes WHERE beat_id = ? AND user_id = ? AND battle_id = ?", beatID, userID, battleID)
+	return err
+}
+
+func (s *sqlVoteStore) Tally(battleID int) (VoteTally, error) {
+	tally := VoteTally{Votes: map[int]int{}, Voters: map[int]bool{}}
+
+	rows, err := s.read.Query("SELECT beat_id, user_id FROM votes WHERE battle_id = ?", battleID)
+	if err != nil {
+		return tally, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var beatID, userID int
+		err = rows.Scan(&beatID, &userID)
+		if err != nil {
+			return tally, err
+		}
+		tally.Votes[beatID]++
+		tally.Voters[userID] = true
+	}
+
+	return tally, rows.Err()
+}
+
+func (s *sqlVoteStore) Voters(battleID int) (map[int][]int, error) {
+	voters := map[int][]int{}
+
+	rows, err := s.read.Query("SELECT user_id, beat_id FROM votes WHERE battle_id = ? ORDER BY user_id, beat_id", battleID)
+	if err != nil {
+		return voters, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, beatID int
+		err = rows.Scan(&userID, &beatID)
+		if err != nil {
+			return voters, err
+		}
+		voters[userID] = append(voters[userID], beatID)
+	}
+
+	return voters, rows.Err()
+}
+
+func (s *sqlVoteStore) Ballot(battleID int, userID int) ([]int, error) {
+	return beatIDs(s.read, "SELECT beat_id FROM ballots WHERE battle_id = ? AND user_id = ? ORDER BY preference", battleID, userID)
+}
+
+func (s *sqlVoteStore) SaveBallot(battleID int, userID int, beatIDs []int) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM ballots WHERE battle_id = ? AND user_id = ?", battleID, userID)
+	if err != nil {
+		return err
+	}
+
+	for i, beatID := range beatIDs {
+		_, err = tx.Exec("INSERT INTO ballots(battle_id, user_id, beat_id, preference) VALUES(?,?,?,?)", battleID, userID, beatID, i+1)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlVoteStore) Ballots(battleID int) (map[int][]int, error) {
+	ballots := map[int][]int{}
+
+	rows, err := s.read.Query("SELECT user_id, beat_id FROM ballots WHERE battle_id = ? ORDER BY user_id, preference", battleID)
+	if err != nil {
+		return ballots, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID, beatID int
+		err = rows.Scan(&userID, &beatID)
+		if err != nil {
+			return ballots, err
+		}
+		ballots[userID] = append(ballots[userID], beatID)
+	}
+
+	return ballots, rows.Err()
+}
+
+func (s *sqlVoteStore) UserScores(battleID int, userID int) (map[int]map[int]int, error) {
+	scores := map[int]map[int]int{}
+
+	rows, err := s.read.Query("SELECT beat_id, criterion_id, score FROM scores WHERE battle_id = ? AND user_id = ?", battleID, userID)
+	if err != nil {
+		return scores, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var beatID, criterionID, score int
+		err = rows.Scan(&beatID, &criterionID, &score)
+		if err != nil {
+			return scores, err
+		}
+		if scores[beatID] == nil {
+			scores[beatID] = map[int]int{}
+		}
+		scores[beatID][criterionID] = score
+	}
+
+	return scores, rows.Err()
+}
+
+func (s *sqlVoteStore) SaveScore(battleID int, beatID int, userID int, criterionID int, score int) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM scores WHERE user_id = ? AND beat_id = ? AND criterion_id = ?", userID, beatID, criterionID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("INSERT INTO scores(battle_id, user_id, beat_id, criterion_id, score) VALUES(?,?,?,?,?)",
+		battleID, userID, beatID, criterionID, score)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlVoteStore) Scores(battleID int) ([]Score, error) {
+	rows, err := s.read.Query("SELECT user_id, beat_id, criterion_id, score FROM scores WHERE battle_id = ? ORDER BY beat_id, criterion_id, user_id", battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	scores := []Score{}
+	for rows.Next() {
+		score := Score{}
+		err = rows.Scan(&score.UserID, &score.BeatID, &score.CriterionID, &score.Score)
+		if err != nil {
+			return nil, err
+		}
+		scores = append(scores, score)
+	}
+
+	return scores, rows.Err()
+}
+
+func (s *sqlVoteStore) UserLikes(battleID int, userID int) ([]int, error) {
+	return beatIDs(s.read, "SELECT beat_id FROM likes WHERE user_id = ? AND battle_id = ? ORDER BY beat_id", userID, battleID)
+}
+
+func (s *sqlVoteStore) AddLike(battleID int, beatID int, userID int) error {
+	_, err := s.write.Exec("INSERT INTO likes(user_id, beat_id, battle_id) VALUES (?, ?, ?)", userID, beatID, battleID)
+	return err
+}
+
+func (s *sqlVoteStore) LikeCounts(battleID int) (map[int]int, error) {
+	rows, err := s.read.Query("SELECT beat_id, COUNT(*) FROM likes WHERE battle_id = ? GROUP BY beat_id", battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var beatID, count int
+		err = rows.Scan(&beatID, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[beatID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *sqlVoteStore) RemoveLike(battleID int, beatID int, userID int) error {
+	_, err := s.write.Exec("DELETE from likes WHERE user_id = ? AND beat_id = ? AND battle_id = ?", userID, beatID, battleID)
+	return err
+}
+
+/*-------
+Feedback
+-------*/
+
+type sqlFeedbackStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlFeedbackStore) Save(beatID int, userID int, feedback string) (bool, error) {
+	var feedbackID int
+	err := s.read.QueryRow("SELECT id FROM feedback WHERE user_id = ? AND beat_id = ?", userID, beatID).Scan(&feedbackID)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	if err == sql.ErrNoRows {
+		_, err = s.write.Exec("INSERT INTO feedback(feedback, user_id, beat_id) VALUES (?, ?, ?)", feedback, userID, beatID)
+		return err == nil, err
+	}
+
+	_, err = s.write.Exec("UPDATE feedback SET feedback = ? WHERE id = ?", feedback, feedbackID)
+	return false, err
+}
+
+func (s *sqlFeedbackStore) Counts(battleID int) (map[int]int, error) {
+	query := `SELECT feedback.user_id, COUNT(*)
+				FROM feedback
+				INNER JOIN beats ON beats.id = feedback.beat_id
+				WHERE beats.battle_id = ? AND feedback.feedback <> ''
+				GROUP BY feedback.user_id`
+
+	rows, err := s.read.Query(query, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[int]int{}
+	for rows.Next() {
+		var userID, count int
+		err = rows.Scan(&userID, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[userID] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *sqlFeedbackStore) Given(battleID int, userID int) (map[int]string, error) {
+	query := `SELECT feedback.beat_id, feedback.feedback
+				FROM feedback
+				INNER JOIN beats ON beats.id = feedback.beat_id
+				WHERE beats.battle_id = ? AND feedback.user_id = ?`
+
+	rows, err := s.read.Query(query, battleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	given := map[int]string{}
+	for rows.Next() {
+		var beatID int
+		var feedback string
+		err = rows.Scan(&beatID, &feedback)
+		if err != nil {
+			return nil, err
+		}
+		given[beatID] = feedback
+	}
+
+	return given, rows.Err()
+}
+
+func (s *sqlFeedbackStore) Received(battleID int, userID int) ([]Feedback, error) {
+	query := `SELECT users.nickname, feedback.feedback
+				FROM beats
+				LEFT JOIN feedback on feedback.beat_id = beats.id
+				LEFT JOIN users on feedback.user_id = users.id
+				WHERE beats.battle_id = ? AND beats.user_id = ? AND feedback.feedback IS NOT NULL`
+
+	rows, err := s.read.Query(query, battleID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	curFeedback := Feedback{}
+	feedback := []Feedback{}
+	for rows.Next() {
+		err = rows.Scan(&curFeedback.From, &curFeedback.Feedback)
+		if err != nil {
+			return nil, err
+		}
+		feedback = append(feedback, curFeedback)
+	}
+
+	return feedback, rows.Err()
+}
+
+/*-------
+Advertisements
+-------*/
+
+type sqlAdStore struct {
+	read *sql.DB
+}
+
+func (s *sqlAdStore) Active() ([]Advertisement, error) {
+	rows, err := s.read.Query("SELECT id, url, image FROM ads WHERE active = 1")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	advertisement := Advertisement{}
+	advertisements := []Advertisement{}
+	for rows.Next() {
+		err = rows.Scan(&advertisement.ID, &advertisement.URL, &advertisement.Image)
+		if err != nil {
+			return nil, err
+		}
+		advertisements = append(advertisements, advertisement)
+	}
+
+	return advertisements, rows.Err()
+}
+
+/*-------
+Tags
+-------*/
+
+type sqlTagStore struct {
+	read *sql.DB
+}
+
+func (s *sqlTagStore) Search(prefix string, limit int) ([]TagCount, error) {
+	return s.counts(prefix, limit)
+}
+
+func (s *sqlTagStore) Cloud(limit int) ([]TagCount, error) {
+	tags, err := s.counts("", limit)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags, nil
+}
+
+// counts returns the tags starting with prefix by how many public, non-draft battles use them.
+func (s *sqlTagStore) counts(prefix string, limit int) ([]TagCount, error) {
+	query := `SELECT tags.tag, COUNT(battles.id) FROM tags
+			INNER JOIN battles_tags ON battles_tags.tag_id = tags.id
+			INNER JOIN battles ON battles.id = battles_tags.battle_id
+			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id
+			WHERE tags.tag LIKE ? ESCAPE '!' AND battles.status != ? AND IFNULL(battle_settings.private, 0) = 0
+			GROUP BY tags.id, tags.tag
+			ORDER BY COUNT(battles.id) DESC, tags.tag ASC
+			LIMIT ?`
+
+	rows, err := s.read.Query(query, escapeLike(prefix)+"%", StatusDraft, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tag := TagCount{}
+	tags := []TagCount{}
+	for rows.Next() {
+		err = rows.Scan(&tag.Tag, &tag.Count)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+
+	return tags, rows.Err()
+}
+
+/*-------
+Search
+-------*/
+
+type sqlSearchStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlSearchStore) Index(battleID int, terms map[string]int) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM battle_search WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for term, weight := range terms {
+		_, err = tx.Exec("INSERT INTO battle_search(battle_id, term, weight) VALUES(?,?,?)", battleID, term, weight)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlSearchStore) Search(terms []string, limit int, offset int) ([]Battle, error) {
+	// Each term matches indexed terms it's a prefix of, and host nicknames containing it.
+	matches := []string{}
+	args := []interface{}{}
+	for i, term := range terms {
+		matches = append(matches,
+			`SELECT battle_id, ? AS term_index, CASE WHEN term = ? THEN weight * 2 ELSE weight END AS score
+			FROM battle_search WHERE term LIKE ? ESCAPE '!'`,
+			`SELECT battles.id, ?, ? FROM battles
+			INNER JOIN users ON users.id = battles.user_id
+			WHERE users.nickname LIKE ? ESCAPE '!'`)
+		args = append(args, i, term, escapeLike(term)+"%", i, searchWeightHost, "%"+escapeLike(term)+"%")
+	}
+
+	query := `SELECT battles.id, battles.title, battles.deadline, battles.voting_deadline,
+			battles.type, battles.status, battles.tags,
+			(SELECT COUNT(*) FROM beats WHERE beats.battle_id = battles.id),
+			users.id, users.nickname, users.flair,
+			COUNT(DISTINCT matches.term_index) AS matched, SUM(matches.score) AS score
+			FROM (` + strings.Join(matches, " UNION ALL ") + `) AS matches
+			INNER JOIN battles ON battles.id = matches.battle_id
+			INNER JOIN users ON users.id = battles.user_id
+			LEFT JOIN battle_settings ON battle_settings.id = battles.settings_id
+			WHERE IFNULL(battle_settings.private, 0) = 0 AND battles.status != ?
+			GROUP BY battles.id
+			ORDER BY matched DESC, score DESC, battles.deadline DESC, battles.id DESC
+			LIMIT ? OFFSET ?`
+	args = append(args, StatusDraft, limit, offset)
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := ""
+	matched, score := 0, 0
+	battle := Battle{}
+	battles := []Battle{}
+	for rows.Next() {
+		err = rows.Scan(&battle.ID, &battle.Title, &battle.Deadline, &battle.VotingDeadline,
+			&battle.Type, &battle.Status, &tags, &battle.Entries,
+			&battle.Host.ID, &battle.Host.Name, &battle.Host.Flair,
+			&matched, &score)
+		if err != nil {
+			return nil, err
+		}
+
+		battle.Tags = SetTags(tags)
+		battles = append(battles, battle)
+	}
+
+	return battles, rows.Err()
+}
+
+/*-------
+Results
+-------*/
+
+type sqlResultStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlResultStore) SaveRounds(battleID int, rounds []RoundCount) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM battle_rounds WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for _, count := range rounds {
+		_, err = tx.Exec("INSERT INTO battle_rounds(battle_id, round, beat_id, votes, eliminated) VALUES(?,?,?,?,?)",
+			battleID, count.Round, count.BeatID, count.Votes, count.Eliminated)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlResultStore) Rounds(battleID int) ([]RoundCount, error) {
+	rows, err := s.read.Query(`SELECT round, beat_id, votes, eliminated FROM battle_rounds
+			WHERE battle_id = ? ORDER BY round, votes DESC, beat_id`, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rounds := []RoundCount{}
+	for rows.Next() {
+		count := RoundCount{}
+		err = rows.Scan(&count.Round, &count.BeatID, &count.Votes, &count.Eliminated)
+		if err != nil {
+			return nil, err
+		}
+		rounds = append(rounds, count)
+	}
+
+	return rounds, rows.Err()
+}
+
+func (s *sqlResultStore) SaveBreakdown(battleID int, breakdown []CriterionScore) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM criterion_scores WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for _, score := range breakdown {
+		_, err = tx.Exec("INSERT INTO criterion_scores(battle_id, beat_id, criterion_id, score) VALUES(?,?,?,?)",
+			battleID, score.BeatID, score.CriterionID, score.Score)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlResultStore) Breakdown(battleID int) ([]CriterionScore, error) {
+	rows, err := s.read.Query("SELECT beat_id, criterion_id, score FROM criterion_scores WHERE battle_id = ? ORDER BY beat_id, criterion_id", battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	breakdown := []CriterionScore{}
+	for rows.Next() {
+		score := CriterionScore{}
+		err = rows.Scan(&score.BeatID, &score.CriterionID, &score.Score)
+		if err != nil {
+			return nil, err
+		}
+		breakdown = append(breakdown, score)
+	}
+
+	return breakdown, rows.Err()
+}
+
+func (s *sqlResultStore) SaveTallies(battleID int, tallies []JudgeTally) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM battle_tallies WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for _, tally := range tallies {
+		_, err = tx.Exec("INSERT INTO battle_tallies(battle_id, beat_id, judge_score, public_score, score) VALUES(?,?,?,?,?)",
+			battleID, tally.BeatID, tally.Judges, tally.Public, tally.Score)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlResultStore) Tallies(battleID int) ([]JudgeTally, error) {
+	rows, err := s.read.Query("SELECT beat_id, judge_score, public_score, score FROM battle_tallies WHERE battle_id = ? ORDER BY score DESC, beat_id", battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tallies := []JudgeTally{}
+	for rows.Next() {
+		tally := JudgeTally{}
+		err = rows.Scan(&tally.BeatID, &tally.Judges, &tally.Public, &tally.Score)
+		if err != nil {
+			return nil, err
+		}
+		tallies = append(tallies, tally)
+	}
+
+	return tallies, rows.Err()
+}
+
+func (s *sqlResultStore) SaveRecords(battleID int, winnerID int, records []ChampionshipRecord) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM championship_records WHERE battle_id = ?", battleID)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		_, err = tx.Exec("INSERT INTO championship_records(beat_id, battle_id, user_id, placement, finished_at) VALUES(?,?,?,?,?)",
+			record.BeatID, battleID, record.UserID, record.Placement, utc(record.FinishedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE battles SET winner_id = ? WHERE id = ?", winnerID, battleID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlResultStore) UserRecords(userID int) ([]ChampionshipRecord, error) {
+	query := `SELECT championship_records.beat_id, championship_records.battle_id, championship_records.user_id,
+			championship_records.placement, championship_records.finished_at, battles.title
+			FROM championship_records
+			INNER JOIN battles ON battles.id = championship_records.battle_id
+			WHERE championship_records.user_id = ?
+			ORDER BY championship_records.finished_at, championship_records.battle_id`
+
+	rows, err := s.read.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ChampionshipRecord{}
+	for rows.Next() {
+		record := ChampionshipRecord{}
+		err = rows.Scan(&record.BeatID, &record.BattleID, &record.UserID, &record.Placement, &record.FinishedAt, &record.Title)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+/*-------
+Judges
+-------*/
+
+type sqlJudgeStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlJudgeStore) Invite(battleID int, userID int) error {
+	invited := 0
+	err := s.read.QueryRow("SELECT COUNT(*) FROM battle_judges WHERE battle_id = ? AND user_id = ?", battleID, userID).Scan(&invited)
+	if err != nil || invited > 0 {
+		return err
+	}
+
+	_, err = s.write.Exec("INSERT INTO battle_judges(battle_id, user_id, status, invited_at) VALUES(?,?,?,?)",
+		battleID, userID, JudgeInvited, utc(time.Now()))
+	return err
+}
+
+func (s *sqlJudgeStore) Respond(battleID int, userID int, status JudgeStatus) error {
+	res, err := s.write.Exec("UPDATE battle_judges SET status = ? WHERE battle_id = ? AND user_id = ?", status, battleID, userID)
+	if err != nil {
+		return err
+	}
+
+	// MySQL doesn't count unchanged rows as affected, so check the invitation separately.
+	if affected, err := res.RowsAffected(); err == nil && affected > 0 {
+		return nil
+	}
+	invited := 0
+	err = s.read.QueryRow("SELECT COUNT(*) FROM battle_judges WHERE battle_id = ? AND user_id = ?", battleID, userID).Scan(&invited)
+	if err == nil && invited == 0 {
+		return ErrNotFound
+	}
+	return err
+}
+
+func (s *sqlJudgeStore) Remove(battleID int, userID int) error {
+	_, err := s.write.Exec("DELETE FROM battle_judges WHERE battle_id = ? AND user_id = ?", battleID, userID)
+	return err
+}
+
+func (s *sqlJudgeStore) List(battleID int) ([]Judge, error) {
+	query := `SELECT users.id, users.nickname, users.flair, battle_judges.status, battle_judges.invited_at
+			FROM battle_judges
+			INNER JOIN users ON users.id = battle_judges.user_id
+			WHERE battle_judges.battle_id = ?
+			ORDER BY battle_judges.invited_at, users.id`
+
+	rows, err := s.read.Query(query, battleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	judges := []Judge{}
+	for rows.Next() {
+		judge := Judge{}
+		err = rows.Scan(&judge.User.ID, &judge.User.Name, &judge.User.Flair, &judge.Status, &judge.InvitedAt)
+		if err != nil {
+			return nil, err
+		}
+		judges = append(judges, judge)
+	}
+
+	return judges, rows.Err()
+}
+
+/*-------
+Ratings
+-------*/
+
+type sqlRatingStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlRatingStore) Get(category string, userIDs []int) (map[int]Rating, error) {
+	ratings := map[int]Rating{}
+	if len(userIDs) == 0 {
+		return ratings, nil
+	}
+
+	args := []interface{}{category}
+	for _, userID := range userIDs {
+		args = append(args, userID)
+	}
+	query := "SELECT user_id, rating, battles, updated_at FROM ratings WHERE category = ? AND user_id IN (?" +
+		strings.Repeat(", ?", len(userIDs)-1) + ")"
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rating := Rating{Category: category}
+		err = rows.Scan(&rating.UserID, &rating.Rating, &rating.Battles, &rating.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		ratings[rating.UserID] = rating
+	}
+
+	return ratings, rows.Err()
+}
+
+func (s *sqlRatingStore) SaveChanges(changes []RatingChange) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, change := range changes {
+		_, err = tx.Exec("DELETE FROM rating_history WHERE battle_id = ? AND user_id = ? AND category = ?",
+			change.BattleID, change.UserID, change.Category)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`INSERT INTO rating_history(battle_id, user_id, category, placement, rating_before, rating_after, finished_at)
+				VALUES(?,?,?,?,?,?,?)`,
+			change.BattleID, change.UserID, change.Category, change.Placement, change.Before, change.After, utc(change.FinishedAt))
+		if err != nil {
+			return err
+		}
+
+		// battles always goes up, so even MySQL counts the row as affected.
+		res, err := tx.Exec("UPDATE ratings SET rating = ?, battles = battles + 1, updated_at = ? WHERE user_id = ? AND category = ?",
+			change.After, utc(change.FinishedAt), change.UserID, change.Category)
+		if err != nil {
+			return err
+		}
+		if affected, err := res.RowsAffected(); err != nil || affected > 0 {
+			continue
+		}
+
+		_, err = tx.Exec("INSERT INTO ratings(user_id, category, rating, battles, updated_at) VALUES(?,?,?,?,?)",
+			change.UserID, change.Category, change.After, 1, utc(change.FinishedAt))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlRatingStore) RatedAfter(battleID int, finishedAt time.Time) (bool, error) {
+	rated := 0
+	err := s.read.QueryRow(`SELECT COUNT(*) FROM rating_history
+			WHERE battle_id = ? OR finished_at > ? OR (finished_at = ? AND battle_id > ?)`,
+		battleID, utc(finishedAt), utc(finishedAt), battleID).Scan(&rated)
+	return rated > 0, err
+}
+
+func (s *sqlRatingStore) Reset() error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM rating_history")
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM ratings")
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlRatingStore) Leaderboard(q LeaderboardQuery) ([]LeaderboardRow, error) {
+	args := []interface{}{}
+	window := ""
+	if !q.Since.IsZero() {
+		window = " AND rating_history.finished_at >= ?"
+		args = append(args, utc(q.Since))
+	}
+	args = append(args, q.Category, q.Limit)
+
+	query := `SELECT users.id, users.nickname, users.flair, ratings.rating,
+			COUNT(rating_history.battle_id), SUM(rating_history.rating_after - rating_history.rating_before)
+			FROM ratings
+			INNER JOIN users ON users.id = ratings.user_id
+			INNER JOIN rating_history ON rating_history.user_id = ratings.user_id
+				AND rating_history.category = ratings.category` + window + `
+			WHERE ratings.category = ?
+			GROUP BY users.id, users.nickname, users.flair, ratings.rating
+			ORDER BY ratings.rating DESC, users.id
+			LIMIT ?`
+
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	leaderboard := []LeaderboardRow{}
+	for rows.Next() {
+		row := LeaderboardRow{Rank: len(leaderboard) + 1}
+		err = rows.Scan(&row.User.ID, &row.User.Name, &row.User.Flair, &row.Rating, &row.Battles, &row.Change)
+		if err != nil {
+			return nil, err
+		}
+		leaderboard = append(leaderboard, row)
+	}
+
+	return leaderboard, rows.Err()
+}
+
+func (s *sqlRatingStore) History(userID int, category string, limit int) ([]RatingChange, error) {
+	query := `SELECT rating_history.battle_id, rating_history.placement, rating_history.rating_before,
+			rating_history.rating_after, rating_history.finished_at, battles.title
+			FROM rating_history
+			INNER JOIN battles ON battles.id = rating_history.battle_id
+			WHERE rating_history.user_id = ? AND rating_history.category = ?
+			ORDER BY rating_history.finished_at DESC, rating_history.battle_id DESC
+			LIMIT ?`
+
+	rows, err := s.read.Query(query, userID, category, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []RatingChange{}
+	for rows.Next() {
+		change := RatingChange{UserID: userID, Category: category}
+		err = rows.Scan(&change.BattleID, &change.Placement, &change.Before, &change.After, &change.FinishedAt, &change.Title)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, change)
+	}
+
+	return history, rows.Err()
+}
+
+/*-------
+Series
+-------*/
+
+type sqlSeriesStore struct {
+	read, write *sql.DB
+}
+
+func (s *sqlSeriesStore) Insert(series Series) (int, error) {
+	res, err := s.write.Exec("INSERT INTO series(user_id, title, points, drop_lowest, created_at) VALUES(?,?,?,?,?)",
+		series.Host.ID, series.Title, PointsString(series.Points), series.DropLowest, utc(series.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	seriesID, err := res.LastInsertId()
+	return int(seriesID), err
+}
+
+func (s *sqlSeriesStore) Get(seriesID int) (Series, error) {
+	query := `SELECT series.id, series.title, series.points, series.drop_lowest, series.created_at,
+			users.id, users.nickname, users.flair
+			FROM series
+			INNER JOIN users ON users.id = series.user_id
+			WHERE series.id = ?`
+
+	series, points := Series{}, ""
+	err := s.read.QueryRow(query, seriesID).Scan(&series.ID, &series.Title, &points, &series.DropLowest, &series.CreatedAt,
+		&series.Host.ID, &series.Host.Name, &series.Host.Flair)
+	if err != nil {
+		return Series{}, notFound(err)
+	}
+
+	series.Points = ParsePoints(points)
+	return series, nil
+}
+
+func (s *sqlSeriesStore) Update(series Series) error {
+	_, err := s.write.Exec("UPDATE series SET title = ?, points = ?, drop_lowest = ? WHERE id = ? AND user_id = ?",
+		series.Title, PointsString(series.Points), series.DropLowest, series.ID, series.Host.ID)
+	return err
+}
+
+func (s *sqlSeriesStore) ListByHost(userID int) ([]Series, error) {
+	query := `SELECT series.id, series.title, series.points, series.drop_lowest, series.created_at,
+			users.id, users.nickname, users.flair
+			FROM series
+			INNER JOIN users ON users.id = series.user_id
+			WHERE series.user_id = ?
+			ORDER BY series.id DESC`
+
+	rows, err := s.read.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []Series{}
+	for rows.Next() {
+		series, points := Series{}, ""
+		err = rows.Scan(&series.ID, &series.Title, &points, &series.DropLowest, &series.CreatedAt,
+			&series.Host.ID, &series.Host.Name, &series.Host.Flair)
+		if err != nil {
+			return nil, err
+		}
+		series.Points = ParsePoints(points)
+		list = append(list, series)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *sqlSeriesStore) InsertSeason(season Season) (int, error) {
+	res, err := s.write.Exec("INSERT INTO seasons(series_id, title, created_at) VALUES(?,?,?)",
+		season.SeriesID, season.Title, utc(season.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	seasonID, err := res.LastInsertId()
+	return int(seasonID), err
+}
+
+func (s *sqlSeriesStore) GetSeason(seasonID int) (Season, error) {
+	season := Season{}
+	err := s.read.QueryRow("SELECT id, series_id, title, created_at FROM seasons WHERE id = ?", seasonID).
+		Scan(&season.ID, &season.SeriesID, &season.Title, &season.CreatedAt)
+	if err != nil {
+		return Season{}, notFound(err)
+	}
+
+	return season, nil
+}
+
+func (s *sqlSeriesStore) Seasons(seriesID int) ([]Season, error) {
+	rows, err := s.read.Query("SELECT id, series_id, title, created_at FROM seasons WHERE series_id = ? ORDER BY id", seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	seasons := []Season{}
+	for rows.Next() {
+		season := Season{}
+		err = rows.Scan(&season.ID, &season.SeriesID, &season.Title, &season.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		seasons = append(seasons, season)
+	}
+
+	return seasons, rows.Err()
+}
+
+func (s *sqlSeriesStore) Battles(seriesID int) ([]Battle, error) {
+	query := `SELECT battles.id, battles.title, battles.deadline, battles.voting_deadline,
+			battles.type, battles.status, battles.season_id, battles.winner_id
+			FROM battles
+			INNER JOIN seasons ON seasons.id = battles.season_id
+			WHERE seasons.series_id = ?
+			ORDER BY battles.deadline, battles.id`
+
+	rows, err := s.read.Query(query, seriesID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	battles := []Battle{}
+	for rows.Next() {
+		battle := Battle{}
+		err = rows.Scan(&battle.ID, &battle.Title, &battle.Deadline, &battle.VotingDeadline,
+			&battle.Type, &battle.Status, &battle.SeasonID, &battle.WinnerID)
+		if err != nil {
+			return nil, err
+		}
+		battles = append(battles, battle)
+	}
+
+	return battles, rows.Err()
+}
+
+func (s *sqlSeriesStore) Records(seasonID int) ([]ChampionshipRecord, error) {
+	query := `SELECT championship_records.beat_id, championship_records.battle_id, championship_records.user_id,
+			championship_records.placement, championship_records.finished_at, battles.title
+			FROM championship_records
+			INNER JOIN battles ON battles.id = championship_records.battle_id
+			WHERE battles.season_id = ?
+			ORDER BY championship_records.finished_at, championship_records.battle_id`
+
+	rows, err := s.read.Query(query, seasonID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []ChampionshipRecord{}
+	for rows.Next() {
+		record := ChampionshipRecord{}
+		err = rows.Scan(&record.BeatID, &record.BattleID, &record.UserID, &record.Placement, &record.FinishedAt, &record.Title)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
+
+/*-------
+Tournaments
+-------*/
+
+type sqlTournamentStore struct {
+	read, write *sql.DB
+}
+
+// tournamentColumns are the columns scanTournament reads, with the host joined from users.
+const tournamentColumns = `tournaments.id, tournaments.title, tournaments.rules, tournaments.type, tournaments.format,
+			tournaments.seeding, tournaments.entry_hours, tournaments.voting_hours, tournaments.status,
+			tournaments.winner_id, tournaments.created_at, users.id, users.nickname, users.flair`
+
+// scanTournament reads a row of tournamentColumns.
+func scanTournament(row interface{ Scan(...interface{}) error }) (Tournament, error) {
+	tournament := Tournament{}
+	err := row.Scan(&tournament.ID, &tournament.Title, &tournament.Rules, &tournament.Type, &tournament.Format,
+		&tournament.Seeding, &tournament.EntryHours, &tournament.VotingHours, &tournament.Status,
+		&tournament.WinnerID, &tournament.CreatedAt, &tournament.Host.ID, &tournament.Host.Name, &tournament.Host.Flair)
+	return tournament, err
+}
+
+func (s *sqlTournamentStore) Insert(tournament Tournament) (int, error) {
+	stmt := `INSERT INTO tournaments(user_id, title, rules, type, format, seeding, entry_hours, voting_hours, status, created_at)
+			VALUES(?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := s.write.Exec(stmt, tournament.Host.ID, tournament.Title, tournament.Rules, tournament.Type, tournament.Format,
+		tournament.Seeding, tournament.EntryHours, tournament.VotingHours, tournament.Status, utc(tournament.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	tournamentID, err := res.LastInsertId()
+	return int(tournamentID), err
+}
+
+func (s *sqlTournamentStore) Get(tournamentID int) (Tournament, error) {
+	query := `SELECT ` + tournamentColumns + `
+			FROM tournaments
+			INNER JOIN users ON users.id = tournaments.user_id
+			WHERE tournaments.id = ?`
+
+	tournament, err := scanTournament(s.read.QueryRow(query, tournamentID))
+	if err != nil {
+		return Tournament{}, notFound(err)
+	}
+
+	return tournament, nil
+}
+
+func (s *sqlTournamentStore) List(limit int) ([]Tournament, error) {
+	query := `SELECT ` + tournamentColumns + `
+			FROM tournaments
+			INNER JOIN users ON users.id = tournaments.user_id
+			ORDER BY tournaments.id DESC
+			LIMIT ?`
+
+	rows, err := s.read.Query(query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tournaments := []Tournament{}
+	for rows.Next() {
+		tournament, err := scanTournament(rows)
+		if err != nil {
+			return nil, err
+		}
+		tournaments = append(tournaments, tournament)
+	}
+
+	return tournaments, rows.Err()
+}
+
+func (s *sqlTournamentStore) SetStatus(tournamentID int, status TournamentStatus, winnerID int) error {
+	_, err := s.write.Exec("UPDATE tournaments SET status = ?, winner_id = ? WHERE id = ?", status, winnerID, tournamentID)
+	return err
+}
+
+func (s *sqlTournamentStore) Join(tournamentID int, userID int, joinedAt time.Time) error {
+	_, err := s.write.Exec("INSERT INTO tournament_entrants(tournament_id, user_id, joined_at) VALUES(?,?,?)",
+		tournamentID, userID, utc(joinedAt))
+	return err
+}
+
+func (s *sqlTournamentStore) Leave(tournamentID int, userID int) error {
+	_, err := s.write.Exec("DELETE FROM tournament_entrants WHERE tournament_id = ? AND user_id = ?", tournamentID, userID)
+	return err
+}
+
+func (s *sqlTournamentStore) Entrants(tournamentID int) ([]TournamentEntrant, error) {
+	query := `SELECT tournament_entrants.seed, tournament_entrants.joined_at, users.id, users.nickname, users.flair
+			FROM tournament_entrants
+			INNER JOIN users ON users.id = tournament_entrants.user_id
+			WHERE tournament_entrants.tournament_id = ?
+			ORDER BY tournament_entrants.seed, tournament_entrants.joined_at, users.id`
+
+	rows, err := s.read.Query(query, tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entrants := []TournamentEntrant{}
+	for rows.Next() {
+		entrant := TournamentEntrant{}
+		err = rows.Scan(&entrant.Seed, &entrant.JoinedAt, &entrant.User.ID, &entrant.User.Name, &entrant.User.Flair)
+		if err != nil {
+			return nil, err
+		}
+		entrants = append(entrants, entrant)
+	}
+
+	return entrants, rows.Err()
+}
+
+func (s *sqlTournamentStore) Start(tournamentID int, userIDs []int) error {
+	tx, err := s.write.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("UPDATE tournaments SET status = ? WHERE id = ? AND status = ?", TournamentRunning, tournamentID, TournamentSignup)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrTournamentStarted
+	}
+
+	for i, userID := range userIDs {
+		_, err = tx.Exec("UPDATE tournament_entrants SET seed = ? WHERE tournament_id = ? AND user_id = ?", i+1, tournamentID, userID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// matchColumns are the columns scanMatch reads.
+const matchColumns = `id, tournament_id, side, round, position, battle_id, player1_id, player2_id, winner_id, decided_by, created_at`
+
+// scanMatch reads a row of matchColumns.
+func scanMatch(row interface{ Scan(...interface{}) error }) (TournamentMatch, error) {
+	match := TournamentMatch{}
+	err := row.Scan(&match.ID, &match.TournamentID, &match.Side, &match.Round, &match.Position, &match.BattleID,
+		&match.Players[0], &match.Players[1], &match.WinnerID, &match.DecidedBy, &match.CreatedAt)
+	return match, err
+}
+
+func (s *sqlTournamentStore) Matches(tournamentID int) ([]TournamentMatch, error) {
+	rows, err := s.read.Query("SELECT "+matchColumns+" FROM tournament_matches WHERE tournament_id = ? ORDER BY id", tournamentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	matches := []TournamentMatch{}
+	for rows.Next() {
+		match, err := scanMatch(rows)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, match)
+	}
+
+	return matches, rows.Err()
+}
+
+func (s *sqlTournamentStore) InsertMatch(match TournamentMatch) (int, error) {
+	stmt := `INSERT INTO tournament_matches(tournament_id, side, round, position, battle_id, player1_id, player2_id,
+			winner_id, decided_by, created_at)
+			VALUES(?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := s.write.Exec(stmt, match.TournamentID, match.Side, match.Round, match.Position, match.BattleID,
+		match.Players[0], match.Players[1], match.WinnerID, match.DecidedBy, utc(match.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	matchID, err := res.LastInsertId()
+	return int(matchID), err
+}
+
+func (s *sqlTournamentStore) UpdateMatch(match TournamentMatch) error {
+	_, err := s.write.Exec("UPDATE tournament_matches SET player1_id = ?, player2_id = ?, winner_id = ?, decided_by = ? WHERE id = ?",
+		match.Players[0], match.Players[1], match.WinnerID, match.DecidedBy, match.ID)
+	return err
+}
+
+func (s *sqlTournamentStore) MatchByBattle(battleID int) (TournamentMatch, error) {
+	match, err := scanMatch(s.read.QueryRow("SELECT "+matchColumns+" FROM tournament_matches WHERE battle_id = ?", battleID))
+	if err != nil {
+		return TournamentMatch{}, notFound(err)
+	}
+
+	return match, nil
+}
+
+/*-------
+Schedules
+-------*/
+
+type sqlScheduleStore struct {
+	read, write *sql.DB
+}
+
+// scheduleColumns are the columns scanSchedule reads, with the host joined from users and the title from battles.
+const scheduleColumns = `schedules.id, schedules.battle_id, COALESCE(battles.title, ''), schedules.cadence, schedules.timezone,
+			schedules.starts_at, schedules.entry_hours, schedules.voting_hours, schedules.packs, schedules.runs,
+			schedules.next_run, schedules.opened, schedules.last_battle_id, schedules.paused, schedules.created_at,
+			users.id, users.nickname, users.flair`
+
+// scheduleTables joins scheduleColumns' tables. A deleted battle leaves its schedules without a title.
+const scheduleTables = `schedules
+			INNER JOIN users ON users.id = schedules.user_id
+			LEFT JOIN battles ON battles.id = schedules.battle_id`
+
+// scanSchedule reads a row of scheduleColumns.
+func scanSchedule(row interface{ Scan(...interface{}) error }) (Schedule, error) {
+	schedule := Schedule{}
+	var packs string
+	err := row.Scan(&schedule.ID, &schedule.BattleID, &schedule.Title, &schedule.Cadence, &schedule.Timezone,
+		&schedule.StartsAt, &schedule.EntryHours, &schedule.VotingHours, &packs, &schedule.Runs,
+		&schedule.NextRun, &schedule.Opened, &schedule.LastBattleID, &schedule.Paused, &schedule.CreatedAt,
+		&schedule.Host.ID, &schedule.Host.Name, &schedule.Host.Flair)
+	schedule.Packs = ParsePacks(packs)
+	return schedule, err
+}
+
+// querySchedules runs a query for scheduleColumns.
+func (s *sqlScheduleStore) querySchedules(query string, args ...interface{}) ([]Schedule, error) {
+	rows, err := s.read.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+
+	return schedules, rows.Err()
+}
+
+func (s *sqlScheduleStore) Insert(schedule Schedule) (int, error) {
+	stmt := `INSERT INTO schedules(user_id, battle_id, cadence, timezone, starts_at, entry_hours, voting_hours, packs,
+			runs, next_run, paused, created_at)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	res, err := s.write.Exec(stmt, schedule.Host.ID, schedule.BattleID, schedule.Cadence, schedule.Timezone,
+		utc(schedule.StartsAt), schedule.EntryHours, schedule.VotingHours, strings.Join(schedule.Packs, "\n"),
+		schedule.Runs, utc(schedule.NextRun), schedule.Paused, utc(schedule.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	scheduleID, err := res.LastInsertId()
+	return int(scheduleID), err
+}
+
+func (s *sqlScheduleStore) Get(scheduleID int) (Schedule, error) {
+	query := "SELECT " + scheduleColumns + " FROM " + scheduleTables + " WHERE schedules.id = ?"
+
+	schedule, err := scanSchedule(s.read.QueryRow(query, scheduleID))
+	if err != nil {
+		return Schedule{}, notFound(err)
+	}
+
+	return schedule, nil
+}
+
+func (s *sqlScheduleStore) ListByHost(userID int) ([]Schedule, error) {
+	query := "SELECT " + scheduleColumns + " FROM " + scheduleTables + " WHERE schedules.user_id = ? ORDER BY schedules.id DESC"
+	return s.querySchedules(query, userID)
+}
+
+func (s *sqlScheduleStore) SetPaused(scheduleID int, paused bool) error {
+	_, err := s.write.Exec("UPDATE schedules SET paused = ? WHERE id = ?", paused, scheduleID)
+	return err
+}
+
+func (s *sqlScheduleStore) Delete(scheduleID int) error {
+	_, err := s.write.Exec("DELETE FROM schedules WHERE id = ?", scheduleID)
+	return err
+}
+
+func (s *sqlScheduleStore) Due(now time.Time) ([]Schedule, error) {
+	query := "SELECT " + scheduleColumns + " FROM " + scheduleTables + `
+			WHERE schedules.paused = ? AND schedules.next_run <= ?
+			ORDER BY schedules.next_run`
+	return s.querySchedules(query, false, utc(now))
+}
+
+func (s *sqlScheduleStore) NextRun() (time.Time, bool, error) {
+	var next time.Time
+	err := s.read.QueryRow("SELECT next_run FROM schedules WHERE paused = ? ORDER BY next_run LIMIT 1", false).Scan(&next)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+
+	return next, true, nil
+}
+
+func (s *sqlScheduleStore) Claim(scheduleID int, from int, to int, nextRun time.Time) error {
+	res, err := s.write.Exec("UPDATE schedules SET runs = ?, next_run = ? WHERE id = ? AND runs = ?",
+		to, utc(nextRun), scheduleID, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrStaleSchedule
+	}
+
+	return nil
+}
+
+func (s *sqlScheduleStore) RecordBattle(scheduleID int, battleID int) error {
+	_, err := s.write.Exec("UPDATE schedules SET opened = opened + 1, last_battle_id = ? WHERE id = ?", battleID, scheduleID)
+	return err
+}
+
+/*-------
+Templates
+-------*/
+
+type sqlTemplateStore struct {
+	read, write *sql.DB
+}
+
+// templateColumns are the columns scanTemplate reads, with the host joined from users.
+const templateColumns = `battle_templates.id, battle_templates.name, battle_templates.title, battle_templates.rules,
+			battle_templates.type, battle_templates.maxvotes, battle_templates.tags, battle_templates.logo,
+			battle_templates.background, battle_templates.show_users, battle_templates.show_entries,
+			battle_templates.tracking_id, battle_templates.private, battle_templates.field_1, battle_templates.field_2,
+			battle_templates.field_3, battle_templates.created_at, users.id, users.nickname, users.flair`
+
+// scanTemplate reads a row of templateColumns.
+func scanTemplate(row interface{ Scan(...interface{}) error }) (BattleTemplate, error) {
+	template := BattleTemplate{}
+	var tags string
+	err := row.Scan(&template.ID, &template.Name, &template.Title, &template.Rules,
+		&template.Type, &template.MaxVotes, &tags, &template.Settings.Logo,
+		&template.Settings.Background, &template.Settings.ShowUsers, &template.Settings.ShowEntries,
+		&template.Settings.TrackingID, &template.Settings.Private, &template.Settings.Field1, &template.Settings.Field2,
+		&template.Settings.Field3, &template.CreatedAt, &template.Host.ID, &template.Host.Name, &template.Host.Flair)
+	template.Tags = SetTags(tags)
+	return template, err
+}
+
+func (s *sqlTemplateStore) Insert(template BattleTemplate) (int, error) {
+	stmt := `INSERT INTO battle_templates(user_id, name, title, rules, type, maxvotes, tags, logo, background, show_users,
+			show_entries, tracking_id, private, field_1, field_2, field_3, created_at)
+			VALUES(?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`
+
+	settings := template.Settings
+	res, err := s.write.Exec(stmt, template.Host.ID, template.Name, template.Title, template.Rules, template.Type,
+		template.MaxVotes, strings.Join(template.Tags, ","), settings.Logo, settings.Background, settings.ShowUsers,
+		settings.ShowEntries, settings.TrackingID, settings.Private, settings.Field1, settings.Field2, settings.Field3,
+		utc(template.CreatedAt))
+	if err != nil {
+		return 0, err
+	}
+
+	templateID, err := res.LastInsertId()
+	return int(templateID), err
+}
+
+func (s *sqlTemplateStore) Get(templateID int) (BattleTemplate, error) {
+	query := `SELECT ` + templateColumns + `
+			FROM battle_templates
+			INNER JOIN users ON users.id = battle_templates.user_id
+			WHERE battle_templates.id = ?`
+
+	template, err := scanTemplate(s.read.QueryRow(query, templateID))
+	if err != nil {
+		return BattleTemplate{}, notFound(err)
+	}
+
+	return template, nil
+}
+
+func (s *sqlTemplateStore) ListByHost(userID int) ([]BattleTemplate, error) {
+	query := `SELECT ` + templateColumns + `
+			FROM battle_templates
+			INNER JOIN users ON users.id = battle_templates.user_id
+			WHERE battle_templates.user_id = ?
+			ORDER BY battle_templates.name, battle_templates.id`
+
+	rows, err := s.read.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := []BattleTemplate{}
+	for rows.Next() {
+		template, err := scanTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, template)
+	}
+
+	return templates, rows.Err()
+}
+
+func (s *sqlTemplateStore) Update(template BattleTemplate) error {
+	stmt := `UPDATE battle_templates SET name = ?, title = ?, rules = ?, type = ?, maxvotes = ?, tags = ?, logo = ?,
+			background = ?, show_users = ?, show_entries = ?, tracking_id = ?, private = ?, field_1 = ?, field_2 = ?,
+			field_3 = ?
+			WHERE id = ? AND user_id = ?`
+
+	settings := template.Settings
+	_, err := s.write.Exec(stmt, template.Name, template.Title, template.Rules, template.Type, template.MaxVotes,
+		strings.Join(template.Tags, ","), settings.Logo, settings.Background, settings.ShowUsers, settings.ShowEntries,
+		settings.TrackingID, settings.Private, settings.Field1, settings.Field2, settings.Field3,
+		template.ID, template.Host.ID)
+	return err
+}
+
+func (s *sqlTemplateStore) Delete(templateID int, hostID int) error {
+	_, err := s.write.Exec("DELETE FROM battle_templates WHERE id = ? AND user_id = ?", templateID, hostID)
+	return err
+}
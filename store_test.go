@@ -0,0 +1,147 @@
+package main
+
+import (
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storeOutcome is what a run of storeScenario saw, without IDs, which the stores hand out differently.
+type storeOutcome struct {
+	Title       string
+	Status      BattleStatus
+	Host        string
+	Tags        []string
+	Entries     []string
+	URLs        []string
+	Stale       error
+	Votes       []int
+	Voters      int
+	Transitions []BattleStatus
+	Due         bool
+	Remaining   []string
+}
+
+// storeScenario runs a battle from entry through voting on a set of stores.
+func storeScenario(t *testing.T, stores Stores) storeOutcome {
+	t.Helper()
+	outcome := storeOutcome{}
+	must := func(err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hostID, err := stores.Users.Insert(User{Name: "Host"}, "")
+	must(err)
+	aliceID, err := stores.Users.Insert(User{Name: "Alice"}, "")
+	must(err)
+	bobID, err := stores.Users.Insert(User{Name: "Bob"}, "")
+	must(err)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	battleID, err := stores.Battles.Insert(Battle{
+		Title:          "Sample Flip",
+		Rules:          "Flip the sample.",
+		Host:           User{ID: hostID},
+		Type:           "beat",
+		Status:         StatusEntry,
+		MaxVotes:       1,
+		Deadline:       now.Add(time.Hour),
+		VotingDeadline: now.Add(2 * time.Hour),
+	})
+	must(err)
+	must(stores.Battles.SetTags(battleID, []string{"lofi", "drill"}))
+
+	aliceBeat, err := stores.Beats.Insert(Beat{BattleID: battleID, Artist: User{ID: aliceID}, URL: "https://soundcloud.com/alice/first"})
+	must(err)
+	_, err = stores.Beats.Insert(Beat{BattleID: battleID, Artist: User{ID: bobID}, URL: "https://soundcloud.com/bob/entry"})
+	must(err)
+	must(stores.Beats.Update(Beat{BattleID: battleID, Artist: User{ID: aliceID}, URL: "https://soundcloud.com/alice/second"}))
+
+	must(stores.Battles.Transition(battleID, StatusEntry, StatusVoting, TriggerScheduler, 0, ""))
+	outcome.Stale = stores.Battles.Transition(battleID, StatusEntry, StatusVoting, TriggerScheduler, 0, "")
+
+	battle, err := stores.Battles.Get(battleID)
+	must(err)
+	outcome.Title = battle.Title
+	outcome.Status = battle.Status
+	outcome.Host = battle.Host.Name
+	outcome.Tags = battle.Tags
+
+	beats, err := stores.Beats.ListByBattle(battleID)
+	must(err)
+	for _, beat := range beats {
+		outcome.Entries = append(outcome.Entries, beat.Artist.Name)
+		outcome.URLs = append(outcome.URLs, beat.URL)
+	}
+
+	must(stores.Votes.Add(battleID, aliceBeat, bobID))
+	must(stores.Votes.Add(battleID, aliceBeat, hostID))
+	tally, err := stores.Votes.Tally(battleID)
+	must(err)
+	outcome.Votes = []int{tally.Votes[aliceBeat]}
+	outcome.Voters = len(tally.Voters)
+
+	transitions, err := stores.Battles.Transitions(battleID)
+	must(err)
+	for _, transition := range transitions {
+		outcome.Transitions = append(outcome.Transitions, transition.To)
+	}
+
+	due, err := stores.Battles.Due(StatusVoting, now.Add(3*time.Hour))
+	must(err)
+	outcome.Due = len(due) == 1 && due[0] == battleID
+
+	must(stores.Beats.Delete(battleID, bobID))
+	beats, err = stores.Beats.ListByBattle(battleID)
+	must(err)
+	for _, beat := range beats {
+		outcome.Remaining = append(outcome.Remaining, beat.Artist.Name)
+	}
+
+	return outcome
+}
+
+// TestStoreParity checks the in-memory stores handlers are tested on behave like the SQL ones.
+func TestStoreParity(t *testing.T) {
+	driver, dsn, err := parseDatabaseURL("sqlite:" + t.TempDir() + "/parity.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = MigrateUp(db, driver, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memory := storeScenario(t, NewMemoryStores())
+	sqlite := storeScenario(t, NewSQLStores(db, db))
+	if !reflect.DeepEqual(memory, sqlite) {
+		t.Errorf("memory stores saw\n%+v\nSQL stores saw\n%+v", memory, sqlite)
+	}
+
+	want := storeOutcome{
+		Title:       "Sample Flip",
+		Status:      StatusVoting,
+		Host:        "Host",
+		Tags:        []string{"lofi", "drill"},
+		Entries:     []string{"Alice", "Bob"},
+		URLs:        []string{"https://soundcloud.com/alice/second", "https://soundcloud.com/bob/entry"},
+		Stale:       ErrStaleTransition,
+		Votes:       []int{2},
+		Voters:      2,
+		Transitions: []BattleStatus{StatusVoting},
+		Due:         true,
+		Remaining:   []string{"Alice"},
+	}
+	if !reflect.DeepEqual(memory, want) {
+		t.Errorf("memory stores saw\n%+v\nwant\n%+v", memory, want)
+	}
+}
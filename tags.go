@@ -0,0 +1,162 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TagCount is a tag and how many public battles use it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// maxTags is how many tags a battle can have, matching the chips input.
+const maxTags = 3
+
+// maxTagLength is the width of tags.tag.
+const maxTagLength = 64
+
+// tagAliases maps common spellings onto one tag so they share a page.
+var tagAliases = map[string]string{
+	"lo fi":         "lofi",
+	"lo-fi":         "lofi",
+	"hiphop":        "hip-hop",
+	"hip hop":       "hip-hop",
+	"boombap":       "boom-bap",
+	"boom bap":      "boom-bap",
+	"dnb":           "drum-and-bass",
+	"d&b":           "drum-and-bass",
+	"drum and bass": "drum-and-bass",
+	"drum n bass":   "drum-and-bass",
+	"drum & bass":   "drum-and-bass",
+	"rnb":           "r&b",
+	"r and b":       "r&b",
+}
+
+// NormalizeTag lowercases a tag, collapses its whitespace and resolves aliases.
+// It returns "" for a tag that's empty or too long.
+func NormalizeTag(tag string) string {
+	tag = strings.TrimLeft(strings.TrimSpace(html.UnescapeString(tag)), "#")
+	tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+	if alias, ok := tagAliases[tag]; ok {
+		tag = alias
+	}
+
+	if utf8.RuneCountInString(tag) > maxTagLength {
+		return ""
+	}
+	return tag
+}
+
+// NormalizeTags parses the comma separated tags from a battle form, dropping blanks and duplicates.
+func NormalizeTags(tags string) []string {
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, tag := range strings.Split(policy.Sanitize(tags), ",") {
+		tag = NormalizeTag(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+
+		seen[tag] = true
+		normalized = append(normalized, tag)
+		if len(normalized) == maxTags {
+			break
+		}
+	}
+
+	return normalized
+}
+
+// TagsJSON - Returns tags starting with ?q= for the tag inputs to autocomplete, most used first.
+func (app *App) TagsJSON(c echo.Context) error {
+	prefix := NormalizeTag(policy.Sanitize(c.QueryParam("q")))
+
+	tags, err := app.Tags.Search(prefix, 10)
+	if err != nil {
+		log.Println(err)
+		return c.JSON(http.StatusInternalServerError, []TagCount{})
+	}
+
+	return c.JSON(http.StatusOK, tags)
+}
+
+// ViewTags - Shows every tag in use, sized by how many battles use it.
+func (app *App) ViewTags(c echo.Context) error {
+	start := time.Now()
+	me := app.GetUser(c, false)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	tags, err := app.Tags.Cloud(200)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// Scale the font between 1rem and 2.5rem by the log of each count.
+	most := 1
+	for _, tag := range tags {
+		if tag.Count > most {
+			most = tag.Count
+		}
+	}
+	sizes := map[string]string{}
+	for _, tag := range tags {
+		size := 1.0
+		if most > 1 {
+			size += 1.5 * math.Log(float64(tag.Count)) / math.Log(float64(most))
+		}
+		sizes[tag.Tag] = strconv.FormatFloat(size, 'f', 2, 64) + "rem"
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     "Beatbattle.app - Tags",
+			"Analytics": analyticsKey,
+		},
+		"Tags":  tags,
+		"Sizes": sizes,
+		"Me":    me,
+		"Toast": toast,
+		"Ads":   ads,
+	}
+
+	duration := time.Since(start)
+	fmt.Println("ViewTags time: " + duration.String())
+
+	return c.Render(http.StatusOK, "Tags", m)
+}
+
+// RunTags is the `tags reindex` command. It normalizes every battle's tags,
+// rewrites the tags & battles_tags tables from them and reindexes the battle for search.
+func RunTags(app *App, args []string) {
+	if len(args) == 0 || args[0] != "reindex" {
+		fmt.Println("usage: tags reindex")
+		return
+	}
+
+	battles, err := app.Battles.List(BattleQuery{})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, battle := range battles {
+		err = app.Battles.SetTags(battle.ID, NormalizeTags(strings.Join(battle.Tags, ",")))
+		if err != nil {
+			log.Fatal(err)
+		}
+		app.IndexBattle(battle.ID)
+	}
+
+	fmt.Printf("Reindexed tags on %d battles\n", len(battles))
+}
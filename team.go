@@ -0,0 +1,414 @@
+package main
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// MemberRole is what a team member did on an entry.
+type MemberRole string
+
+// Member roles. Entrants are producers unless they pick otherwise.
+const (
+	RoleProducer MemberRole = "producer"
+	RoleVocalist MemberRole = "vocalist"
+	RoleMixer    MemberRole = "mixer"
+)
+
+// MemberStatus is where a team invitation stands.
+type MemberStatus string
+
+// Member statuses. Only accepted members are credited on the entry.
+const (
+	MemberInvited  MemberStatus = "invited"
+	MemberAccepted MemberStatus = "accepted"
+	MemberDeclined MemberStatus = "declined"
+)
+
+// maxTeamMembers caps how many users can be credited on or invited to an entry, the entrant included.
+const maxTeamMembers = 8
+
+// BeatMember is a user credited on, or invited to, a team entry.
+type BeatMember struct {
+	BeatID    int          `json:"beat_id"`
+	User      User         `json:"user"`
+	Role      MemberRole   `json:"role"`
+	Status    MemberStatus `json:"status"`
+	InvitedAt time.Time    `json:"invited_at"`
+}
+
+// TeamInvitation is an entry the logged in user has been invited to, with its entrant.
+type TeamInvitation struct {
+	BeatID int
+	Artist User
+	Role   MemberRole
+}
+
+// TeamView is what the battle page shows a user about the team entries they're on or invited to.
+type TeamView struct {
+	// Entry is the user's entry, as its entrant or an accepted member. Members are everyone on or invited to it.
+	Entry       Beat
+	Members     []BeatMember
+	Invitations []TeamInvitation
+}
+
+// ParseMemberRole reads a role from a form, defaulting to producer.
+func ParseMemberRole(text string) MemberRole {
+	switch MemberRole(text) {
+	case RoleVocalist, RoleMixer:
+		return MemberRole(text)
+	}
+	return RoleProducer
+}
+
+// Credits returns the accepted members of a battle's entries, keyed by beat then user ID.
+func Credits(members []BeatMember) map[int]map[int]bool {
+	credits := map[int]map[int]bool{}
+	for _, member := range members {
+		if member.Status != MemberAccepted {
+			continue
+		}
+		if credits[member.BeatID] == nil {
+			credits[member.BeatID] = map[int]bool{}
+		}
+		credits[member.BeatID][member.User.ID] = true
+	}
+	return credits
+}
+
+// EntryCredits returns who's credited on an entry, entrant first. Entrants who never picked a role are producers.
+func EntryCredits(beat Beat, members []BeatMember) []BeatMember {
+	entrant := BeatMember{BeatID: beat.ID, User: beat.Artist, Role: RoleProducer, Status: MemberAccepted}
+	credits := []BeatMember{}
+	for _, member := range members {
+		if member.BeatID != beat.ID || member.Status != MemberAccepted {
+			continue
+		}
+		if member.User.ID == beat.Artist.ID {
+			entrant.Role = member.Role
+			continue
+		}
+		credits = append(credits, member)
+	}
+	if len(credits) == 0 {
+		return nil
+	}
+
+	return append([]BeatMember{entrant}, credits...)
+}
+
+// creditedEntry returns the entry a user is credited on in a battle, as its entrant or an accepted member.
+func creditedEntry(beats []Beat, credits map[int]map[int]bool, userID int) (Beat, bool) {
+	for _, beat := range beats {
+		if beat.Artist.ID == userID || credits[beat.ID][userID] {
+			return beat, true
+		}
+	}
+	return Beat{}, false
+}
+
+// teamCredits returns the accepted members of a battle's entries, keyed by beat then user ID.
+func (app *App) teamCredits(battleID int) (map[int]map[int]bool, error) {
+	members, err := app.Beats.Members(battleID)
+	if err != nil {
+		return nil, err
+	}
+	return Credits(members), nil
+}
+
+// BattleTeam works out the team entry a user is on in a battle and the invitations they haven't answered.
+func BattleTeam(beats []Beat, members []BeatMember, userID int) TeamView {
+	team := TeamView{}
+	if userID == 0 {
+		return team
+	}
+
+	if entry, ok := creditedEntry(beats, Credits(members), userID); ok {
+		team.Entry = entry
+		for _, member := range members {
+			if member.BeatID == entry.ID {
+				team.Members = append(team.Members, member)
+			}
+		}
+	}
+
+	for _, member := range members {
+		if member.User.ID != userID || member.Status != MemberInvited {
+			continue
+		}
+		for _, beat := range beats {
+			if beat.ID == member.BeatID {
+				team.Invitations = append(team.Invitations, TeamInvitation{BeatID: beat.ID, Artist: beat.Artist, Role: member.Role})
+			}
+		}
+	}
+
+	return team
+}
+
+// saveEntrantRole credits an entrant on their own team entry with the role they picked.
+func (app *App) saveEntrantRole(battle Battle, beatID int, me User, role MemberRole) error {
+	if !battle.Teams {
+		return nil
+	}
+
+	members, err := app.Beats.Members(battle.ID)
+	if err != nil {
+		return err
+	}
+
+	entrant := BeatMember{BeatID: beatID, User: me, Role: role, Status: MemberAccepted, InvitedAt: time.Now()}
+	for _, member := range members {
+		if member.BeatID == beatID && member.User.ID == me.ID {
+			entrant.InvitedAt = member.InvitedAt
+		}
+	}
+
+	return app.Beats.SaveMember(entrant)
+}
+
+// teamBattle loads the battle a team form was posted to with its entries and their members, setting a toast
+// when teams can't be changed. Teams are settled once entry closes.
+func (app *App) teamBattle(c echo.Context) (Battle, []Beat, []BeatMember, bool) {
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return Battle{}, nil, nil, false
+	}
+
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return Battle{}, nil, nil, false
+	}
+	if battle.Status != StatusEntry {
+		SetToast(c, "teamsclosed")
+		return battle, nil, nil, false
+	}
+
+	beats, err := app.Beats.ListByBattle(battleID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return battle, nil, nil, false
+	}
+
+	members, err := app.Beats.Members(battleID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return battle, nil, nil, false
+	}
+
+	return battle, beats, members, true
+}
+
+// InviteMember - Lets an entrant invite a user onto their entry with a role, by profile link or user ID.
+func (app *App) InviteMember(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battle, beats, members, ok := app.teamBattle(c)
+	redirectURL := "/battle/" + c.Param("id")
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+	if !battle.Teams {
+		SetToast(c, "noteams")
+		return c.Redirect(302, redirectURL)
+	}
+
+	entry := Beat{}
+	for _, beat := range beats {
+		if beat.Artist.ID == me.ID {
+			entry = beat
+		}
+	}
+	if entry.ID == 0 {
+		SetToast(c, "nobeat")
+		return c.Redirect(302, redirectURL)
+	}
+
+	// Take the last part of a link like https://beatbattle.app/user/12.
+	user := strings.TrimRight(strings.TrimSpace(c.FormValue("user")), "/")
+	userID, err := strconv.Atoi(user[strings.LastIndex(user, "/")+1:])
+	if err != nil || userID == me.ID {
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	invitee, err := app.Users.Get(userID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	// Users can only be credited on one entry per battle.
+	if _, credited := creditedEntry(beats, Credits(members), userID); credited {
+		SetToast(c, "alreadycredited")
+		return c.Redirect(302, redirectURL)
+	}
+
+	// Entrants who entered before the battle allowed teams are credited as producers.
+	size, entrant := 0, false
+	for _, member := range members {
+		if member.BeatID != entry.ID {
+			continue
+		}
+		if member.User.ID == userID && member.Status == MemberInvited {
+			SetToast(c, "alreadycredited")
+			return c.Redirect(302, redirectURL)
+		}
+		if member.Status != MemberDeclined && member.User.ID != userID {
+			size++
+		}
+		entrant = entrant || member.User.ID == me.ID
+	}
+	if !entrant {
+		size++
+	}
+	if size >= maxTeamMembers {
+		SetToast(c, "teamfull")
+		return c.Redirect(302, redirectURL)
+	}
+	if !entrant {
+		err = app.saveEntrantRole(battle, entry.ID, me, RoleProducer)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, redirectURL)
+		}
+	}
+
+	err = app.Beats.SaveMember(BeatMember{
+		BeatID:    entry.ID,
+		User:      User{ID: invitee.ID},
+		Role:      ParseMemberRole(c.FormValue("role")),
+		Status:    MemberInvited,
+		InvitedAt: time.Now(),
+	})
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "memberinvited")
+	return c.Redirect(302, redirectURL)
+}
+
+// RespondMember - Accepts or declines the logged in user's invitation onto an entry.
+func (app *App) RespondMember(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battle, beats, members, ok := app.teamBattle(c)
+	redirectURL := "/battle/" + c.Param("id")
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+
+	beatID, _ := strconv.Atoi(c.FormValue("beatID"))
+	invited := false
+	for _, member := range members {
+		invited = invited || (member.BeatID == beatID && member.User.ID == me.ID && member.Status == MemberInvited)
+	}
+	if !invited {
+		SetToast(c, "noteaminvite")
+		return c.Redirect(302, redirectURL)
+	}
+
+	status, toast := MemberDeclined, "memberdeclined"
+	if c.FormValue("response") == "accept" {
+		status, toast = MemberAccepted, "memberaccepted"
+
+		if !battle.Teams {
+			SetToast(c, "noteams")
+			return c.Redirect(302, redirectURL)
+		}
+		if _, credited := creditedEntry(beats, Credits(members), me.ID); credited {
+			SetToast(c, "alreadycredited")
+			return c.Redirect(302, redirectURL)
+		}
+	}
+
+	err := app.Beats.RespondMember(beatID, me.ID, status)
+	if err == ErrNotFound {
+		SetToast(c, "noteaminvite")
+		return c.Redirect(302, redirectURL)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, toast)
+	return c.Redirect(302, redirectURL)
+}
+
+// RemoveMember - Lets an entrant take a user off their entry, or a member leave the entry they're on.
+func (app *App) RemoveMember(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	_, beats, members, ok := app.teamBattle(c)
+	redirectURL := "/battle/" + c.Param("id")
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+
+	userID, err := strconv.Atoi(c.FormValue("userID"))
+	if err != nil {
+		SetToast(c, "nouser")
+		return c.Redirect(302, redirectURL)
+	}
+
+	entry, ok := creditedEntry(beats, Credits(members), me.ID)
+	if !ok || userID == entry.Artist.ID || (userID != me.ID && me.ID != entry.Artist.ID) {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err = app.Beats.RemoveMember(entry.ID, userID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	toast := "memberremoved"
+	if userID == me.ID {
+		toast = "teamleft"
+	}
+	SetToast(c, toast)
+	return c.Redirect(302, redirectURL)
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// BattleTemplate is a battle's setup saved by its host to start new battles from.
+type BattleTemplate struct {
+	ID   int
+	Host User
+	// Name tells a host's templates apart. Battles started from the template get Title.
+	Name     string
+	Title    string
+	Rules    string
+	Type     string
+	MaxVotes int
+	Tags     []string
+	// Settings are copied into each battle's own settings, so their ID is never set.
+	Settings  BattleSettings
+	CreatedAt time.Time
+}
+
+// NewBattle returns the setup the submit form starts with when it isn't prefilled.
+func NewBattle() Battle {
+	return Battle{
+		Type:          "Beat",
+		MaxVotes:      3,
+		VotingMode:    VotingApproval,
+		Qualification: QualificationRules{MinVotes: 1},
+	}
+}
+
+// Battle returns a new battle set up from the template, ready for the submit form.
+func (t BattleTemplate) Battle() Battle {
+	battle := NewBattle()
+	battle.Title = html.UnescapeString(t.Title)
+	battle.Rules = html.UnescapeString(t.Rules)
+	battle.Type = strings.Title(t.Type)
+	battle.MaxVotes = t.MaxVotes
+	battle.Tags = t.Tags
+	battle.Settings = t.Settings
+	return battle
+}
+
+// TemplateFromBattle saves a battle's setup as a template.
+func TemplateFromBattle(battle Battle) BattleTemplate {
+	settings := battle.Settings
+	settings.ID = 0
+
+	return BattleTemplate{
+		Host:      battle.Host,
+		Name:      battle.Title,
+		Title:     battle.Title,
+		Rules:     battle.Rules,
+		Type:      strings.ToLower(battle.Type),
+		MaxVotes:  battle.MaxVotes,
+		Tags:      battle.Tags,
+		Settings:  settings,
+		CreatedAt: time.Now(),
+	}
+}
+
+// FormTemplate reads a template from the template form.
+func FormTemplate(c echo.Context) BattleTemplate {
+	battleType := policy.Sanitize(c.FormValue("type"))
+	if battleType != "rap" {
+		battleType = "beat"
+	}
+
+	maxVotes, err := strconv.Atoi(c.FormValue("maxvotes"))
+	if err != nil || maxVotes < 1 {
+		maxVotes = 3
+	}
+
+	settings := FormBattleSettings(c)
+	settings.ID = 0
+
+	title := strings.TrimSpace(policy.Sanitize(c.FormValue("title")))
+	name := parseSeriesTitle(c.FormValue("name"))
+	if name == "" {
+		name = title
+	}
+
+	return BattleTemplate{
+		Name:     name,
+		Title:    title,
+		Rules:    strings.TrimSpace(policy.Sanitize(c.FormValue("rules"))),
+		Type:     battleType,
+		MaxVotes: maxVotes,
+		Tags:     NormalizeTags(c.FormValue("tags")),
+		Settings: settings,
+	}
+}
+
+// prefillBattle works out the setup for the submit form from the template or battle in the query string.
+// Hosts can only start from their own. Cloned battles keep everything but their deadlines.
+func (app *App) prefillBattle(c echo.Context, me User) (Battle, string) {
+	if templateID, err := strconv.Atoi(c.QueryParam("template")); err == nil {
+		template, err := app.Templates.Get(templateID)
+		if err == nil && template.Host.ID == me.ID {
+			return template.Battle(), ""
+		}
+		if err != nil && err != ErrNotFound {
+			log.Println(err)
+		}
+	}
+
+	if battleID, err := strconv.Atoi(c.QueryParam("battle")); err == nil {
+		battle := app.GetBattle(battleID)
+		if battle.Host.ID == me.ID {
+			criteria, err := app.Battles.Criteria(battleID)
+			if err != nil {
+				log.Println(err)
+			}
+
+			battle.ID = 0
+			battle.Status = StatusDraft
+			battle.WinnerID = 0
+			battle.Settings.ID = 0
+			return battle, CriteriaString(criteria)
+		}
+	}
+
+	return NewBattle(), ""
+}
+
+// requestTemplate loads the template a page or form is for, as long as the logged in user saved it.
+func (app *App) requestTemplate(c echo.Context, me User) (BattleTemplate, bool) {
+	templateID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return BattleTemplate{}, false
+	}
+
+	template, err := app.Templates.Get(templateID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return BattleTemplate{}, false
+	}
+
+	if template.Host.ID != me.ID {
+		SetToast(c, "403")
+		return BattleTemplate{}, false
+	}
+
+	return template, true
+}
+
+// UserTemplates - Lists the logged in user's battle templates.
+func (app *App) UserTemplates(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	userID, _ := strconv.Atoi(c.Param("id"))
+	if !me.Authenticated || me.ID != userID {
+		SetToast(c, "403")
+		return c.Redirect(302, "/user/"+c.Param("id"))
+	}
+
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+	user := app.GetUserDB(userID)
+
+	templates, err := app.Templates.ListByHost(me.ID)
+	if err != nil {
+		log.Println(err)
+		templates = []BattleTemplate{}
+	}
+	for i := range templates {
+		templates[i].Name = html.UnescapeString(templates[i].Name)
+		templates[i].Title = html.UnescapeString(templates[i].Title)
+		templates[i].Type = strings.Title(templates[i].Type)
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     user.Name + "'s Templates",
+			"Analytics": analyticsKey,
+		},
+		"Page":      "templates",
+		"Templates": templates,
+		"Me":        me,
+		"User":      user,
+		"Toast":     toast,
+		"Ads":       ads,
+	}
+
+	return c.Render(http.StatusOK, "UserTemplates", m)
+}
+
+// ViewTemplate - Shows the form for a new template, or for editing one of the logged in user's.
+func (app *App) ViewTemplate(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	template := BattleTemplate{Type: "beat", MaxVotes: 3}
+	if c.Param("id") != "" {
+		var ok bool
+		template, ok = app.requestTemplate(c, me)
+		if !ok {
+			return c.Redirect(302, "/user/"+strconv.Itoa(me.ID)+"/templates")
+		}
+		template.Name = html.UnescapeString(template.Name)
+	}
+
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     "Battle Template",
+			"Analytics": analyticsKey,
+		},
+		"Template": template,
+		"Battle":   template.Battle(),
+		"Me":       me,
+		"Toast":    toast,
+		"Ads":      ads,
+	}
+
+	return c.Render(http.StatusOK, "Template", m)
+}
+
+// InsertTemplate - Saves a template from the template form, or from one of the logged in user's battles.
+func (app *App) InsertTemplate(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/templates"
+
+	var template BattleTemplate
+	if c.Param("id") != "" {
+		battleID, _ := strconv.Atoi(c.Param("id"))
+		battle, err := app.Battles.Get(battleID)
+		if err != nil || battle.Host.ID != me.ID {
+			SetToast(c, "404")
+			return c.Redirect(302, "/battle/"+c.Param("id"))
+		}
+		template = TemplateFromBattle(battle)
+	} else {
+		template = FormTemplate(c)
+		template.CreatedAt = time.Now()
+	}
+	template.Host = me
+
+	if template.Name == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	templateID, err := app.Templates.Insert(template)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	duration := time.Since(start)
+	fmt.Println("InsertTemplate time: " + duration.String())
+
+	SetToast(c, "templatesaved")
+	return c.Redirect(302, "/template/"+strconv.Itoa(templateID))
+}
+
+// UpdateTemplate - Saves the template form over one of the logged in user's templates.
+func (app *App) UpdateTemplate(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	current, ok := app.requestTemplate(c, me)
+	if !ok {
+		return c.Redirect(302, "/user/"+strconv.Itoa(me.ID)+"/templates")
+	}
+	redirectURL := "/template/" + strconv.Itoa(current.ID)
+
+	template := FormTemplate(c)
+	template.ID = current.ID
+	template.Host = me
+	if template.Name == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err := app.Templates.Update(template)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "successupdate")
+	return c.Redirect(302, redirectURL)
+}
+
+// DeleteTemplate - Deletes one of the logged in user's templates. Battles started from it are kept.
+func (app *App) DeleteTemplate(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+	redirectURL := "/user/" + strconv.Itoa(me.ID) + "/templates"
+
+	template, ok := app.requestTemplate(c, me)
+	if !ok {
+		return c.Redirect(302, redirectURL)
+	}
+
+	err := app.Templates.Delete(template.ID, me.ID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "templatedeleted")
+	return c.Redirect(302, redirectURL)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TieBreaker decides between entries that finish level.
+type TieBreaker string
+
+// Tie-breakers. Without any, tied entries share a placement, e.g. 1, 1, 3.
+const (
+	// TieJudges favours the entry the judges rated higher. It only applies to judged battles.
+	TieJudges TieBreaker = "judges"
+	// TieLikes favours the entry with more likes.
+	TieLikes TieBreaker = "likes"
+	// TieEarliest favours the entry submitted first, so it always settles a tie.
+	TieEarliest TieBreaker = "earliest"
+	// TieHost leaves entries still tied sharing a placement for the host to settle by hand.
+	TieHost TieBreaker = "host"
+)
+
+// maxTieBreakers is how many tie-breakers a battle can chain. Earliest submission and the host both end a chain.
+const maxTieBreakers = 3
+
+// tieBreakerNames are the tie-breakers as the battle forms list them.
+var tieBreakerNames = map[TieBreaker]string{
+	TieJudges:   "Judge Score",
+	TieLikes:    "Likes",
+	TieEarliest: "Earliest Submission",
+	TieHost:     "Host Decides",
+}
+
+// ParseTieBreakers reads a battle's tie-breakers from a comma separated list, dropping unknowns and
+// duplicates. Nothing can follow the host deciding, so the list stops there.
+func ParseTieBreakers(text string) []TieBreaker {
+	breakers := []TieBreaker{}
+	for _, field := range strings.Split(text, ",") {
+		breaker := TieBreaker(strings.ToLower(strings.TrimSpace(field)))
+		if _, ok := tieBreakerNames[breaker]; !ok || containsTieBreaker(breakers, breaker) {
+			continue
+		}
+
+		breakers = append(breakers, breaker)
+		if breaker == TieHost || breaker == TieEarliest || len(breakers) == maxTieBreakers {
+			break
+		}
+	}
+
+	return breakers
+}
+
+// FormTieBreakers reads the tie-breaker selects from a battle form, first tie-breaker first.
+func FormTieBreakers(c echo.Context) []TieBreaker {
+	params, err := c.FormParams()
+	if err != nil {
+		return []TieBreaker{}
+	}
+	return ParseTieBreakers(strings.Join(params["tie_breakers"], ","))
+}
+
+// TieBreakerSlots pads a battle's tie-breakers out to one per select on the battle form.
+func TieBreakerSlots(breakers []TieBreaker) []string {
+	slots := make([]string, maxTieBreakers)
+	for i, breaker := range breakers {
+		slots[i] = string(breaker)
+	}
+	return slots
+}
+
+// TieBreakersText describes how a battle settles ties for its page.
+func TieBreakersText(breakers []TieBreaker) string {
+	names := []string{}
+	for _, breaker := range breakers {
+		names = append(names, tieBreakerNames[breaker])
+	}
+
+	switch {
+	case len(names) == 0:
+		return "Tied entries share a placement."
+	case breakers[len(breakers)-1] == TieHost && len(names) == 1:
+		return "The host settles ties."
+	case breakers[len(breakers)-1] == TieHost:
+		return "Ties are broken by " + strings.Join(names[:len(names)-1], ", then ") + ", then settled by the host."
+	case breakers[len(breakers)-1] == TieEarliest:
+		return "Ties are broken by " + strings.Join(names, ", then ") + "."
+	}
+	return "Ties are broken by " + strings.Join(names, ", then ") + ". Entries still tied share a placement."
+}
+
+// TieBreakersString writes tie-breakers back out the way ParseTieBreakers reads them.
+func TieBreakersString(breakers []TieBreaker) string {
+	fields := []string{}
+	for _, breaker := range breakers {
+		fields = append(fields, string(breaker))
+	}
+	return strings.Join(fields, ",")
+}
+
+// containsTieBreaker checks if the tie-breaker is already in the list.
+func containsTieBreaker(breakers []TieBreaker, breaker TieBreaker) bool {
+	for _, b := range breakers {
+		if b == breaker {
+			return true
+		}
+	}
+	return false
+}
+
+// placeResults orders results by score, highest first, with disqualified entries last, and numbers the
+// qualified ones. Entries with the same score go through the battle's tie-breakers in order, and entries
+// that are still level share a placement, so the next one skips ahead.
+func (app *App) placeResults(battle Battle, beats []Beat, results []BeatResult, scores map[int]float64) ([]BeatResult, error) {
+	// Every tie-breaker is a list of values where higher wins.
+	submitted := map[int]float64{}
+	for i, beat := range beats {
+		submitted[beat.ID] = float64(len(beats) - i)
+	}
+
+	breakers := []map[int]float64{}
+	for _, breaker := range battle.TieBreakers {
+		switch breaker {
+		case TieJudges:
+			if battle.JudgeWeight == 0 {
+				continue
+			}
+			tallies, err := app.Results.Tallies(battle.ID)
+			if err != nil {
+				return nil, err
+			}
+			judges := map[int]float64{}
+			for _, tally := range tallies {
+				judges[tally.BeatID] = tally.Judges
+			}
+			breakers = append(breakers, judges)
+		case TieLikes:
+			likes, err := app.Votes.LikeCounts(battle.ID)
+			if err != nil {
+				return nil, err
+			}
+			counts := map[int]float64{}
+			for beatID, count := range likes {
+				counts[beatID] = float64(count)
+			}
+			breakers = append(breakers, counts)
+		case TieEarliest:
+			breakers = append(breakers, submitted)
+		}
+	}
+
+	// compare is above zero when a places ahead of b, and zero when they're tied.
+	compare := func(a, b BeatResult) float64 {
+		if diff := scores[a.BeatID] - scores[b.BeatID]; diff != 0 {
+			return diff
+		}
+		for _, values := range breakers {
+			if diff := values[a.BeatID] - values[b.BeatID]; diff != 0 {
+				return diff
+			}
+		}
+		return 0
+	}
+
+	// Ties that are never settled keep submission order on the page.
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Voted != b.Voted {
+			return a.Voted
+		}
+		if diff := compare(a, b); diff != 0 {
+			return diff > 0
+		}
+		return submitted[a.BeatID] > submitted[b.BeatID]
+	})
+
+	for i := range results {
+		results[i].Placement = 0
+		if !results[i].Voted {
+			continue
+		}
+
+		results[i].Placement = i + 1
+		if i > 0 && results[i-1].Voted && compare(results[i-1], results[i]) == 0 {
+			results[i].Placement = results[i-1].Placement
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestParseTieBreakers(t *testing.T) {
+	tests := []struct {
+		text     string
+		breakers []TieBreaker
+	}{
+		{"", []TieBreaker{}},
+		{"likes, Judges", []TieBreaker{TieLikes, TieJudges}},
+		{"likes, bogus, likes, judges", []TieBreaker{TieLikes, TieJudges}},
+		// Earliest submission and the host both settle every tie, so nothing comes after them.
+		{"earliest, likes", []TieBreaker{TieEarliest}},
+		{"likes, host, judges", []TieBreaker{TieLikes, TieHost}},
+		{"judges, likes, judges, bogus, earliest, host", []TieBreaker{TieJudges, TieLikes, TieEarliest}},
+	}
+	for _, test := range tests {
+		breakers := ParseTieBreakers(test.text)
+		if !reflect.DeepEqual(breakers, test.breakers) {
+			t.Errorf("ParseTieBreakers(%q) = %v, want %v", test.text, breakers, test.breakers)
+		}
+	}
+}
+
+func TestPlaceResults(t *testing.T) {
+	app := testApp(t)
+	host := testUser(t, app, "Host")
+	battle := testBattle(t, app, host, StatusVoting)
+	beats := []Beat{}
+	for i := 1; i <= 4; i++ {
+		beats = append(beats, testEntry(t, app, battle, testUser(t, app, "Artist "+strconv.Itoa(i))))
+	}
+	first, second, third, fourth := beats[0].ID, beats[1].ID, beats[2].ID, beats[3].ID
+
+	// The third entry is liked most, then the second. The judges rate the second highest.
+	for _, like := range []struct{ beatID, userID int }{{third, beats[0].Artist.ID}, {third, beats[1].Artist.ID}, {second, beats[2].Artist.ID}} {
+		err := app.Votes.AddLike(battle.ID, like.beatID, like.userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err := app.Results.SaveTallies(battle.ID, []JudgeTally{{BeatID: first, Judges: 5}, {BeatID: second, Judges: 8}, {BeatID: third, Judges: 5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first three entries tie on score, ahead of the fourth.
+	scores := map[int]float64{first: 3, second: 3, third: 3, fourth: 1}
+	tests := []struct {
+		name         string
+		breakers     []TieBreaker
+		judgeWeight  int
+		disqualified int
+		// placements are in finishing order, as beat ID and placement pairs.
+		placements [][2]int
+	}{
+		{"shared", nil, 0, 0, [][2]int{{first, 1}, {second, 1}, {third, 1}, {fourth, 4}}},
+		{"host decides", []TieBreaker{TieHost}, 0, 0, [][2]int{{first, 1}, {second, 1}, {third, 1}, {fourth, 4}}},
+		{"likes", []TieBreaker{TieLikes}, 0, 0, [][2]int{{third, 1}, {second, 2}, {first, 3}, {fourth, 4}}},
+		{"earliest", []TieBreaker{TieEarliest}, 0, 0, [][2]int{{first, 1}, {second, 2}, {third, 3}, {fourth, 4}}},
+		{"judges in an unjudged battle", []TieBreaker{TieJudges}, 0, 0, [][2]int{{first, 1}, {second, 1}, {third, 1}, {fourth, 4}}},
+		{"judges leave a tie", []TieBreaker{TieJudges}, 50, 0, [][2]int{{second, 1}, {first, 2}, {third, 2}, {fourth, 4}}},
+		{"judges then likes", []TieBreaker{TieJudges, TieLikes}, 50, 0, [][2]int{{second, 1}, {third, 2}, {first, 3}, {fourth, 4}}},
+		{"likes then earliest", []TieBreaker{TieLikes, TieEarliest}, 0, 0, [][2]int{{third, 1}, {second, 2}, {first, 3}, {fourth, 4}}},
+		{"disqualified last", nil, 0, first, [][2]int{{second, 1}, {third, 1}, {fourth, 3}, {first, 0}}},
+	}
+	for _, test := range tests {
+		battle.TieBreakers = test.breakers
+		battle.JudgeWeight = test.judgeWeight
+		results := []BeatResult{}
+		for _, beat := range beats {
+			results = append(results, BeatResult{BeatID: beat.ID, Voted: beat.ID != test.disqualified})
+		}
+
+		results, err := app.placeResults(battle, beats, results, scores)
+		if err != nil {
+			t.Fatal(err)
+		}
+		placements := [][2]int{}
+		for _, result := range results {
+			placements = append(placements, [2]int{result.BeatID, result.Placement})
+		}
+		if !reflect.DeepEqual(placements, test.placements) {
+			t.Errorf("%s: placements = %v, want %v", test.name, placements, test.placements)
+		}
+	}
+}
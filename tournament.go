@@ -0,0 +1,706 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gomarkdown/markdown"
+	"github.com/labstack/echo/v4"
+)
+
+// TournamentFormat is how many losses knock an entrant out of a tournament.
+type TournamentFormat string
+
+// Tournament formats.
+const (
+	FormatSingle TournamentFormat = "single"
+	FormatDouble TournamentFormat = "double"
+)
+
+// TournamentSeeding is how entrants are seeded when a tournament starts.
+type TournamentSeeding string
+
+// Seedings. Rating seeds by the entrants' rating in the tournament's battle type, unrated entrants last.
+const (
+	SeedSignup TournamentSeeding = "signup"
+	SeedRating TournamentSeeding = "rating"
+)
+
+// TournamentStatus is the stage a tournament is in.
+type TournamentStatus string
+
+// Tournament statuses, in order.
+const (
+	TournamentSignup   TournamentStatus = "signup"
+	TournamentRunning  TournamentStatus = "running"
+	TournamentComplete TournamentStatus = "complete"
+)
+
+// MatchDecision is how a match's winner was decided.
+type MatchDecision string
+
+// Match decisions.
+const (
+	DecidedBattle MatchDecision = "battle"
+	// DecidedNoShow matches were won by the only player to enter, or by the higher seed when neither did.
+	DecidedNoShow MatchDecision = "noshow"
+	DecidedHost   MatchDecision = "host"
+)
+
+// Tournament entrant limits. 64 entrants fill a six round bracket.
+const (
+	minTournamentEntrants = 2
+	maxTournamentEntrants = 64
+)
+
+// Default and longest entry & voting periods of a tournament's matches, in hours.
+const (
+	defaultEntryHours  = 72
+	defaultVotingHours = 48
+	maxMatchHours      = 720
+)
+
+// ErrTournamentStarted is returned when a tournament has already left signups.
+var ErrTournamentStarted = errors.New("tournament already started")
+
+// Tournament is an elimination bracket of head-to-head battles run by one host.
+type Tournament struct {
+	ID      int
+	Host    User
+	Title   string
+	Rules   string
+	Type    string
+	Format  TournamentFormat
+	Seeding TournamentSeeding
+	// EntryHours and VotingHours are how long each match's battle is open for entries, then votes.
+	EntryHours  int
+	VotingHours int
+	Status      TournamentStatus
+	WinnerID    int
+	CreatedAt   time.Time
+}
+
+// TournamentEntrant is a user signed up to a tournament. Seed is 0 until the tournament starts.
+type TournamentEntrant struct {
+	User     User
+	Seed     int
+	JoinedAt time.Time
+}
+
+// TournamentMatch is a match that has been played, or is being, with the battle deciding it.
+type TournamentMatch struct {
+	ID           int
+	TournamentID int
+	Side         BracketSide
+	Round        int
+	Position     int
+	BattleID     int
+	Players      [2]int
+	WinnerID     int
+	DecidedBy    MatchDecision
+	CreatedAt    time.Time
+}
+
+// ParseTournamentFormat reads a tournament format, defaulting to single elimination.
+func ParseTournamentFormat(text string) TournamentFormat {
+	if TournamentFormat(text) == FormatDouble {
+		return FormatDouble
+	}
+	return FormatSingle
+}
+
+// ParseSeeding reads a tournament's seeding, defaulting to signup order.
+func ParseSeeding(text string) TournamentSeeding {
+	if TournamentSeeding(text) == SeedRating {
+		return SeedRating
+	}
+	return SeedSignup
+}
+
+// parseMatchHours reads an entry or voting period, falling back to the default when it's out of range.
+func parseMatchHours(text string, fallback int) int {
+	hours, err := strconv.Atoi(text)
+	if err != nil || hours < 1 || hours > maxMatchHours {
+		return fallback
+	}
+	return hours
+}
+
+// SeedEntrants orders a tournament's entrants by seed. Ties keep signup order.
+func (app *App) SeedEntrants(tournament Tournament, entrants []TournamentEntrant) ([]TournamentEntrant, error) {
+	seeded := append([]TournamentEntrant(nil), entrants...)
+	if tournament.Seeding != SeedRating {
+		return seeded, nil
+	}
+
+	userIDs := []int{}
+	for _, entrant := range seeded {
+		userIDs = append(userIDs, entrant.User.ID)
+	}
+	ratings, err := app.Ratings.Get(strings.ToLower(tournament.Type), userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(seeded, func(i, j int) bool {
+		a, aRated := ratings[seeded[i].User.ID]
+		b, bRated := ratings[seeded[j].User.ID]
+		if aRated != bRated {
+			return aRated
+		}
+		return a.Rating > b.Rating
+	})
+	return seeded, nil
+}
+
+// TournamentBracket works out a tournament's bracket from its entrants and matches.
+func (app *App) TournamentBracket(tournament Tournament) (Bracket, []TournamentEntrant, error) {
+	entrants, err := app.Tournaments.Entrants(tournament.ID)
+	if err != nil {
+		return Bracket{}, nil, err
+	}
+
+	matches, err := app.Tournaments.Matches(tournament.ID)
+	if err != nil {
+		return Bracket{}, nil, err
+	}
+
+	return BuildBracket(tournament.Format, entrants, matches), entrants, nil
+}
+
+// SyncTournament brings a running tournament up to date with its bracket. Every match that's ready gets a
+// battle, a match whose players changed after a host override swaps them over, and the tournament is
+// complete once it has a champion.
+func (app *App) SyncTournament(tournamentID int) error {
+	tournament, err := app.Tournaments.Get(tournamentID)
+	if err != nil {
+		return err
+	}
+	if tournament.Status == TournamentSignup {
+		return nil
+	}
+
+	bracket, _, err := app.TournamentBracket(tournament)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range bracket.Ready() {
+		players := [2]int{m.Slots[0].User.ID, m.Slots[1].User.ID}
+		if m.Match.ID == 0 {
+			err = app.startMatch(tournament, bracket, m)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if m.Match.Players == players {
+			continue
+		}
+
+		// Whoever was replaced can't stay entered in the match's battle.
+		for _, userID := range m.Match.Players {
+			if userID != players[0] && userID != players[1] && m.Match.BattleID != 0 {
+				err = app.Beats.Delete(m.Match.BattleID, userID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		m.Match.Players = players
+		m.Match.WinnerID = 0
+		m.Match.DecidedBy = ""
+		err = app.Tournaments.UpdateMatch(m.Match)
+		if err != nil {
+			return err
+		}
+	}
+
+	status, winnerID := TournamentRunning, 0
+	if bracket.Champion.User.ID != 0 {
+		status, winnerID = TournamentComplete, bracket.Champion.User.ID
+	}
+	if status != tournament.Status || winnerID != tournament.WinnerID {
+		return app.Tournaments.SetStatus(tournament.ID, status, winnerID)
+	}
+	return nil
+}
+
+// startMatch opens a ready match's battle, which only its two players can enter.
+func (app *App) startMatch(tournament Tournament, bracket Bracket, m *BracketMatch) error {
+	title := html.UnescapeString(tournament.Title) + " - " + bracket.RoundName(m.Key)
+	if round, ok := bracket.Round(m.Key); ok && len(round.Matches) > 1 {
+		title += ", Match " + strconv.Itoa(m.Key.Position)
+	}
+
+	deadline := time.Now().Add(time.Duration(tournament.EntryHours) * time.Hour)
+	battle := Battle{
+		Title:          policy.Sanitize(title),
+		Rules:          policy.Sanitize(tournament.Rules + "\n\n" + m.Slots[0].User.Name + " vs " + m.Slots[1].User.Name + ". Only they can enter."),
+		Deadline:       deadline,
+		VotingDeadline: deadline.Add(time.Duration(tournament.VotingHours) * time.Hour),
+		Host:           tournament.Host,
+		MaxVotes:       1,
+		VotingMode:     VotingApproval,
+		Type:           tournament.Type,
+		Status:         StatusEntry,
+		Tags:           []string{},
+		TieBreakers:    []TieBreaker{TieLikes, TieEarliest},
+	}
+
+	battleID, err := app.Battles.Insert(battle)
+	if err != nil {
+		return err
+	}
+	app.IndexBattle(battleID)
+
+	err = app.Battles.RecordTransition(battleID, "", StatusEntry, TriggerScheduler, 0, "Tournament match")
+	if err != nil {
+		log.Println(err)
+	}
+
+	_, err = app.Tournaments.InsertMatch(TournamentMatch{
+		TournamentID: tournament.ID,
+		Side:         m.Key.Side,
+		Round:        m.Key.Round,
+		Position:     m.Key.Position,
+		BattleID:     battleID,
+		Players:      [2]int{m.Slots[0].User.ID, m.Slots[1].User.ID},
+		CreatedAt:    time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	app.WakeScheduler()
+	return nil
+}
+
+// AdvanceTournament decides a tournament match once its battle is complete and moves the winner on.
+// A match the host already decided is left alone.
+func (app *App) AdvanceTournament(battle Battle) error {
+	match, err := app.Tournaments.MatchByBattle(battle.ID)
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if match.WinnerID != 0 {
+		return nil
+	}
+
+	match.WinnerID, match.DecidedBy = battle.WinnerID, DecidedBattle
+	if match.WinnerID != match.Players[0] && match.WinnerID != match.Players[1] {
+		match.WinnerID, match.DecidedBy, err = app.noShowWinner(match)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = app.Tournaments.UpdateMatch(match)
+	if err != nil {
+		return err
+	}
+
+	return app.SyncTournament(match.TournamentID)
+}
+
+// noShowWinner decides a match nobody placed in. The only player who entered goes through, and when
+// neither did the higher seed does.
+func (app *App) noShowWinner(match TournamentMatch) (int, MatchDecision, error) {
+	beats, err := app.Beats.ListByBattle(match.BattleID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	entered := map[int]bool{}
+	for _, beat := range beats {
+		entered[beat.Artist.ID] = true
+	}
+	if entered[match.Players[0]] != entered[match.Players[1]] {
+		if entered[match.Players[1]] {
+			return match.Players[1], DecidedNoShow, nil
+		}
+		return match.Players[0], DecidedNoShow, nil
+	}
+
+	entrants, err := app.Tournaments.Entrants(match.TournamentID)
+	if err != nil {
+		return 0, "", err
+	}
+	for _, entrant := range entrants {
+		if entrant.User.ID == match.Players[0] || entrant.User.ID == match.Players[1] {
+			return entrant.User.ID, DecidedNoShow, nil
+		}
+	}
+	return match.Players[0], DecidedNoShow, nil
+}
+
+// BattleTournament returns the tournament a battle is a match in, or an empty one.
+func (app *App) BattleTournament(battleID int) Tournament {
+	match, err := app.Tournaments.MatchByBattle(battleID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		return Tournament{}
+	}
+
+	tournament, err := app.Tournaments.Get(match.TournamentID)
+	if err != nil {
+		log.Println(err)
+		return Tournament{}
+	}
+
+	tournament.Title = html.UnescapeString(tournament.Title)
+	return tournament
+}
+
+// requestTournament loads the tournament a page or form is for, setting a toast when it doesn't exist.
+func (app *App) requestTournament(c echo.Context) (Tournament, bool) {
+	tournamentID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return Tournament{}, false
+	}
+
+	tournament, err := app.Tournaments.Get(tournamentID)
+	if err != nil {
+		if err != ErrNotFound {
+			log.Println(err)
+		}
+		SetToast(c, "404")
+		return Tournament{}, false
+	}
+
+	return tournament, true
+}
+
+// ViewTournaments - Lists the latest tournaments, with a form to start one.
+func (app *App) ViewTournaments(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	tournaments, err := app.Tournaments.List(50)
+	if err != nil {
+		log.Println(err)
+		tournaments = []Tournament{}
+	}
+	for i := range tournaments {
+		tournaments[i].Title = html.UnescapeString(tournaments[i].Title)
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     "Beatbattle.app - Tournaments",
+			"Analytics": analyticsKey,
+		},
+		"Tournaments":        tournaments,
+		"DefaultEntryHours":  defaultEntryHours,
+		"DefaultVotingHours": defaultVotingHours,
+		"Me":                 me,
+		"Toast":              toast,
+		"Ads":                ads,
+	}
+
+	return c.Render(http.StatusOK, "Tournaments", m)
+}
+
+// InsertTournament - Opens signups for a new tournament hosted by the logged in user.
+func (app *App) InsertTournament(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battleType := policy.Sanitize(c.FormValue("type"))
+	if battleType != "beat" && battleType != "rap" {
+		SetToast(c, "invalidtype")
+		return c.Redirect(302, "/tournaments")
+	}
+
+	tournament := Tournament{
+		Host:        me,
+		Title:       parseSeriesTitle(c.FormValue("title")),
+		Rules:       strings.TrimSpace(policy.Sanitize(c.FormValue("rules"))),
+		Type:        battleType,
+		Format:      ParseTournamentFormat(c.FormValue("format")),
+		Seeding:     ParseSeeding(c.FormValue("seeding")),
+		EntryHours:  parseMatchHours(c.FormValue("entry_hours"), defaultEntryHours),
+		VotingHours: parseMatchHours(c.FormValue("voting_hours"), defaultVotingHours),
+		Status:      TournamentSignup,
+		CreatedAt:   time.Now(),
+	}
+	if tournament.Title == "" || tournament.Rules == "" {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, "/tournaments")
+	}
+
+	tournamentID, err := app.Tournaments.Insert(tournament)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, "/tournaments")
+	}
+
+	SetToast(c, "successadd")
+	return c.Redirect(302, "/tournament/"+strconv.Itoa(tournamentID))
+}
+
+// ViewTournament - Shows a tournament's entrants and bracket.
+func (app *App) ViewTournament(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, false)
+
+	tournament, ok := app.requestTournament(c)
+	if !ok {
+		return c.Redirect(302, "/tournaments")
+	}
+	toast := GetToast(c)
+	ads := app.GetAdvertisements()
+
+	tournament.Title = html.UnescapeString(tournament.Title)
+	md := []byte(html.UnescapeString(tournament.Rules))
+	rules := template.HTML(markdown.ToHTML(md, nil, nil))
+
+	bracket, entrants, err := app.TournamentBracket(tournament)
+	if err != nil {
+		log.Println(err)
+		entrants = []TournamentEntrant{}
+	}
+
+	joined := false
+	for _, entrant := range entrants {
+		if entrant.User.ID == me.ID {
+			joined = true
+		}
+	}
+
+	m := map[string]interface{}{
+		"Meta": map[string]interface{}{
+			"Title":     tournament.Title,
+			"Analytics": analyticsKey,
+		},
+		"Tournament": tournament,
+		"Rules":      rules,
+		"Entrants":   entrants,
+		"Bracket":    bracket,
+		"Joined":     joined,
+		"IsOwner":    me.Authenticated && me.ID == tournament.Host.ID,
+		"Me":         me,
+		"Toast":      toast,
+		"Ads":        ads,
+	}
+
+	duration := time.Since(start)
+	fmt.Println("ViewTournament time: " + duration.String())
+
+	return c.Render(http.StatusOK, "Tournament", m)
+}
+
+// JoinTournament - Signs the logged in user up to a tournament, or takes them off it.
+func (app *App) JoinTournament(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	tournament, ok := app.requestTournament(c)
+	if !ok {
+		return c.Redirect(302, "/tournaments")
+	}
+	redirectURL := "/tournament/" + strconv.Itoa(tournament.ID)
+
+	if tournament.Status != TournamentSignup {
+		SetToast(c, "signupsclosed")
+		return c.Redirect(302, redirectURL)
+	}
+
+	if c.Path() == "/tournament/:id/leave" {
+		err := app.Tournaments.Leave(tournament.ID, me.ID)
+		if err != nil {
+			log.Println(err)
+			SetToast(c, "502")
+			return c.Redirect(302, redirectURL)
+		}
+		SetToast(c, "tournamentleft")
+		return c.Redirect(302, redirectURL)
+	}
+
+	entrants, err := app.Tournaments.Entrants(tournament.ID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	for _, entrant := range entrants {
+		if entrant.User.ID == me.ID {
+			return c.Redirect(302, redirectURL)
+		}
+	}
+	if len(entrants) >= maxTournamentEntrants {
+		SetToast(c, "tournamentfull")
+		return c.Redirect(302, redirectURL)
+	}
+
+	err = app.Tournaments.Join(tournament.ID, me.ID, time.Now())
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "tournamentjoined")
+	return c.Redirect(302, redirectURL)
+}
+
+// StartTournament - Closes a tournament's signups, seeds its entrants and opens the first round's battles.
+func (app *App) StartTournament(c echo.Context) error {
+	start := time.Now()
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	tournament, ok := app.requestTournament(c)
+	if !ok {
+		return c.Redirect(302, "/tournaments")
+	}
+	redirectURL := "/tournament/" + strconv.Itoa(tournament.ID)
+
+	if tournament.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	entrants, err := app.Tournaments.Entrants(tournament.ID)
+	if err == nil {
+		entrants, err = app.SeedEntrants(tournament, entrants)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	if len(entrants) < minTournamentEntrants {
+		SetToast(c, "fewentrants")
+		return c.Redirect(302, redirectURL)
+	}
+
+	seeds := []int{}
+	for _, entrant := range entrants {
+		seeds = append(seeds, entrant.User.ID)
+	}
+	err = app.Tournaments.Start(tournament.ID, seeds)
+	if err == ErrTournamentStarted {
+		SetToast(c, "signupsclosed")
+		return c.Redirect(302, redirectURL)
+	}
+	if err == nil {
+		err = app.SyncTournament(tournament.ID)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	duration := time.Since(start)
+	fmt.Println("StartTournament time: " + duration.String())
+
+	SetToast(c, "tournamentstarted")
+	return c.Redirect(302, redirectURL)
+}
+
+// OverrideMatch - Lets a tournament's host decide a match themselves, e.g. after a no-show or a dispute.
+// A match can't be changed once a later match that depends on it has been decided.
+func (app *App) OverrideMatch(c echo.Context) error {
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	tournament, ok := app.requestTournament(c)
+	if !ok {
+		return c.Redirect(302, "/tournaments")
+	}
+	redirectURL := "/tournament/" + strconv.Itoa(tournament.ID)
+
+	if tournament.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	round, _ := strconv.Atoi(c.FormValue("round"))
+	position, _ := strconv.Atoi(c.FormValue("position"))
+	winnerID, _ := strconv.Atoi(c.FormValue("winner"))
+	key := MatchKey{BracketSide(c.FormValue("side")), round, position}
+
+	bracket, _, err := app.TournamentBracket(tournament)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	m, ok := bracket.Match(key)
+	if !ok || m.Match.ID == 0 || (m.State != MatchReady && m.State != MatchDecided) {
+		SetToast(c, "404")
+		return c.Redirect(302, redirectURL)
+	}
+	if m.Locked {
+		SetToast(c, "matchlocked")
+		return c.Redirect(302, redirectURL)
+	}
+	if winnerID != m.Slots[0].User.ID && winnerID != m.Slots[1].User.ID {
+		SetToast(c, "validationerror")
+		return c.Redirect(302, redirectURL)
+	}
+
+	m.Match.WinnerID, m.Match.DecidedBy = winnerID, DecidedHost
+	err = app.Tournaments.UpdateMatch(m.Match)
+	if err == nil {
+		err = app.SyncTournament(tournament.ID)
+	}
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+
+	SetToast(c, "successupdate")
+	return c.Redirect(302, redirectURL)
+}
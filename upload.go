@@ -0,0 +1,356 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// UploadFormat is an audio format entries can be uploaded as.
+type UploadFormat struct {
+	Ext  string
+	Type string
+	// Limit is the largest file of the format accepted, in bytes.
+	Limit int64
+}
+
+// uploadFormats are the formats entries can be uploaded as. Lossless files get more room.
+var uploadFormats = []UploadFormat{
+	{Ext: "mp3", Type: "audio/mpeg", Limit: 25 << 20},
+	{Ext: "flac", Type: "audio/flac", Limit: 100 << 20},
+	{Ext: "wav", Type: "audio/wav", Limit: 150 << 20},
+}
+
+// maxEntryForm is the largest beat form accepted, the largest upload plus room for the other fields.
+var maxEntryForm = int64(150<<20) + 1<<20
+
+// transferTimeout is how long uploading, streaming or downloading entries can take. The server's own
+// timeouts are kept short for every other route.
+const transferTimeout = 30 * time.Minute
+
+// BeatFile is an entry's uploaded audio, kept in the app's file storage.
+type BeatFile struct {
+	Key  string `json:"-"`
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	Type string `json:"type"`
+}
+
+// Upload is an audio file sent with a beat form, checked and analysed but not stored yet.
+type Upload struct {
+	Header *multipart.FileHeader
+	Format UploadFormat
+	Info   AudioInfo
+}
+
+// SniffAudio works out an upload's format from its first bytes, whatever it's named.
+func SniffAudio(head []byte) (UploadFormat, bool) {
+	ext := ""
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		ext = "flac"
+	case len(head) >= 12 && bytes.HasPrefix(head, []byte("RIFF")) && string(head[8:12]) == "WAVE":
+		ext = "wav"
+	case bytes.HasPrefix(head, []byte("ID3")):
+		ext = "mp3"
+	// An MPEG audio frame sync without an ID3 tag. Layer bits of 00 are AAC, not MP3.
+	case len(head) >= 2 && head[0] == 0xFF && head[1]&0xE0 == 0xE0 && head[1]&0x06 != 0:
+		ext = "mp3"
+	}
+
+	for _, format := range uploadFormats {
+		if format.Ext == ext {
+			return format, true
+		}
+	}
+	return UploadFormat{}, false
+}
+
+// AllowsUploads reports whether a battle's entries can be uploaded. Battles whose entries aren't audio can't,
+// nor can battles narrowed to certain track hosts, since an upload isn't on any of them.
+func AllowsUploads(battle Battle) bool {
+	if len(battle.TrackHosts) > 0 {
+		return false
+	}
+	_, ok := typeTrackHosts[strings.ToLower(battle.Type)]
+	return !ok
+}
+
+// LongTransfer gives a route's requests transferTimeout to be read and answered, instead of the server's timeouts.
+func LongTransfer(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		deadline := time.Now().Add(transferTimeout)
+		controller := http.NewResponseController(c.Response().Writer)
+		err := controller.SetReadDeadline(deadline)
+		if err == nil {
+			err = controller.SetWriteDeadline(deadline)
+		}
+		if err != nil {
+			log.Println(err)
+		}
+		return next(c)
+	}
+}
+
+// ReadEntryForm reads a beat form, capping its size so oversized uploads are turned away while they're sent.
+// It returns the toast for a form that can't be read, or "" if it's fine. Call it before anything reads the form.
+func ReadEntryForm(c echo.Context) string {
+	req := c.Request()
+	req.Body = http.MaxBytesReader(c.Response(), req.Body, maxEntryForm)
+
+	err := req.ParseMultipartForm(32 << 20)
+	if err == http.ErrNotMultipart {
+		err = req.ParseForm()
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return "uploadsize"
+	}
+	if err != nil {
+		log.Println(err)
+		return "validationerror"
+	}
+	return ""
+}
+
+// ReadUpload checks and analyses the audio file sent with a beat form. It returns nil if there wasn't one,
+// or the toast for why it can't be entered.
+func ReadUpload(c echo.Context, battle Battle) (*Upload, string) {
+	header, err := c.FormFile("audio")
+	if err == http.ErrMissingFile || err == http.ErrNotMultipart {
+		return nil, ""
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, "badaudio"
+	}
+	if !AllowsUploads(battle) {
+		return nil, "noupload"
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		log.Println(err)
+		return nil, "badaudio"
+	}
+	defer file.Close()
+
+	head := make([]byte, 12)
+	n, _ := io.ReadFull(file, head)
+	format, ok := SniffAudio(head[:n])
+	if !ok {
+		return nil, "badaudio"
+	}
+	if header.Size > format.Limit {
+		return nil, "uploadsize"
+	}
+
+	info, err := AnalyseAudio(file)
+	if err != nil {
+		log.Println(err)
+		return nil, "badaudio"
+	}
+
+	return &Upload{Header: header, Format: format, Info: info}, ""
+}
+
+// StoreUpload keeps an entrant's upload in file storage under a key of its own, so replacing an entry
+// never overwrites the file it's replacing.
+func (app *App) StoreUpload(upload *Upload, battleID int, userID int) (BeatFile, error) {
+	file, err := upload.Header.Open()
+	if err != nil {
+		return BeatFile{}, err
+	}
+	defer file.Close()
+
+	stored := BeatFile{
+		Key:  "battles/" + strconv.Itoa(battleID) + "/" + strconv.Itoa(userID) + "-" + RandString(12) + "." + upload.Format.Ext,
+		Name: policy.Sanitize(path.Base(strings.ReplaceAll(upload.Header.Filename, "\\", "/"))),
+		Size: upload.Header.Size,
+		Type: upload.Format.Type,
+	}
+
+	err = app.Files.Put(stored.Key, file, stored.Size, stored.Type)
+	return stored, err
+}
+
+// UploadTrack is how an uploaded entry plays, streamed from the site.
+func UploadTrack(battleID int, beatID int) ResolvedTrack {
+	audioURL := "/battle/" + strconv.Itoa(battleID) + "/audio/" + strconv.Itoa(beatID)
+	return ResolvedTrack{
+		URL:   audioURL,
+		Embed: TrackEmbed{Provider: "upload", URL: audioURL, Height: 54},
+	}
+}
+
+// StreamBeat plays an uploaded entry, honouring Range requests so players can seek.
+// Until voting opens only the entry's team and the battle's host can listen.
+func (app *App) StreamBeat(c echo.Context) error {
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+	beatID, err := strconv.Atoi(c.Param("beat"))
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	beat, err := app.Beats.Get(beatID)
+	if err != nil || beat.BattleID != battleID || beat.File.Key == "" {
+		return c.NoContent(http.StatusNotFound)
+	}
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		return c.NoContent(http.StatusNotFound)
+	}
+
+	if battle.Status == StatusDraft || battle.Status == StatusEntry {
+		me := app.GetUser(c, false)
+		credits, err := app.teamCredits(battleID)
+		if err != nil {
+			log.Println(err)
+			return c.NoContent(http.StatusBadGateway)
+		}
+		if !me.Authenticated || (me.ID != beat.Artist.ID && me.ID != battle.Host.ID && !credits[beat.ID][me.ID]) {
+			return c.NoContent(http.StatusForbidden)
+		}
+	}
+
+	file, err := app.Files.Open(beat.File.Key)
+	if err == ErrNotFound {
+		return c.NoContent(http.StatusNotFound)
+	}
+	if err != nil {
+		log.Println(err)
+		return c.NoContent(http.StatusBadGateway)
+	}
+	defer file.Close()
+
+	c.Response().Header().Set(echo.HeaderContentType, beat.File.Type)
+	http.ServeContent(c.Response(), c.Request(), "", file.ModTime, file)
+	return nil
+}
+
+// DownloadEntries sends a battle's host every entry in one zip. Uploaded entries are in it as files,
+// numbered in the order they were entered, and linked entries are listed in links.txt.
+func (app *App) DownloadEntries(c echo.Context) error {
+	me := app.GetUser(c, false)
+	if !me.Authenticated {
+		SetToast(c, "relog")
+		return c.Redirect(302, "/login")
+	}
+
+	battleID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+	redirectURL := "/battle/" + strconv.Itoa(battleID)
+
+	battle, err := app.Battles.Get(battleID)
+	if err != nil {
+		SetToast(c, "404")
+		return c.Redirect(302, "/")
+	}
+	if battle.Host.ID != me.ID {
+		SetToast(c, "403")
+		return c.Redirect(302, redirectURL)
+	}
+
+	beats, err := app.Beats.ListByBattle(battleID)
+	if err != nil {
+		log.Println(err)
+		SetToast(c, "502")
+		return c.Redirect(302, redirectURL)
+	}
+	if len(beats) == 0 {
+		SetToast(c, "noentries")
+		return c.Redirect(302, redirectURL)
+	}
+
+	start := time.Now()
+	c.Response().Header().Set(echo.HeaderContentType, "application/zip")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="battle-`+strconv.Itoa(battleID)+`-entries.zip"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	// Audio is already compressed, so files are stored as they are.
+	archive := zip.NewWriter(c.Response())
+	links := strings.Builder{}
+	for i, beat := range beats {
+		name := fmt.Sprintf("%02d - %s", i+1, archiveName(beat.Artist.Name))
+		if beat.File.Key == "" {
+			links.WriteString(name + ": " + beat.URL + "\r\n")
+			continue
+		}
+
+		err = app.archiveFile(archive, name+path.Ext(beat.File.Key), beat.File.Key)
+		if err != nil {
+			// The headers are sent, so all that's left is to cut the download short.
+			log.Println(err)
+			return nil
+		}
+	}
+
+	if links.Len() > 0 {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: "links.txt", Method: zip.Deflate, Modified: start})
+		if err == nil {
+			_, err = io.WriteString(w, links.String())
+		}
+		if err != nil {
+			log.Println(err)
+			return nil
+		}
+	}
+
+	err = archive.Close()
+	if err != nil {
+		log.Println(err)
+	}
+
+	duration := time.Since(start)
+	fmt.Println("DownloadEntries time: " + duration.String())
+	return nil
+}
+
+// archiveFile copies a stored file into a zip.
+func (app *App) archiveFile(archive *zip.Writer, name string, key string) error {
+	file, err := app.Files.Open(key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: file.ModTime})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// archiveName makes an artist's name safe to use as a file name on any system.
+func archiveName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	name = strings.Trim(name, " .")
+	if name == "" {
+		return "Unknown"
+	}
+	return name
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// TestLongTransfer lets a slow upload finish and be answered on a server whose timeouts would cut it off.
+func TestLongTransfer(t *testing.T) {
+	e := echo.New()
+	echoBody := func(c echo.Context) error {
+		body, err := io.ReadAll(c.Request().Body)
+		if err != nil {
+			return err
+		}
+		time.Sleep(200 * time.Millisecond)
+		return c.String(http.StatusOK, string(body))
+	}
+	e.POST("/long", echoBody, LongTransfer)
+	e.POST("/short", echoBody)
+
+	server := httptest.NewUnstartedServer(e)
+	server.Config.ReadTimeout = 100 * time.Millisecond
+	server.Config.WriteTimeout = 100 * time.Millisecond
+	server.Start()
+	defer server.Close()
+
+	// The body arrives in two halves, well after the read timeout.
+	send := func(path string) (string, error) {
+		body, w := io.Pipe()
+		go func() {
+			w.Write([]byte("first half "))
+			time.Sleep(200 * time.Millisecond)
+			w.Write([]byte("second half"))
+			w.Close()
+		}()
+
+		resp, err := http.Post(server.URL+path, "application/octet-stream", body)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		received, err := io.ReadAll(resp.Body)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = echo.NewHTTPError(resp.StatusCode)
+		}
+		return string(received), err
+	}
+
+	received, err := send("/long")
+	if err != nil || received != "first half second half" {
+		t.Errorf("long transfer got %q, %v", received, err)
+	}
+	received, err = send("/short")
+	if err == nil && received == "first half second half" {
+		t.Error("the server's timeouts didn't apply without LongTransfer, so the test proves nothing")
+	}
+}
+
+func TestAllowsUploads(t *testing.T) {
+	tests := []struct {
+		battle Battle
+		want   bool
+	}{
+		{Battle{Type: "beat"}, true},
+		{Battle{Type: "art"}, false},
+		{Battle{Type: "beat", TrackHosts: []string{"soundcloud.com"}}, false},
+	}
+	for _, test := range tests {
+		if got := AllowsUploads(test.battle); got != test.want {
+			t.Errorf("AllowsUploads(%s battle with track hosts %v) = %t, want %t", test.battle.Type, test.battle.TrackHosts, got, test.want)
+		}
+	}
+}
+
+// failingUpdates is a beat store whose entries can be inserted but not updated.
+type failingUpdates struct {
+	BeatStore
+}
+
+func (failingUpdates) Update(beat Beat) error {
+	return errors.New("beats unavailable")
+}
+
+// TestInsertBeatUploadFails takes a new uploaded entry back out, file and all, when it can't be given its
+// stream URL, so the entrant can upload it again.
+func TestInsertBeatUploadFails(t *testing.T) {
+	app := testApp(t)
+	uploads := t.TempDir()
+	app.Files = NewLocalStorage(uploads)
+	app.Beats = failingUpdates{app.Beats}
+	host := testUser(t, app, "Host")
+	alice := testUser(t, app, "Alice")
+	battle := testBattle(t, app, host, StatusEntry)
+
+	audio, err := os.ReadFile("testdata/resolver/audius_stream.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	file, err := form.CreateFormFile("audio", "entry.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(audio)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/beat/submit", body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+
+	rec := serveRequest(t, app.InsertBeat, alice, req, "id", strconv.Itoa(battle.ID))
+	if toast := redirectToast(t, rec); toast != "502" {
+		t.Errorf("toast = %q, want 502", toast)
+	}
+	_, err = app.Beats.GetByUser(battle.ID, alice.ID)
+	if err != ErrNotFound {
+		t.Errorf("entry after failing: err = %v, want ErrNotFound", err)
+	}
+	err = filepath.WalkDir(uploads, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			t.Errorf("%s was left uploaded", path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
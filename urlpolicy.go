@@ -0,0 +1,141 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Default URL policy. Hosts match their subdomains too, and a host with a path, like amazon.com/clouddrive,
+// only matches links under that path. Both lists can be replaced with TRACK_HOSTS & ATTACHMENT_HOSTS.
+var (
+	// trackHosts are the sites entries can be linked from.
+	trackHosts = []string{"soundcloud.com", "audius.co", "bandcamp.com", "youtube.com", "youtu.be", "archive.org"}
+	// attachmentHosts are the sites battle attachments, like sample packs, can be linked from.
+	attachmentHosts = []string{"drive.google.com", "dropbox.com", "onedrive.com", "1drv.ms", "sharepoint.com",
+		"mega.nz", "amazon.com/clouddrive", "filetransfer.io", "wetransfer.com", "we.tt", "sellfy.com",
+		"bandcamp.com", "archive.org", "audius.co", "soundcloud.com", "youtube.com"}
+)
+
+// typeTrackHosts replace the track hosts for battle types whose entries aren't audio.
+var typeTrackHosts = map[string][]string{
+	"art": {"imgur.com", "artstation.com", "deviantart.com", "instagram.com", "drive.google.com", "dropbox.com"},
+}
+
+// URLPolicy is where a battle's entries and attachments can be linked from.
+type URLPolicy struct {
+	Tracks      []string
+	Attachments []string
+}
+
+// TypeURLPolicy is the URL policy for battles of a type that haven't narrowed their track hosts.
+func TypeURLPolicy(battleType string) URLPolicy {
+	tracks, ok := typeTrackHosts[strings.ToLower(battleType)]
+	if !ok {
+		tracks = trackHosts
+	}
+	return URLPolicy{Tracks: tracks, Attachments: attachmentHosts}
+}
+
+// BattleURLPolicy is the URL policy for a battle. Hosts can narrow the track hosts for their battle,
+// e.g. to SoundCloud only, but can't allow anything its type doesn't.
+func BattleURLPolicy(battle Battle) URLPolicy {
+	urls := TypeURLPolicy(battle.Type)
+	if hosts := NarrowHosts(battle.TrackHosts, urls.Tracks); len(hosts) > 0 {
+		urls.Tracks = hosts
+	}
+	return urls
+}
+
+// NarrowHosts returns the hosts that are also in allowed, without duplicates.
+func NarrowHosts(hosts []string, allowed []string) []string {
+	narrowed := []string{}
+	for _, host := range hosts {
+		host = normalizeHost(host)
+		if containsTag(allowed, host) && !containsTag(narrowed, host) {
+			narrowed = append(narrowed, host)
+		}
+	}
+	return narrowed
+}
+
+// ParseHosts reads a comma separated host list, as stored or set in the environment.
+func ParseHosts(text string) []string {
+	hosts := []string{}
+	for _, field := range strings.Split(text, ",") {
+		if host := normalizeHost(field); host != "" && !containsTag(hosts, host) {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts
+}
+
+// FormTrackHosts reads the track hosts a battle form narrows entries to.
+func FormTrackHosts(c echo.Context) []string {
+	params, err := c.FormParams()
+	if err != nil {
+		return []string{}
+	}
+	return ParseHosts(strings.Join(params["track_hosts"], ","))
+}
+
+// normalizeHost lowercases a host and drops any scheme, www. and trailing slash or dot.
+func normalizeHost(host string) string {
+	host = strings.ToLower(strings.TrimSpace(host))
+	host = strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://")
+	host = strings.TrimPrefix(host, "www.")
+	return strings.Trim(host, "/.")
+}
+
+// ParseLink reads a submitted link, which has to be an absolute http or https URL.
+func ParseLink(text string) (*url.URL, bool) {
+	link, err := url.Parse(strings.TrimSpace(text))
+	if err != nil || (link.Scheme != "http" && link.Scheme != "https") || link.Hostname() == "" || link.User != nil {
+		return nil, false
+	}
+	return link, true
+}
+
+// HostAllowed reports whether a link is on one of the hosts or their subdomains, and under the host's path if it has one.
+// Lookalikes like notsoundcloud.com or soundcloud.com.evil.io don't match soundcloud.com.
+func HostAllowed(link *url.URL, hosts []string) bool {
+	host := strings.TrimSuffix(strings.ToLower(link.Hostname()), ".")
+	for _, allowed := range hosts {
+		domain, path, _ := strings.Cut(allowed, "/")
+		if host != domain && !strings.HasSuffix(host, "."+domain) {
+			continue
+		}
+		if path == "" || strings.TrimSuffix(link.Path, "/") == "/"+path || strings.HasPrefix(link.Path, "/"+path+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckTrack returns the toast for a track link the policy doesn't allow, or "" if it's fine.
+func (p URLPolicy) CheckTrack(link *url.URL) string {
+	if HostAllowed(link, p.Tracks) {
+		return ""
+	}
+	if len(p.Tracks) == 1 && p.Tracks[0] == "soundcloud.com" {
+		return "sconly"
+	}
+	return "trackhost"
+}
+
+// CheckAttachment returns the toast for an attachment the policy doesn't allow, or "" if it's fine.
+// Attachments are optional, so a blank one is fine too.
+func (p URLPolicy) CheckAttachment(attachment string) string {
+	if strings.TrimSpace(attachment) == "" {
+		return ""
+	}
+	link, ok := ParseLink(attachment)
+	if !ok {
+		return "badattachment"
+	}
+	if !HostAllowed(link, p.Attachments) {
+		return "attachmenthost"
+	}
+	return ""
+}
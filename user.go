@@ -1,14 +1,14 @@
 package main
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"html"
 	"log"
 	"net/http"
+	"net/url"
+	"sort"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -59,13 +59,9 @@ func ComparePasswords(hashedPwd string, plainPwd []byte) bool {
 	return true
 }
 
-// GetUserDB retrieves user from the database using a UserID.
-func GetUserDB(UserID int) User {
-	query := "SELECT provider, provider_id, nickname, flair FROM users WHERE id = ?"
-	user := User{}
-	user.ID = UserID
-
-	err := dbRead.QueryRow(query, UserID).Scan(&user.Provider, &user.ProviderID, &user.Name, &user.Flair)
+// GetUserDB retrieves user from the store using a UserID.
+func (app *App) GetUserDB(UserID int) User {
+	user, err := app.Users.Get(UserID)
 	if err != nil {
 		log.Println(err)
 		return User{}
@@ -76,7 +72,7 @@ func GetUserDB(UserID int) User {
 
 // Callback does the main heavy lifting of the 2FA authentication.
 // This code is kind of messy and should be refactored.
-func Callback(c echo.Context) error {
+func (app *App) Callback(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
@@ -174,9 +170,8 @@ func Callback(c echo.Context) error {
 	}
 
 	// Check if user exists.
-	userID := 0
-	err = dbRead.QueryRow("SELECT id FROM users WHERE provider=? and provider_id=?", user.Provider, user.ProviderID).Scan(&userID)
-	if err != nil && err != sql.ErrNoRows {
+	userID, err := app.Users.FindByProvider(user.Provider, user.ProviderID)
+	if err != nil && err != ErrNotFound {
 		fmt.Println(fmt.Sprintf("Checking to see if user exists failed: %s", err))
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
@@ -185,44 +180,19 @@ func Callback(c echo.Context) error {
 	accessTokenEncrypted := HashAndSalt([]byte(user.AccessToken))
 	// If user doesn't exist, add to db.
 	if userID == 0 {
-		sql := `INSERT INTO 
-				users(provider, provider_id, nickname, access_token, expiry, flair) 
-				VALUES
-				(?,?,?,?,?,?)`
-
-		stmt, err := dbWrite.Prepare(sql)
+		userID, err = app.Users.Insert(user, accessTokenEncrypted)
 		if err != nil {
 			fmt.Println(fmt.Sprintf("User insert SQL failure: %s", err))
 			SetToast(c, "cache")
 			return c.Redirect(302, "/login")
 		}
-		defer stmt.Close()
-		stmt.Exec(user.Provider, user.ProviderID, user.Name, accessTokenEncrypted, user.ExpiresAt, "")
 	} else {
-		sql := `UPDATE
-				users 
-				SET 
-				nickname = ?, access_token = ?, expiry = ? WHERE id = ?`
-
-		stmt, err := dbWrite.Prepare(sql)
+		err = app.Users.UpdateLogin(userID, user.Name, accessTokenEncrypted, user.ExpiresAt)
 		if err != nil {
 			fmt.Println(fmt.Sprintf("User update SQL failure: %s", err))
 			SetToast(c, "cache")
 			return c.Redirect(302, "/login")
 		}
-		defer stmt.Close()
-		stmt.Exec(user.Name, accessTokenEncrypted, user.ExpiresAt, userID)
-	}
-
-	// Select user ID. This seems awfully unnecessary. We shoudl be able to get this from the insert statement.
-	// TODO - Clean this up.
-	if userID == 0 {
-		err = dbRead.QueryRow("SELECT id FROM users WHERE provider=? and provider_id=?", user.Provider, user.ProviderID).Scan(&userID)
-		if err != nil && err != sql.ErrNoRows {
-			fmt.Println(fmt.Sprintf("(SQL) Selecting user ID failed: %s", err))
-			SetToast(c, "502")
-			return c.Redirect(302, "/")
-		}
 	}
 
 	user.ID = userID
@@ -283,7 +253,7 @@ func Logout(c echo.Context) error {
 // GetUser retrieves user details from local storage.
 // If validation is required, it checks if the access token is expired.
 // REVIEW - not slow, but confusing
-func GetUser(c echo.Context, validate bool) User {
+func (app *App) GetUser(c echo.Context, validate bool) User {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
@@ -308,8 +278,8 @@ func GetUser(c echo.Context, validate bool) User {
 		}
 
 		if validate {
-			var dbHash string
-			err := dbRead.QueryRow("SELECT access_token, expiry FROM users WHERE id = ?", user.ID).Scan(&dbHash, &user.ExpiresAt)
+			dbHash, expiry, err := app.Users.Token(user.ID)
+			user.ExpiresAt = expiry
 			if err != nil {
 				fmt.Println(fmt.Sprintf("(SQL) Selecting access token & expiry failed: %s", err))
 				return User{}
@@ -351,10 +321,9 @@ func GetUser(c echo.Context, validate bool) User {
 				user.ExpiresAt = newToken.Expiry
 				user.Authenticated = true
 
-				sql := "UPDATE users SET access_token = ?, expiry = ? WHERE id = ?"
-
 				// If we can't update the users in the database, destroy the session.
-				stmt, err := dbWrite.Prepare(sql)
+				accessTokenEncrypted := HashAndSalt([]byte(user.AccessToken))
+				err = app.Users.UpdateToken(user.ID, accessTokenEncrypted, user.ExpiresAt)
 				if err != nil {
 					fmt.Println(fmt.Sprintf("(SQL) Cant update DB user, destroying session: %s", err))
 					sess.Values["user"] = User{}
@@ -362,11 +331,7 @@ func GetUser(c echo.Context, validate bool) User {
 					SetToast(c, "cache")
 					return User{}
 				}
-				defer stmt.Close()
-
-				accessTokenEncrypted := HashAndSalt([]byte(user.AccessToken))
 				dbHash = accessTokenEncrypted
-				stmt.Exec(accessTokenEncrypted, user.ExpiresAt, user.ID)
 			}
 
 			if !ComparePasswords(dbHash, []byte(user.AccessToken)) {
@@ -418,7 +383,7 @@ func AjaxResponse(c echo.Context, redirect bool, redirectPath string, toastQuery
 }
 
 // AddVote is a user function that grabs the logged in user object and adds a vote to the DB.
-func AddVote(c echo.Context) error {
+func (app *App) AddVote(c echo.Context) error {
 	start := time.Now()
 
 	// Set the request to close automatically.
@@ -426,7 +391,7 @@ func AddVote(c echo.Context) error {
 	c.Request().Close = true
 
 	// Get user, return if not auth.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -461,50 +426,58 @@ func AddVote(c echo.Context) error {
 	}
 
 	// Get battle status, max votes, and vote array.
-	var deadline time.Time
-	maxVotes := 1
-	var voteArray []uint8
-	err = dbRead.QueryRow(
-		`SELECT battle.voting_deadline, battle.maxvotes, GROUP_CONCAT(DISTINCT IFNULL(votes.beat_id, '')) AS user_votes
-		FROM (SELECT voting_deadline, maxvotes, id FROM battles WHERE battles.id = ?) battle
-		LEFT JOIN (SELECT beat_id, battle_id FROM votes WHERE user_id = ? AND battle_id = ? ORDER BY beat_id) votes
-		ON battle.id = votes.battle_id`,
-		// Fill in
-		battleID, me.ID, battleID).Scan(
-		//
-		&deadline, &maxVotes, &voteArray)
-
-	if err != nil && err != sql.ErrNoRows {
+	battle, err := app.Battles.Get(battleID)
+	if err != nil && err != ErrNotFound {
 		log.Println("Vote err, no rows.")
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "502")
 	}
 
 	// Reject if not currently in voting stage or if challenge is invalid.
-	if err == sql.ErrNoRows || time.Until(deadline) < 0 {
+	if err == ErrNotFound || battle.Status != StatusVoting || time.Until(battle.VotingDeadline) < 0 {
 		return AjaxResponse(c, true, redirectURL, "302")
 	}
+	if battle.VotingMode == VotingRanked {
+		return AjaxResponse(c, false, redirectURL, "rankedonly")
+	}
+	if battle.VotingMode == VotingScore {
+		return AjaxResponse(c, false, redirectURL, "scoreonly")
+	}
 
-	voteString := string(voteArray)
-	voteStringArray := strings.Split(voteString, ",")
-	var userVotes []int
-	for _, s := range voteStringArray {
-		voteID, _ := strconv.Atoi(s)
-		if voteID != 0 {
-			userVotes = append(userVotes, voteID)
-		}
+	allowed, err := app.mayVote(battle, me.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if !allowed {
+		return AjaxResponse(c, false, redirectURL, "entrantsonly")
 	}
 
-	if len(userVotes) < maxVotes {
+	// Team members can't vote for the entry they're credited on either.
+	credits, err := app.teamCredits(battle.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if credits[beatID][me.ID] {
+		return AjaxResponse(c, false, redirectURL, "owntrack")
+	}
+
+	userVotes, err := app.Votes.UserVotes(battleID, me.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+
+	if len(userVotes) < battle.MaxVotes {
 		// If a vote for this beat does not exist
 		if !ContainsInt(userVotes, beatID) {
 			// Add a vote to the vote table for the beat.
-			ins, err := dbWrite.Prepare("INSERT INTO votes(beat_id, user_id, battle_id) VALUES(?,?,?)")
+			err = app.Votes.Add(battleID, beatID, me.ID)
 			if err != nil {
+				log.Println(err)
 				return AjaxResponse(c, false, redirectURL, "404")
 			}
-			defer ins.Close()
-			ins.Exec(beatID, me.ID, battleID)
 
 			duration := time.Since(start)
 			fmt.Println("AddVote time: " + duration.String())
@@ -512,12 +485,11 @@ func AddVote(c echo.Context) error {
 			return AjaxResponse(c, false, redirectURL, "successvote")
 		} else if ContainsInt(userVotes, beatID) {
 			// Delete vote from the votes table.
-			del, err := dbWrite.Prepare("DELETE FROM votes WHERE beat_id = ? AND user_id = ? AND battle_id = ?")
+			err = app.Votes.Remove(battleID, beatID, me.ID)
 			if err != nil {
+				log.Println(err)
 				return AjaxResponse(c, true, redirectURL, "404")
 			}
-			defer del.Close()
-			del.Exec(beatID, me.ID, battleID)
 
 			duration := time.Since(start)
 			fmt.Println("AddVote time: " + duration.String())
@@ -530,14 +502,12 @@ func AddVote(c echo.Context) error {
 		}
 
 		// Delete vote from the votes table.
-		del, err := dbWrite.Prepare("DELETE FROM votes WHERE beat_id = ? AND user_id = ? AND battle_id = ?")
+		err = app.Votes.Remove(battleID, beatID, me.ID)
 		if err != nil {
+			log.Println(err)
 			return AjaxResponse(c, false, redirectURL, "404")
 		}
 
-		defer del.Close()
-		del.Exec(beatID, me.ID, battleID)
-
 		duration := time.Since(start)
 		fmt.Println("AddVote time: " + duration.String())
 		return AjaxResponse(c, false, redirectURL, "successdelvote")
@@ -550,12 +520,12 @@ func AddVote(c echo.Context) error {
 }
 
 // AddLike ...
-func AddLike(c echo.Context) error {
+func (app *App) AddLike(c echo.Context) error {
 	start := time.Now()
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -572,24 +542,28 @@ func AddLike(c echo.Context) error {
 
 	redirectURL := "/battle/" + strconv.Itoa(battleID) + "/"
 
-	if !RowExists("SELECT user_id FROM likes WHERE user_id = ? AND beat_id = ?", me.ID, beatID) {
-		ins, err := dbWrite.Prepare("INSERT INTO likes(user_id, beat_id, battle_id) VALUES (?, ?, ?)")
+	userLikes, err := app.Votes.UserLikes(battleID, me.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, "/", "502")
+	}
+
+	if !ContainsInt(userLikes, beatID) {
+		err = app.Votes.AddLike(battleID, beatID, me.ID)
 		if err != nil {
+			log.Println(err)
 			return AjaxResponse(c, false, "/", "502")
 		}
-		defer ins.Close()
-		ins.Exec(me.ID, beatID, battleID)
 		duration := time.Since(start)
 		fmt.Println("AddLike time: " + duration.String())
 		return AjaxResponse(c, false, redirectURL, "liked")
 	}
 
-	del, err := dbWrite.Prepare("DELETE from likes WHERE user_id = ? AND beat_id = ? AND battle_id = ?")
+	err = app.Votes.RemoveLike(battleID, beatID, me.ID)
 	if err != nil {
+		log.Println(err)
 		return AjaxResponse(c, false, "/", "502")
 	}
-	defer del.Close()
-	del.Exec(me.ID, beatID, battleID)
 
 	duration := time.Since(start)
 	fmt.Println("AddLike time: " + duration.String())
@@ -598,11 +572,11 @@ func AddLike(c echo.Context) error {
 }
 
 // AddFeedback ...
-func AddFeedback(c echo.Context) error {
+func (app *App) AddFeedback(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -613,110 +587,70 @@ func AddFeedback(c echo.Context) error {
 		return AjaxResponse(c, false, "/", "404")
 	}
 
-	var battleID int
-	var userID int
 	feedback := policy.Sanitize(c.FormValue("feedback"))
 
-	err = dbRead.QueryRow("SELECT battle_id, user_id FROM beats WHERE id = ?", beatID).Scan(&battleID, &userID)
+	beat, err := app.Beats.Get(beatID)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, false, "/", "404")
 	}
 
-	redirectURL := "/battle/" + strconv.Itoa(battleID) + "/"
+	redirectURL := "/battle/" + strconv.Itoa(beat.BattleID) + "/"
 
-	if userID == me.ID {
-		return AjaxResponse(c, false, "/", "feedbackself")
+	credits, err := app.teamCredits(beat.BattleID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
 	}
-
-	if !RowExists("SELECT id FROM feedback WHERE user_id = ? AND beat_id = ?", me.ID, beatID) {
-		ins, err := dbWrite.Prepare("INSERT INTO feedback(feedback, user_id, beat_id) VALUES (?, ?, ?)")
-		if err != nil {
-			log.Println(err)
-			return AjaxResponse(c, true, "/", "502")
-		}
-		defer ins.Close()
-		ins.Exec(feedback, me.ID, beatID)
-		return AjaxResponse(c, false, redirectURL, "successaddfeedback")
+	if beat.Artist.ID == me.ID || credits[beat.ID][me.ID] {
+		return AjaxResponse(c, false, "/", "feedbackself")
 	}
 
-	update, err := dbWrite.Prepare("UPDATE feedback SET feedback = ? WHERE user_id = ? AND beat_id = ?")
+	created, err := app.Feedback.Save(beatID, me.ID, feedback)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "502")
 	}
-	defer update.Close()
-	update.Exec(feedback, me.ID, beatID)
+	if created {
+		return AjaxResponse(c, false, redirectURL, "successaddfeedback")
+	}
 
 	return AjaxResponse(c, false, redirectURL, "successupdate")
 }
 
 // ViewFeedback - Retrieves user's feedback and returns a page containing them.
-func ViewFeedback(c echo.Context) error {
+func (app *App) ViewFeedback(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
 	// Check if the user is properly authenticated.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		SetToast(c, "relog")
 		return c.Redirect(302, "/login")
 	}
 
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 	toast := GetToast(c)
 	battleID, err := strconv.Atoi(c.Param("id"))
-	if err != nil && err != sql.ErrNoRows {
+	if err != nil {
 		SetToast(c, "404")
 		return c.Redirect(302, "/")
 	}
 
 	// Retrieve battle, return to front page if battle doesn't exist.
-	battle := GetBattle(battleID)
+	battle := app.GetBattle(battleID)
 	if battle.Title == "" {
 		SetToast(c, "404")
 		return c.Redirect(302, "/")
 	}
 
-	query := `SELECT users.nickname, feedback.feedback
-				FROM beats
-				LEFT JOIN feedback on feedback.beat_id = beats.id
-				LEFT JOIN users on feedback.user_id = users.id
-				WHERE beats.battle_id = ? AND beats.user_id = ? AND feedback.feedback IS NOT NULL`
-
-	rows, err := dbRead.Query(query, battleID, me.ID)
+	feedback, err := app.Feedback.Received(battleID, me.ID)
 	if err != nil {
 		log.Println(err)
 		SetToast(c, "404")
 		return c.Redirect(302, "/")
 	}
-	defer rows.Close()
-
-	type Feedback struct {
-		From     string `json:"from"`
-		Feedback string `json:"feedback"`
-	}
-
-	curFeedback := Feedback{}
-	feedback := []Feedback{}
-
-	for rows.Next() {
-		err = rows.Scan(&curFeedback.From, &curFeedback.Feedback)
-		if err != nil {
-			log.Println(err)
-			SetToast(c, "502")
-			return c.Redirect(302, "/")
-		}
-
-		feedback = append(feedback, curFeedback)
-	}
-	// Reference: http://go-database-sql.org/errors.html - I'm not really sure if this does anything positive lmao.
-	if err = rows.Err(); err != nil {
-		log.Println(err)
-	}
-	if err = rows.Close(); err != nil {
-		log.Println(err)
-	}
 
 	log.Println(feedback)
 	feedbackJSON, err := json.Marshal(feedback)
@@ -739,7 +673,7 @@ func ViewFeedback(c echo.Context) error {
 }
 
 // UserBattles - Retrieves user's battles and returns a page containing them.
-func UserBattles(c echo.Context) error {
+func (app *App) UserBattles(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
@@ -747,36 +681,47 @@ func UserBattles(c echo.Context) error {
 	// This is for the invite functionality.
 	userID := 0
 	user := User{}
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 	title := ""
 	userID, _ = strconv.Atoi(c.Param("id"))
-	user = GetUserDB(userID)
+	user = app.GetUserDB(userID)
 	title = user.Name + "'s"
 
-	battles := GetBattles("user:" + c.Param("id"))
-	battlesJSON, _ := json.Marshal(battles)
+	// A zero HostID doesn't filter, so an invalid ID would list every battle.
+	battles := BattlePage{Battles: []Battle{}}
+	history := ChampionshipHistory{Finishes: []ChampionshipRecord{}}
+	ratings, ratingHistory := []Rating{}, []RatingChange{}
+	if userID > 0 {
+		battles = app.GetBattlePage(ParseBattleQuery(c, HostBattles(userID, me.ID)))
+		history = app.UserHistory(userID)
+		ratings, ratingHistory = app.UserRatings(userID)
+	}
 
 	m := map[string]interface{}{
 		"Meta": map[string]interface{}{
 			"Title":     title + " Battles",
 			"Analytics": analyticsKey,
 		},
-		"Page":    "battles",
-		"Battles": string(battlesJSON),
-		"Me":      me,
-		"User":    user,
-		"Toast":   toast,
-		"Tag":     policy.Sanitize(c.Param("tag")),
-		"Ads":     ads,
+		"Page":          "battles",
+		"Battles":       battles,
+		"BattlesURL":    battlesURL(c, url.Values{"list": {"user"}, "user": {strconv.Itoa(userID)}}),
+		"Me":            me,
+		"User":          user,
+		"History":       history,
+		"Ratings":       ratings,
+		"RatingHistory": ratingHistory,
+		"Toast":         toast,
+		"Tag":           policy.Sanitize(c.Param("tag")),
+		"Ads":           ads,
 	}
 	return c.Render(302, "UserBattles", m)
 }
 
-// UserSubmissions - Retrieves user's submissions and returns a page containing them.
-func UserSubmissions(c echo.Context) error {
+// UserSubmissions - Retrieves user's submissions, team entries they're credited on included, and returns a page containing them.
+func (app *App) UserSubmissions(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
@@ -784,44 +729,43 @@ func UserSubmissions(c echo.Context) error {
 	// This is for the invite functionality.
 	userID := 0
 	user := User{}
-	me := GetUser(c, false)
+	me := app.GetUser(c, false)
 
 	toast := GetToast(c)
-	ads := GetAdvertisements()
+	ads := app.GetAdvertisements()
 	title := ""
 
 	userID, _ = strconv.Atoi(c.Param("id"))
-	user = GetUserDB(userID)
+	user = app.GetUserDB(userID)
 	title = user.Name + "'s"
 
-	submission := Beat{}
 	entries := []Beat{}
 	disqualified := []Beat{}
 
-	query := `
-			SELECT beats.url, beats.votes, beats.voted, battles.id, battles.title, battles.results, beats.placement
-			FROM beats
-			LEFT JOIN battles on battles.id=beats.battle_id
-			WHERE beats.user_id=?
-			GROUP BY 1
-			ORDER BY beats.placement ASC`
-
-	rows, err := dbRead.Query(query, userID)
+	submissions, err := app.Beats.ListByUser(userID)
 	if err != nil {
+		log.Println(err)
 		SetToast(c, "502")
 		return c.Redirect(302, "/")
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		submission = Beat{}
-		err = rows.Scan(&submission.URL, &submission.Votes, &submission.Voted, &submission.BattleID, &submission.Battle.Title, &submission.Battle.Results, &submission.Placement)
+	// Credit everyone on team entries, loading each team battle's members once.
+	members := map[int][]BeatMember{}
+	for _, submission := range submissions {
+		if _, ok := members[submission.BattleID]; ok || !submission.Battle.Teams {
+			continue
+		}
+		members[submission.BattleID], err = app.Beats.Members(submission.BattleID)
 		if err != nil {
-			SetToast(c, "502")
-			return c.Redirect(302, "/")
+			log.Println(err)
 		}
+	}
 
+	for _, submission := range submissions {
 		submission.Battle.Title = html.UnescapeString(submission.Battle.Title)
+		submission.Members = EntryCredits(submission, members[submission.BattleID])
+		submission.Embed = app.Tracks.Offline(submission)
+		submission.Audio.Summary = submission.Audio.Describe()
 
 		if submission.Placement == 0 {
 			submission.Placement = 999
@@ -832,14 +776,6 @@ func UserSubmissions(c echo.Context) error {
 		entries = append(entries, submission)
 	}
 	entries = append(entries, disqualified...)
-	
-	// Reference: http://go-database-sql.org/errors.html - I'm not really sure if this does anything positive lmao.
-	if err = rows.Err(); err != nil {
-		log.Println(err)
-	}
-	if err = rows.Close(); err != nil {
-		log.Println(err)
-	}
 
 	submissionsJSON, err := json.Marshal(entries)
 	if err != nil {
@@ -865,7 +801,7 @@ func UserSubmissions(c echo.Context) error {
 }
 
 // DisqualifyBeat
-func DisqualifyBeat(c echo.Context) error {
+func (app *App) DisqualifyBeat(c echo.Context) error {
 	start := time.Now()
 
 	// Set the request to close automatically.
@@ -873,7 +809,7 @@ func DisqualifyBeat(c echo.Context) error {
 	c.Request().Close = true
 
 	// Get user, return if not auth.
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		log.Println("Auth error.")
 		return AjaxResponse(c, true, "/login/", "noauth")
@@ -895,37 +831,41 @@ func DisqualifyBeat(c echo.Context) error {
 	}
 
 	redirectURL := "/battle/" + strconv.Itoa(battleID) + "/"
-	battle := GetBattle(battleID)
+	beat, err := app.Beats.Get(beatID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, redirectURL, "404")
+	}
+
+	battle := app.GetBattle(beat.BattleID)
 	if me.ID == battle.Host.ID {
-		voted := 1
-		err := dbRead.QueryRow("SELECT voted FROM beats WHERE id = ?", beatID).Scan(&voted)
+		err = app.Beats.SetVoted(beatID, !beat.Voted)
 		if err != nil {
 			log.Println(err)
+			return AjaxResponse(c, true, redirectURL, "404")
 		}
 
-		if voted == 1 {
-			del, err := dbWrite.Prepare("UPDATE beats SET voted = '0', placement = '0' WHERE id = ?")
+		// A finished battle's records follow the host's changes.
+		if battle.Status == StatusComplete {
+			err = app.RecordChampionships(battle)
 			if err != nil {
 				log.Println(err)
-				return AjaxResponse(c, true, redirectURL, "404")
+				return AjaxResponse(c, true, redirectURL, "502")
 			}
-			defer del.Close()
-			del.Exec(beatID)
-			duration := time.Since(start)
-			fmt.Println("DisqualifyBeat time: " + duration.String())
-			return AjaxResponse(c, false, redirectURL, "disqualified")
-		} else {
-			add, err := dbWrite.Prepare("UPDATE beats SET voted = '1' WHERE id = ?")
-			if err != nil {
-				return AjaxResponse(c, true, redirectURL, "404")
+			// The battle was already rated, so its new placements count once ratings are recomputed.
+			err = app.RateBattle(battle)
+			if err != nil && err != ErrRatingsStale {
+				log.Println(err)
+				return AjaxResponse(c, true, redirectURL, "502")
 			}
-			defer add.Close()
-			add.Exec(beatID)
-			duration := time.Since(start)
-			fmt.Println("DisqualifyBeat time: " + duration.String())
-			return AjaxResponse(c, false, redirectURL, "requalified")
 		}
 
+		duration := time.Since(start)
+		fmt.Println("DisqualifyBeat time: " + duration.String())
+		if beat.Voted {
+			return AjaxResponse(c, false, redirectURL, "disqualified")
+		}
+		return AjaxResponse(c, false, redirectURL, "requalified")
 	}
 	duration := time.Since(start)
 	fmt.Println("DisqualifyBeat time: " + duration.String())
@@ -933,11 +873,11 @@ func DisqualifyBeat(c echo.Context) error {
 }
 
 // SetPlacement ...
-func SetPlacement(c echo.Context) error {
+func (app *App) SetPlacement(c echo.Context) error {
 	// Set the request to close automatically.
 	c.Request().Header.Set("Connection", "close")
 	c.Request().Close = true
-	me := GetUser(c, true)
+	me := app.GetUser(c, true)
 	if !me.Authenticated {
 		return AjaxResponse(c, true, "/login/", "noauth")
 	}
@@ -947,112 +887,79 @@ func SetPlacement(c echo.Context) error {
 		return AjaxResponse(c, true, "/", "404")
 	}
 
-	var battleID, hostID, curPlacement int
 	placement, _ := strconv.Atoi(policy.Sanitize(c.FormValue("placement")))
 
-	/* This should be simplified into singular queries. */
-
-	err = dbRead.QueryRow("SELECT battle_id, placement FROM beats WHERE id = ?", beatID).Scan(&battleID, &curPlacement)
+	beat, err := app.Beats.Get(beatID)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "404")
 	}
 
-	err = dbRead.QueryRow("SELECT user_id FROM battles WHERE id = ?", battleID).Scan(&hostID)
+	battle, err := app.Battles.Get(beat.BattleID)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "404")
 	}
 
-	redirectURL := "/battle/" + strconv.Itoa(battleID) + "/"
-	log.Println(hostID)
-	log.Println(me.ID)
-	if hostID != me.ID {
+	redirectURL := "/battle/" + strconv.Itoa(battle.ID) + "/"
+	if battle.Host.ID != me.ID {
 		return AjaxResponse(c, true, "/", "403")
 	}
 
-	ins, err := dbWrite.Prepare("UPDATE beats SET placement = ? WHERE id = ?")
+	beats, err := app.Beats.ListByBattle(battle.ID)
 	if err != nil {
 		log.Println(err)
 		return AjaxResponse(c, true, "/", "502")
 	}
-	defer ins.Close()
-	ins.Exec(placement, beatID)
-
-	if placement < curPlacement {
-		log.Println("<")
-		upd1, err := dbWrite.Prepare(`UPDATE
-										beats AS m
-									JOIN
-										( SELECT id, row_number() OVER (ORDER BY placement) AS rn 
-										FROM beats
-										WHERE beats.voted AND beats.battle_id = ? AND beats.placement < ?
-										) AS sub
-									ON m.id = sub.id
-									SET
-										m.placement = sub.rn
-									WHERE m.voted AND m.battle_id = ?`)
-		if err != nil {
-			log.Println(err)
-			return AjaxResponse(c, true, "/", "502")
+
+	// Take the beat out of the qualified entries, put it back at its new placement and renumber.
+	placed := []Beat{}
+	for _, entry := range beats {
+		if entry.Voted && entry.ID != beatID {
+			placed = append(placed, entry)
 		}
-		defer upd1.Close()
-		upd1.Exec(battleID, placement, battleID)
-
-		upd2, err := dbWrite.Prepare(`UPDATE
-										beats AS m
-									JOIN
-										( SELECT id, row_number() OVER (ORDER BY placement) AS rn 
-										FROM beats
-										WHERE beats.voted AND beats.battle_id = ? AND beats.placement >= ? AND beats.id NOT IN (?)
-										) AS sub
-									ON m.id = sub.id
-									SET
-										m.placement = sub.rn + ?
-									WHERE m.voted AND m.battle_id = ?`)
-		if err != nil {
-			log.Println(err)
-			return AjaxResponse(c, true, "/", "502")
+	}
+	sort.SliceStable(placed, func(i, j int) bool {
+		return placed[i].Placement < placed[j].Placement
+	})
+
+	if placement < 1 {
+		placement = 1
+	}
+	if placement > len(placed)+1 {
+		placement = len(placed) + 1
+	}
+	placed = append(placed[:placement-1], append([]Beat{beat}, placed[placement-1:]...)...)
+
+	results := make([]BeatResult, len(placed))
+	for i, entry := range placed {
+		results[i] = BeatResult{
+			BeatID:    entry.ID,
+			Votes:     entry.Votes,
+			Voted:     entry.Voted,
+			Placement: i + 1,
 		}
-		defer upd2.Close()
-		upd2.Exec(battleID, placement, beatID, placement, battleID)
-	} else {
-		log.Println(">")
-		upd1, err := dbWrite.Prepare(`UPDATE
-										beats AS m
-									JOIN
-										( SELECT id, row_number() OVER (ORDER BY placement) AS rn 
-										FROM beats
-										WHERE beats.voted AND beats.battle_id = ? AND beats.placement <= ? AND beats.id NOT IN (?)
-										) AS sub
-									ON m.id = sub.id
-									SET
-										m.placement = sub.rn
-									WHERE m.voted AND m.battle_id = ?`)
+	}
+
+	err = app.Beats.SaveResults(results)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+
+	if battle.Status == StatusComplete {
+		err = app.RecordChampionships(battle)
 		if err != nil {
 			log.Println(err)
 			return AjaxResponse(c, true, "/", "502")
 		}
-		defer upd1.Close()
-		upd1.Exec(battleID, placement, beatID, battleID)
-
-		upd2, err := dbWrite.Prepare(`UPDATE
-										beats AS m
-									JOIN
-										( SELECT id, row_number() OVER (ORDER BY placement) AS rn 
-										FROM beats
-										WHERE beats.voted AND beats.battle_id = ? AND beats.placement > ?
-										) AS sub
-									ON m.id = sub.id
-									SET
-										m.placement = sub.rn + ?
-									WHERE m.voted AND m.battle_id = ?`)
-		if err != nil {
+		// The battle was already rated, so its new placements count once ratings are recomputed.
+		err = app.RateBattle(battle)
+		if err != nil && err != ErrRatingsStale {
 			log.Println(err)
 			return AjaxResponse(c, true, "/", "502")
 		}
-		defer upd2.Close()
-		upd2.Exec(battleID, placement, placement, battleID)
 	}
+
 	return AjaxResponse(c, false, redirectURL, "placement")
 }
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// VotingMode is how a battle's entries are ranked once voting closes.
+type VotingMode string
+
+// Voting modes. Approval and ranked voting limit each voter to the battle's max votes.
+const (
+	// VotingApproval gives every vote the same weight and ranks entries by their count.
+	VotingApproval VotingMode = "approval"
+	// VotingRanked has voters rank entries in order, counted by instant runoff.
+	VotingRanked VotingMode = "ranked"
+)
+
+// ParseVotingMode reads the voting mode from a battle form, defaulting to approval.
+func ParseVotingMode(mode string) VotingMode {
+	switch VotingMode(mode) {
+	case VotingRanked, VotingScore:
+		return VotingMode(mode)
+	}
+	return VotingApproval
+}
+
+// RoundCount is an entry's votes in one round of an instant-runoff count.
+type RoundCount struct {
+	Round      int
+	BeatID     int
+	Votes      int
+	Eliminated bool
+}
+
+// RoundView is a round of an instant-runoff count as the battle page shows it.
+type RoundView struct {
+	Round   int
+	Entries []RoundEntry
+}
+
+// RoundEntry is one entry's line in a RoundView.
+type RoundEntry struct {
+	Artist     User
+	Votes      int
+	Eliminated bool
+}
+
+// InstantRunoff counts ranked ballots between the candidates, given in submission order.
+// Each round every ballot counts for its highest ranked candidate still standing, and the
+// candidate with the fewest votes is eliminated until one is left. It returns the candidates
+// from winner to last along with every round's counts.
+//
+// Ties for fewest votes are broken by the earlier rounds, latest first, then against the later submission.
+func InstantRunoff(candidates []int, ballots [][]int) ([]int, []RoundCount) {
+	standing := map[int]bool{}
+	for _, beatID := range candidates {
+		standing[beatID] = true
+	}
+
+	history := map[int][]int{}
+	eliminated := []int{}
+	rounds := []RoundCount{}
+	for round := 1; len(standing) > 0; round++ {
+		counts := map[int]int{}
+		for _, ballot := range ballots {
+			for _, beatID := range ballot {
+				if standing[beatID] {
+					counts[beatID]++
+					break
+				}
+			}
+		}
+
+		loser := 0
+		for _, beatID := range candidates {
+			if !standing[beatID] {
+				continue
+			}
+			history[beatID] = append(history[beatID], counts[beatID])
+			if loser == 0 || compareHistory(history[beatID], history[loser]) <= 0 {
+				loser = beatID
+			}
+		}
+
+		// The last candidate standing wins, so a lone candidate only gets a round if it ran unopposed.
+		if len(standing) == 1 && len(candidates) > 1 {
+			eliminated = append(eliminated, loser)
+			break
+		}
+
+		for _, beatID := range candidates {
+			if standing[beatID] {
+				rounds = append(rounds, RoundCount{Round: round, BeatID: beatID, Votes: counts[beatID],
+					Eliminated: beatID == loser && len(standing) > 1})
+			}
+		}
+		delete(standing, loser)
+		eliminated = append(eliminated, loser)
+	}
+
+	// The first eliminated places last.
+	order := make([]int, len(eliminated))
+	for i, beatID := range eliminated {
+		order[len(eliminated)-1-i] = beatID
+	}
+
+	return order, rounds
+}
+
+// compareHistory compares two candidates' counts, most recent round first.
+func compareHistory(a []int, b []int) int {
+	for i := len(a) - 1; i >= 0; i-- {
+		if a[i] != b[i] {
+			return a[i] - b[i]
+		}
+	}
+	return 0
+}
+
+// rankedResults places a ranked battle's entries by instant runoff and saves the rounds.
+// Entries whose artist didn't qualify are left out of the count. The count settles its own ties.
+func (app *App) rankedResults(battle Battle, beats []Beat, qualified map[int]bool) ([]BeatResult, error) {
+	battleID := battle.ID
+	ballots, err := app.Votes.Ballots(battleID)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []int{}
+	for _, beat := range beats {
+		if qualified[beat.Artist.ID] {
+			candidates = append(candidates, beat.ID)
+		}
+	}
+
+	voters := []int{}
+	for userID := range ballots {
+		voters = append(voters, userID)
+	}
+	sort.Ints(voters)
+	ranked := [][]int{}
+	for _, userID := range voters {
+		ranked = append(ranked, ballots[userID])
+	}
+
+	order, rounds := InstantRunoff(candidates, ranked)
+	err = app.Results.SaveRounds(battleID, rounds)
+	if err != nil {
+		return nil, err
+	}
+
+	// An entry keeps the votes it had in the last round it was counted in.
+	votes := map[int]int{}
+	for _, count := range rounds {
+		votes[count.BeatID] = count.Votes
+	}
+	scores := map[int]float64{}
+	for i, beatID := range order {
+		scores[beatID] = float64(len(order) - i)
+	}
+
+	results := []BeatResult{}
+	for _, beat := range beats {
+		results = append(results, BeatResult{
+			BeatID: beat.ID,
+			Votes:  votes[beat.ID],
+			Voted:  qualified[beat.Artist.ID],
+		})
+	}
+
+	return app.placeResults(battle, beats, results, scores)
+}
+
+// BattleRounds returns a ranked battle's instant-runoff rounds with each entry's artist.
+func (app *App) BattleRounds(battleID int, beats []Beat) []RoundView {
+	counts, err := app.Results.Rounds(battleID)
+	if err != nil {
+		log.Println(err)
+		return nil
+	}
+
+	artists := map[int]User{}
+	for _, beat := range beats {
+		artists[beat.ID] = beat.Artist
+	}
+
+	rounds := []RoundView{}
+	for _, count := range counts {
+		if len(rounds) == 0 || rounds[len(rounds)-1].Round != count.Round {
+			rounds = append(rounds, RoundView{Round: count.Round})
+		}
+		round := &rounds[len(rounds)-1]
+		round.Entries = append(round.Entries, RoundEntry{
+			Artist:     artists[count.BeatID],
+			Votes:      count.Votes,
+			Eliminated: count.Eliminated,
+		})
+	}
+
+	return rounds
+}
+
+// SaveBallot replaces the logged in user's ranked ballot for a battle.
+// The ballot is posted as comma separated beat IDs, first choice first.
+func (app *App) SaveBallot(c echo.Context) error {
+	start := time.Now()
+
+	// Set the request to close automatically.
+	c.Request().Header.Set("Connection", "close")
+	c.Request().Close = true
+
+	// Get user, return if not auth.
+	me := app.GetUser(c, true)
+	if !me.Authenticated {
+		return AjaxResponse(c, true, "/login/", "noauth")
+	}
+
+	battleID, err := strconv.Atoi(c.FormValue("battleID"))
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, "/", "404")
+	}
+
+	redirectURL := "/battle/" + strconv.Itoa(battleID) + "/"
+
+	battle, err := app.Battles.Get(battleID)
+	if err != nil && err != ErrNotFound {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+
+	// Reject if not currently in voting stage or if battle is invalid.
+	if err == ErrNotFound || battle.Status != StatusVoting || time.Until(battle.VotingDeadline) < 0 {
+		return AjaxResponse(c, true, redirectURL, "notvoting")
+	}
+	if battle.VotingMode != VotingRanked {
+		return AjaxResponse(c, false, redirectURL, "notranked")
+	}
+
+	allowed, err := app.mayVote(battle, me.ID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	if !allowed {
+		return AjaxResponse(c, false, redirectURL, "entrantsonly")
+	}
+
+	beats, err := app.Beats.ListByBattle(battleID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	credits, err := app.teamCredits(battleID)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, true, "/", "502")
+	}
+	artists := map[int]int{}
+	for _, beat := range beats {
+		artists[beat.ID] = beat.Artist.ID
+	}
+
+	ballot := []int{}
+	for _, value := range strings.Split(c.FormValue("beats"), ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+
+		beatID, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return AjaxResponse(c, false, redirectURL, "404")
+		}
+
+		artistID, ok := artists[beatID]
+		if !ok || ContainsInt(ballot, beatID) {
+			return AjaxResponse(c, false, redirectURL, "404")
+		}
+		if artistID == me.ID || credits[beatID][me.ID] {
+			return AjaxResponse(c, false, redirectURL, "owntrack")
+		}
+		ballot = append(ballot, beatID)
+	}
+
+	if len(ballot) > battle.MaxVotes {
+		return AjaxResponse(c, false, redirectURL, "maxvotes")
+	}
+
+	err = app.Votes.SaveBallot(battleID, me.ID, ballot)
+	if err != nil {
+		log.Println(err)
+		return AjaxResponse(c, false, redirectURL, "502")
+	}
+
+	duration := time.Since(start)
+	fmt.Println("SaveBallot time: " + duration.String())
+
+	return AjaxResponse(c, false, redirectURL, "successballot")
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInstantRunoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		candidates []int
+		ballots    [][]int
+		order      []int
+		// eliminated is who each round knocked out.
+		eliminated []int
+	}{
+		{
+			name:       "no candidates",
+			candidates: []int{},
+			ballots:    [][]int{},
+			order:      []int{},
+			eliminated: nil,
+		},
+		{
+			name:       "unopposed",
+			candidates: []int{7},
+			ballots:    [][]int{{7}},
+			order:      []int{7},
+			eliminated: nil,
+		},
+		{
+			name:       "leader holds on",
+			candidates: []int{1, 2, 3},
+			ballots:    [][]int{{1, 2}, {1, 3}, {1}, {2, 1}, {3, 2}},
+			order:      []int{1, 2, 3},
+			eliminated: []int{3, 2},
+		},
+		{
+			name:       "transfers overturn the first round",
+			candidates: []int{1, 2, 3},
+			ballots:    [][]int{{1}, {1}, {2, 3}, {3, 2}, {3, 2}},
+			order:      []int{3, 1, 2},
+			eliminated: []int{2, 1},
+		},
+		{
+			// Once every entry on a ballot is out it stops counting, leaving 1 and 3 tied.
+			// The tie goes against the later submission.
+			name:       "exhausted ballots",
+			candidates: []int{1, 2, 3},
+			ballots:    [][]int{{1, 2}, {1}, {2}, {3}, {3}},
+			order:      []int{1, 3, 2},
+			eliminated: []int{2, 3},
+		},
+		{
+			// Everyone has 3 votes in round 2, so the earlier round knocks 2 out rather than the latest entry.
+			name:       "ties broken by earlier rounds",
+			candidates: []int{1, 2, 3, 4},
+			ballots:    [][]int{{1}, {1}, {1}, {2}, {2}, {3}, {3}, {3}, {4, 2}},
+			order:      []int{1, 3, 2, 4},
+			eliminated: []int{4, 2, 3},
+		},
+		{
+			name:       "no ballots",
+			candidates: []int{1, 2},
+			ballots:    [][]int{},
+			order:      []int{1, 2},
+			eliminated: []int{2},
+		},
+	}
+	for _, test := range tests {
+		order, rounds := InstantRunoff(test.candidates, test.ballots)
+		if !reflect.DeepEqual(order, test.order) {
+			t.Errorf("%s: order = %v, want %v", test.name, order, test.order)
+		}
+		var eliminated []int
+		for _, count := range rounds {
+			if count.Eliminated {
+				eliminated = append(eliminated, count.BeatID)
+			}
+		}
+		if !reflect.DeepEqual(eliminated, test.eliminated) {
+			t.Errorf("%s: eliminated %v, want %v", test.name, eliminated, test.eliminated)
+		}
+	}
+}
+
+func TestInstantRunoffRounds(t *testing.T) {
+	_, rounds := InstantRunoff([]int{1, 2, 3}, [][]int{{1, 2}, {1, 3}, {1}, {2, 1}, {3, 2}})
+	want := []RoundCount{
+		{Round: 1, BeatID: 1, Votes: 3},
+		{Round: 1, BeatID: 2, Votes: 1},
+		{Round: 1, BeatID: 3, Votes: 1, Eliminated: true},
+		{Round: 2, BeatID: 1, Votes: 3},
+		{Round: 2, BeatID: 2, Votes: 2, Eliminated: true},
+	}
+	if !reflect.DeepEqual(rounds, want) {
+		t.Errorf("rounds = %+v, want %+v", rounds, want)
+	}
+}